@@ -0,0 +1,235 @@
+// Package token issues and verifies the JWTs used for authentication.
+//
+// Tokens are signed with the active key and carry its ID in the "kid" header.
+// Retired keys can stay configured for verification only, so keys can be
+// rotated without logging everyone out. HS256 uses shared secrets; RS256 and
+// EdDSA use key pairs whose public halves are published as a JWKS.
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"health-store/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, expired or not signed by a known key
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnknownKey is returned for tokens whose kid is not configured
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// PurposeMFAPending marks a token that only proves the password step of a
+// two-step login. It can be exchanged for access tokens with a second factor
+// and must not be accepted as an access token.
+const PurposeMFAPending = "mfa_pending"
+
+// Claims are the claims carried by an access token
+type Claims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Purpose  string `json:"purpose,omitempty"` // empty for access tokens
+	MFA      bool   `json:"mfa,omitempty"`     // the user passed a second factor
+	jwt.RegisteredClaims
+}
+
+// key is a signing or verification key
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{} // nil for verification-only keys
+	verifyKey interface{}
+}
+
+// Manager signs and verifies tokens
+type Manager struct {
+	active *key
+	keys   map[string]*key
+}
+
+// NewManager builds a manager from the JWT configuration
+func NewManager(cfg config.JWTConfig) (*Manager, error) {
+	method := jwt.GetSigningMethod(cfg.SigningMethod)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported JWT signing method: %s", cfg.SigningMethod)
+	}
+	if cfg.KeyID == "" {
+		return nil, errors.New("JWT key ID is required")
+	}
+
+	active, err := loadSigningKey(cfg, method)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		active: active,
+		keys:   map[string]*key{active.id: active},
+	}
+
+	for kid, value := range cfg.VerificationKeys {
+		if _, exists := m.keys[kid]; exists {
+			return nil, fmt.Errorf("duplicate JWT key ID: %s", kid)
+		}
+		verifyKey, err := loadVerificationKey(method, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT verification key %s: %v", kid, err)
+		}
+		m.keys[kid] = &key{id: kid, method: method, verifyKey: verifyKey}
+	}
+
+	return m, nil
+}
+
+// Sign signs claims with the active key
+func (m *Manager) Sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, claims)
+	token.Header["kid"] = m.active.id
+	return token.SignedString(m.active.signKey)
+}
+
+// Parse verifies a token and returns its claims. Tokens without a kid header
+// (issued before key IDs were introduced) are checked against the active key.
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		k := m.active
+		if kid, ok := t.Header["kid"].(string); ok {
+			if k, ok = m.keys[kid]; !ok {
+				return nil, ErrUnknownKey
+			}
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+		return k.verifyKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that can verify tokens. It is empty for
+// HS256, whose secrets must never be published.
+func (m *Manager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range m.keys {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// loadSigningKey loads the active key: the secret for HS256, or the private
+// key file for RS256 and EdDSA
+func loadSigningKey(cfg config.JWTConfig, method jwt.SigningMethod) (*key, error) {
+	k := &key{id: cfg.KeyID, method: method}
+
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if cfg.SecretKey == "" {
+			return nil, errors.New("JWT secret key is required for " + method.Alg())
+		}
+		k.signKey = []byte(cfg.SecretKey)
+		k.verifyKey = k.signKey
+	case *jwt.SigningMethodRSA:
+		pem, err := readKeyFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %v", err)
+		}
+		k.signKey = private
+		k.verifyKey = &private.PublicKey
+	case *jwt.SigningMethodEd25519:
+		pem, err := readKeyFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Ed25519 private key: %v", err)
+		}
+		k.signKey = private
+		k.verifyKey = private.(ed25519.PrivateKey).Public()
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method: %s", method.Alg())
+	}
+
+	return k, nil
+}
+
+// loadVerificationKey loads a retired key: a secret for HS256, or the path
+// of a public key file for RS256 and EdDSA
+func loadVerificationKey(method jwt.SigningMethod, value string) (interface{}, error) {
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return []byte(value), nil
+	case *jwt.SigningMethodRSA:
+		pem, err := readKeyFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseRSAPublicKeyFromPEM(pem)
+	case *jwt.SigningMethodEd25519:
+		pem, err := readKeyFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseEdPublicKeyFromPEM(pem)
+	}
+	return nil, fmt.Errorf("unsupported JWT signing method: %s", method.Alg())
+}
+
+// readKeyFile reads a PEM key file
+func readKeyFile(path string) ([]byte, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("JWT key file is required for asymmetric signing")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key file: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,328 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"health-store/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret-of-at-least-32-characters"
+
+// writeRSAKey writes a new RSA key pair as PEM files and returns the private
+// key with the paths of both files
+func writeRSAKey(t *testing.T, name string) (*rsa.PrivateKey, string, string) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	dir := t.TempDir()
+	privatePath := writePEM(t, filepath.Join(dir, name+".pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private))
+	publicPath := writePEM(t, filepath.Join(dir, name+".pub.pem"), "PUBLIC KEY", public)
+	return private, privatePath, publicPath
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	return path
+}
+
+func newTestManager(t *testing.T, cfg config.JWTConfig) *Manager {
+	t.Helper()
+	m, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func testClaims(expiresIn time.Duration) *Claims {
+	return &Claims{
+		Username: "alice",
+		Role:     "customer",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "7",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
+
+// signWith signs claims with a key outside any manager, setting kid when it is not empty
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, signKey interface{}, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signKey)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestManagerParse(t *testing.T) {
+	_, activePath, activePublicPath := writeRSAKey(t, "active")
+	retired, _, retiredPublicPath := writeRSAKey(t, "retired")
+	rsaManager := newTestManager(t, config.JWTConfig{
+		SigningMethod:    "RS256",
+		KeyID:            "2024-06",
+		PrivateKeyFile:   activePath,
+		VerificationKeys: map[string]string{"2024-01": retiredPublicPath},
+	})
+	hmacManager := newTestManager(t, config.JWTConfig{
+		SigningMethod:    "HS256",
+		KeyID:            "current",
+		SecretKey:        testSecret,
+		VerificationKeys: map[string]string{"previous": "previous-secret-of-at-least-32-chars"},
+	})
+	activePublicPEM, err := os.ReadFile(activePublicPath)
+	if err != nil {
+		t.Fatalf("read public key: %v", err)
+	}
+
+	signActive := func(m *Manager, claims *Claims) string {
+		signed, err := m.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		manager *Manager
+		token   string
+		wantErr bool
+	}{
+		{name: "active RS256 key", manager: rsaManager, token: signActive(rsaManager, testClaims(time.Hour))},
+		{name: "active HS256 key", manager: hmacManager, token: signActive(hmacManager, testClaims(time.Hour))},
+		{name: "rotated RS256 key", manager: rsaManager, token: signWith(t, jwt.SigningMethodRS256, "2024-01", retired, testClaims(time.Hour))},
+		{name: "rotated HS256 secret", manager: hmacManager, token: signWith(t, jwt.SigningMethodHS256, "previous", []byte("previous-secret-of-at-least-32-chars"), testClaims(time.Hour))},
+		{name: "no kid uses the active key", manager: hmacManager, token: signWith(t, jwt.SigningMethodHS256, "", []byte(testSecret), testClaims(time.Hour))},
+		{name: "unknown kid", manager: hmacManager, token: signWith(t, jwt.SigningMethodHS256, "unknown", []byte(testSecret), testClaims(time.Hour)), wantErr: true},
+		{
+			// The public key is no secret, so an HS256 token keyed with it must not pass as RS256
+			name:    "HS256 token against an RS256 key",
+			manager: rsaManager,
+			token:   signWith(t, jwt.SigningMethodHS256, "2024-06", activePublicPEM, testClaims(time.Hour)),
+			wantErr: true,
+		},
+		{name: "rotated kid signed by another key", manager: rsaManager, token: signWith(t, jwt.SigningMethodRS256, "2024-01", mustRSAKey(t), testClaims(time.Hour)), wantErr: true},
+		{name: "wrong HS256 secret", manager: hmacManager, token: signWith(t, jwt.SigningMethodHS256, "current", []byte("another-secret-of-at-least-32-chars"), testClaims(time.Hour)), wantErr: true},
+		{name: "expired", manager: hmacManager, token: signActive(hmacManager, testClaims(-time.Minute)), wantErr: true},
+		{name: "malformed", manager: hmacManager, token: "not.a.token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.manager.Parse(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Parse error = %v, want %v", err, ErrInvalidToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if claims.Username != "alice" || claims.Role != "customer" || claims.Subject != "7" {
+				t.Errorf("claims = %+v, want alice, customer, subject 7", claims)
+			}
+		})
+	}
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return key
+}
+
+func TestManagerSignSetsKid(t *testing.T) {
+	m := newTestManager(t, config.JWTConfig{SigningMethod: "HS256", KeyID: "current", SecretKey: testSecret})
+	signed, err := m.Sign(testClaims(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if kid := token.Header["kid"]; kid != "current" {
+		t.Errorf("kid = %v, want current", kid)
+	}
+}
+
+func TestNewManagerRejectsInvalidConfig(t *testing.T) {
+	_, privatePath, publicPath := writeRSAKey(t, "key")
+
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+		want string
+	}{
+		{name: "unsupported method", cfg: config.JWTConfig{SigningMethod: "none", KeyID: "k", SecretKey: testSecret}, want: "unsupported JWT signing method"},
+		{name: "missing key ID", cfg: config.JWTConfig{SigningMethod: "HS256", SecretKey: testSecret}, want: "key ID is required"},
+		{name: "missing HS256 secret", cfg: config.JWTConfig{SigningMethod: "HS256", KeyID: "k"}, want: "secret key is required"},
+		{name: "missing RS256 key file", cfg: config.JWTConfig{SigningMethod: "RS256", KeyID: "k"}, want: "key file is required"},
+		{name: "public key as private key", cfg: config.JWTConfig{SigningMethod: "RS256", KeyID: "k", PrivateKeyFile: publicPath}, want: "failed to parse RSA private key"},
+		{
+			name: "verification key reusing the active kid",
+			cfg:  config.JWTConfig{SigningMethod: "RS256", KeyID: "k", PrivateKeyFile: privatePath, VerificationKeys: map[string]string{"k": publicPath}},
+			want: "duplicate JWT key ID",
+		},
+		{
+			name: "unreadable verification key",
+			cfg:  config.JWTConfig{SigningMethod: "RS256", KeyID: "k", PrivateKeyFile: privatePath, VerificationKeys: map[string]string{"old": filepath.Join(t.TempDir(), "missing.pem")}},
+			want: "failed to load JWT verification key old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewManager(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewManager error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerJWKS(t *testing.T) {
+	active, activePath, _ := writeRSAKey(t, "active")
+	retired, _, retiredPublicPath := writeRSAKey(t, "retired")
+	rsaManager := newTestManager(t, config.JWTConfig{
+		SigningMethod:    "RS256",
+		KeyID:            "2024-06",
+		PrivateKeyFile:   activePath,
+		VerificationKeys: map[string]string{"2024-01": retiredPublicPath},
+	})
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatalf("marshal Ed25519 key: %v", err)
+	}
+	edManager := newTestManager(t, config.JWTConfig{
+		SigningMethod:  "EdDSA",
+		KeyID:          "ed-1",
+		PrivateKeyFile: writePEM(t, filepath.Join(t.TempDir(), "ed.pem"), "PRIVATE KEY", der),
+	})
+
+	hmacManager := newTestManager(t, config.JWTConfig{SigningMethod: "HS256", KeyID: "current", SecretKey: testSecret})
+
+	t.Run("RS256 publishes the active and rotated keys", func(t *testing.T) {
+		keys := map[string]JWK{}
+		for _, jwk := range rsaManager.JWKS().Keys {
+			keys[jwk.Kid] = jwk
+		}
+		for kid, public := range map[string]*rsa.PublicKey{"2024-06": &active.PublicKey, "2024-01": &retired.PublicKey} {
+			jwk, ok := keys[kid]
+			if !ok {
+				t.Errorf("JWKS has no key %s", kid)
+				continue
+			}
+			if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" {
+				t.Errorf("key %s = %+v, want an RS256 signing key", kid, jwk)
+			}
+			if jwk.N != base64.RawURLEncoding.EncodeToString(public.N.Bytes()) ||
+				jwk.E != base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()) {
+				t.Errorf("key %s does not match its public key", kid)
+			}
+		}
+		if len(keys) != 2 {
+			t.Errorf("JWKS has %d keys, want 2", len(keys))
+		}
+	})
+
+	t.Run("EdDSA publishes an OKP key", func(t *testing.T) {
+		keys := edManager.JWKS().Keys
+		want := base64.RawURLEncoding.EncodeToString(edPrivate.Public().(ed25519.PublicKey))
+		if len(keys) != 1 || keys[0].Kty != "OKP" || keys[0].Crv != "Ed25519" || keys[0].X != want || keys[0].Kid != "ed-1" {
+			t.Errorf("JWKS = %+v, want the Ed25519 public key", keys)
+		}
+	})
+
+	t.Run("HS256 publishes nothing", func(t *testing.T) {
+		if keys := hmacManager.JWKS().Keys; keys == nil || len(keys) != 0 {
+			t.Errorf("JWKS = %+v, want an empty key list", keys)
+		}
+	})
+}
+
+// The secrets tokens are signed with are checked when the configuration is
+// validated, before a manager is built
+func TestConfigRejectsDefaultSecretInProduction(t *testing.T) {
+	production := func(jwtConfig config.JWTConfig) *config.Config {
+		return &config.Config{
+			Server:    config.ServerConfig{Env: "production"},
+			JWT:       jwtConfig,
+			Market:    config.MarketplaceConfig{MaxPendingShopRequests: 1},
+			Inventory: config.InventoryConfig{SalesWindow: 24 * time.Hour},
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want string
+	}{
+		{
+			name: "default JWT secret",
+			cfg:  production(config.JWTConfig{SigningMethod: "HS256", SecretKey: config.DefaultJWTSecret, RefreshSecret: "refresh"}),
+			want: "JWT_SECRET_KEY",
+		},
+		{
+			name: "short JWT secret",
+			cfg:  production(config.JWTConfig{SigningMethod: "HS256", SecretKey: "short", RefreshSecret: "refresh"}),
+			want: "JWT_SECRET_KEY",
+		},
+		{
+			name: "default refresh secret",
+			cfg:  production(config.JWTConfig{SigningMethod: "HS256", SecretKey: testSecret, RefreshSecret: config.DefaultRefreshSecret}),
+			want: "JWT_REFRESH_SECRET",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want one about %s", err, tt.want)
+			}
+		})
+	}
+
+	// Outside production the defaults are accepted
+	development := production(config.JWTConfig{SigningMethod: "HS256", SecretKey: config.DefaultJWTSecret, RefreshSecret: config.DefaultRefreshSecret})
+	development.Server.Env = "development"
+	if err := development.Validate(); err != nil {
+		t.Errorf("Validate in development: %v", err)
+	}
+}
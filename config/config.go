@@ -1,19 +1,27 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Payment  PaymentConfig
-	Storage  StorageConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Payment   PaymentConfig
+	Cart      CartConfig
+	Account   AccountConfig
+	Security  SecurityConfig
+	Mail      MailConfig
+	Storage   StorageConfig
+	Market    MarketplaceConfig
+	Inventory InventoryConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -36,17 +44,81 @@ type DatabaseConfig struct {
 
 // JWTConfig holds JWT-related configuration
 type JWTConfig struct {
-	SecretKey     string
-	Expiration    time.Duration
-	RefreshSecret string
+	SigningMethod     string // HS256, RS256 or EdDSA
+	KeyID             string // kid of the active signing key
+	SecretKey         string // HS256 signing secret
+	PrivateKeyFile    string // PEM private key for RS256 or EdDSA
+	VerificationKeys  map[string]string
+	Expiration        time.Duration // access token lifetime
+	RefreshSecret     string
+	RefreshExpiration time.Duration
+	CleanupInterval   time.Duration
 }
 
+// Default secrets, only acceptable outside production
+const (
+	DefaultJWTSecret     = "your-super-secret-jwt-key-change-this-in-production-2024"
+	DefaultRefreshSecret = "your-refresh-secret-key"
+	DefaultMFASecret     = "your-mfa-secret-encryption-key"
+	// DefaultFakeWebhookSecret signs webhooks of the fake payment provider
+	DefaultFakeWebhookSecret = "fake-webhook-secret"
+)
+
 // PaymentConfig holds payment-related configuration
 type PaymentConfig struct {
+	Provider             string // fake, stripe or paypal
+	Currency             string
+	Timeout              time.Duration
 	StripeSecretKey      string
 	StripePublishableKey string
+	StripeBaseURL        string
+	StripeWebhookSecret  string
 	PayPalClientID       string
 	PayPalSecret         string
+	PayPalBaseURL        string
+	PayPalWebhookID      string
+	FakeWebhookSecret    string
+}
+
+// CartConfig holds cart reservation configuration
+type CartConfig struct {
+	ReservationTTL           time.Duration
+	ReservationSweepInterval time.Duration
+	GuestTokenTTL            time.Duration
+}
+
+// AccountConfig holds account recovery and verification configuration
+type AccountConfig struct {
+	AppBaseURL               string // frontend URL used in email links
+	PasswordResetTTL         time.Duration
+	EmailVerificationTTL     time.Duration
+	RequireEmailVerification bool
+}
+
+// SecurityConfig holds login throttling, MFA and role configuration
+type SecurityConfig struct {
+	LoginMaxAccountFailures int           // failures before an account is locked
+	LoginMaxIPFailures      int           // failures before a client address is locked
+	LoginFailureWindow      time.Duration // failures older than this are forgotten
+	LoginLockoutDuration    time.Duration
+	LoginBackoffBase        time.Duration // delay after the first failure, doubled after each further one
+	LoginBackoffMax         time.Duration
+	MFAIssuer               string        // issuer shown in authenticator apps
+	MFASecretKey            string        // encrypts stored TOTP secrets
+	MFAPendingTTL           time.Duration // how long the second login step may take
+	RequireAdminMFA         bool          // keep admins out of admin routes until they pass MFA
+	RoleCacheTTL            time.Duration // how long role permissions are cached
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver       string // smtp or log
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	LogFile      string // log driver only; empty writes to the application log
 }
 
 // StorageConfig holds file storage configuration
@@ -55,6 +127,24 @@ type StorageConfig struct {
 	UploadPath    string
 }
 
+// MarketplaceConfig holds seller onboarding, commission and payout configuration
+type MarketplaceConfig struct {
+	CommissionRate         float64       // default commission on shop sales, as a fraction
+	PayoutInterval         time.Duration // how often payout batches are created
+	MinPayout              float64       // balances below this are carried over to the next batch
+	MaxPendingShopRequests int           // shop requests a user may have waiting for review at once
+}
+
+// InventoryConfig holds stock ledger and low-stock alert configuration
+type InventoryConfig struct {
+	ReconcileInterval time.Duration // how often stock is reconciled with the stock ledger
+	LowStockInterval  time.Duration // how often stock levels are checked for low-stock alerts
+	SalesWindow       time.Duration // trailing window sales velocity is computed over
+	LowStockCoverDays int           // products with fewer days of cover than this raise an alert
+	ReorderCoverDays  int           // days of cover suggested reorders restock to
+	AlertEmails       []string      // addresses low-stock alerts are emailed to, logged when empty
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	readTimeout := getEnvAsDuration("SERVER_READ_TIMEOUT", 10*time.Second)
@@ -76,20 +166,81 @@ func LoadConfig() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			SecretKey:     getEnv("JWT_SECRET_KEY", "your-super-secret-jwt-key-change-this-in-production-2024"),
-			Expiration:    getEnvAsDuration("JWT_EXPIRATION", 24*time.Hour),
-			RefreshSecret: getEnv("JWT_REFRESH_SECRET", "your-refresh-secret-key"),
+			SigningMethod:     getEnv("JWT_SIGNING_METHOD", "HS256"),
+			KeyID:             getEnv("JWT_KEY_ID", "primary"),
+			SecretKey:         getEnv("JWT_SECRET_KEY", DefaultJWTSecret),
+			PrivateKeyFile:    getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			VerificationKeys:  getEnvAsMap("JWT_VERIFICATION_KEYS"),
+			Expiration:        getEnvAsDuration("JWT_EXPIRATION", 15*time.Minute),
+			RefreshSecret:     getEnv("JWT_REFRESH_SECRET", DefaultRefreshSecret),
+			RefreshExpiration: getEnvAsDuration("JWT_REFRESH_EXPIRATION", 7*24*time.Hour),
+			CleanupInterval:   getEnvAsDuration("JWT_CLEANUP_INTERVAL", time.Hour),
 		},
 		Payment: PaymentConfig{
+			Provider:             getEnv("PAYMENT_PROVIDER", "fake"),
+			Currency:             getEnv("PAYMENT_CURRENCY", "USD"),
+			Timeout:              getEnvAsDuration("PAYMENT_TIMEOUT", 15*time.Second),
 			StripeSecretKey:      getEnv("STRIPE_SECRET_KEY", ""),
 			StripePublishableKey: getEnv("STRIPE_PUBLISHABLE_KEY", ""),
+			StripeBaseURL:        getEnv("STRIPE_BASE_URL", ""),
+			StripeWebhookSecret:  getEnv("STRIPE_WEBHOOK_SECRET", ""),
 			PayPalClientID:       getEnv("PAYPAL_CLIENT_ID", ""),
 			PayPalSecret:         getEnv("PAYPAL_SECRET", ""),
+			PayPalBaseURL:        getEnv("PAYPAL_BASE_URL", ""),
+			PayPalWebhookID:      getEnv("PAYPAL_WEBHOOK_ID", ""),
+			FakeWebhookSecret:    getEnv("FAKE_PAYMENT_WEBHOOK_SECRET", DefaultFakeWebhookSecret),
+		},
+		Cart: CartConfig{
+			ReservationTTL:           getEnvAsDuration("CART_RESERVATION_TTL", 30*time.Minute),
+			ReservationSweepInterval: getEnvAsDuration("CART_RESERVATION_SWEEP_INTERVAL", time.Minute),
+			GuestTokenTTL:            getEnvAsDuration("CART_GUEST_TOKEN_TTL", 30*24*time.Hour),
+		},
+		Account: AccountConfig{
+			AppBaseURL:               getEnv("APP_BASE_URL", "http://localhost:5173"),
+			PasswordResetTTL:         getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+			EmailVerificationTTL:     getEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+			RequireEmailVerification: getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+		},
+		Security: SecurityConfig{
+			LoginMaxAccountFailures: getEnvAsInt("SECURITY_LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			LoginMaxIPFailures:      getEnvAsInt("SECURITY_LOGIN_MAX_IP_FAILURES", 20),
+			LoginFailureWindow:      getEnvAsDuration("SECURITY_LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			LoginLockoutDuration:    getEnvAsDuration("SECURITY_LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			LoginBackoffBase:        getEnvAsDuration("SECURITY_LOGIN_BACKOFF_BASE", time.Second),
+			LoginBackoffMax:         getEnvAsDuration("SECURITY_LOGIN_BACKOFF_MAX", time.Minute),
+			MFAIssuer:               getEnv("SECURITY_MFA_ISSUER", "Health Store"),
+			MFASecretKey:            getEnv("SECURITY_MFA_SECRET_KEY", DefaultMFASecret),
+			MFAPendingTTL:           getEnvAsDuration("SECURITY_MFA_PENDING_TTL", 5*time.Minute),
+			RequireAdminMFA:         getEnvAsBool("SECURITY_REQUIRE_ADMIN_MFA", false),
+			RoleCacheTTL:            getEnvAsDuration("SECURITY_ROLE_CACHE_TTL", time.Minute),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Health Store <no-reply@healthstore.local>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			LogFile:      getEnv("MAIL_LOG_FILE", ""),
 		},
 		Storage: StorageConfig{
 			CloudinaryURL: getEnv("CLOUDINARY_URL", ""),
 			UploadPath:    getEnv("UPLOAD_PATH", "./uploads"),
 		},
+		Market: MarketplaceConfig{
+			CommissionRate:         getEnvAsFloat("MARKETPLACE_COMMISSION_RATE", 0.10),
+			PayoutInterval:         getEnvAsDuration("MARKETPLACE_PAYOUT_INTERVAL", 7*24*time.Hour),
+			MinPayout:              getEnvAsFloat("MARKETPLACE_MIN_PAYOUT", 10),
+			MaxPendingShopRequests: getEnvAsInt("MARKETPLACE_MAX_PENDING_SHOP_REQUESTS", 1),
+		},
+		Inventory: InventoryConfig{
+			ReconcileInterval: getEnvAsDuration("INVENTORY_RECONCILE_INTERVAL", 24*time.Hour),
+			LowStockInterval:  getEnvAsDuration("INVENTORY_LOW_STOCK_INTERVAL", time.Hour),
+			SalesWindow:       getEnvAsDuration("INVENTORY_SALES_WINDOW", 30*24*time.Hour),
+			LowStockCoverDays: getEnvAsInt("INVENTORY_LOW_STOCK_COVER_DAYS", 14),
+			ReorderCoverDays:  getEnvAsInt("INVENTORY_REORDER_COVER_DAYS", 30),
+			AlertEmails:       getEnvAsList("INVENTORY_ALERT_EMAILS"),
+		},
 	}
 }
 
@@ -112,6 +263,17 @@ func getEnvAsInt(key string, fallback int) int {
 	return fallback
 }
 
+// getEnvAsFloat gets an environment variable as float with a fallback value
+func getEnvAsFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+		log.Printf("Warning: Invalid float value for %s: %s, using fallback: %g", key, value, fallback)
+	}
+	return fallback
+}
+
 // getEnvAsDuration gets an environment variable as duration with a fallback value
 func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -134,6 +296,82 @@ func getEnvAsBool(key string, fallback bool) bool {
 	return fallback
 }
 
+// getEnvAsMap gets an environment variable holding comma-separated key=value pairs
+func getEnvAsMap(key string) map[string]string {
+	result := map[string]string{}
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || k == "" || v == "" {
+			log.Printf("Warning: Invalid key=value pair in %s: %q, ignoring", key, pair)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// getEnvAsList gets an environment variable holding comma-separated values
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Validate rejects invalid settings and settings that must not be left at
+// their defaults in production
+func (c *Config) Validate() error {
+	if c.Market.CommissionRate < 0 || c.Market.CommissionRate > 1 {
+		return errors.New("MARKETPLACE_COMMISSION_RATE must be between 0 and 1")
+	}
+	if c.Market.MaxPendingShopRequests < 1 {
+		return errors.New("MARKETPLACE_MAX_PENDING_SHOP_REQUESTS must be at least 1")
+	}
+	if c.Inventory.SalesWindow < 24*time.Hour {
+		return errors.New("INVENTORY_SALES_WINDOW must be at least 24h")
+	}
+	if c.Inventory.LowStockCoverDays < 0 || c.Inventory.ReorderCoverDays < c.Inventory.LowStockCoverDays {
+		return errors.New("INVENTORY_REORDER_COVER_DAYS must be at least INVENTORY_LOW_STOCK_COVER_DAYS, which must not be negative")
+	}
+
+	if !c.IsProduction() {
+		return nil
+	}
+
+	if c.JWT.SigningMethod == "HS256" && (c.JWT.SecretKey == DefaultJWTSecret || len(c.JWT.SecretKey) < 32) {
+		return errors.New("JWT_SECRET_KEY must be set to a secret of at least 32 characters in production")
+	}
+	if c.JWT.RefreshSecret == DefaultRefreshSecret {
+		return errors.New("JWT_REFRESH_SECRET must be set in production")
+	}
+	if c.Security.MFASecretKey == DefaultMFASecret {
+		return errors.New("SECURITY_MFA_SECRET_KEY must be set in production")
+	}
+
+	// The fake provider approves every payment, and its webhooks can be forged
+	switch c.Payment.Provider {
+	case "", "fake":
+		return errors.New("PAYMENT_PROVIDER must be stripe or paypal in production")
+	case "stripe":
+		if c.Payment.StripeWebhookSecret == "" {
+			return errors.New("STRIPE_WEBHOOK_SECRET must be set in production")
+		}
+	case "paypal":
+		if c.Payment.PayPalWebhookID == "" {
+			return errors.New("PAYPAL_WEBHOOK_ID must be set in production")
+		}
+	}
+	return nil
+}
+
 // IsDevelopment returns true if the environment is development
 func (c *Config) IsDevelopment() bool {
 	return c.Server.Env == "development"
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"health-store/models"
 	"health-store/service"
 
 	"github.com/gin-gonic/gin"
@@ -12,12 +13,17 @@ import (
 // Users
 func GetUsers(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		users, err := userService.GetAllUsers()
+		params, ok := bindListParams(c, models.UserListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := userService.ListUsers(params)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+			respondListError(c, err, "Failed to retrieve users")
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		respondPage(c, page)
 	}
 }
 
@@ -39,7 +45,7 @@ func GetUser(userService *service.UserService) gin.HandlerFunc {
 	}
 }
 
-func UpdateUser(userService *service.UserService) gin.HandlerFunc {
+func UpdateUser(userService *service.UserService, roleService *service.RoleService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		userID, err := strconv.Atoi(id)
@@ -85,6 +91,16 @@ func UpdateUser(userService *service.UserService) gin.HandlerFunc {
 			existingUser.ContactNumber = contactNumber
 		}
 		if role, ok := updateData["role"].(string); ok {
+			// Users can be given any role except the one for anonymous visitors
+			exists, err := roleService.RoleExists(role)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+				return
+			}
+			if !exists || role == models.RoleGuest {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + role})
+				return
+			}
 			existingUser.Role = role
 		}
 
@@ -114,3 +130,28 @@ func DeleteUser(userService *service.UserService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 	}
 }
+
+// UnlockUser clears the failed logins and lockout of a user's account
+func UnlockUser(userService *service.UserService, loginGuard *service.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		userID, err := strconv.Atoi(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if _, err := userService.GetUserByID(uint(userID)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		actorID := c.MustGet("userID").(uint)
+		user, err := loginGuard.UnlockUser(uint(userID), actorID, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully", "user_id": user.ID})
+	}
+}
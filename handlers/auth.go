@@ -1,36 +1,21 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
+	"health-store/auth/token"
 	"health-store/models"
 	"health-store/service"
+	"health-store/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(getJWTSecret())
-
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET_KEY")
-	if secret == "" {
-		// default secret
-		secret = "your-super-secret-jwt-key-change-this-in-production-2024"
-	}
-	return secret
-}
-
-type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func Register(userService *service.UserService) gin.HandlerFunc {
+func Register(userService *service.UserService, accountService *service.AccountService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.UserRegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -51,11 +36,17 @@ func Register(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully", "user_id": user.ID})
+		// The account is usable even if the verification email could not be sent;
+		// the user can ask for a new one
+		if err := accountService.SendVerificationEmail(user); err != nil {
+			utils.LogError(err, "Failed to send verification email")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully, please check your email to verify your address", "user_id": user.ID})
 	}
 }
 
-func Login(userService *service.UserService) gin.HandlerFunc {
+func Login(userService *service.UserService, authService *service.AuthService, accountService *service.AccountService, cartService *service.CartService, loginGuard *service.LoginGuard, mfaService *service.MFAService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.UserLoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -69,36 +60,311 @@ func Login(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
+		// Refuse attempts while the account or client address is throttled
+		if !checkLoginThrottle(c, loginGuard, req.Username) {
+			return
+		}
+
 		// Authenticate user through service
 		user, err := userService.AuthenticateUser(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidCredentials) {
+				if err := loginGuard.RecordFailure(req.Username, c.ClientIP(), c.Request.UserAgent()); err != nil {
+					utils.LogError(err, "Failed to record failed login")
+				}
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrInvalidCredentials.Error()})
+			return
+		}
+
+		if err := accountService.CheckLoginAllowed(user); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Users with MFA get a short-lived token to finish the login with a code
+		if user.MFAEnabled {
+			mfaToken, expiresIn, err := mfaService.IssuePendingToken(user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaToken,
+				"expires_in":   expiresIn,
+			})
+			return
+		}
+
+		// Failures are only cleared once the whole login succeeded, so knowing
+		// the password does not reset the throttling of code guesses
+		if err := loginGuard.RecordSuccess(user.Username); err != nil {
+			utils.LogError(err, "Failed to clear failed logins")
+		}
+
+		startSession(c, user, false, authService, cartService)
+	}
+}
+
+// LoginMFA finishes a two-step login with a TOTP or recovery code
+func LoginMFA(authService *service.AuthService, cartService *service.CartService, mfaService *service.MFAService, loginGuard *service.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MFALoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		user, err := mfaService.PendingUser(req.MFAToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
-		expirationTime := time.Now().Add(24 * time.Hour) // Extended to 24
-		claims := &Claims{
-			Username: req.Username,
-			Role:     user.Role,
-			RegisteredClaims: jwt.RegisteredClaims{
-				ExpiresAt: jwt.NewNumericDate(expirationTime),
-				IssuedAt:  jwt.NewNumericDate(time.Now()),
-				Subject:   fmt.Sprintf("%d", user.ID),
-			},
+		// Wrong codes count as failed logins, so guessing codes is throttled too
+		if !checkLoginThrottle(c, loginGuard, user.Username) {
+			return
+		}
+
+		if err := mfaService.VerifyCode(user, req.Code); err != nil {
+			if errors.Is(err, service.ErrInvalidMFACode) {
+				if err := loginGuard.RecordFailure(user.Username, c.ClientIP(), c.Request.UserAgent()); err != nil {
+					utils.LogError(err, "Failed to record failed login")
+				}
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString(jwtKey)
+		if err := loginGuard.RecordSuccess(user.Username); err != nil {
+			utils.LogError(err, "Failed to clear failed logins")
+		}
+
+		startSession(c, user, true, authService, cartService)
+	}
+}
+
+// checkLoginThrottle responds with 429 and returns false while logins for
+// username or from the client address are throttled
+func checkLoginThrottle(c *gin.Context, loginGuard *service.LoginGuard, username string) bool {
+	err := loginGuard.Check(username, c.ClientIP())
+	if err == nil {
+		return true
+	}
+
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error()})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+	return false
+}
+
+// startSession issues tokens to a user who completed login and merges their guest cart
+func startSession(c *gin.Context, user *models.User, mfaVerified bool, authService *service.AuthService, cartService *service.CartService) {
+	tokens, err := authService.IssueTokens(user, mfaVerified, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response := gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user": gin.H{
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"role":           user.Role,
+			"email_verified": user.EmailVerified,
+			"mfa_enabled":    user.MFAEnabled,
+		},
+	}
+
+	// Merge the cart built before logging in into the user's cart. A failed
+	// merge leaves the guest cart in place and does not fail the login.
+	if guestToken := guestCartToken(c); guestToken != "" {
+		merge, err := cartService.MergeGuestCart(guestToken, user.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			utils.LogError(err, "Failed to merge guest cart")
+		} else {
+			response["cart_merge"] = merge
+			c.SetCookie(cartTokenCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func RefreshToken(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"token": tokenString, "user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
-		}})
+		tokens, err := authService.Refresh(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func Logout(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var req models.LogoutRequest
+		// The body is optional
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+				return
+			}
+		}
+
+		jti := c.GetString("tokenID")
+		expiresAt, _ := c.Get("tokenExpiresAt")
+		expiry, _ := expiresAt.(time.Time)
+
+		err := authService.Logout(userID, jti, expiry, req.RefreshToken)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRefreshToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+// JWKS publishes the public keys that verify access tokens
+func JWKS(tokenManager *token.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, tokenManager.JWKS())
+	}
+}
+
+func ForgotPassword(accountService *service.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		// Always answer the same way so the endpoint does not reveal which emails exist
+		if err := accountService.RequestPasswordReset(req.Email); err != nil {
+			utils.LogError(err, "Failed to send password reset email")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, a password reset link has been sent"})
+	}
+}
+
+func ResetPassword(accountService *service.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		if err := accountService.ResetPassword(req.Token, req.Password); err != nil {
+			if errors.Is(err, service.ErrInvalidUserToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in with your new password"})
+	}
+}
+
+func VerifyEmail(accountService *service.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		user, err := accountService.VerifyEmail(req.Token)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidUserToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully", "user_id": user.ID})
+	}
+}
+
+func ResendVerification(accountService *service.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ResendVerificationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		if err := accountService.ResendVerificationEmail(req.Email); err != nil {
+			utils.LogError(err, "Failed to resend verification email")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is not verified yet, a new verification link has been sent"})
 	}
 }
@@ -10,25 +10,60 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	cartTokenHeader = "X-Cart-Token"
+	cartTokenCookie = "cart_token"
+)
+
+// guestCartToken returns the guest cart token sent with the request, from the
+// X-Cart-Token header or the cart_token cookie
+func guestCartToken(c *gin.Context) string {
+	token := c.GetHeader(cartTokenHeader)
+	if token == "" {
+		token, _ = c.Cookie(cartTokenCookie)
+	}
+	if len(token) > 64 {
+		return ""
+	}
+	return token
+}
+
+// cartOwner resolves whose cart the request targets. Authenticated users use
+// their own cart; guests are identified by their cart token, and a new token
+// is issued when issueToken is set and the request carries none.
+func cartOwner(c *gin.Context, cartService *service.CartService, issueToken bool) (models.CartOwner, error) {
+	if userID, exists := c.Get("userID"); exists {
+		return models.CartOwner{UserID: userID.(uint)}, nil
+	}
+
+	token := guestCartToken(c)
+	if token == "" && issueToken {
+		var err error
+		token, err = cartService.NewGuestToken()
+		if err != nil {
+			return models.CartOwner{}, err
+		}
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(cartTokenCookie, token, int(cartService.GuestTokenTTL().Seconds()), "/", "", c.Request.TLS != nil, true)
+		c.Header(cartTokenHeader, token)
+	}
+
+	return models.CartOwner{GuestToken: token}, nil
+}
+
 func GetCart(cartService *service.CartService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
-		cart, err := cartService.GetCartByUserID(userID)
+		owner, _ := cartOwner(c, cartService, false)
+		cart, err := cartService.GetCartSummary(owner)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cart"})
 			return
 		}
 
-		// Calculate total
-		total := 0.0
-		for _, item := range cart.CartItems {
-			total += item.Product.Price * float64(item.Quantity)
-		}
-
-		// Add total to response
 		response := gin.H{
 			"cart":  cart,
-			"total": total,
+			"total": cart.Total,
 		}
 
 		c.JSON(http.StatusOK, response)
@@ -37,26 +72,70 @@ func GetCart(cartService *service.CartService) gin.HandlerFunc {
 
 func AddToCart(cartService *service.CartService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
 		var cartItem models.CartItem
 		if err := c.ShouldBindJSON(&cartItem); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		err := cartService.AddToCart(userID, cartItem)
+		owner, err := cartOwner(c, cartService, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create guest cart"})
+			return
+		}
+
+		err = cartService.AddToCart(owner, cartItem)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Item added to cart successfully"})
+		response := gin.H{"message": "Item added to cart successfully"}
+		if owner.IsGuest() {
+			response["cart_token"] = owner.GuestToken
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func UpdateCartItem(cartService *service.CartService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, _ := cartOwner(c, cartService, false)
+		cartItemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item ID"})
+			return
+		}
+
+		var req models.CartItemQuantityUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		item, err := cartService.UpdateCartItemQuantity(uint(cartItemID), owner, req.Quantity)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if item == nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart successfully"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Cart item updated successfully", "item": item})
 	}
 }
 
 func RemoveFromCart(cartService *service.CartService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
+		owner, _ := cartOwner(c, cartService, false)
 		cartItemIDStr := c.Param("id")
 		cartItemID, err := strconv.Atoi(cartItemIDStr)
 		if err != nil {
@@ -64,7 +143,7 @@ func RemoveFromCart(cartService *service.CartService) gin.HandlerFunc {
 			return
 		}
 
-		err = cartService.RemoveFromCart(uint(cartItemID), userID)
+		err = cartService.RemoveFromCart(uint(cartItemID), owner)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"health-store/models"
 	"health-store/service"
@@ -75,7 +76,7 @@ func GiveFeedback(feedbackService *service.FeedbackService) gin.HandlerFunc {
 	}
 }
 
-// GetProductFeedback gets all feedback for a specific product
+// GetProductFeedback gets a page of the feedback for a specific product
 func GetProductFeedback(feedbackService *service.FeedbackService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productID := c.Param("productId")
@@ -91,15 +92,34 @@ func GetProductFeedback(feedbackService *service.FeedbackService) gin.HandlerFun
 			return
 		}
 
-		feedbacks, err := feedbackService.GetFeedbackByProductID(id)
+		params, ok := bindListParams(c, models.FeedbackListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := feedbackService.ListProductFeedback(id, params)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve feedback"})
+			respondListError(c, err, "Failed to retrieve feedback")
+			return
+		}
+		respondPage(c, page)
+	}
+}
+
+// DeleteFeedback deletes a feedback. Access is checked by FeedbackPolicy.
+func DeleteFeedback(feedbackService *service.FeedbackService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feedbackID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedback ID"})
+			return
+		}
+
+		if err := feedbackService.DeleteFeedback(uint(feedbackID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feedback"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"feedbacks": feedbacks,
-			"count":     len(feedbacks),
-		})
+		c.JSON(http.StatusOK, gin.H{"message": "Feedback deleted successfully"})
 	}
 }
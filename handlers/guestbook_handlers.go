@@ -41,16 +41,17 @@ func CreateGuestBookEntry(guestBookService *service.GuestBookService) gin.Handle
 // GetAllGuestBookEntries allows admin to view all guestbook entries
 func GetAllGuestBookEntries(guestBookService *service.GuestBookService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		entries, err := guestBookService.GetAllEntries()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch guestbook entries"})
+		params, ok := bindListParams(c, models.GuestBookListSpec)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"entries": entries,
-			"count":   len(entries),
-		})
+		page, err := guestBookService.ListEntries(params)
+		if err != nil {
+			respondListError(c, err, "Failed to fetch guestbook entries")
+			return
+		}
+		respondPage(c, page)
 	}
 }
 
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProductLots lists the inventory lots of a product, earliest expiry first
+func GetProductLots(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+
+		lots, err := inventoryService.GetProductLots(productID)
+		if err != nil {
+			respondInventoryError(c, err, "Failed to retrieve lots")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": productID,
+			"lots":       lots,
+			"count":      len(lots),
+		})
+	}
+}
+
+// ReceiveInventoryLot records a lot received into stock and adds its units
+// to the stock of the product
+func ReceiveInventoryLot(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req models.InventoryLotCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		lot, err := inventoryService.ReceiveLot(productID, req)
+		if err != nil {
+			respondInventoryError(c, err, "Failed to receive lot")
+			return
+		}
+
+		c.JSON(http.StatusCreated, lot)
+	}
+}
+
+// UpdateInventoryLot corrects a lot. Setting its quantity to 0 writes it off.
+func UpdateInventoryLot(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		lotID, err := strconv.ParseUint(c.Param("lotId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lot ID"})
+			return
+		}
+
+		var req models.InventoryLotUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		lot, err := inventoryService.UpdateLot(productID, uint(lotID), req)
+		if err != nil {
+			respondInventoryError(c, err, "Failed to update lot")
+			return
+		}
+
+		c.JSON(http.StatusOK, lot)
+	}
+}
+
+// GetExpiringLots reports the lots with units left that expire within the
+// next days days (default 30), including lots that have already expired
+func GetExpiringLots(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(service.DefaultExpiringLotDays)))
+		if err != nil || days < 1 || days > service.MaxExpiringLotDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days, use 1 to " + strconv.Itoa(service.MaxExpiringLotDays)})
+			return
+		}
+
+		report, err := inventoryService.GetExpiringLots(days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve expiring lots"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetStockHistory lists the stock movements of a product and its variants
+func GetStockHistory(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		params, ok := bindListParams(c, models.StockMovementListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := inventoryService.GetStockHistory(productID, params)
+		if errors.Is(err, service.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			respondListError(c, err, "Failed to retrieve stock history")
+			return
+		}
+		respondPage(c, page)
+	}
+}
+
+// GetStockDiscrepancies lists the products and variants whose stock disagreed
+// with the stock ledger at the last reconciliation
+func GetStockDiscrepancies(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		discrepancies, err := inventoryService.GetStockDiscrepancies()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stock discrepancies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"discrepancies": discrepancies,
+			"count":         len(discrepancies),
+		})
+	}
+}
+
+// ReconcileStock reconciles stock with the stock ledger now, without waiting
+// for the background job
+func ReconcileStock(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := inventoryService.ReconcileStock()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile stock"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetLowStockAlerts lists the products running low on stock with suggested
+// reorder quantities, computed from current stock and recent sales
+func GetLowStockAlerts(inventoryService *service.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := inventoryService.GetLowStockReport()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve low-stock alerts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func respondInventoryError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrProductNotFound), errors.Is(err, service.ErrLotNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLotNumberTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidLotDate), errors.Is(err, service.ErrLotExpired),
+		errors.Is(err, service.ErrVariantRequired), errors.Is(err, service.ErrVariantNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
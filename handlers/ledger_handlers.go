@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCommissionRules lists the commission rules and the default rate
+func GetCommissionRules(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, defaultRate, err := ledgerService.GetCommissionRules()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve commission rules"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"default_rate": defaultRate,
+			"rules":        rules,
+		})
+	}
+}
+
+// SaveCommissionRule sets the commission rate of a shop or category
+func SaveCommissionRule(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CommissionRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		rule, err := ledgerService.SaveCommissionRule(req)
+		if err != nil {
+			respondLedgerError(c, err, "Failed to save commission rule")
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteCommissionRule deletes a commission rule
+func DeleteCommissionRule(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid commission rule ID"})
+			return
+		}
+
+		if err := ledgerService.DeleteCommissionRule(uint(ruleID)); err != nil {
+			respondLedgerError(c, err, "Failed to delete commission rule")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Commission rule deleted successfully"})
+	}
+}
+
+// GetSellerBalances lists what is currently owed to every shop
+func GetSellerBalances(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		balances, err := ledgerService.GetSellerBalances()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve seller balances"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"balances": balances})
+	}
+}
+
+// GetPayoutBatches lists the payout batches
+func GetPayoutBatches(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batches, err := ledgerService.GetPayoutBatches()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payout batches"})
+			return
+		}
+		c.JSON(http.StatusOK, batches)
+	}
+}
+
+// GetPayoutBatch shows a payout batch with its payouts
+func GetPayoutBatch(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batchID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payout batch ID"})
+			return
+		}
+
+		batch, err := ledgerService.GetPayoutBatch(uint(batchID))
+		if err != nil {
+			respondLedgerError(c, err, "Failed to retrieve payout batch")
+			return
+		}
+		c.JSON(http.StatusOK, batch)
+	}
+}
+
+// CreatePayoutBatch pays out the shops that are due without waiting for the scheduler
+func CreatePayoutBatch(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batch, err := ledgerService.CreatePayoutBatch()
+		if err != nil {
+			respondLedgerError(c, err, "Failed to create payout batch")
+			return
+		}
+		c.JSON(http.StatusCreated, batch)
+	}
+}
+
+// UpdatePayoutStatus records whether a payout was paid or failed
+func UpdatePayoutStatus(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payoutID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payout ID"})
+			return
+		}
+
+		var req models.PayoutStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		payout, err := ledgerService.UpdatePayoutStatus(uint(payoutID), req)
+		if err != nil {
+			respondLedgerError(c, err, "Failed to update payout")
+			return
+		}
+		c.JSON(http.StatusOK, payout)
+	}
+}
+
+// GetSellerStatement exports the statement of a shop as json, csv or pdf.
+// Access is checked by ShopPolicy.
+func GetSellerStatement(ledgerService *service.LedgerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shopID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+			return
+		}
+
+		format := c.DefaultQuery("format", "pdf") // pdf, csv, json
+		startDate := c.Query("start_date")        // Optional: YYYY-MM-DD
+		endDate := c.Query("end_date")            // Optional: YYYY-MM-DD
+
+		var start, end *string
+		if startDate != "" {
+			start = &startDate
+		}
+		if endDate != "" {
+			end = &endDate
+		}
+
+		statement, err := ledgerService.GetSellerStatement(uint(shopID), start, end)
+		if err != nil {
+			respondLedgerError(c, err, "Failed to generate statement")
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, statement)
+			return
+		}
+
+		data, err := ledgerService.ExportSellerStatement(statement, format)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate statement: " + err.Error()})
+			return
+		}
+
+		// Set appropriate headers based on format
+		switch format {
+		case "csv":
+			c.Writer.Header().Set("Content-Type", "text/csv")
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=statement-shop-%d.csv", shopID))
+		default:
+			c.Writer.Header().Set("Content-Type", "application/pdf")
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=statement-shop-%d.pdf", shopID))
+		}
+
+		c.Writer.Write(data)
+	}
+}
+
+func respondLedgerError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrCommissionRuleNotFound), errors.Is(err, service.ErrCommissionScopeNotFound),
+		errors.Is(err, service.ErrPayoutBatchNotFound), errors.Is(err, service.ErrPayoutNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPayoutSettled), errors.Is(err, service.ErrNoPayoutsDue):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCommissionRule), errors.Is(err, service.ErrInvalidStatementPeriod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMFAStatus reports whether the current user has MFA and how many recovery codes are left
+func GetMFAStatus(userService *service.UserService, mfaService *service.MFAService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userService.GetUserByID(c.MustGet("userID").(uint))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		response := gin.H{
+			"mfa_enabled":  user.MFAEnabled,
+			"mfa_verified": c.GetBool("mfaVerified"),
+		}
+		if user.MFAEnabled {
+			remaining, err := mfaService.RemainingRecoveryCodes(user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve MFA status"})
+				return
+			}
+			response["recovery_codes_remaining"] = remaining
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// EnrollMFA starts TOTP enrollment for the current user
+func EnrollMFA(userService *service.UserService, mfaService *service.MFAService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userService.GetUserByID(c.MustGet("userID").(uint))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		enrollment, err := mfaService.Enroll(user)
+		if err != nil {
+			if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA enrollment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// ConfirmMFA turns MFA on with a code from the authenticator. The response
+// carries the recovery codes and a new session that counts as MFA verified.
+func ConfirmMFA(userService *service.UserService, authService *service.AuthService, mfaService *service.MFAService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MFACodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		user, err := userService.GetUserByID(c.MustGet("userID").(uint))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		codes, err := mfaService.Confirm(user, req.Code)
+		if err != nil {
+			respondMFAError(c, err, "Failed to enable MFA")
+			return
+		}
+
+		tokens, err := authService.IssueTokens(user, true, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Multi-factor authentication enabled, store the recovery codes somewhere safe",
+			"recovery_codes": codes,
+			"token":          tokens.AccessToken,
+			"refresh_token":  tokens.RefreshToken,
+			"expires_in":     tokens.ExpiresIn,
+		})
+	}
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func RegenerateRecoveryCodes(userService *service.UserService, mfaService *service.MFAService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MFACodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		user, err := userService.GetUserByID(c.MustGet("userID").(uint))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		codes, err := mfaService.RegenerateRecoveryCodes(user, req.Code)
+		if err != nil {
+			respondMFAError(c, err, "Failed to regenerate recovery codes")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// DisableMFA turns MFA off for the current user
+func DisableMFA(userService *service.UserService, mfaService *service.MFAService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MFADisableRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		user, err := userService.GetUserByID(c.MustGet("userID").(uint))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if err := mfaService.Disable(user, req.Password, req.Code); err != nil {
+			respondMFAError(c, err, "Failed to disable MFA")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Multi-factor authentication disabled"})
+	}
+}
+
+// respondMFAError maps MFA service errors to responses
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFANotEnabled), errors.Is(err, service.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"health-store/models"
 	"health-store/service"
@@ -10,32 +12,96 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func PlaceOrder(orderService *service.OrderService) gin.HandlerFunc {
+func PlaceOrder(orderService *service.OrderService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("userID").(uint)
 
 		var req models.PlaceOrderRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		if !bindPlaceOrderRequest(c, cloudinaryService, &req) {
 			return
 		}
 
-		// Validate the request
-		if err := models.ValidateStruct(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
-			return
+		order, err := orderService.PlaceOrder(userID, req)
+
+		// Drop an uploaded prescription the order did not keep
+		if req.PrescriptionURL != "" && (err != nil || order.Prescription == nil) {
+			_ = cloudinaryService.DeleteImage(c.Request.Context(), req.PrescriptionURL)
 		}
 
-		order, err := orderService.PlaceOrder(userID, req)
 		if err != nil {
+			if errors.Is(err, service.ErrPaymentDeclined) {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrPrescriptionRequired) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrProductUnavailable) || errors.Is(err, service.ErrVariantRequired) || errors.Is(err, service.ErrVariantNotFound) ||
+				errors.Is(err, service.ErrInsufficientUnexpiredStock) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		if order.Status == "awaiting_payment" {
+			c.JSON(http.StatusAccepted, gin.H{"message": "Order placed, awaiting payment confirmation", "order": order})
+			return
+		}
+		if order.Status == "pending_verification" {
+			c.JSON(http.StatusAccepted, gin.H{"message": "Order placed, awaiting prescription verification", "order": order})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully", "order": order})
 	}
 }
 
+// bindPlaceOrderRequest binds a checkout from JSON, or from a multipart form
+// carrying the prescription document, which is uploaded to storage. It
+// responds and returns false when the request is invalid.
+func bindPlaceOrderRequest(c *gin.Context, cloudinaryService *service.CloudinaryService, req *models.PlaceOrderRequest) bool {
+	multipart := strings.Contains(c.GetHeader("Content-Type"), "multipart/form-data")
+	bind := c.ShouldBindJSON
+	if multipart {
+		bind = c.ShouldBind
+	}
+	if err := bind(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return false
+	}
+
+	// Validate the request
+	if err := models.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return false
+	}
+
+	if !multipart {
+		return true
+	}
+
+	file, header, err := c.Request.FormFile("prescription")
+	if err == http.ErrMissingFile {
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process prescription: " + err.Error()})
+		return false
+	}
+	defer file.Close()
+
+	documentURL, err := cloudinaryService.UploadDocument(c.Request.Context(), file, header.Filename, "prescriptions")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload prescription: " + err.Error()})
+		return false
+	}
+	req.PrescriptionURL = documentURL
+	return true
+}
+
 // UpdateOrderStatus allows admin to update order status
 func UpdateOrderStatus(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -59,6 +125,10 @@ func UpdateOrderStatus(orderService *service.OrderService) gin.HandlerFunc {
 		}
 
 		err = orderService.UpdateOrderStatus(uint(orderID), req.Status)
+		if errors.Is(err, service.ErrAwaitingVerification) || errors.Is(err, service.ErrRecalledLotShipment) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -71,19 +141,23 @@ func UpdateOrderStatus(orderService *service.OrderService) gin.HandlerFunc {
 // GetAllOrders allows admin to view all orders
 func GetAllOrders(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		orders, err := orderService.GetAllOrders()
+		params, ok := bindListParams(c, models.OrderListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := orderService.ListOrders(params)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
+			respondListError(c, err, "Failed to retrieve orders")
 			return
 		}
-		c.JSON(http.StatusOK, orders)
+		respondPage(c, page)
 	}
 }
 
-// GetOrder allows viewing a specific order
+// GetOrder allows viewing a specific order. Access is checked by OrderPolicy.
 func GetOrder(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
 		orderIDStr := c.Param("id")
 		orderID, err := strconv.Atoi(orderIDStr)
 		if err != nil {
@@ -97,13 +171,6 @@ func GetOrder(orderService *service.OrderService) gin.HandlerFunc {
 			return
 		}
 
-		// Check if user owns the order or is admin
-		userRole := c.MustGet("userRole").(string)
-		if order.UserID != userID && userRole != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this order"})
-			return
-		}
-
 		c.JSON(http.StatusOK, order)
 	}
 }
@@ -113,22 +180,24 @@ func GetUserOrders(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("userID").(uint)
 
-		orders, err := orderService.GetOrdersByUserID(userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
+		params, ok := bindListParams(c, models.OrderListSpec)
+		if !ok {
 			return
 		}
+		// Customers only see their own orders
+		delete(params.Filters, "user_id")
 
-		c.JSON(http.StatusOK, gin.H{
-			"orders": orders,
-			"count":  len(orders),
-		})
+		page, err := orderService.ListUserOrders(userID, params)
+		if err != nil {
+			respondListError(c, err, "Failed to retrieve orders")
+			return
+		}
+		respondPage(c, page)
 	}
 }
 
 func CancelOrder(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
 		orderIDStr := c.Param("id")
 		orderID, err := strconv.Atoi(orderIDStr)
 		if err != nil {
@@ -136,7 +205,7 @@ func CancelOrder(orderService *service.OrderService) gin.HandlerFunc {
 			return
 		}
 
-		err = orderService.CancelOrder(uint(orderID), userID)
+		err = orderService.CancelOrder(uint(orderID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -148,7 +217,6 @@ func CancelOrder(orderService *service.OrderService) gin.HandlerFunc {
 // GeneratePurchaseReceipt generates a PDF receipt for a customer's order
 func GeneratePurchaseReceipt(orderService *service.OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("userID").(uint)
 		orderIDStr := c.Param("id")
 		orderID, err := strconv.Atoi(orderIDStr)
 		if err != nil {
@@ -156,20 +224,6 @@ func GeneratePurchaseReceipt(orderService *service.OrderService) gin.HandlerFunc
 			return
 		}
 
-		// Get the order to verify ownership
-		order, err := orderService.GetOrderByID(uint(orderID))
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-			return
-		}
-
-		// Check if user owns the order or is admin
-		userRole := c.MustGet("userRole").(string)
-		if order.UserID != userID && userRole != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to generate receipt for this order"})
-			return
-		}
-
 		// Generate PDF
 		pdfData, err := orderService.GeneratePurchaseReceiptPDF(uint(orderID))
 		if err != nil {
@@ -183,3 +237,57 @@ func GeneratePurchaseReceipt(orderService *service.OrderService) gin.HandlerFunc
 		c.Data(http.StatusOK, "application/pdf", pdfData)
 	}
 }
+
+// GetShopOrders lists the sub-orders a shop has to fulfil. Access is checked by ShopPolicy.
+func GetShopOrders(orderService *service.OrderService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shopID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+			return
+		}
+
+		shopOrders, err := orderService.GetShopOrders(uint(shopID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve shop orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"shop_orders": shopOrders,
+			"count":       len(shopOrders),
+		})
+	}
+}
+
+// ShipShopOrder marks a shop's sub-order shipped. Access is checked by ShopPolicy.
+func ShipShopOrder(orderService *service.OrderService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shopID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+			return
+		}
+		shopOrderID, err := strconv.Atoi(c.Param("shopOrderId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop order ID"})
+			return
+		}
+
+		shopOrder, err := orderService.ShipShopOrder(uint(shopID), uint(shopOrderID))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrShopOrderNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrShopOrderNotPending), errors.Is(err, service.ErrOrderNotPaid),
+				errors.Is(err, service.ErrRecalledLotShipment):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ship shop order"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Shop order shipped", "shop_order": shopOrder})
+	}
+}
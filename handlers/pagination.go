@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"health-store/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindListParams reads limit, cursor, sort and the filters whitelisted by spec
+// from the query string. sort names a field, prefixed with "-" for
+// descending order. It responds with 400 and returns false when they are
+// invalid.
+func bindListParams(c *gin.Context, spec models.ListSpec) (models.ListParams, bool) {
+	params := models.ListParams{Limit: models.DefaultPageLimit, Filters: map[string]string{}}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > models.MaxPageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxPageLimit)})
+			return params, false
+		}
+		params.Limit = value
+	}
+
+	sort := c.DefaultQuery("sort", spec.DefaultSort)
+	params.Sort = strings.TrimPrefix(sort, "-")
+	params.Desc = strings.HasPrefix(sort, "-")
+	if _, ok := spec.Sorts[params.Sort]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort field: " + params.Sort})
+		return params, false
+	}
+
+	for name := range spec.Filters {
+		if value := c.Query(name); value != "" {
+			params.Filters[name] = value
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := models.DecodeListCursor(cursor)
+		if err != nil || decoded.Sort != params.Sort || decoded.Desc != params.Desc {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return params, false
+		}
+		params.Cursor = decoded
+	}
+
+	return params, true
+}
+
+// respondPage sends a page of a list endpoint with a link to the next page,
+// which repeats the current query with the next cursor
+func respondPage[T any](c *gin.Context, page *models.Page[T]) {
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+		page.Links.Next = next.RequestURI()
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// respondListError reports invalid filter or cursor values with 400 and
+// anything else with fallback
+func respondListError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, models.ErrInvalidListParams) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
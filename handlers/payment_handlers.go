@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/service"
+	"health-store/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentWebhook receives asynchronous payment notifications from a provider
+func PaymentWebhook(webhookService *service.PaymentWebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider := c.Param("provider")
+
+		payload, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+
+		err = webhookService.HandleWebhook(provider, payload, c.Request.Header)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUnknownPaymentProvider):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrInvalidWebhook):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				// A non-2xx response makes the provider retry the delivery
+				utils.LogError(err, "Failed to process "+provider+" webhook")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	}
+}
+
+// GetPaymentEvents allows admin to view stored payment webhook events
+func GetPaymentEvents(webhookService *service.PaymentWebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, err := webhookService.GetEvents(c.Query("status"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payment events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"events": events,
+			"count":  len(events),
+		})
+	}
+}
+
+// ReplayPaymentEvent allows admin to process a stored payment webhook event again
+func ReplayPaymentEvent(webhookService *service.PaymentWebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		eventID, err := strconv.Atoi(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+			return
+		}
+
+		event, err := webhookService.ReplayEvent(uint(eventID))
+		if err != nil {
+			if event == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "event": event})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Payment event replayed successfully",
+			"event":   event,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+
+	"health-store/middleware"
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ownership policies for routes addressing a single resource. Routes declare
+// them with middleware.Authorize; the permission lets staff act on resources
+// of other users.
+
+// ShopPolicy admits the shop's owner and roles holding permission
+func ShopPolicy(shopService *service.ShopService, permission models.Permission) middleware.Policy {
+	return middleware.Policy{
+		Resource:   "shop",
+		Permission: permission,
+		Owns: func(c *gin.Context, id uint) (bool, error) {
+			shop, err := shopService.GetShopByID(id)
+			if err != nil {
+				return false, middleware.ErrResourceNotFound
+			}
+			return isCurrentUser(c, shop.UserID), nil
+		},
+	}
+}
+
+// ShopRequestPolicy admits the applicant of the shop request and roles holding permission
+func ShopRequestPolicy(shopService *service.ShopService, permission models.Permission) middleware.Policy {
+	return middleware.Policy{
+		Resource:   "shop request",
+		Permission: permission,
+		Owns: func(c *gin.Context, id uint) (bool, error) {
+			shopRequest, err := shopService.GetShopRequestByID(id)
+			if err != nil {
+				return false, middleware.ErrResourceNotFound
+			}
+			return isCurrentUser(c, shopRequest.UserID), nil
+		},
+	}
+}
+
+// OrderPolicy admits the user who placed the order and roles holding permission
+func OrderPolicy(orderService *service.OrderService, permission models.Permission) middleware.Policy {
+	return middleware.Policy{
+		Resource:   "order",
+		Permission: permission,
+		Owns: func(c *gin.Context, id uint) (bool, error) {
+			order, err := orderService.GetOrderByID(id)
+			if err != nil {
+				return false, middleware.ErrResourceNotFound
+			}
+			return isCurrentUser(c, order.UserID), nil
+		},
+	}
+}
+
+// CartItemPolicy admits only the owner of the cart holding the item, which
+// is a guest when the request carries a cart token instead of a user token
+func CartItemPolicy(cartService *service.CartService) middleware.Policy {
+	return middleware.Policy{
+		Resource: "cart item",
+		Owns: func(c *gin.Context, id uint) (bool, error) {
+			owner, err := cartOwner(c, cartService, false)
+			if err != nil {
+				return false, err
+			}
+			owns, err := cartService.IsCartItemOwner(id, owner)
+			if errors.Is(err, service.ErrCartItemNotFound) {
+				return false, middleware.ErrResourceNotFound
+			}
+			return owns, err
+		},
+	}
+}
+
+// FeedbackPolicy admits the author of the feedback and roles holding permission
+func FeedbackPolicy(feedbackService *service.FeedbackService, permission models.Permission) middleware.Policy {
+	return middleware.Policy{
+		Resource:   "feedback",
+		Permission: permission,
+		Owns: func(c *gin.Context, id uint) (bool, error) {
+			feedback, err := feedbackService.GetFeedbackByID(id)
+			if err != nil {
+				return false, middleware.ErrResourceNotFound
+			}
+			return isCurrentUser(c, feedback.UserID), nil
+		},
+	}
+}
+
+// isCurrentUser reports whether userID is the authenticated user of the request
+func isCurrentUser(c *gin.Context, userID uint) bool {
+	current, exists := c.Get("userID")
+	return exists && current.(uint) == userID
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPrescriptions lists prescriptions for review. Filter on status=pending
+// for the review queue.
+func GetPrescriptions(prescriptionService *service.PrescriptionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, ok := bindListParams(c, models.PrescriptionListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := prescriptionService.ListPrescriptions(params)
+		if err != nil {
+			respondListError(c, err, "Failed to retrieve prescriptions")
+			return
+		}
+		respondPage(c, page)
+	}
+}
+
+// GetPrescription shows a prescription with its order and customer
+func GetPrescription(prescriptionService *service.PrescriptionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prescriptionID, ok := prescriptionIDParam(c)
+		if !ok {
+			return
+		}
+
+		prescription, err := prescriptionService.GetPrescription(prescriptionID)
+		if err != nil {
+			respondPrescriptionError(c, err, "Failed to retrieve prescription")
+			return
+		}
+		c.JSON(http.StatusOK, prescription)
+	}
+}
+
+// ApprovePrescription approves a prescription and releases its order
+func ApprovePrescription(prescriptionService *service.PrescriptionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prescriptionID, ok := prescriptionIDParam(c)
+		if !ok {
+			return
+		}
+		reviewerID := c.MustGet("userID").(uint)
+
+		prescription, err := prescriptionService.ApprovePrescription(prescriptionID, reviewerID)
+		if err != nil {
+			respondPrescriptionError(c, err, "Failed to approve prescription")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Prescription approved", "prescription": prescription})
+	}
+}
+
+// RejectPrescription rejects a prescription with a reason and cancels its order
+func RejectPrescription(prescriptionService *service.PrescriptionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prescriptionID, ok := prescriptionIDParam(c)
+		if !ok {
+			return
+		}
+		reviewerID := c.MustGet("userID").(uint)
+
+		var req models.PrescriptionRejectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		prescription, err := prescriptionService.RejectPrescription(prescriptionID, reviewerID, req)
+		if err != nil {
+			respondPrescriptionError(c, err, "Failed to reject prescription")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Prescription rejected, order cancelled", "prescription": prescription})
+	}
+}
+
+// prescriptionIDParam reads the prescription ID of the route. It responds and
+// returns false when it is invalid.
+func prescriptionIDParam(c *gin.Context) (uint, bool) {
+	prescriptionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return 0, false
+	}
+	return uint(prescriptionID), true
+}
+
+func respondPrescriptionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrPrescriptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPrescriptionReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPaymentDeclined):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
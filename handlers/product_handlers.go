@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,84 +15,7 @@ import (
 func CreateProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.ProductCreateRequest
-
-		// Check content type to determine binding method
-		contentType := c.GetHeader("Content-Type")
-		if strings.Contains(contentType, "multipart/form-data") {
-			// Manually parse form values
-			if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
-				return
-			}
-
-			// Debug: Log all form values
-			categoryIDStr := c.PostForm("category_id")
-			nameStr := c.PostForm("name")
-			descStr := c.PostForm("description")
-			priceStr := c.PostForm("price")
-			stockStr := c.PostForm("stock")
-
-			// Return debug info if description is empty
-			if descStr == "" {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Description is empty",
-					"debug": gin.H{
-						"category_id": categoryIDStr,
-						"name": nameStr,
-						"description": descStr,
-						"price": priceStr,
-						"stock": stockStr,
-						"all_form_values": c.Request.PostForm,
-					},
-				})
-				return
-			}
-
-			// Manually extract and convert form values
-			categoryID, _ := strconv.ParseUint(categoryIDStr, 10, 32)
-			price, _ := strconv.ParseFloat(priceStr, 64)
-			stock, _ := strconv.Atoi(stockStr)
-
-			req.CategoryID = uint(categoryID)
-			req.Name = nameStr
-			req.Description = descStr
-			req.Price = price
-			req.Stock = stock
-			req.ImageURL = c.PostForm("image_url")
-
-			// Handle image upload if provided
-			file, header, err := c.Request.FormFile("image")
-			if err == nil {
-				defer file.Close()
-
-				// Upload to Cloudinary
-				imageURL, err := cloudinaryService.UploadImage(c.Request.Context(), file, header.Filename)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
-					return
-				}
-				req.ImageURL = imageURL
-			} else if err != http.ErrMissingFile {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process image: " + err.Error()})
-				return
-			}
-		} else {
-			// JSON binding for backward compatibility
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
-				return
-			}
-		}
-
-		// Validate the request
-		if err := models.ValidateStruct(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
-			return
-		}
-
-		// Ensure we have an image URL
-		if req.ImageURL == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Product image is required"})
+		if !bindProductCreateRequest(c, cloudinaryService, &req) {
 			return
 		}
 
@@ -108,12 +32,17 @@ func CreateProduct(productService *service.ProductService, cloudinaryService *se
 
 func GetProducts(productService *service.ProductService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		products, err := productService.GetAllProducts()
+		params, ok := bindListParams(c, models.ProductListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := productService.ListProducts(params)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+			respondListError(c, err, "Failed to retrieve products")
 			return
 		}
-		c.JSON(http.StatusOK, products)
+		respondPage(c, page)
 	}
 }
 
@@ -130,113 +59,72 @@ func GetProduct(productService *service.ProductService, feedbackService *service
 			return
 		}
 
-		// Get feedback for this product
-		feedbacks, err := feedbackService.GetFeedbackByProductID(uint(id))
-		if err != nil {
-			// If error fetching feedback, return product without feedback
-			c.JSON(http.StatusOK, product)
+		respondProductWithFeedback(c, product, feedbackService)
+	}
+}
+
+// GetCatalogProducts searches the products on sale, leaving out products of
+// inactive shops. Results are filtered and sorted by the query parameters and
+// paged with an opaque cursor.
+func GetCatalogProducts(productService *service.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ProductSearchRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters: " + err.Error()})
 			return
 		}
 
-		// Create response with feedback
-		response := gin.H{
-			"id":          product.ID,
-			"category_id": product.CategoryID,
-			"name":        product.Name,
-			"description": product.Description,
-			"price":       product.Price,
-			"stock":       product.Stock,
-			"image_url":   product.ImageURL,
-			"created_at":  product.CreatedAt,
-			"updated_at":  product.UpdatedAt,
-			"feedbacks":   feedbacks,
+		if err := models.ValidateStruct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
 		}
-
-		// Include category if loaded
-		if product.Category.ID != 0 {
-			response["category"] = product.Category
+		if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_price can not be greater than max_price"})
+			return
 		}
 
-		c.JSON(http.StatusOK, response)
+		result, err := productService.SearchCatalogProducts(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidProductCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+// GetCatalogProduct shows a product on sale with its feedback. Products of
+// inactive shops are not found.
+func GetCatalogProduct(productService *service.ProductService, feedbackService *service.FeedbackService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
 			return
 		}
+		product, err := productService.GetCatalogProduct(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 
-		var req models.ProductUpdateRequest
-
-		// Check content type to determine binding method
-		contentType := c.GetHeader("Content-Type")
-		if strings.Contains(contentType, "multipart/form-data") {
-			// Manually parse form values
-			if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
-				return
-			}
-
-			// Manually extract and convert form values (only if provided)
-			if categoryIDStr := c.PostForm("category_id"); categoryIDStr != "" {
-				categoryID, _ := strconv.ParseUint(categoryIDStr, 10, 32)
-				req.CategoryID = uint(categoryID)
-			}
-			if name := c.PostForm("name"); name != "" {
-				req.Name = name
-			}
-			if description := c.PostForm("description"); description != "" {
-				req.Description = description
-			}
-			if priceStr := c.PostForm("price"); priceStr != "" {
-				price, _ := strconv.ParseFloat(priceStr, 64)
-				req.Price = price
-			}
-			if stockStr := c.PostForm("stock"); stockStr != "" {
-				stock, _ := strconv.Atoi(stockStr)
-				req.Stock = stock
-			}
-			if imageURL := c.PostForm("image_url"); imageURL != "" {
-				req.ImageURL = imageURL
-			}
+		respondProductWithFeedback(c, product, feedbackService)
+	}
+}
 
-			// Handle image upload if provided
-			file, header, err := c.Request.FormFile("image")
-			if err == nil {
-				defer file.Close()
-
-				// Get existing product to delete old image
-				existingProduct, err := productService.GetProductByID(uint(id))
-				if err == nil && existingProduct.ImageURL != "" {
-					// Delete old image from Cloudinary
-					_ = cloudinaryService.DeleteImage(c.Request.Context(), existingProduct.ImageURL)
-				}
-
-				// Upload new image to Cloudinary
-				imageURL, err := cloudinaryService.UploadImage(c.Request.Context(), file, header.Filename)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
-					return
-				}
-				req.ImageURL = imageURL
-			} else if err != http.ErrMissingFile {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process image: " + err.Error()})
-				return
-			}
-		} else {
-			// JSON binding for backward compatibility
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
-				return
-			}
+func UpdateProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
 		}
 
-		// Validate the request
-		if err := models.ValidateStruct(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		var req models.ProductUpdateRequest
+		if !bindProductUpdateRequest(c, productService, cloudinaryService, uint(id), &req) {
 			return
 		}
 
@@ -273,11 +161,227 @@ func DeleteProduct(productService *service.ProductService, cloudinaryService *se
 			return
 		}
 
-		// Delete image from Cloudinary (ignore errors as product is already deleted)
+		// Delete images from Cloudinary (ignore errors as product is already deleted)
 		if product.ImageURL != "" {
 			_ = cloudinaryService.DeleteImage(c.Request.Context(), product.ImageURL)
 		}
+		for _, variant := range product.Variants {
+			if variant.ImageURL != "" {
+				_ = cloudinaryService.DeleteImage(c.Request.Context(), variant.ImageURL)
+			}
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 	}
 }
+
+// respondProductWithFeedback responds with a product and the feedback given on it
+func respondProductWithFeedback(c *gin.Context, product *models.Product, feedbackService *service.FeedbackService) {
+	// Get feedback for this product
+	feedbacks, err := feedbackService.GetFeedbackByProductID(product.ID)
+	if err != nil {
+		// If error fetching feedback, return product without feedback
+		c.JSON(http.StatusOK, product)
+		return
+	}
+
+	// Create response with feedback
+	response := gin.H{
+		"id":              product.ID,
+		"category_id":     product.CategoryID,
+		"shop_id":         product.ShopID,
+		"name":            product.Name,
+		"description":     product.Description,
+		"price":           product.Price,
+		"stock":           product.Stock,
+		"available_stock": product.AvailableStock,
+		"image_url":       product.ImageURL,
+		"variants":        product.Variants,
+		"created_at":      product.CreatedAt,
+		"updated_at":      product.UpdatedAt,
+		"feedbacks":       feedbacks,
+	}
+
+	// Include category if loaded
+	if product.Category.ID != 0 {
+		response["category"] = product.Category
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// bindProductCreateRequest reads a new product from a JSON or multipart body
+// and uploads the image of multipart requests. It responds and returns false
+// when the request is invalid.
+func bindProductCreateRequest(c *gin.Context, cloudinaryService *service.CloudinaryService, req *models.ProductCreateRequest) bool {
+	// Check content type to determine binding method
+	contentType := c.GetHeader("Content-Type")
+	if strings.Contains(contentType, "multipart/form-data") {
+		// Manually parse form values
+		if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+			return false
+		}
+
+		// Debug: Log all form values
+		categoryIDStr := c.PostForm("category_id")
+		nameStr := c.PostForm("name")
+		descStr := c.PostForm("description")
+		priceStr := c.PostForm("price")
+		stockStr := c.PostForm("stock")
+
+		// Return debug info if description is empty
+		if descStr == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Description is empty",
+				"debug": gin.H{
+					"category_id":     categoryIDStr,
+					"name":            nameStr,
+					"description":     descStr,
+					"price":           priceStr,
+					"stock":           stockStr,
+					"all_form_values": c.Request.PostForm,
+				},
+			})
+			return false
+		}
+
+		// Manually extract and convert form values
+		categoryID, _ := strconv.ParseUint(categoryIDStr, 10, 32)
+		price, _ := strconv.ParseFloat(priceStr, 64)
+		stock, _ := strconv.Atoi(stockStr)
+
+		req.CategoryID = uint(categoryID)
+		req.Name = nameStr
+		req.Description = descStr
+		req.Price = price
+		req.Stock = stock
+		req.ImageURL = c.PostForm("image_url")
+		if shopIDStr := c.PostForm("shop_id"); shopIDStr != "" {
+			shopID, _ := strconv.ParseUint(shopIDStr, 10, 32)
+			id := uint(shopID)
+			req.ShopID = &id
+		}
+		req.RequiresPrescription, _ = strconv.ParseBool(c.PostForm("requires_prescription"))
+		req.ReorderThreshold, _ = strconv.Atoi(c.PostForm("reorder_threshold"))
+
+		// Handle image upload if provided
+		file, header, err := c.Request.FormFile("image")
+		if err == nil {
+			defer file.Close()
+
+			// Upload to Cloudinary
+			imageURL, err := cloudinaryService.UploadImage(c.Request.Context(), file, header.Filename)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
+				return false
+			}
+			req.ImageURL = imageURL
+		} else if err != http.ErrMissingFile {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process image: " + err.Error()})
+			return false
+		}
+	} else {
+		// JSON binding for backward compatibility
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return false
+		}
+	}
+
+	// Validate the request
+	if err := models.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return false
+	}
+
+	// Ensure we have an image URL
+	if req.ImageURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product image is required"})
+		return false
+	}
+	return true
+}
+
+// bindProductUpdateRequest reads product changes from a JSON or multipart body.
+// A multipart image replaces the product's current one. It responds and
+// returns false when the request is invalid.
+func bindProductUpdateRequest(c *gin.Context, productService *service.ProductService, cloudinaryService *service.CloudinaryService, id uint, req *models.ProductUpdateRequest) bool {
+	// Check content type to determine binding method
+	contentType := c.GetHeader("Content-Type")
+	if strings.Contains(contentType, "multipart/form-data") {
+		// Manually parse form values
+		if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+			return false
+		}
+
+		// Manually extract and convert form values (only if provided)
+		if categoryIDStr := c.PostForm("category_id"); categoryIDStr != "" {
+			categoryID, _ := strconv.ParseUint(categoryIDStr, 10, 32)
+			req.CategoryID = uint(categoryID)
+		}
+		if name := c.PostForm("name"); name != "" {
+			req.Name = name
+		}
+		if description := c.PostForm("description"); description != "" {
+			req.Description = description
+		}
+		if priceStr := c.PostForm("price"); priceStr != "" {
+			price, _ := strconv.ParseFloat(priceStr, 64)
+			req.Price = price
+		}
+		if stockStr := c.PostForm("stock"); stockStr != "" {
+			stock, _ := strconv.Atoi(stockStr)
+			req.Stock = stock
+		}
+		if imageURL := c.PostForm("image_url"); imageURL != "" {
+			req.ImageURL = imageURL
+		}
+		if requiresStr := c.PostForm("requires_prescription"); requiresStr != "" {
+			requires, _ := strconv.ParseBool(requiresStr)
+			req.RequiresPrescription = &requires
+		}
+		if thresholdStr := c.PostForm("reorder_threshold"); thresholdStr != "" {
+			threshold, _ := strconv.Atoi(thresholdStr)
+			req.ReorderThreshold = &threshold
+		}
+
+		// Handle image upload if provided
+		file, header, err := c.Request.FormFile("image")
+		if err == nil {
+			defer file.Close()
+
+			// Get existing product to delete old image
+			existingProduct, err := productService.GetProductByID(id)
+			if err == nil && existingProduct.ImageURL != "" {
+				// Delete old image from Cloudinary
+				_ = cloudinaryService.DeleteImage(c.Request.Context(), existingProduct.ImageURL)
+			}
+
+			// Upload new image to Cloudinary
+			imageURL, err := cloudinaryService.UploadImage(c.Request.Context(), file, header.Filename)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
+				return false
+			}
+			req.ImageURL = imageURL
+		} else if err != http.ErrMissingFile {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process image: " + err.Error()})
+			return false
+		}
+	} else {
+		// JSON binding for backward compatibility
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return false
+		}
+	}
+
+	// Validate the request
+	if err := models.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return false
+	}
+	return true
+}
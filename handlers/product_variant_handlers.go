@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProductVariants lists the variants of a product
+func GetProductVariants(productService *service.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+
+		variants, err := productService.GetProductVariants(productID)
+		if err != nil {
+			respondVariantError(c, err, "Failed to retrieve variants")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": productID,
+			"variants":   variants,
+			"count":      len(variants),
+		})
+	}
+}
+
+// GetProductVariant shows a variant of a product
+func GetProductVariant(productService *service.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, variantID, ok := variantIDParams(c)
+		if !ok {
+			return
+		}
+
+		variant, err := productService.GetProductVariant(productID, variantID)
+		if err != nil {
+			respondVariantError(c, err, "Failed to retrieve variant")
+			return
+		}
+
+		c.JSON(http.StatusOK, variant)
+	}
+}
+
+// CreateProductVariant adds a variant to a product from a JSON or multipart
+// body. A multipart image is uploaded as the variant's image.
+func CreateProductVariant(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req models.ProductVariantCreateRequest
+		if !bindVariantRequest(c, &req) {
+			return
+		}
+		imageURL, ok := uploadVariantImage(c, cloudinaryService)
+		if !ok {
+			return
+		}
+		if imageURL != "" {
+			req.ImageURL = imageURL
+		}
+
+		variant, err := productService.CreateProductVariant(productID, req)
+		if err != nil {
+			respondVariantError(c, err, "Failed to create variant")
+			return
+		}
+
+		c.JSON(http.StatusCreated, variant)
+	}
+}
+
+// UpdateProductVariant updates a variant of a product from a JSON or
+// multipart body. A multipart image replaces the variant's current one.
+func UpdateProductVariant(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, variantID, ok := variantIDParams(c)
+		if !ok {
+			return
+		}
+
+		existing, err := productService.GetProductVariant(productID, variantID)
+		if err != nil {
+			respondVariantError(c, err, "Failed to update variant")
+			return
+		}
+
+		var req models.ProductVariantUpdateRequest
+		if !bindVariantRequest(c, &req) {
+			return
+		}
+		imageURL, ok := uploadVariantImage(c, cloudinaryService)
+		if !ok {
+			return
+		}
+		if imageURL != "" {
+			if existing.ImageURL != "" {
+				_ = cloudinaryService.DeleteImage(c.Request.Context(), existing.ImageURL)
+			}
+			req.ImageURL = imageURL
+		}
+
+		variant, err := productService.UpdateProductVariant(productID, variantID, req)
+		if err != nil {
+			respondVariantError(c, err, "Failed to update variant")
+			return
+		}
+
+		c.JSON(http.StatusOK, variant)
+	}
+}
+
+// DeleteProductVariant deletes a variant of a product and its image
+func DeleteProductVariant(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, variantID, ok := variantIDParams(c)
+		if !ok {
+			return
+		}
+
+		variant, err := productService.GetProductVariant(productID, variantID)
+		if err != nil {
+			respondVariantError(c, err, "Failed to delete variant")
+			return
+		}
+
+		if err := productService.DeleteProductVariant(productID, variantID); err != nil {
+			respondVariantError(c, err, "Failed to delete variant")
+			return
+		}
+
+		// Delete image from Cloudinary (ignore errors as variant is already deleted)
+		if variant.ImageURL != "" {
+			_ = cloudinaryService.DeleteImage(c.Request.Context(), variant.ImageURL)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+	}
+}
+
+// bindVariantRequest reads a variant request from a JSON or multipart body
+// and validates it. It responds and returns false when the request is invalid.
+func bindVariantRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBind(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return false
+	}
+
+	if err := models.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// uploadVariantImage uploads the image of a multipart variant request and
+// returns its URL, or an empty URL when the request has no image. It
+// responds and returns false when the upload fails.
+func uploadVariantImage(c *gin.Context, cloudinaryService *service.CloudinaryService) (string, bool) {
+	if !strings.Contains(c.GetHeader("Content-Type"), "multipart/form-data") {
+		return "", true
+	}
+
+	file, header, err := c.Request.FormFile("image")
+	if err == http.ErrMissingFile {
+		return "", true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process image: " + err.Error()})
+		return "", false
+	}
+	defer file.Close()
+
+	imageURL, err := cloudinaryService.UploadImage(c.Request.Context(), file, header.Filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
+		return "", false
+	}
+	return imageURL, true
+}
+
+// productIDParam reads the product ID of the route. It responds and returns
+// false when it is invalid.
+func productIDParam(c *gin.Context) (uint, bool) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return 0, false
+	}
+	return uint(productID), true
+}
+
+// variantIDParams reads the product and variant IDs of the route. It
+// responds and returns false when they are invalid.
+func variantIDParams(c *gin.Context) (uint, uint, bool) {
+	productID, ok := productIDParam(c)
+	if !ok {
+		return 0, 0, false
+	}
+	variantID, err := strconv.ParseUint(c.Param("variantId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return 0, 0, false
+	}
+	return productID, uint(variantID), true
+}
+
+func respondVariantError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrProductNotFound), errors.Is(err, service.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrVariantSKUTaken), errors.Is(err, service.ErrVariantOrdered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLotStockManaged):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRecalls lists recalls
+func GetRecalls(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, ok := bindListParams(c, models.RecallListSpec)
+		if !ok {
+			return
+		}
+
+		page, err := recallService.ListRecalls(params)
+		if err != nil {
+			respondListError(c, err, "Failed to retrieve recalls")
+			return
+		}
+		respondPage(c, page)
+	}
+}
+
+// GetRecall shows a recall with the products and lots it covers
+func GetRecall(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recallID, ok := recallIDParam(c)
+		if !ok {
+			return
+		}
+
+		recall, err := recallService.GetRecall(recallID)
+		if err != nil {
+			respondRecallError(c, err, "Failed to retrieve recall")
+			return
+		}
+		c.JSON(http.StatusOK, recall)
+	}
+}
+
+// CreateRecall issues a recall and blocks the stock it covers from sale
+func CreateRecall(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.RecallCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		recall, err := recallService.CreateRecall(req)
+		if err != nil {
+			respondRecallError(c, err, "Failed to create recall")
+			return
+		}
+		c.JSON(http.StatusCreated, recall)
+	}
+}
+
+// CloseRecall closes a recall and puts the products and variants it blocked
+// back on sale
+func CloseRecall(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recallID, ok := recallIDParam(c)
+		if !ok {
+			return
+		}
+
+		recall, err := recallService.CloseRecall(recallID)
+		if err != nil {
+			respondRecallError(c, err, "Failed to close recall")
+			return
+		}
+		c.JSON(http.StatusOK, recall)
+	}
+}
+
+// GetRecallAffected lists the orders and customers affected by a recall
+func GetRecallAffected(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recallID, ok := recallIDParam(c)
+		if !ok {
+			return
+		}
+
+		report, err := recallService.GetRecallReport(recallID)
+		if err != nil {
+			respondRecallError(c, err, "Failed to retrieve affected orders")
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// NotifyRecallCustomers emails the affected customers of a recall who have
+// not been notified yet
+func NotifyRecallCustomers(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recallID, ok := recallIDParam(c)
+		if !ok {
+			return
+		}
+
+		result, err := recallService.NotifyCustomers(recallID)
+		if err != nil {
+			respondRecallError(c, err, "Failed to notify customers")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetRecallReport exports the report of a recall as pdf, csv or json
+func GetRecallReport(recallService *service.RecallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recallID, ok := recallIDParam(c)
+		if !ok {
+			return
+		}
+
+		format := c.DefaultQuery("format", "pdf") // pdf, csv, json
+
+		report, err := recallService.GetRecallReport(recallID)
+		if err != nil {
+			respondRecallError(c, err, "Failed to generate recall report")
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		data, err := recallService.ExportRecallReport(report, format)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recall report: " + err.Error()})
+			return
+		}
+
+		// Set appropriate headers based on format
+		switch format {
+		case "csv":
+			c.Writer.Header().Set("Content-Type", "text/csv")
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=recall-%d.csv", recallID))
+		default:
+			c.Writer.Header().Set("Content-Type", "application/pdf")
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=recall-%d.pdf", recallID))
+		}
+
+		c.Writer.Write(data)
+	}
+}
+
+// recallIDParam reads the recall ID of the route. It responds and returns
+// false when it is invalid.
+func recallIDParam(c *gin.Context) (uint, bool) {
+	recallID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recall ID"})
+		return 0, false
+	}
+	return uint(recallID), true
+}
+
+func respondRecallError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRecallNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRecallClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrProductNotFound), errors.Is(err, service.ErrVariantNotFound), errors.Is(err, service.ErrLotNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetRoles(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := roleService.GetRoles()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roles"})
+			return
+		}
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+func GetRole(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+
+		role, err := roleService.GetRole(uint(roleID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// GetPermissions lists every permission that can be granted to a role
+func GetPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"permissions": models.AllPermissions})
+	}
+}
+
+func CreateRole(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CreateRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		role, err := roleService.CreateRole(req)
+		if err != nil {
+			respondRoleError(c, err, "Failed to create role")
+			return
+		}
+		c.JSON(http.StatusCreated, role)
+	}
+}
+
+func UpdateRole(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+
+		var req models.UpdateRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		role, err := roleService.UpdateRole(uint(roleID), req)
+		if err != nil {
+			respondRoleError(c, err, "Failed to update role")
+			return
+		}
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+func DeleteRole(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+
+		if err := roleService.DeleteRole(uint(roleID)); err != nil {
+			respondRoleError(c, err, "Failed to delete role")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+	}
+}
+
+// respondRoleError maps role service errors to responses
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBuiltInRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -10,7 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// CreateShopRequest allows an admin to create a shop creation request
+// CreateShopRequest lets a user apply for a shop
 func CreateShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("userID").(uint)
@@ -29,7 +31,7 @@ func CreateShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 
 		shopRequest, err := shopService.CreateShopRequest(userID, &req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondShopRequestError(c, err, "Failed to submit shop request")
 			return
 		}
 
@@ -40,63 +42,46 @@ func CreateShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 	}
 }
 
-// GetMyShopRequests allows an admin to view their shop requests
+// GetMyShopRequests lists the shop requests of the current user
 func GetMyShopRequests(shopService *service.ShopService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("userID").(uint)
 
-		requests, err := shopService.GetUserShopRequests(userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shop requests"})
+		params, ok := bindListParams(c, models.ShopRequestListSpec)
+		if !ok {
 			return
 		}
+		delete(params.Filters, "user_id")
 
-		c.JSON(http.StatusOK, requests)
+		page, err := shopService.ListUserShopRequests(userID, params)
+		if err != nil {
+			respondListError(c, err, "Failed to fetch shop requests")
+			return
+		}
+		respondPage(c, newShopRequestPage(page))
 	}
 }
 
-// GetAllShopRequests allows admin to view all shop requests
+// GetAllShopRequests allows admin to view shop requests, optionally filtered by status
 func GetAllShopRequests(shopService *service.ShopService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Optional: filter by status
-		status := c.Query("status")
-
-		var requests []models.ShopRequest
-		var err error
-
-		if status != "" {
-			requests, err = shopService.GetShopRequestsByStatus(status)
-		} else {
-			requests, err = shopService.GetAllShopRequests()
+		params, ok := bindListParams(c, models.ShopRequestListSpec)
+		if !ok {
+			return
 		}
 
+		page, err := shopService.ListShopRequests(params)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shop requests"})
-			return
-		}
-
-		// Transform to response format
-		responses := make([]models.ShopRequestResponse, len(requests))
-		for i, req := range requests {
-			responses[i] = models.ShopRequestResponse{
-				ID:              req.ID,
-				UserID:          req.UserID,
-				Username:        req.User.Username,
-				Email:           req.User.Email,
-				ShopName:        req.ShopName,
-				Description:     req.Description,
-				Status:          req.Status,
-				RejectionReason: req.RejectionReason,
-				CreatedAt:       req.CreatedAt,
-				UpdatedAt:       req.UpdatedAt,
-			}
+			respondListError(c, err, "Failed to fetch shop requests")
+			return
 		}
-
-		c.JSON(http.StatusOK, responses)
+		respondPage(c, newShopRequestPage(page))
 	}
 }
 
-// GetShopRequest allows admin to view a specific shop request
+// GetShopRequest shows a shop request with its documents and comments to its
+// applicant or a reviewer. Access is checked by ShopRequestPolicy on
+// applicant routes.
 func GetShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
@@ -106,26 +91,13 @@ func GetShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 			return
 		}
 
-		shopRequest, err := shopService.GetShopRequestByID(uint(requestID))
+		shopRequest, err := shopService.GetShopRequestDetails(uint(requestID))
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Shop request not found"})
 			return
 		}
 
-		response := models.ShopRequestResponse{
-			ID:              shopRequest.ID,
-			UserID:          shopRequest.UserID,
-			Username:        shopRequest.User.Username,
-			Email:           shopRequest.User.Email,
-			ShopName:        shopRequest.ShopName,
-			Description:     shopRequest.Description,
-			Status:          shopRequest.Status,
-			RejectionReason: shopRequest.RejectionReason,
-			CreatedAt:       shopRequest.CreatedAt,
-			UpdatedAt:       shopRequest.UpdatedAt,
-		}
-
-		c.JSON(http.StatusOK, response)
+		c.JSON(http.StatusOK, newShopRequestResponse(shopRequest))
 	}
 }
 
@@ -139,13 +111,17 @@ func ApproveShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 			return
 		}
 
-		err = shopService.ApproveShopRequest(uint(requestID))
+		reviewerID := c.MustGet("userID").(uint)
+		shop, err := shopService.ApproveShopRequest(uint(requestID), reviewerID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondShopRequestError(c, err, "Failed to approve shop request")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Shop request approved successfully"})
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Shop request approved successfully",
+			"shop":    shop,
+		})
 	}
 }
 
@@ -161,11 +137,19 @@ func RejectShopRequest(shopService *service.ShopService) gin.HandlerFunc {
 
 		var req models.ShopRequestApprovalRequest
 		// Make the body optional - if not provided, use empty reason
-		_ = c.ShouldBindJSON(&req)
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+		if req.Status != "" && req.Status != "rejected" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be rejected, use the approve endpoint to approve a request"})
+			return
+		}
 
-		err = shopService.RejectShopRequest(uint(requestID), req.RejectionReason)
+		reviewerID := c.MustGet("userID").(uint)
+		err = shopService.RejectShopRequest(uint(requestID), reviewerID, req.RejectionReason)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondShopRequestError(c, err, "Failed to reject shop request")
 			return
 		}
 
@@ -283,6 +267,10 @@ func DeleteShop(shopService *service.ShopService) gin.HandlerFunc {
 
 		err = shopService.DeleteShop(uint(shopID))
 		if err != nil {
+			if errors.Is(err, service.ErrShopInUse) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
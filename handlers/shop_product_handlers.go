@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetShopProducts lists the products of an active shop
+func GetShopProducts(shopService *service.ShopService, productService *service.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shopID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+			return
+		}
+
+		// Inactive shops are hidden along with their products
+		shop, err := shopService.GetShopByID(uint(shopID))
+		if err != nil || !shop.IsActive {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			return
+		}
+
+		products, err := productService.GetShopProducts(shop.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"shop_id":  shop.ID,
+			"products": products,
+			"count":    len(products),
+		})
+	}
+}
+
+// CreateShopProduct adds a product to a shop. Access is checked by ShopPolicy.
+func CreateShopProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shopID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+			return
+		}
+
+		var req models.ProductCreateRequest
+		if !bindProductCreateRequest(c, cloudinaryService, &req) {
+			return
+		}
+
+		// Products created here always belong to the shop of the route
+		id := uint(shopID)
+		req.ShopID = &id
+
+		product, err := productService.CreateProduct(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+// UpdateShopProduct updates a product of a shop. Access is checked by ShopPolicy.
+func UpdateShopProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := shopProduct(c, productService)
+		if !ok {
+			return
+		}
+
+		var req models.ProductUpdateRequest
+		if !bindProductUpdateRequest(c, productService, cloudinaryService, product.ID, &req) {
+			return
+		}
+
+		updated, err := productService.UpdateProduct(product.ID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteShopProduct deletes a product of a shop. Access is checked by ShopPolicy.
+func DeleteShopProduct(productService *service.ProductService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := shopProduct(c, productService)
+		if !ok {
+			return
+		}
+
+		if err := productService.DeleteProduct(product.ID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		// Delete image from Cloudinary (ignore errors as product is already deleted)
+		if product.ImageURL != "" {
+			_ = cloudinaryService.DeleteImage(c.Request.Context(), product.ImageURL)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	}
+}
+
+// shopProduct loads the product a shop product route addresses. Products of
+// other shops are not found. It responds and returns false on failure.
+func shopProduct(c *gin.Context, productService *service.ProductService) (*models.Product, bool) {
+	shopID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shop ID"})
+		return nil, false
+	}
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+
+	product, err := productService.GetShopProduct(uint(shopID), uint(productID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+	return product, true
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+	"health-store/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateShopRequest lets the applicant change a pending or rejected shop
+// request. Access is checked by ShopRequestPolicy.
+func UpdateShopRequest(shopService *service.ShopService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		var req models.ShopRequestCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		shopRequest, err := shopService.UpdateShopRequest(uint(requestID), &req)
+		if err != nil {
+			respondShopRequestError(c, err, "Failed to update shop request")
+			return
+		}
+
+		c.JSON(http.StatusOK, newShopRequestResponse(shopRequest))
+	}
+}
+
+// ResubmitShopRequest puts a rejected shop request back up for review.
+// Access is checked by ShopRequestPolicy.
+func ResubmitShopRequest(shopService *service.ShopService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		shopRequest, err := shopService.ResubmitShopRequest(uint(requestID))
+		if err != nil {
+			respondShopRequestError(c, err, "Failed to resubmit shop request")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Shop request resubmitted successfully",
+			"request": newShopRequestResponse(shopRequest),
+		})
+	}
+}
+
+// WithdrawShopRequest takes back a pending or rejected shop request. Access is
+// checked by ShopRequestPolicy.
+func WithdrawShopRequest(shopService *service.ShopService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		shopRequest, err := shopService.WithdrawShopRequest(uint(requestID))
+		if err != nil {
+			respondShopRequestError(c, err, "Failed to withdraw shop request")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Shop request withdrawn successfully",
+			"request": newShopRequestResponse(shopRequest),
+		})
+	}
+}
+
+// UploadShopRequestDocument attaches a document uploaded as the multipart
+// "file" field to a shop request. Access is checked by ShopRequestPolicy.
+func UploadShopRequestDocument(shopService *service.ShopService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		var req models.ShopRequestDocumentUpload
+		req.Type = c.PostForm("type")
+		if err := models.ValidateStruct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A document file is required"})
+			return
+		}
+		defer file.Close()
+
+		url, err := cloudinaryService.UploadDocument(c.Request.Context(), file, header.Filename, "shop-requests")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload document: " + err.Error()})
+			return
+		}
+
+		document, err := shopService.AddShopRequestDocument(uint(requestID), req.Type, header.Filename, url)
+		if err != nil {
+			// The request can no longer take documents, drop the upload
+			_ = cloudinaryService.DeleteImage(c.Request.Context(), url)
+			respondShopRequestError(c, err, "Failed to attach document")
+			return
+		}
+
+		c.JSON(http.StatusCreated, document)
+	}
+}
+
+// DeleteShopRequestDocument removes a document from a shop request. Access is
+// checked by ShopRequestPolicy.
+func DeleteShopRequestDocument(shopService *service.ShopService, cloudinaryService *service.CloudinaryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+		documentID, err := strconv.Atoi(c.Param("documentId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+			return
+		}
+
+		document, err := shopService.DeleteShopRequestDocument(uint(requestID), uint(documentID))
+		if err != nil {
+			respondShopRequestError(c, err, "Failed to delete document")
+			return
+		}
+
+		// Delete the file from Cloudinary (ignore errors as the document is already detached)
+		_ = cloudinaryService.DeleteImage(c.Request.Context(), document.URL)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+	}
+}
+
+// GetShopRequestComments lists the comment log of a shop request. Access is
+// checked by ShopRequestPolicy.
+func GetShopRequestComments(shopService *service.ShopService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		comments, err := shopService.GetShopRequestComments(uint(requestID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"comments": comments,
+			"count":    len(comments),
+		})
+	}
+}
+
+// AddShopRequestComment adds a comment by the applicant or a reviewer to a
+// shop request. Access is checked by ShopRequestPolicy; anyone who is not the
+// applicant comments as a reviewer.
+func AddShopRequestComment(shopService *service.ShopService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+			return
+		}
+
+		var req models.ShopRequestCommentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		if err := models.ValidateStruct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+			return
+		}
+
+		userID := c.MustGet("userID").(uint)
+		isReviewer := !c.GetBool("isResourceOwner")
+
+		comment, err := shopService.AddShopRequestComment(uint(requestID), userID, isReviewer, &req)
+		if err != nil {
+			respondShopRequestError(c, err, "Failed to add comment")
+			return
+		}
+
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+// newShopRequestResponse builds the response of a shop request with selected user fields
+func newShopRequestResponse(shopRequest *models.ShopRequest) models.ShopRequestResponse {
+	return models.ShopRequestResponse{
+		ID:              shopRequest.ID,
+		UserID:          shopRequest.UserID,
+		Username:        shopRequest.User.Username,
+		Email:           shopRequest.User.Email,
+		ShopName:        shopRequest.ShopName,
+		Description:     shopRequest.Description,
+		Status:          shopRequest.Status,
+		RejectionReason: shopRequest.RejectionReason,
+		Submissions:     shopRequest.Submissions,
+		ReviewedAt:      shopRequest.ReviewedAt,
+		Documents:       shopRequest.Documents,
+		Comments:        shopRequest.Comments,
+		CreatedAt:       shopRequest.CreatedAt,
+		UpdatedAt:       shopRequest.UpdatedAt,
+	}
+}
+
+// newShopRequestPage transforms a page of shop requests to the response format
+func newShopRequestPage(page *models.Page[models.ShopRequest]) *models.Page[models.ShopRequestResponse] {
+	responses := make([]models.ShopRequestResponse, len(page.Data))
+	for i := range page.Data {
+		responses[i] = newShopRequestResponse(&page.Data[i])
+	}
+	return &models.Page[models.ShopRequestResponse]{
+		Data:       responses,
+		Count:      page.Count,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func respondShopRequestError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrShopRequestNotFound), errors.Is(err, service.ErrShopRequestDocumentNotFound),
+		errors.Is(err, service.ErrShopRequestCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrShopRequestProcessed), errors.Is(err, service.ErrShopRequestNotEditable),
+		errors.Is(err, service.ErrShopRequestNotRejected), errors.Is(err, service.ErrShopRequestIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTooManyShopRequests):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"health-store/auth/token"
 	"health-store/config"
+	"health-store/middleware"
 	"health-store/models"
 	"health-store/repositories"
 	"health-store/routes"
@@ -51,6 +54,24 @@ func main() {
 	utils.Info("Starting Medical Equipment Online Store Backend")
 	utils.Infof("Environment: %s", cfg.Server.Env)
 
+	if err := cfg.Validate(); err != nil {
+		utils.LogError(err, "Invalid configuration")
+		log.Fatal("Invalid configuration:", err)
+	}
+
+	// Initialize token manager shared by the auth service and middleware
+	tokenManager, err := token.NewManager(cfg.JWT)
+	if err != nil {
+		utils.LogError(err, "Failed to initialize token manager")
+		log.Fatal("Failed to initialize token manager:", err)
+	}
+	middleware.SetTokenManager(tokenManager)
+	utils.Infof("Token manager initialized: %s (kid %s)", cfg.JWT.SigningMethod, cfg.JWT.KeyID)
+	if cfg.Security.RequireAdminMFA {
+		middleware.SetMFARequiredRoles("admin")
+		utils.Info("MFA required for admin role")
+	}
+
 	// Database connection
 	DB, err = gorm.Open(mysql.Open(cfg.GetDatabaseDSN()), &gorm.Config{})
 	if err != nil {
@@ -60,24 +81,60 @@ func main() {
 
 	utils.Info("Database connection successful.")
 
+	// Accounts created before email verification existed are treated as verified
+	backfillEmailVerified := !DB.Migrator().HasColumn(&models.User{}, "email_verified")
+
 	// Auto-migrate the schema
 	err = DB.AutoMigrate(
 		&models.User{},
 		&models.Category{},
 		&models.Product{},
+		&models.ProductVariant{},
+		&models.InventoryLot{},
 		&models.Cart{},
 		&models.CartItem{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderItemLot{},
+		&models.Prescription{},
+		&models.StockMovement{},
+		&models.StockDiscrepancy{},
+		&models.LowStockNotification{},
+		&models.Recall{},
+		&models.RecallItem{},
+		&models.RecallNotification{},
+		&models.ShopOrder{},
 		&models.Feedback{},
 		&models.ShopRequest{},
+		&models.ShopRequestDocument{},
+		&models.ShopRequestComment{},
 		&models.Shop{},
 		&models.GuestBook{},
+		&models.PaymentWebhookEvent{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.UserToken{},
+		&models.LoginThrottle{},
+		&models.AuditLog{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.RolePermission{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.CommissionRule{},
+		&models.PayoutBatch{},
+		&models.Payout{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	if backfillEmailVerified {
+		if err := DB.Model(&models.User{}).Where("1 = 1").Update("email_verified", true).Error; err != nil {
+			log.Fatal("Failed to backfill email verification:", err)
+		}
+	}
+
 	fmt.Println("Database migration successful.")
 
 	// Initialize repositories
@@ -90,6 +147,17 @@ func main() {
 	shopRequestRepo := repositories.NewShopRequestRepository(DB)
 	shopRepo := repositories.NewShopRepository(DB)
 	guestBookRepo := repositories.NewGuestBookRepository(DB)
+	paymentEventRepo := repositories.NewPaymentEventRepository(DB)
+	tokenRepo := repositories.NewTokenRepository(DB)
+	securityRepo := repositories.NewSecurityRepository(DB)
+	mfaRepo := repositories.NewMFARepository(DB)
+	roleRepo := repositories.NewRoleRepository(DB)
+	ledgerRepo := repositories.NewLedgerRepository(DB)
+	inventoryRepo := repositories.NewInventoryRepository(DB)
+	recallRepo := repositories.NewRecallRepository(DB)
+	prescriptionRepo := repositories.NewPrescriptionRepository(DB)
+	stockMovementRepo := repositories.NewStockMovementRepository(DB)
+	unitOfWork := repositories.NewUnitOfWork(DB)
 
 	// Initialize Cloudinary service
 	cloudinaryService, err := service.NewCloudinaryService(cfg.Storage.CloudinaryURL)
@@ -99,16 +167,71 @@ func main() {
 	}
 	utils.Info("Cloudinary service initialized successfully")
 
+	// Initialize payment gateway
+	paymentGateway, err := service.NewPaymentGateway(cfg.Payment)
+	if err != nil {
+		utils.LogError(err, "Failed to initialize payment gateway")
+		log.Fatal("Failed to initialize payment gateway:", err)
+	}
+	utils.Infof("Payment gateway initialized: %s", paymentGateway.Name())
+
+	// Initialize mailer
+	mailer, err := service.NewMailer(cfg.Mail)
+	if err != nil {
+		utils.LogError(err, "Failed to initialize mailer")
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+	utils.Infof("Mailer initialized: %s", cfg.Mail.Driver)
+	stockAlertNotifier := service.NewStockAlertNotifier(mailer, cfg.Inventory.AlertEmails)
+
 	// Initialize services
 	userService := service.NewUserService(userRepo)
-	productService := service.NewProductService(productRepo, categoryRepo)
-	orderService := service.NewOrderService(orderRepo, cartRepo, productRepo)
-	cartService := service.NewCartService(cartRepo, productRepo)
+	authService := service.NewAuthService(tokenRepo, userRepo, tokenManager, cfg.JWT)
+	accountService := service.NewAccountService(userRepo, tokenRepo, mailer, cfg.Account)
+	loginGuard := service.NewLoginGuard(securityRepo, userRepo, cfg.Security)
+	mfaService := service.NewMFAService(mfaRepo, userRepo, tokenManager, cfg.Security)
+	roleService := service.NewRoleService(roleRepo, middleware.InvalidateRoleCache)
+	productService := service.NewProductService(productRepo, categoryRepo, cartRepo, inventoryRepo, shopRepo, unitOfWork)
+	ledgerService := service.NewLedgerService(ledgerRepo, shopRepo, categoryRepo, unitOfWork, cfg.Market)
+	orderService := service.NewOrderService(orderRepo, cartRepo, productRepo, unitOfWork, paymentGateway, ledgerService)
+	inventoryService := service.NewInventoryService(inventoryRepo, productRepo, stockMovementRepo, unitOfWork, stockAlertNotifier, cfg.Inventory)
+	recallService := service.NewRecallService(recallRepo, unitOfWork, mailer)
+	prescriptionService := service.NewPrescriptionService(prescriptionRepo, unitOfWork, orderService, mailer)
+	cartService := service.NewCartService(cartRepo, productRepo, unitOfWork, cfg.Cart.ReservationTTL, cfg.Cart.GuestTokenTTL)
 	categoryService := service.NewCategoryService(categoryRepo)
 	feedbackService := service.NewFeedbackService(feedbackRepo)
 	reportService := service.NewReportService(orderRepo, productRepo, userRepo)
-	shopService := service.NewShopService(shopRequestRepo, shopRepo)
+	shopService := service.NewShopService(shopRequestRepo, shopRepo, userRepo, unitOfWork, mailer, cfg.Market.MaxPendingShopRequests)
 	guestBookService := service.NewGuestBookService(guestBookRepo)
+	paymentWebhookService := service.NewPaymentWebhookService(paymentEventRepo, paymentGateway, orderService)
+
+	// Seed the built-in roles, then serve permissions from the roles table
+	if err := roleService.SeedDefaultRoles(); err != nil {
+		log.Fatal("Failed to seed roles:", err)
+	}
+	middleware.SetRoleLoader(roleRepo.FindAll, cfg.Security.RoleCacheTTL)
+
+	// Start the stock ledger of products created before it existed, before
+	// legacy carts return their stock through it
+	if opened, err := inventoryService.RecordOpeningStock(); err != nil {
+		log.Fatal("Failed to record opening stock:", err)
+	} else if opened > 0 {
+		utils.Infof("Recorded opening stock for %d products", opened)
+	}
+
+	// Convert carts created before reservations existed, then start releasing
+	// expired reservations in the background
+	if converted, err := cartService.MigrateLegacyReservations(); err != nil {
+		log.Fatal("Failed to migrate cart reservations:", err)
+	} else if converted > 0 {
+		utils.Infof("Converted %d legacy cart items into reservations", converted)
+	}
+	cartService.StartReservationSweeper(context.Background(), cfg.Cart.ReservationSweepInterval)
+	authService.StartTokenCleanup(context.Background(), cfg.JWT.CleanupInterval)
+	loginGuard.StartCleanup(context.Background(), cfg.Security.LoginFailureWindow)
+	ledgerService.StartPayoutScheduler(context.Background(), cfg.Market.PayoutInterval)
+	inventoryService.StartStockReconciler(context.Background(), cfg.Inventory.ReconcileInterval)
+	inventoryService.StartLowStockMonitor(context.Background(), cfg.Inventory.LowStockInterval)
 
 	// Initialize Gin router
 	r := gin.Default()
@@ -117,8 +240,8 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5176", "http://localhost:5000", "http://localhost:5173", "http://localhost:5174", "http://localhost:5175"}, // frontend URLs
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Cart-Token"},
+		ExposeHeaders:    []string{"Content-Length", "X-Cart-Token"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -127,7 +250,10 @@ func main() {
 	routes.SetupRoutes(
 		r,
 		DB,
+		tokenManager,
 		userService,
+		authService,
+		accountService,
 		productService,
 		categoryService,
 		orderService,
@@ -137,6 +263,14 @@ func main() {
 		cloudinaryService,
 		shopService,
 		guestBookService,
+		paymentWebhookService,
+		loginGuard,
+		mfaService,
+		roleService,
+		ledgerService,
+		inventoryService,
+		recallService,
+		prescriptionService,
 	)
 
 	fmt.Printf("Starting server on port %s...\n", cfg.Server.Port)
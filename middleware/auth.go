@@ -2,31 +2,32 @@ package middleware
 
 import (
 	"net/http"
-	"os"
 	"strings"
 
+	"health-store/auth/token"
 	"health-store/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(getJWTSecret())
+var tokenManager *token.Manager
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET_KEY")
-	if secret == "" {
-		// Fallback to a more secure default secret
-		secret = "your-super-secret-jwt-key-change-this-in-production-2024"
-	}
-	return secret
+// mfaRequiredRoles are the roles that must pass a second factor before they are admitted
+var mfaRequiredRoles = map[string]bool{}
+
+// SetTokenManager sets the token manager used to verify access tokens
+func SetTokenManager(m *token.Manager) {
+	tokenManager = m
 }
 
-type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	jwt.RegisteredClaims
+// SetMFARequiredRoles sets the roles whose access tokens must show a passed
+// second factor
+func SetMFARequiredRoles(roles ...string) {
+	mfaRequiredRoles = map[string]bool{}
+	for _, role := range roles {
+		mfaRequiredRoles[role] = true
+	}
 }
 
 func AuthMiddleware(db *gorm.DB, allowedRoles ...string) gin.HandlerFunc {
@@ -38,51 +39,132 @@ func AuthMiddleware(db *gorm.DB, allowedRoles ...string) gin.HandlerFunc {
 			return
 		}
 
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+		if !authenticate(c, db, tokenString, allowedRoles, true) {
+			return
+		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		c.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// AuthMiddlewareWithoutMFA works like AuthMiddleware but admits users whose
+// role requires MFA before they passed it, so they can enroll and log out
+func AuthMiddlewareWithoutMFA(db *gorm.DB, allowedRoles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
 			return
 		}
 
-		var user models.User
-		if err := db.Where("username = ?", claims.Username).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
+		if !authenticate(c, db, tokenString, allowedRoles, false) {
 			return
 		}
 
-		// Set user info in context
-		c.Set("userID", user.ID)
+		c.Next()
+	}
+}
 
-		// Handle missing role - default to customer if empty
-		userRole := user.Role
-		if userRole == "" {
-			userRole = "customer" // Default role
-		}
-		c.Set("userRole", userRole)
-
-		// Check authorization
-		authorized := false
-		for _, role := range allowedRoles {
-			if userRole == role {
-				authorized = true
-				break
-			}
+// OptionalAuthMiddleware authenticates the request when an Authorization
+// header is present and otherwise lets it through as the "guest" role.
+// An invalid token is still rejected rather than silently treated as a guest.
+func OptionalAuthMiddleware(db *gorm.DB, allowedRoles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			c.Set("userRole", "guest")
+			c.Next()
+			return
 		}
 
-		if !authorized {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User role not found or not authorized"})
-			c.Abort()
+		if !authenticate(c, db, tokenString, allowedRoles, true) {
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// authenticate validates the bearer token, loads the user into the context
+// and checks the user's role and, when enforceMFA is set, whether the role
+// requires a second factor. It aborts the request and returns false on failure.
+func authenticate(c *gin.Context, db *gorm.DB, tokenString string, allowedRoles []string, enforceMFA bool) bool {
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+	// Tokens with a purpose, such as mfa pending tokens, are not access tokens
+	claims, err := tokenManager.Parse(tokenString)
+	if err != nil || claims.Purpose != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+
+	// Tokens carrying an ID can be revoked on logout
+	if claims.ID != "" {
+		var revoked int64
+		if err := db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			c.Abort()
+			return false
+		}
+		if revoked > 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return false
+		}
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", claims.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Abort()
+		return false
+	}
+
+	// Set user info in context
+	c.Set("userID", user.ID)
+	c.Set("tokenID", claims.ID)
+	c.Set("mfaVerified", claims.MFA)
+	if claims.ExpiresAt != nil {
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+	}
+
+	// Handle missing role - default to customer if empty
+	userRole := user.Role
+	if userRole == "" {
+		userRole = "customer" // Default role
+	}
+	c.Set("userRole", userRole)
+
+	// Custom roles are admitted wherever their base role is
+	base, err := baseRole(userRole)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load role"})
+		c.Abort()
+		return false
+	}
+
+	// Check authorization
+	authorized := false
+	for _, role := range allowedRoles {
+		if userRole == role || base == role {
+			authorized = true
+			break
+		}
+	}
+
+	if !authorized {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User role not found or not authorized"})
+		c.Abort()
+		return false
+	}
+
+	if enforceMFA && (mfaRequiredRoles[userRole] || mfaRequiredRoles[base]) && !claims.MFA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Multi-factor authentication required", "code": "MFA_REQUIRED"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"health-store/auth/token"
+	"health-store/config"
+	"health-store/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestAuth opens an in-memory database holding one user with role and
+// sets up the token manager the middleware verifies tokens with
+func newTestAuth(t *testing.T, role string) *gorm.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.RevokedToken{}); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	if err := db.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: "hash", Role: role}).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	m, err := token.NewManager(config.JWTConfig{SigningMethod: "HS256", KeyID: "test", SecretKey: "test-secret-of-at-least-32-characters"})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	SetTokenManager(m)
+	t.Cleanup(func() { SetTokenManager(nil) })
+	return db
+}
+
+func signTestToken(t *testing.T, role, jti string, mfa bool) string {
+	t.Helper()
+	signed, err := tokenManager.Sign(&token.Claims{
+		Username: "alice",
+		Role:     role,
+		MFA:      mfa,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+// serveAuthenticated sends a request carrying accessToken through handler
+// and returns the response
+func serveAuthenticated(handler gin.HandlerFunc, accessToken string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/", handler, func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddlewareRejectsRevokedToken(t *testing.T) {
+	db := newTestAuth(t, "customer")
+	handler := AuthMiddleware(db, "customer")
+	accessToken := signTestToken(t, "customer", "jti-1", false)
+
+	if w := serveAuthenticated(handler, accessToken); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if err := db.Create(&models.RevokedToken{JTI: "jti-1", ExpiresAt: time.Now().Add(time.Hour)}).Error; err != nil {
+		t.Fatalf("revoke token: %v", err)
+	}
+	w := serveAuthenticated(handler, accessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body.String())
+	}
+
+	// Other tokens of the same user are still accepted
+	if w := serveAuthenticated(handler, signTestToken(t, "customer", "jti-2", false)); w.Code != http.StatusOK {
+		t.Errorf("other token status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serveAuthenticated(handler, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddlewareRequiresMFAForAdmins(t *testing.T) {
+	db := newTestAuth(t, "admin")
+	SetMFARequiredRoles("admin")
+	t.Cleanup(func() { SetMFARequiredRoles() })
+
+	tests := []struct {
+		name     string
+		handler  gin.HandlerFunc
+		mfa      bool
+		wantCode int
+	}{
+		{name: "without second factor", handler: AuthMiddleware(db, "admin"), wantCode: http.StatusForbidden},
+		{name: "with second factor", handler: AuthMiddleware(db, "admin"), mfa: true, wantCode: http.StatusOK},
+		{name: "enrollment routes", handler: AuthMiddlewareWithoutMFA(db, "admin"), wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAuthenticated(tt.handler, signTestToken(t, "admin", "", tt.mfa))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode == http.StatusForbidden && !strings.Contains(w.Body.String(), `"MFA_REQUIRED"`) {
+				t.Errorf("body = %s, want code MFA_REQUIRED", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareAdmitsOtherRolesWithoutMFA(t *testing.T) {
+	db := newTestAuth(t, "customer")
+	SetMFARequiredRoles("admin")
+	t.Cleanup(func() { SetMFARequiredRoles() })
+
+	if w := serveAuthenticated(AuthMiddleware(db, "customer"), signTestToken(t, "customer", "", false)); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"health-store/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrResourceNotFound is returned by Policy.Owns when the resource does not exist
+var ErrResourceNotFound = errors.New("resource not found")
+
+// Denial reasons reported in 403 responses
+const (
+	ReasonNotOwner             = "not_owner"                    // owner-only route
+	ReasonNotOwnerNoPermission = "not_owner_without_permission" // neither owner nor holding the permission
+)
+
+// Policy describes who may act on the resource a route addresses: its owner,
+// or anyone whose role holds Permission
+type Policy struct {
+	Resource   string            // name used in responses, e.g. "shop"
+	Param      string            // route parameter holding the resource ID, "id" when empty
+	Permission models.Permission // lets non-owners through; empty for owner-only routes
+	// Owns reports whether the caller owns the resource. It returns
+	// ErrResourceNotFound when the resource does not exist.
+	Owns func(c *gin.Context, id uint) (bool, error)
+}
+
+// Authorize creates middleware enforcing a policy. Owners and holders of the
+// policy's permission pass; everyone else gets 403 with a structured reason.
+// The outcome is stored in the context as "isResourceOwner".
+func Authorize(policy Policy) gin.HandlerFunc {
+	param := policy.Param
+	if param == "" {
+		param = "id"
+	}
+
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + policy.Resource + " ID"})
+			c.Abort()
+			return
+		}
+
+		owns, err := policy.Owns(c, uint(id))
+		if err != nil {
+			if errors.Is(err, ErrResourceNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": capitalize(policy.Resource) + " not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access to " + policy.Resource})
+			}
+			c.Abort()
+			return
+		}
+		c.Set("isResourceOwner", owns)
+		if owns {
+			c.Next()
+			return
+		}
+
+		reason := ReasonNotOwner
+		if policy.Permission != "" {
+			allowed, err := hasPermission(c.GetString("userRole"), policy.Permission)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				c.Abort()
+				return
+			}
+			if allowed {
+				c.Next()
+				return
+			}
+			reason = ReasonNotOwnerNoPermission
+		}
+
+		response := gin.H{
+			"error":       "You are not allowed to access this " + policy.Resource,
+			"code":        "FORBIDDEN",
+			"reason":      reason,
+			"resource":    policy.Resource,
+			"resource_id": id,
+		}
+		if policy.Permission != "" {
+			response["required"] = "owner or " + string(policy.Permission)
+		} else {
+			response["required"] = "owner"
+		}
+		c.JSON(http.StatusForbidden, response)
+		c.Abort()
+	}
+}
+
+// capitalize upper-cases the first letter of an ASCII resource name
+func capitalize(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
@@ -8,7 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RequirePermission creates middleware that requires specific permissions
+// RequirePermission creates middleware that requires specific permissions.
+// Role permissions come from the role cache (see SetRoleLoader).
 func RequirePermission(permission models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("userRole")
@@ -19,7 +20,13 @@ func RequirePermission(permission models.Permission) gin.HandlerFunc {
 		}
 
 		role := userRole.(string)
-		if !models.HasPermission(role, permission) {
+		allowed, err := hasPermission(role, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error":    "Insufficient permissions",
 				"required": string(permission),
@@ -44,16 +51,22 @@ func RequireAnyPermission(permissions ...models.Permission) gin.HandlerFunc {
 		}
 
 		role := userRole.(string)
-		hasPermission := false
+		granted := false
 
 		for _, permission := range permissions {
-			if models.HasPermission(role, permission) {
-				hasPermission = true
+			allowed, err := hasPermission(role, permission)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				c.Abort()
+				return
+			}
+			if allowed {
+				granted = true
 				break
 			}
 		}
 
-		if !hasPermission {
+		if !granted {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error":    "Insufficient permissions",
 				"required": "any of " + permissionsString(permissions),
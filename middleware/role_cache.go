@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"health-store/models"
+)
+
+// RoleLoader loads every role with its permissions
+type RoleLoader func() ([]models.Role, error)
+
+// cachedRole is the part of a role the middleware needs for each request
+type cachedRole struct {
+	baseRole    string
+	permissions map[models.Permission]bool
+}
+
+// roleCache keeps roles in memory so permission checks do not hit the
+// database on every request. It is reloaded after ttl, so changes made by
+// other instances are picked up, and immediately after InvalidateRoleCache.
+type roleCache struct {
+	mu       sync.RWMutex
+	loader   RoleLoader
+	ttl      time.Duration
+	roles    map[string]cachedRole
+	loadedAt time.Time
+}
+
+var roles = &roleCache{}
+
+// SetRoleLoader sets where roles are loaded from and how long they are cached.
+// Until it is called, the built-in default permissions are used.
+func SetRoleLoader(loader RoleLoader, ttl time.Duration) {
+	roles.mu.Lock()
+	defer roles.mu.Unlock()
+	roles.loader = loader
+	roles.ttl = ttl
+	roles.roles = nil
+}
+
+// InvalidateRoleCache drops the cached roles so the next request reloads them
+func InvalidateRoleCache() {
+	roles.mu.Lock()
+	defer roles.mu.Unlock()
+	roles.roles = nil
+}
+
+// lookup returns the cached role with the given name
+func (rc *roleCache) lookup(name string) (cachedRole, bool, error) {
+	rc.mu.RLock()
+	if rc.loader == nil {
+		rc.mu.RUnlock()
+		return defaultRole(name)
+	}
+	if rc.roles != nil && time.Since(rc.loadedAt) < rc.ttl {
+		role, ok := rc.roles[name]
+		rc.mu.RUnlock()
+		return role, ok, nil
+	}
+	rc.mu.RUnlock()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	// Another request may have reloaded while waiting for the lock
+	if rc.roles == nil || time.Since(rc.loadedAt) >= rc.ttl {
+		loaded, err := rc.loader()
+		if err != nil {
+			return cachedRole{}, false, err
+		}
+
+		rc.roles = make(map[string]cachedRole, len(loaded))
+		for _, r := range loaded {
+			permissions := make(map[models.Permission]bool, len(r.Grants))
+			for _, grant := range r.Grants {
+				permissions[grant.Permission] = true
+			}
+			rc.roles[r.Name] = cachedRole{baseRole: r.BaseRole, permissions: permissions}
+		}
+		rc.loadedAt = time.Now()
+	}
+
+	role, ok := rc.roles[name]
+	return role, ok, nil
+}
+
+// defaultRole builds a role from the built-in default permissions
+func defaultRole(name string) (cachedRole, bool, error) {
+	defaults, ok := models.RolePermissions[name]
+	if !ok {
+		return cachedRole{}, false, nil
+	}
+
+	permissions := make(map[models.Permission]bool, len(defaults))
+	for _, p := range defaults {
+		permissions[p] = true
+	}
+	return cachedRole{baseRole: models.BuiltInBaseRole(name), permissions: permissions}, true, nil
+}
+
+// hasPermission reports whether a role has been granted permission
+func hasPermission(roleName string, permission models.Permission) (bool, error) {
+	role, ok, err := roles.lookup(roleName)
+	if err != nil || !ok {
+		return false, err
+	}
+	return role.permissions[permission], nil
+}
+
+// baseRole returns the built-in role whose routes a role is admitted to
+func baseRole(roleName string) (string, error) {
+	role, ok, err := roles.lookup(roleName)
+	if err != nil || !ok {
+		return roleName, err
+	}
+	return role.baseRole, nil
+}
@@ -1,9 +1,26 @@
 package models
 
+import "time"
+
 type CartItem struct {
 	ID        uint    `gorm:"primaryKey" json:"id"`
 	CartID    uint    `gorm:"column:cart_id;not null" json:"cart_id"`
 	ProductID uint    `gorm:"column:product_id;not null" json:"product_id"`
 	Product   Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  int     `gorm:"column:quantity;not null" json:"quantity"`
+	// VariantID is the variant bought, required for products with variants
+	VariantID *uint           `gorm:"column:variant_id;index" json:"variant_id,omitempty"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  int             `gorm:"column:quantity;not null" json:"quantity"`
+	// Stock held for this line until ReservedUntil; released (set to 0) by the sweeper once expired
+	ReservedQuantity int        `gorm:"column:reserved_quantity;not null;default:0" json:"reserved_quantity"`
+	ReservedUntil    *time.Time `gorm:"column:reserved_until;index" json:"reserved_until,omitempty"`
+}
+
+// UnitPrice returns the price of one unit of the line: the price of its
+// variant, or of its product when it has none. Product and Variant must be loaded.
+func (i *CartItem) UnitPrice() float64 {
+	if i.Variant != nil {
+		return i.Variant.Price
+	}
+	return i.Product.Price
 }
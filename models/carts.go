@@ -3,10 +3,62 @@ package models
 import "time"
 
 type Cart struct {
-	ID        uint       `gorm:"primaryKey" json:"id"`
-	UserID    uint       `gorm:"column:user_id;not null;index" json:"user_id"`
-	User      User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	CartItems []CartItem `gorm:"foreignKey:CartID" json:"items,omitempty"`
-	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	ID     uint  `gorm:"primaryKey" json:"id"`
+	UserID *uint `gorm:"column:user_id;index" json:"user_id"`
+	User   User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	// GuestToken identifies an anonymous visitor's cart; nil for user carts
+	GuestToken *string    `gorm:"column:guest_token;size:64;uniqueIndex" json:"-"`
+	CartItems  []CartItem `gorm:"foreignKey:CartID" json:"items,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// CartOwner identifies whose cart an operation applies to: a registered user
+// or an anonymous visitor holding a guest cart token
+type CartOwner struct {
+	UserID     uint
+	GuestToken string
+}
+
+// IsGuest reports whether the owner is an anonymous visitor
+func (o CartOwner) IsGuest() bool {
+	return o.UserID == 0
+}
+
+// CartItemQuantityUpdateRequest represents the request payload for changing the quantity of a cart line.
+// A quantity of 0 removes the line.
+type CartItemQuantityUpdateRequest struct {
+	Quantity int `json:"quantity" validate:"gte=0,lte=1000"`
+}
+
+// CartItemResponse is a cart line with its subtotal computed server-side
+type CartItemResponse struct {
+	CartItem
+	Subtotal float64 `json:"subtotal"`
+}
+
+// CartResponse is the cart returned to clients, with per-line subtotals and the cart total
+type CartResponse struct {
+	ID        uint               `json:"id"`
+	UserID    *uint              `json:"user_id"`
+	Items     []CartItemResponse `json:"items"`
+	ItemCount int                `json:"item_count"`
+	Total     float64            `json:"total"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// CartMergeAdjustment describes a guest cart line that could not be merged in full
+// because the stock was no longer available
+type CartMergeAdjustment struct {
+	ProductID uint  `json:"product_id"`
+	VariantID *uint `json:"variant_id,omitempty"`
+	Requested int   `json:"requested"`
+	Quantity  int   `json:"quantity"` // quantity kept in the user's cart, 0 if the line was dropped
+}
+
+// CartMergeResult summarizes merging a guest cart into a user's cart on login
+type CartMergeResult struct {
+	MergedItems int                   `json:"merged_items"`
+	Adjustments []CartMergeAdjustment `json:"adjustments,omitempty"`
 }
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// InventoryLot is a batch of a product, or of one of its variants, received
+// into stock. Once a product has lots its units are sold from the lots that
+// have not expired, earliest expiry first.
+type InventoryLot struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ProductID uint            `gorm:"column:product_id;not null;index:idx_inventory_lots_fefo,priority:1" json:"product_id"`
+	Product   *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	VariantID *uint           `gorm:"column:variant_id;index" json:"variant_id,omitempty"` // set for products with variants
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	LotNumber string          `gorm:"column:lot_number;size:64;not null" json:"lot_number"`
+	// ExpiryDate is the last day the lot may be sold
+	ExpiryDate time.Time `gorm:"column:expiry_date;type:date;not null;index:idx_inventory_lots_fefo,priority:2" json:"expiry_date"`
+	// Quantity is the number of units left in the lot
+	Quantity   int       `gorm:"column:quantity;not null" json:"quantity"`
+	ReceivedAt time.Time `gorm:"column:received_at;type:date;not null" json:"received_at"`
+	// RecallID is set once the lot is recalled. Its units are taken out of
+	// stock and never sold.
+	RecallID  *uint     `gorm:"column:recall_id;index" json:"recall_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsExpired reports whether the lot may no longer be sold on the day of now
+func (l *InventoryLot) IsExpired(now time.Time) bool {
+	year, month, day := now.Date()
+	return l.ExpiryDate.Before(time.Date(year, month, day, 0, 0, 0, 0, l.ExpiryDate.Location()))
+}
+
+// OrderItemLot records how many units of an order item were taken from a lot
+type OrderItemLot struct {
+	ID          uint          `gorm:"primaryKey" json:"-"`
+	OrderItemID uint          `gorm:"column:order_item_id;not null;index" json:"-"`
+	LotID       uint          `gorm:"column:lot_id;not null;index" json:"lot_id"`
+	LotNumber   string        `gorm:"column:lot_number;size:64;not null" json:"lot_number"`
+	ExpiryDate  time.Time     `gorm:"column:expiry_date;type:date;not null" json:"expiry_date"`
+	Quantity    int           `gorm:"column:quantity;not null" json:"quantity"`
+	Lot         *InventoryLot `gorm:"foreignKey:LotID" json:"-"`
+}
+
+// InventoryLotCreateRequest represents the request payload for receiving a lot into stock
+type InventoryLotCreateRequest struct {
+	VariantID  *uint  `json:"variant_id,omitempty"` // required for products with variants
+	LotNumber  string `json:"lot_number" validate:"required,max=64"`
+	ExpiryDate string `json:"expiry_date" validate:"required"` // YYYY-MM-DD
+	Quantity   int    `json:"quantity" validate:"required,gt=0"`
+	ReceivedAt string `json:"received_at,omitempty"` // YYYY-MM-DD, defaults to today
+}
+
+// InventoryLotUpdateRequest represents the request payload for correcting a
+// lot. Fields left out are not changed.
+type InventoryLotUpdateRequest struct {
+	LotNumber  string `json:"lot_number,omitempty" validate:"omitempty,max=64"`
+	ExpiryDate string `json:"expiry_date,omitempty"` // YYYY-MM-DD
+	Quantity   *int   `json:"quantity,omitempty" validate:"omitempty,gte=0"`
+}
+
+// ExpiringLot is a lot with units left that expires within the reporting window
+type ExpiringLot struct {
+	InventoryLot
+	ProductName string `json:"product_name"`
+	SKU         string `json:"sku,omitempty"`
+	DaysLeft    int    `json:"days_left"` // negative once expired
+	Expired     bool   `json:"expired"`
+}
+
+// ExpiringLotsReport lists the lots expiring within Days days, soonest first
+type ExpiringLotsReport struct {
+	Days        int           `json:"days"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Lots        []ExpiringLot `json:"lots"`
+	Count       int           `json:"count"`
+	Units       int           `json:"units"` // units left across the lots
+}
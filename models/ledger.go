@@ -0,0 +1,132 @@
+package models
+
+import "time"
+
+// Ledger accounts. Entries on seller_payable always carry the shop they are owed to.
+const (
+	LedgerAccountCash             = "platform_cash"      // money collected from customers
+	LedgerAccountSellerPayable    = "seller_payable"     // money owed to shops
+	LedgerAccountCommission       = "commission_revenue" // platform commission on shop sales
+	LedgerAccountStoreSales       = "store_sales"        // sales of products sold by the store itself
+	LedgerAccountPayoutsInTransit = "payouts_in_transit" // payouts sent to shops but not confirmed yet
+)
+
+// Ledger transaction types
+const (
+	LedgerTypeSale          = "sale"
+	LedgerTypeRefund        = "refund"
+	LedgerTypePayout        = "payout"
+	LedgerTypePayoutSettled = "payout_settled"
+	LedgerTypePayoutFailed  = "payout_failed"
+)
+
+// LedgerTransaction groups the entries of one financial event. The debits
+// and credits of its entries always balance.
+type LedgerTransaction struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	Type        string        `gorm:"size:30;not null;index" json:"type"`
+	OrderID     *uint         `gorm:"index" json:"order_id,omitempty"`
+	ShopOrderID *uint         `gorm:"index" json:"shop_order_id,omitempty"`
+	ShopID      *uint         `gorm:"index" json:"shop_id,omitempty"`
+	PayoutID    *uint         `gorm:"index" json:"payout_id,omitempty"`
+	Description string        `json:"description"`
+	Entries     []LedgerEntry `gorm:"foreignKey:TransactionID" json:"entries,omitempty"`
+	CreatedAt   time.Time     `gorm:"index" json:"created_at"`
+}
+
+// LedgerEntry debits or credits one account
+type LedgerEntry struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	TransactionID uint      `gorm:"not null;index" json:"transaction_id"`
+	Account       string    `gorm:"size:50;not null;index" json:"account"`
+	ShopID        *uint     `gorm:"index" json:"shop_id,omitempty"`
+	Debit         float64   `gorm:"not null;default:0" json:"debit"`
+	Credit        float64   `gorm:"not null;default:0" json:"credit"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CommissionRule sets the platform commission for a shop or a category.
+// Shop rules take precedence over category rules, which take precedence
+// over the configured default rate.
+type CommissionRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ShopID     *uint     `gorm:"uniqueIndex" json:"shop_id,omitempty"`
+	CategoryID *uint     `gorm:"uniqueIndex" json:"category_id,omitempty"`
+	Rate       float64   `gorm:"not null" json:"rate"` // fraction of the sale, e.g. 0.1 for 10%
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CommissionRuleRequest creates or replaces the commission rule of a shop or category
+type CommissionRuleRequest struct {
+	ShopID     *uint    `json:"shop_id,omitempty"`
+	CategoryID *uint    `json:"category_id,omitempty"`
+	Rate       *float64 `json:"rate" validate:"required,gte=0,lte=1"`
+}
+
+// PayoutBatch pays out the balances owed to shops at one point in time
+type PayoutBatch struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"` // processing, completed
+	TotalAmount float64    `gorm:"not null" json:"total_amount"`
+	PayoutCount int        `gorm:"not null" json:"payout_count"`
+	Payouts     []Payout   `gorm:"foreignKey:BatchID" json:"payouts,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Payout is the money sent to one shop in a batch
+type Payout struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	BatchID       uint       `gorm:"not null;index" json:"batch_id"`
+	ShopID        uint       `gorm:"not null;index" json:"shop_id"`
+	Amount        float64    `gorm:"not null" json:"amount"`
+	Status        string     `gorm:"size:20;not null;index" json:"status"` // pending, paid, failed
+	Reference     string     `json:"reference,omitempty"`                  // bank or provider reference of the transfer
+	FailureReason string     `json:"failure_reason,omitempty"`
+	SettledAt     *time.Time `json:"settled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// PayoutStatusRequest records the outcome of a payout
+type PayoutStatusRequest struct {
+	Status        string `json:"status" validate:"required,oneof=paid failed"`
+	Reference     string `json:"reference,omitempty" validate:"max=255"`
+	FailureReason string `json:"failure_reason,omitempty" validate:"max=255"`
+}
+
+// SellerBalance is the amount currently owed to a shop
+type SellerBalance struct {
+	ShopID  uint    `json:"shop_id"`
+	Balance float64 `json:"balance"`
+}
+
+// SellerStatement lists the ledger activity of a shop over a period
+type SellerStatement struct {
+	ShopID         uint                  `json:"shop_id"`
+	ShopName       string                `json:"shop_name"`
+	StartDate      *string               `json:"start_date,omitempty"`
+	EndDate        *string               `json:"end_date,omitempty"`
+	OpeningBalance float64               `json:"opening_balance"`
+	Sales          float64               `json:"sales"`      // gross sales
+	Commission     float64               `json:"commission"` // commission kept by the platform, net of refunds
+	Refunds        float64               `json:"refunds"`    // gross refunds
+	Payouts        float64               `json:"payouts"`    // paid out, net of failed payouts
+	ClosingBalance float64               `json:"closing_balance"`
+	Lines          []SellerStatementLine `json:"lines"`
+	GeneratedAt    time.Time             `json:"generated_at"`
+}
+
+// SellerStatementLine is one ledger transaction on a seller statement
+type SellerStatementLine struct {
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`
+	OrderID     *uint     `json:"order_id,omitempty"`
+	PayoutID    *uint     `json:"payout_id,omitempty"`
+	Description string    `json:"description"`
+	Gross       float64   `json:"gross"`
+	Commission  float64   `json:"commission"`
+	Net         float64   `json:"net"` // change of the amount owed to the shop
+	Balance     float64   `json:"balance"`
+}
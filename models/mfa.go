@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// MFARecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only a hash of the code is stored.
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"column:user_id;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"column:code_hash;size:64;not null;uniqueIndex" json:"-"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFAEnrollment is returned when a user starts TOTP enrollment. The
+// provisioning URI is meant to be rendered as a QR code for authenticator apps.
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest represents a request carrying a TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MFALoginRequest represents the second step of a login. The code is either
+// a TOTP code or an unused recovery code.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// MFADisableRequest represents the request payload for turning MFA off
+type MFADisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
@@ -5,6 +5,13 @@ type OrderItem struct {
 	OrderID   uint    `gorm:"column:order_id;not null" json:"order_id"`
 	ProductID uint    `gorm:"column:product_id;not null" json:"product_id"`
 	Product   Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  int     `gorm:"column:quantity;not null" json:"quantity"`
-	Price     float64 `gorm:"column:price;not null" json:"price"`
+	// VariantID is the variant bought (nil for products without variants)
+	VariantID *uint           `gorm:"column:variant_id;index" json:"variant_id,omitempty"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  int             `gorm:"column:quantity;not null" json:"quantity"`
+	Price     float64         `gorm:"column:price;not null" json:"price"`
+	// Lots are the inventory lots the units were taken from (empty for products without lots)
+	Lots []OrderItemLot `gorm:"foreignKey:OrderItemID" json:"lots,omitempty"`
+	// ShopOrderID is the sub-order fulfilling the item (nil for orders placed before sub-orders existed)
+	ShopOrderID *uint `gorm:"column:shop_order_id;index" json:"shop_order_id,omitempty"`
 }
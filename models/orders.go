@@ -5,25 +5,50 @@ import (
 )
 
 type Order struct {
-	ID            uint        `gorm:"primaryKey" json:"id"`
-	UserID        uint        `gorm:"column:user_id;not null;index" json:"user_id"`
-	User          User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	OrderItems    []OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
-	Status        string      `gorm:"column:status;not null;index" json:"status"`
-	TotalPrice    float64     `gorm:"column:total_price;not null" json:"total_price"`
-	PaymentMethod string      `gorm:"column:payment_method;not null" json:"payment_method"`
-	BankName      string      `gorm:"column:bank_name" json:"bank_name,omitempty"`
-	CreatedAt     time.Time   `gorm:"autoCreateTime;index" json:"created_at"`
-	UpdatedAt     time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	UserID     uint        `gorm:"column:user_id;not null;index" json:"user_id"`
+	User       User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	OrderItems []OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+	ShopOrders []ShopOrder `gorm:"foreignKey:OrderID" json:"shop_orders,omitempty"`
+	// Prescription is set for orders with prescription-only products
+	Prescription  *Prescription `gorm:"foreignKey:OrderID" json:"prescription,omitempty"`
+	Status        string        `gorm:"column:status;not null;index" json:"status"`
+	TotalPrice    float64       `gorm:"column:total_price;not null" json:"total_price"`
+	PaymentMethod string        `gorm:"column:payment_method;not null" json:"payment_method"`
+	BankName      string        `gorm:"column:bank_name" json:"bank_name,omitempty"`
+	// Payment gateway details (empty for cash on delivery)
+	PaymentProvider      string    `gorm:"column:payment_provider" json:"payment_provider,omitempty"`
+	PaymentTransactionID string    `gorm:"column:payment_transaction_id;index" json:"payment_transaction_id,omitempty"`
+	CreatedAt            time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt            time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ShopOrder is the part of an order fulfilled by a single shop. Items sold by
+// the store itself are grouped in a sub-order without a shop.
+type ShopOrder struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	OrderID    uint        `gorm:"column:order_id;not null;index" json:"order_id"`
+	Order      *Order      `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	ShopID     *uint       `gorm:"column:shop_id;index" json:"shop_id,omitempty"`
+	Status     string      `gorm:"column:status;not null;index" json:"status"`
+	Subtotal   float64     `gorm:"column:subtotal;not null" json:"subtotal"`
+	OrderItems []OrderItem `gorm:"foreignKey:ShopOrderID" json:"items,omitempty"`
+	ShippedAt  *time.Time  `gorm:"column:shipped_at" json:"shipped_at,omitempty"`
+	CreatedAt  time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 // PlaceOrderRequest represents the request payload for placing an order
 type PlaceOrderRequest struct {
-	PaymentMethod string `json:"payment_method" validate:"required,oneof=paypal debit cc cod"`
-	BankName      string `json:"bank_name,omitempty"`
+	PaymentMethod string `form:"payment_method" json:"payment_method" validate:"required,oneof=paypal debit cc cod"`
+	BankName      string `form:"bank_name" json:"bank_name,omitempty"`
+	PaymentToken  string `form:"payment_token" json:"payment_token,omitempty"` // Provider payment method token, not needed for cod
+	// PrescriptionURL is set from the prescription uploaded with a multipart
+	// checkout; orders with prescription-only products need one
+	PrescriptionURL string `form:"-" json:"-"`
 }
 
 // OrderStatusUpdateRequest represents the request payload for updating order status (admin only)
 type OrderStatusUpdateRequest struct {
-	Status string `json:"status" validate:"required,oneof=pending paid shipped cancelled"`
+	Status string `json:"status" validate:"required,oneof=pending paid shipped returned cancelled failed"`
 }
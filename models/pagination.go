@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidListParams is returned for list requests with an unknown sort,
+// a malformed cursor or filter value, or a limit out of range
+var ErrInvalidListParams = errors.New("invalid list parameters")
+
+// Page sizes of list endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ListSpec whitelists what clients may sort and filter a list endpoint by.
+// Sort columns must be non-null columns of the listed table.
+type ListSpec struct {
+	Sorts       map[string]string // sort names mapped to columns
+	Filters     map[string]string // filter query parameters mapped to columns
+	DefaultSort string            // sort name, prefixed with "-" for descending
+}
+
+// ListParams holds the parsed pagination, sorting and filter parameters of a
+// list request
+type ListParams struct {
+	Limit   int
+	Sort    string // a key of ListSpec.Sorts
+	Desc    bool
+	Filters map[string]string // keys of ListSpec.Filters mapped to the requested values
+	Cursor  *ListCursor       // nil for the first page
+}
+
+// ListCursor is the position of the last item of a page. It is handed to
+// clients as an opaque string.
+type ListCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"` // sort value of the last item
+	ID    uint   `json:"id"`
+}
+
+// Encode turns the cursor into an opaque string
+func (c ListCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeListCursor reads a cursor made by ListCursor.Encode
+func DecodeListCursor(value string) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor ListCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Page is the envelope of list endpoints
+type Page[T any] struct {
+	Data       []T       `json:"data"`
+	Count      int       `json:"count"` // items on this page
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Links      PageLinks `json:"links"`
+}
+
+// PageLinks holds the URLs of the pages around a page
+type PageLinks struct {
+	Next string `json:"next,omitempty"`
+}
+
+// List specs of the list endpoints
+var (
+	UserListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "username": "username", "email": "email", "created_at": "created_at"},
+		Filters:     map[string]string{"role": "role", "email_verified": "email_verified", "mfa_enabled": "mfa_enabled"},
+		DefaultSort: "id",
+	}
+	OrderListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at", "total_price": "total_price"},
+		Filters:     map[string]string{"status": "status", "user_id": "user_id", "payment_method": "payment_method"},
+		DefaultSort: "-created_at",
+	}
+	ShopRequestListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at", "updated_at": "updated_at"},
+		Filters:     map[string]string{"status": "status", "user_id": "user_id"},
+		DefaultSort: "-created_at",
+	}
+	GuestBookListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at", "name": "name"},
+		Filters:     map[string]string{"email": "email"},
+		DefaultSort: "-created_at",
+	}
+	FeedbackListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at", "rating": "rating"},
+		Filters:     map[string]string{"rating": "rating", "user_id": "user_id"},
+		DefaultSort: "-created_at",
+	}
+	ProductListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "name": "name", "price": "price", "stock": "stock", "created_at": "created_at"},
+		Filters:     map[string]string{"category_id": "category_id", "shop_id": "shop_id"},
+		DefaultSort: "id",
+	}
+	PrescriptionListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+		Filters:     map[string]string{"status": "status", "user_id": "user_id"},
+		DefaultSort: "created_at",
+	}
+	StockMovementListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+		Filters:     map[string]string{"reason": "reason", "variant_id": "variant_id", "order_id": "order_id"},
+		DefaultSort: "-created_at",
+	}
+	RecallListSpec = ListSpec{
+		Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+		Filters:     map[string]string{"status": "status", "severity": "severity"},
+		DefaultSort: "-created_at",
+	}
+)
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PaymentWebhookEvent stores a raw payment provider webhook for audit and replay
+type PaymentWebhookEvent struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Provider      string     `gorm:"size:32;not null;uniqueIndex:idx_payment_event_provider_event" json:"provider"`
+	EventID       string     `gorm:"size:255;not null;uniqueIndex:idx_payment_event_provider_event" json:"event_id"`
+	EventType     string     `gorm:"size:100" json:"event_type"`
+	TransactionID string     `gorm:"size:255;index" json:"transaction_id,omitempty"`
+	OrderID       *uint      `gorm:"index" json:"order_id,omitempty"`
+	Payload       string     `gorm:"type:longtext;not null" json:"payload"`
+	Status        string     `gorm:"size:20;not null;index" json:"status"` // received, processing, processed, ignored, failed
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -27,6 +27,10 @@ const (
 	PermissionReadOrder   Permission = "order:read"
 	PermissionUpdateOrder Permission = "order:update"
 	PermissionDeleteOrder Permission = "order:delete"
+	// Act on orders of other users
+	PermissionReadAnyOrder   Permission = "order:read_any"
+	PermissionCancelAnyOrder Permission = "order:cancel_any"
+	PermissionShipAnyOrder   Permission = "order:ship_any" // ship sub-orders of any shop
 
 	// Cart permissions
 	PermissionReadCart   Permission = "cart:read"
@@ -35,6 +39,7 @@ const (
 	// Feedback permissions
 	PermissionCreateFeedback Permission = "feedback:create"
 	PermissionReadFeedback   Permission = "feedback:read"
+	PermissionDeleteFeedback Permission = "feedback:delete" // delete feedback of other users
 
 	// Report permissions
 	PermissionReadReport Permission = "report:read"
@@ -52,32 +57,110 @@ const (
 	PermissionCreateGuestBook Permission = "guestbook:create"
 	PermissionReadGuestBook   Permission = "guestbook:read"
 	PermissionDeleteGuestBook Permission = "guestbook:delete"
+
+	// Role permissions
+	PermissionReadRole   Permission = "role:read"
+	PermissionManageRole Permission = "role:manage"
+
+	// Finance permissions
+	PermissionReadFinance   Permission = "finance:read"   // ledger balances, payouts and statements of any shop
+	PermissionManageFinance Permission = "finance:manage" // commission rules and payouts
+
+	// Inventory permissions
+	PermissionReadInventory   Permission = "inventory:read"   // lots and expiry reports
+	PermissionManageInventory Permission = "inventory:manage" // receive and correct lots
+
+	// Recall permissions
+	PermissionReadRecall   Permission = "recall:read"   // recalls, affected customers and reports
+	PermissionManageRecall Permission = "recall:manage" // issue and close recalls, notify customers
+
+	// Prescription permissions
+	PermissionReadPrescription   Permission = "prescription:read"   // prescriptions of any customer
+	PermissionReviewPrescription Permission = "prescription:review" // approve or reject prescriptions
+)
+
+// AllPermissions lists every permission a role can be granted
+var AllPermissions = []Permission{
+	PermissionCreateUser, PermissionReadUser, PermissionUpdateUser, PermissionDeleteUser,
+	PermissionCreateProduct, PermissionReadProduct, PermissionUpdateProduct, PermissionDeleteProduct,
+	PermissionCreateCategory, PermissionReadCategory, PermissionUpdateCategory, PermissionDeleteCategory,
+	PermissionCreateOrder, PermissionReadOrder, PermissionUpdateOrder, PermissionDeleteOrder,
+	PermissionReadAnyOrder, PermissionCancelAnyOrder, PermissionShipAnyOrder,
+	PermissionReadCart, PermissionUpdateCart,
+	PermissionCreateFeedback, PermissionReadFeedback, PermissionDeleteFeedback,
+	PermissionReadReport,
+	PermissionCreateShopRequest, PermissionReadShopRequest, PermissionApproveShop, PermissionRejectShop, PermissionReadShop, PermissionUpdateShop, PermissionDeleteShop,
+	PermissionCreateGuestBook, PermissionReadGuestBook, PermissionDeleteGuestBook,
+	PermissionReadRole, PermissionManageRole,
+	PermissionReadFinance, PermissionManageFinance,
+	PermissionReadInventory, PermissionManageInventory,
+	PermissionReadRecall, PermissionManageRecall,
+	PermissionReadPrescription, PermissionReviewPrescription,
+}
+
+// IsValidPermission reports whether p is a known permission
+func IsValidPermission(p Permission) bool {
+	for _, known := range AllPermissions {
+		if known == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Built-in roles
+const (
+	RoleAdmin      = "admin"
+	RoleCustomer   = "customer"
+	RoleSeller     = "seller" // customers whose shop request was approved
+	RoleGuest      = "guest"
+	RolePharmacist = "pharmacist" // verifies prescriptions
 )
 
-// RolePermissions maps roles to their default permissions
+// RolePermissions maps the built-in roles to their default permissions. They
+// are seeded into the database on startup; after that the roles table is
+// the source of truth.
 var RolePermissions = map[string][]Permission{
-	"admin": {
-		// Admin has all permissions
-		PermissionCreateUser, PermissionReadUser, PermissionUpdateUser, PermissionDeleteUser,
-		PermissionCreateProduct, PermissionReadProduct, PermissionUpdateProduct, PermissionDeleteProduct,
-		PermissionCreateCategory, PermissionReadCategory, PermissionUpdateCategory, PermissionDeleteCategory,
-		PermissionCreateOrder, PermissionReadOrder, PermissionUpdateOrder, PermissionDeleteOrder,
-		PermissionReadCart, PermissionUpdateCart,
-		PermissionCreateFeedback, PermissionReadFeedback,
-		PermissionReadReport,
-		PermissionCreateShopRequest, PermissionReadShopRequest, PermissionApproveShop, PermissionRejectShop, PermissionReadShop, PermissionUpdateShop, PermissionDeleteShop,
-		PermissionCreateGuestBook, PermissionReadGuestBook, PermissionDeleteGuestBook,
-	},
+	// Admin has all permissions
+	"admin": AllPermissions,
 	"customer": {
 		// Customer has limited permissions
 		PermissionReadProduct, PermissionReadCategory,
 		PermissionCreateOrder, PermissionReadOrder, PermissionUpdateOrder,
 		PermissionReadCart, PermissionUpdateCart,
 		PermissionCreateFeedback,
+		PermissionCreateShopRequest,
+	},
+	"seller": {
+		// Sellers shop like customers; their own shops are managed through ownership
+		PermissionReadProduct, PermissionReadCategory,
+		PermissionCreateOrder, PermissionReadOrder, PermissionUpdateOrder,
+		PermissionReadCart, PermissionUpdateCart,
+		PermissionCreateFeedback,
+		PermissionCreateShopRequest,
 	},
+	"pharmacist": {
+		// Pharmacists work the prescription review queue
+		PermissionReadProduct, PermissionReadCategory,
+		PermissionReadPrescription, PermissionReviewPrescription,
+	},
+	"guest": {
+		// Anonymous visitors can browse and build a guest cart
+		PermissionReadProduct, PermissionReadCategory,
+		PermissionReadCart, PermissionUpdateCart,
+	},
+}
+
+// BuiltInBaseRole returns the base role of a built-in role. Sellers are
+// admitted wherever customers are.
+func BuiltInBaseRole(role string) string {
+	if role == RoleSeller {
+		return RoleCustomer
+	}
+	return role
 }
 
-// HasPermission checks if a role has a specific permission
+// HasPermission checks if a built-in role has a specific default permission
 func HasPermission(role string, permission Permission) bool {
 	permissions, exists := RolePermissions[role]
 	if !exists {
@@ -93,7 +176,7 @@ func HasPermission(role string, permission Permission) bool {
 	return false
 }
 
-// GetRolePermissions returns all permissions for a role
+// GetRolePermissions returns the default permissions of a built-in role
 func GetRolePermissions(role string) []Permission {
 	permissions, exists := RolePermissions[role]
 	if !exists {
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Prescription statuses
+const (
+	PrescriptionStatusPending   = "pending"
+	PrescriptionStatusApproved  = "approved"
+	PrescriptionStatusRejected  = "rejected"
+	PrescriptionStatusWithdrawn = "withdrawn" // the order was cancelled or failed before review
+)
+
+// Prescription is the prescription a customer uploaded for an order with
+// prescription-only products. The order is held in pending_verification
+// until a pharmacist approves or rejects it.
+type Prescription struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	OrderID     uint   `gorm:"column:order_id;not null;uniqueIndex" json:"order_id"`
+	Order       *Order `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	UserID      uint   `gorm:"column:user_id;not null;index" json:"user_id"`
+	DocumentURL string `gorm:"column:document_url;not null" json:"document_url"`
+	Status      string `gorm:"column:status;size:20;not null;default:pending;index" json:"status"`
+	// ReviewerID is the pharmacist who approved or rejected the prescription
+	ReviewerID      *uint      `gorm:"column:reviewer_id" json:"reviewer_id,omitempty"`
+	RejectionReason string     `gorm:"column:rejection_reason;type:text" json:"rejection_reason,omitempty"`
+	ReviewedAt      *time.Time `gorm:"column:reviewed_at" json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// PrescriptionRejectRequest represents the request payload for rejecting a prescription
+type PrescriptionRejectRequest struct {
+	Reason string `json:"reason" validate:"required,min=5,max=1000"`
+}
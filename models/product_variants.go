@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// ProductVariant is a purchasable version of a product, such as a size or
+// pack count, with its own SKU, price and stock. Customers buying a product
+// with variants pick one of them.
+type ProductVariant struct {
+	ID         uint              `gorm:"primaryKey" json:"id"`
+	ProductID  uint              `gorm:"column:product_id;not null;index" json:"product_id"`
+	SKU        string            `gorm:"column:sku;size:64;not null;uniqueIndex" json:"sku"`
+	Attributes VariantAttributes `gorm:"embedded" json:"attributes"`
+	Price      float64           `gorm:"column:price;not null" json:"price"`
+	Stock      int               `gorm:"column:stock;not null" json:"stock"`
+	// AvailableStock is Stock minus active cart reservations (computed, not stored)
+	AvailableStock int    `gorm:"-" json:"available_stock"`
+	ImageURL       string `gorm:"column:image_url" json:"image_url,omitempty"`
+	// RecallID is set while an active recall covers every unit of the variant
+	RecallID  *uint     `gorm:"column:recall_id;index" json:"recall_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsSellable reports whether the variant can be bought, which it can unless
+// it is recalled
+func (v *ProductVariant) IsSellable() bool {
+	return v.RecallID == nil
+}
+
+// VariantAttributes describes what sets a variant apart from the other
+// variants of its product. Unused attributes are left empty.
+type VariantAttributes struct {
+	Size      string `gorm:"column:size;size:50" json:"size,omitempty"`
+	Color     string `gorm:"column:color;size:50" json:"color,omitempty"`
+	PackCount int    `gorm:"column:pack_count" json:"pack_count,omitempty"`
+}
+
+// ProductVariantCreateRequest represents the request payload for adding a variant to a product
+type ProductVariantCreateRequest struct {
+	SKU       string  `form:"sku" json:"sku" validate:"required,min=1,max=64"`
+	Size      string  `form:"size" json:"size,omitempty" validate:"max=50"`
+	Color     string  `form:"color" json:"color,omitempty" validate:"max=50"`
+	PackCount int     `form:"pack_count" json:"pack_count,omitempty" validate:"gte=0"`
+	Price     float64 `form:"price" json:"price" validate:"required,gt=0"`
+	Stock     int     `form:"stock" json:"stock" validate:"gte=0"`
+	ImageURL  string  `form:"image_url" json:"image_url,omitempty" validate:"omitempty,url"`
+}
+
+// ProductVariantUpdateRequest represents the request payload for updating a variant.
+// Fields left out are not changed.
+type ProductVariantUpdateRequest struct {
+	SKU       string   `form:"sku" json:"sku,omitempty" validate:"omitempty,max=64"`
+	Size      *string  `form:"size" json:"size,omitempty" validate:"omitempty,max=50"`
+	Color     *string  `form:"color" json:"color,omitempty" validate:"omitempty,max=50"`
+	PackCount *int     `form:"pack_count" json:"pack_count,omitempty" validate:"omitempty,gte=0"`
+	Price     *float64 `form:"price" json:"price,omitempty" validate:"omitempty,gt=0"`
+	Stock     *int     `form:"stock" json:"stock,omitempty" validate:"omitempty,gte=0"`
+	ImageURL  string   `form:"image_url" json:"image_url,omitempty" validate:"omitempty,url"`
+}
@@ -5,16 +5,51 @@ import (
 )
 
 type Product struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	CategoryID  uint      `gorm:"index" json:"category_id"`
-	Category    Category  `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
-	Name        string    `gorm:"index" json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       int       `json:"stock"`
-	ImageURL    string    `json:"image_url"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint     `gorm:"primaryKey" json:"id"`
+	CategoryID  uint     `gorm:"index" json:"category_id"`
+	Category    Category `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	ShopID      *uint    `gorm:"index" json:"shop_id,omitempty"` // nil for products sold by the store itself
+	Shop        *Shop    `gorm:"foreignKey:ShopID" json:"shop,omitempty"`
+	Name        string   `gorm:"index;index:idx_products_search,class:FULLTEXT" json:"name"`
+	Description string   `gorm:"type:text;index:idx_products_search,class:FULLTEXT" json:"description"`
+	// Price is the display price of products with variants, which are sold at the price of the variant
+	Price float64 `json:"price"`
+	// Stock is the total stock of the variants for products with variants
+	Stock int `json:"stock"`
+	// AvailableStock is Stock minus active cart reservations (computed, not stored)
+	AvailableStock int              `gorm:"-" json:"available_stock"`
+	ImageURL       string           `json:"image_url"`
+	Variants       []ProductVariant `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+	// RequiresPrescription holds orders of the product until a pharmacist
+	// verifies the customer's prescription
+	RequiresPrescription bool `gorm:"column:requires_prescription;not null;default:false" json:"requires_prescription"`
+	// ReorderThreshold is the stock below which a low-stock alert is raised, 0 for none
+	ReorderThreshold int `gorm:"column:reorder_threshold;not null;default:0" json:"reorder_threshold"`
+	// RecallID is set while an active recall covers every unit of the product
+	RecallID  *uint     `gorm:"column:recall_id;index" json:"recall_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsSellable reports whether the product can be bought: store products
+// are unless recalled, shop products only while their shop is active as
+// well. Shop must be loaded for shop products.
+func (p *Product) IsSellable() bool {
+	if p.RecallID != nil {
+		return false
+	}
+	return p.ShopID == nil || (p.Shop != nil && p.Shop.IsActive)
+}
+
+// FindVariant returns the variant of the product with the given ID, or nil.
+// Variants must be loaded.
+func (p *Product) FindVariant(id uint) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
 }
 
 // ProductCreateRequest represents the request payload for creating a product
@@ -25,6 +60,10 @@ type ProductCreateRequest struct {
 	Price       float64 `form:"price" json:"price" validate:"required,gt=0"`
 	Stock       int     `form:"stock" json:"stock" validate:"required,gte=0"`
 	ImageURL    string  `form:"image_url" json:"image_url,omitempty" validate:"omitempty,url"`
+	ShopID      *uint   `form:"shop_id" json:"shop_id,omitempty"` // set from the route on shop product routes
+	// RequiresPrescription makes the product prescription-only
+	RequiresPrescription bool `form:"requires_prescription" json:"requires_prescription,omitempty"`
+	ReorderThreshold     int  `form:"reorder_threshold" json:"reorder_threshold,omitempty" validate:"gte=0"`
 }
 
 // ProductUpdateRequest represents the request payload for updating a product
@@ -35,6 +74,10 @@ type ProductUpdateRequest struct {
 	Price       float64 `form:"price" json:"price,omitempty" validate:"omitempty,gt=0"`
 	Stock       int     `form:"stock" json:"stock,omitempty" validate:"omitempty,gte=0"`
 	ImageURL    string  `form:"image_url" json:"image_url,omitempty" validate:"omitempty,url"`
+	// RequiresPrescription is left unchanged when omitted
+	RequiresPrescription *bool `form:"requires_prescription" json:"requires_prescription,omitempty"`
+	// ReorderThreshold is left unchanged when omitted, 0 turns threshold alerts off
+	ReorderThreshold *int `form:"reorder_threshold" json:"reorder_threshold,omitempty" validate:"omitempty,gte=0"`
 }
 
 // TopProduct represents a top-selling product for reporting
@@ -44,3 +87,61 @@ type TopProduct struct {
 	TotalSold    int64   `json:"total_sold"`
 	TotalRevenue float64 `json:"total_revenue"`
 }
+
+// Product search sort orders
+const (
+	ProductSortRelevance  = "relevance" // best match for q first; the default when q is given
+	ProductSortNewest     = "newest"    // the default without q
+	ProductSortPriceAsc   = "price_asc"
+	ProductSortPriceDesc  = "price_desc"
+	ProductSortPopularity = "popularity" // units sold in orders that were not cancelled
+	ProductSortRating     = "rating"     // average feedback rating
+)
+
+// ProductSearchRequest represents the query parameters of a catalog search
+type ProductSearchRequest struct {
+	Query      string   `form:"q" validate:"max=200"`
+	CategoryID *uint    `form:"category_id"`
+	ShopID     *uint    `form:"shop_id"`
+	MinPrice   *float64 `form:"min_price" validate:"omitempty,gte=0"`
+	MaxPrice   *float64 `form:"max_price" validate:"omitempty,gte=0"`
+	InStock    bool     `form:"in_stock"`
+	MinRating  *float64 `form:"min_rating" validate:"omitempty,gte=0,lte=5"`
+	Sort       string   `form:"sort" validate:"omitempty,oneof=relevance newest price_asc price_desc popularity rating"`
+	Limit      int      `form:"limit" validate:"omitempty,gte=1,lte=100"`
+	Cursor     string   `form:"cursor"`
+}
+
+// ProductSearchCursor is the position of the last product of a search page.
+// It is handed to clients as an opaque string.
+type ProductSearchCursor struct {
+	Sort  string  `json:"s"`
+	Value float64 `json:"v"` // sort value of the last product
+	ID    uint    `json:"id"`
+}
+
+// ProductSearchHit is a product matching a search, with the value it is sorted by
+type ProductSearchHit struct {
+	ID        uint
+	SortValue float64
+}
+
+// CategoryFacet counts the products of a category matching a search
+type CategoryFacet struct {
+	CategoryID uint   `json:"category_id"`
+	Name       string `json:"name"`
+	Count      int64  `json:"count"`
+}
+
+// ProductFacets holds the facet counts of a search
+type ProductFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+}
+
+// ProductSearchResult is a page of catalog search results
+type ProductSearchResult struct {
+	Products   []Product     `json:"products"`
+	Total      int64         `json:"total"` // products matching the search across all pages
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Facets     ProductFacets `json:"facets"`
+}
@@ -0,0 +1,123 @@
+package models
+
+import "time"
+
+// Recall severities, from most to least serious
+const (
+	RecallSeverityClassI   = "class_i"   // use may cause serious harm
+	RecallSeverityClassII  = "class_ii"  // use may cause temporary or reversible harm
+	RecallSeverityClassIII = "class_iii" // use is unlikely to cause harm
+)
+
+// Recall statuses
+const (
+	RecallStatusActive = "active"
+	RecallStatusClosed = "closed"
+)
+
+// Recall is a manufacturer recall of products or lots. While a recall is
+// active the stock it covers can not be sold.
+type Recall struct {
+	ID       uint         `gorm:"primaryKey" json:"id"`
+	Reason   string       `gorm:"type:text;not null" json:"reason"`
+	Severity string       `gorm:"size:20;not null;index" json:"severity"`
+	Status   string       `gorm:"size:20;not null;default:active;index" json:"status"`
+	Items    []RecallItem `gorm:"foreignKey:RecallID" json:"items"`
+	// NotifiedAt is when affected customers were last sent a notification
+	NotifiedAt *time.Time `gorm:"column:notified_at" json:"notified_at,omitempty"`
+	ClosedAt   *time.Time `gorm:"column:closed_at" json:"closed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RecallItem is what a recall covers: a lot when LotID is set, else a
+// variant when VariantID is set, else every unit of a product
+type RecallItem struct {
+	ID          uint     `gorm:"primaryKey" json:"id"`
+	RecallID    uint     `gorm:"column:recall_id;not null;index" json:"-"`
+	ProductID   uint     `gorm:"column:product_id;not null;index" json:"product_id"`
+	Product     *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	VariantID   *uint    `gorm:"column:variant_id" json:"variant_id,omitempty"`
+	LotID       *uint    `gorm:"column:lot_id;index" json:"lot_id,omitempty"`
+	LotNumber   string   `gorm:"column:lot_number;size:64" json:"lot_number,omitempty"`
+	ProductName string   `gorm:"column:product_name;not null" json:"product_name"` // name when recalled
+}
+
+// RecallNotification records the notification of a customer affected by a
+// recall
+type RecallNotification struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	RecallID uint   `gorm:"column:recall_id;not null;uniqueIndex:idx_recall_notifications_user,priority:1" json:"recall_id"`
+	UserID   uint   `gorm:"column:user_id;not null;uniqueIndex:idx_recall_notifications_user,priority:2" json:"user_id"`
+	Email    string `gorm:"column:email;not null" json:"email"`
+	// Error is the delivery error of the last attempt, empty once sent
+	Error     string     `gorm:"column:error;type:text" json:"error,omitempty"`
+	SentAt    *time.Time `gorm:"column:sent_at" json:"sent_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RecallCreateRequest represents the request payload for issuing a recall
+type RecallCreateRequest struct {
+	Reason   string              `json:"reason" validate:"required,min=10,max=2000"`
+	Severity string              `json:"severity" validate:"required,oneof=class_i class_ii class_iii"`
+	Items    []RecallItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+// RecallItemRequest names a product, variant or lot covered by a recall.
+// Lots of a variant need the variant as well.
+type RecallItemRequest struct {
+	ProductID uint   `json:"product_id" validate:"required"`
+	VariantID *uint  `json:"variant_id,omitempty"`
+	LotNumber string `json:"lot_number,omitempty" validate:"omitempty,max=64"`
+}
+
+// RecallAffectedItem is a unit of sale covered by a recall: an order item,
+// or the part of it taken from one lot, with the customer who bought it
+type RecallAffectedItem struct {
+	OrderID       uint      `json:"order_id"`
+	OrderedAt     time.Time `json:"ordered_at"`
+	OrderStatus   string    `json:"order_status"`
+	UserID        uint      `json:"user_id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	ContactNumber string    `json:"contact_number"`
+	Address       string    `json:"-"`
+	City          string    `json:"-"`
+	ProductID     uint      `json:"product_id"`
+	ProductName   string    `json:"product_name"`
+	SKU           string    `json:"sku,omitempty"`
+	LotNumber     string    `json:"lot_number,omitempty"`
+	Quantity      int       `json:"quantity"`
+}
+
+// RecallCustomer is a customer who bought units covered by a recall
+type RecallCustomer struct {
+	UserID        uint       `json:"user_id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	ContactNumber string     `json:"contact_number"`
+	Address       string     `json:"address"`
+	City          string     `json:"city"`
+	OrderIDs      []uint     `json:"order_ids"`
+	Units         int        `json:"units"`
+	NotifiedAt    *time.Time `json:"notified_at,omitempty"`
+}
+
+// RecallReport lists the orders and customers affected by a recall
+type RecallReport struct {
+	Recall      *Recall              `json:"recall"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Items       []RecallAffectedItem `json:"items"`
+	Customers   []RecallCustomer     `json:"customers"`
+	Orders      int                  `json:"orders"`   // affected orders
+	Units       int                  `json:"units"`    // units sold
+	Notified    int                  `json:"notified"` // customers notified
+}
+
+// RecallNotifyResult summarizes a notification dispatch
+type RecallNotifyResult struct {
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"` // customers notified before
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Role is a named set of permissions assigned to users through User.Role.
+// A role is admitted to every route group open to its base role ("admin",
+// "customer" or "guest"); its permissions decide what it can do there.
+type Role struct {
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	Name        string           `gorm:"column:name;size:50;not null;uniqueIndex" json:"name"`
+	Description string           `gorm:"column:description;size:255" json:"description"`
+	BaseRole    string           `gorm:"column:base_role;size:50;not null" json:"base_role"`
+	BuiltIn     bool             `gorm:"column:built_in;not null;default:false" json:"built_in"` // seeded roles can not be deleted
+	Grants      []RolePermission `gorm:"foreignKey:RoleID" json:"-"`
+	Permissions []Permission     `gorm:"-" json:"permissions"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// RolePermission grants one permission to a role
+type RolePermission struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	RoleID     uint       `gorm:"column:role_id;not null;uniqueIndex:idx_role_permission" json:"role_id"`
+	Permission Permission `gorm:"column:permission;size:64;not null;uniqueIndex:idx_role_permission" json:"permission"`
+}
+
+// CreateRoleRequest represents the request payload for creating a role
+type CreateRoleRequest struct {
+	Name        string       `json:"name" validate:"required,min=2,max=50"`
+	Description string       `json:"description" validate:"max=255"`
+	BaseRole    string       `json:"base_role" validate:"required,oneof=admin customer"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// UpdateRoleRequest represents the request payload for updating a role.
+// Omitted fields are left unchanged; permissions replace the current set.
+type UpdateRoleRequest struct {
+	Description *string      `json:"description,omitempty" validate:"omitempty,max=255"`
+	BaseRole    *string      `json:"base_role,omitempty" validate:"omitempty,oneof=admin customer"`
+	Permissions []Permission `json:"permissions,omitempty"`
+}
+
+// PermissionNames returns the permissions granted to the role
+func (r *Role) PermissionNames() []Permission {
+	names := make([]Permission, 0, len(r.Grants))
+	for _, grant := range r.Grants {
+		names = append(names, grant.Permission)
+	}
+	return names
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key: an account
+// ("user:<username>") or a client address ("ip:<address>")
+type LoginThrottle struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Key           string     `gorm:"column:throttle_key;size:191;not null;uniqueIndex" json:"key"`
+	Failures      int        `gorm:"column:failures;not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"column:last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"column:locked_until" json:"locked_until,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Audit log actions
+const (
+	AuditLoginFailed     = "login_failed"
+	AuditLoginLocked     = "login_locked"
+	AuditAccountUnlocked = "account_unlocked"
+)
+
+// AuditLog is an append-only record of a security-relevant event
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Action    string    `gorm:"column:action;size:64;not null;index" json:"action"`
+	UserID    *uint     `gorm:"column:user_id;index" json:"user_id,omitempty"`   // affected user, if known
+	ActorID   *uint     `gorm:"column:actor_id;index" json:"actor_id,omitempty"` // user who performed the action, if not the affected user
+	Username  string    `gorm:"column:username;size:100;index" json:"username"`
+	IPAddress string    `gorm:"column:ip_address;size:45" json:"ip_address"`
+	UserAgent string    `gorm:"column:user_agent;size:255" json:"user_agent"`
+	Details   string    `gorm:"column:details;type:text" json:"details"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -4,15 +4,64 @@ import "time"
 
 // ShopRequest represents a shop creation request from a customer
 type ShopRequest struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	UserID      uint      `json:"user_id"`
-	User        User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	ShopName    string    `json:"shop_name" validate:"required,min=3,max=100"`
-	Description string    `json:"description" validate:"required,min=10,max=500"`
-	Status      string    `json:"status" gorm:"default:'pending'" validate:"oneof=pending approved rejected"`
-	RejectionReason string `json:"rejection_reason,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID              uint                  `gorm:"primaryKey" json:"id"`
+	UserID          uint                  `json:"user_id"`
+	User            User                  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	ShopName        string                `json:"shop_name" validate:"required,min=3,max=100"`
+	Description     string                `json:"description" validate:"required,min=10,max=500"`
+	Status          string                `json:"status" gorm:"default:'pending'" validate:"oneof=pending approved rejected withdrawn"`
+	RejectionReason string                `json:"rejection_reason,omitempty"`
+	Submissions     int                   `json:"submissions" gorm:"default:1"` // times the request was submitted for review
+	ReviewedByID    *uint                 `json:"reviewed_by_id,omitempty"`
+	ReviewedAt      *time.Time            `json:"reviewed_at,omitempty"`
+	Documents       []ShopRequestDocument `json:"documents,omitempty" gorm:"foreignKey:ShopRequestID"`
+	Comments        []ShopRequestComment  `json:"comments,omitempty" gorm:"foreignKey:ShopRequestID"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+}
+
+// Shop request document types
+const (
+	ShopDocumentBusinessLicense = "business_license"
+	ShopDocumentTaxCertificate  = "tax_certificate"
+	ShopDocumentIdentity        = "identity"
+	ShopDocumentOther           = "other"
+)
+
+// RequiredShopRequestDocuments lists the documents a shop request needs before it can be approved
+var RequiredShopRequestDocuments = []string{ShopDocumentBusinessLicense}
+
+// ShopRequestDocument is a file attached to a shop request
+type ShopRequestDocument struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ShopRequestID uint      `gorm:"not null;index" json:"shop_request_id"`
+	Type          string    `gorm:"size:50;not null" json:"type"`
+	FileName      string    `json:"file_name"`
+	URL           string    `gorm:"not null" json:"url"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ShopRequestDocumentUpload describes a document uploaded with a multipart form
+type ShopRequestDocumentUpload struct {
+	Type string `form:"type" validate:"required,oneof=business_license tax_certificate identity other"`
+}
+
+// ShopRequestComment is a message between the applicant and the reviewers of a shop request
+type ShopRequestComment struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ShopRequestID uint      `gorm:"not null;index" json:"shop_request_id"`
+	UserID        uint      `gorm:"not null" json:"user_id"`
+	Username      string    `gorm:"size:50" json:"username"`          // author's username when the comment was written
+	ParentID      *uint     `gorm:"index" json:"parent_id,omitempty"` // comment this one replies to
+	IsReviewer    bool      `gorm:"not null;default:false" json:"is_reviewer"`
+	Message       string    `gorm:"type:text;not null" json:"message"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ShopRequestCommentRequest represents the request to comment on a shop request
+type ShopRequestCommentRequest struct {
+	Message  string `json:"message" validate:"required,min=1,max=2000"`
+	ParentID *uint  `json:"parent_id,omitempty"`
 }
 
 // Shop represents an approved shop
@@ -41,16 +90,20 @@ type ShopRequestApprovalRequest struct {
 
 // ShopRequestResponse represents a shop request with selected user fields
 type ShopRequestResponse struct {
-	ID              uint      `json:"id"`
-	UserID          uint      `json:"user_id"`
-	Username        string    `json:"username"`
-	Email           string    `json:"email"`
-	ShopName        string    `json:"shop_name"`
-	Description     string    `json:"description"`
-	Status          string    `json:"status"`
-	RejectionReason string    `json:"rejection_reason,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uint                  `json:"id"`
+	UserID          uint                  `json:"user_id"`
+	Username        string                `json:"username"`
+	Email           string                `json:"email"`
+	ShopName        string                `json:"shop_name"`
+	Description     string                `json:"description"`
+	Status          string                `json:"status"`
+	RejectionReason string                `json:"rejection_reason,omitempty"`
+	Submissions     int                   `json:"submissions"`
+	ReviewedAt      *time.Time            `json:"reviewed_at,omitempty"`
+	Documents       []ShopRequestDocument `json:"documents,omitempty"`
+	Comments        []ShopRequestComment  `json:"comments,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
 }
 
 // ShopUpdateRequest represents the request to update a shop
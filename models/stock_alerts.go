@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ProductStockLevel is the stock of a product with the units sold over the
+// sales window, the input of low-stock alerts
+type ProductStockLevel struct {
+	ProductID        uint   `json:"product_id"`
+	ProductName      string `json:"product_name"`
+	ShopID           *uint  `json:"shop_id,omitempty"`
+	Stock            int    `json:"stock"`
+	ReorderThreshold int    `json:"reorder_threshold"`
+	UnitsSold        int    `json:"units_sold"`
+}
+
+// LowStockAlert flags a product whose stock is below its reorder threshold,
+// or would run out within the configured days of cover at its sales velocity
+type LowStockAlert struct {
+	ProductStockLevel
+	// DailySales is the average units sold a day over the sales window
+	DailySales float64 `json:"daily_sales"`
+	// DaysOfCover is how many days the stock lasts at DailySales, nil for products that did not sell
+	DaysOfCover *float64 `json:"days_of_cover"`
+	// SuggestedReorder is the units to order to restock to the reorder days of cover, above the threshold
+	SuggestedReorder int `json:"suggested_reorder"`
+	// NotifiedAt is when admins were notified of the alert, nil until the next check
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+}
+
+// LowStockNotification records that admins were notified of a product's low
+// stock, so they are notified once until its stock recovers
+type LowStockNotification struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	ProductID  uint      `gorm:"column:product_id;not null;uniqueIndex" json:"product_id"`
+	NotifiedAt time.Time `gorm:"column:notified_at;not null" json:"notified_at"`
+}
+
+// LowStockReport lists the low-stock alerts with their suggested reorders,
+// fewest days of cover first
+type LowStockReport struct {
+	GeneratedAt      time.Time       `json:"generated_at"`
+	SalesWindowDays  int             `json:"sales_window_days"`
+	CoverDays        int             `json:"cover_days"`
+	ReorderCoverDays int             `json:"reorder_cover_days"`
+	Alerts           []LowStockAlert `json:"alerts"`
+	Count            int             `json:"count"`
+}
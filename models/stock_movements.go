@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Reasons stock moves for
+const (
+	StockReasonOpening     = "opening"      // stock on hand when the ledger was started
+	StockReasonAdminAdjust = "admin_adjust" // stock set by an admin, or a lot correction
+	StockReasonLotReceive  = "lot_receive"
+	StockReasonOrderPlace  = "order_place"
+	StockReasonOrderCancel = "order_cancel" // units of cancelled, failed and rejected orders returned to stock
+	StockReasonReturn      = "return"       // units of shipped orders taken back
+	StockReasonRecall      = "recall"
+	// Carts reserve stock without moving it, so adding to a cart records no
+	// movement. Only carts from before reservations, which took stock on
+	// add, give it back when converted.
+	StockReasonCartRemove = "cart_remove"
+)
+
+// StockMovement is an entry of the append-only stock ledger. Every change to
+// the stock of a product, or of one of its variants, is recorded with its
+// reason, so the stock of a product is the sum of its movements.
+type StockMovement struct {
+	ID        uint  `gorm:"primaryKey" json:"id"`
+	ProductID uint  `gorm:"column:product_id;not null;index:idx_stock_movements_product,priority:1" json:"product_id"`
+	VariantID *uint `gorm:"column:variant_id;index" json:"variant_id,omitempty"` // set for stock of a variant
+	// Quantity is the change in units: positive adds stock, negative removes it
+	Quantity  int       `gorm:"column:quantity;not null" json:"quantity"`
+	Reason    string    `gorm:"column:reason;size:20;not null" json:"reason"`
+	OrderID   *uint     `gorm:"column:order_id;index" json:"order_id,omitempty"`
+	LotID     *uint     `gorm:"column:lot_id" json:"lot_id,omitempty"`
+	RecallID  *uint     `gorm:"column:recall_id" json:"recall_id,omitempty"`
+	Note      string    `gorm:"column:note;size:255" json:"note,omitempty"`
+	CreatedAt time.Time `gorm:"index:idx_stock_movements_product,priority:2" json:"created_at"`
+}
+
+// StockDiscrepancy flags a product, or variant, whose stock disagrees with
+// the sum of its stock movements. Discrepancies are replaced by every
+// reconciliation.
+type StockDiscrepancy struct {
+	ID          uint   `gorm:"primaryKey" json:"-"`
+	ProductID   uint   `gorm:"column:product_id;not null;index" json:"product_id"`
+	VariantID   *uint  `gorm:"column:variant_id" json:"variant_id,omitempty"`
+	ProductName string `gorm:"column:product_name;not null" json:"product_name"`
+	SKU         string `gorm:"column:sku;size:64" json:"sku,omitempty"`
+	Stock       int    `gorm:"column:stock;not null" json:"stock"`
+	// LedgerStock is the sum of the stock movements
+	LedgerStock int `gorm:"column:ledger_stock;not null" json:"ledger_stock"`
+	Difference  int `gorm:"column:difference;not null" json:"difference"` // Stock minus LedgerStock
+	// DetectedAt is when the reconciliation first found the discrepancy
+	DetectedAt time.Time `gorm:"column:detected_at;not null" json:"detected_at"`
+	CheckedAt  time.Time `gorm:"column:checked_at;not null" json:"checked_at"`
+}
+
+// StockReconciliation is the result of comparing stock with the ledger
+type StockReconciliation struct {
+	CheckedAt     time.Time          `json:"checked_at"`
+	Discrepancies []StockDiscrepancy `json:"discrepancies"`
+	Count         int                `json:"count"`
+}
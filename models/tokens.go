@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived token exchanged for new access tokens.
+// Only a keyed hash of the token is stored. Every refresh rotates the token
+// within the same family; presenting a token that was already rotated revokes
+// the whole family.
+type RefreshToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"column:user_id;not null;index" json:"user_id"`
+	TokenHash  string     `gorm:"column:token_hash;size:64;not null;uniqueIndex" json:"-"`
+	FamilyID   string     `gorm:"column:family_id;size:32;not null;index" json:"family_id"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	ReplacedBy *uint      `gorm:"column:replaced_by" json:"replaced_by,omitempty"`
+	UserAgent  string     `gorm:"column:user_agent;size:255" json:"user_agent"`
+	IPAddress  string     `gorm:"column:ip_address;size:45" json:"ip_address"`
+	// MFAVerified is carried over to the access tokens issued from this session
+	MFAVerified bool      `gorm:"column:mfa_verified;not null;default:false" json:"mfa_verified"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RevokedToken records the ID (jti) of an access token revoked before it
+// expired. Rows can be purged once ExpiresAt has passed.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"column:jti;size:32;not null;uniqueIndex" json:"jti"`
+	UserID    uint      `gorm:"column:user_id;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenPair is returned on login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// RefreshTokenRequest represents the request payload for refreshing or revoking a session
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest represents the request payload for logging out.
+// The refresh token is optional; when given, its whole session is ended.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// User token purposes
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email for
+// password resets and email verification. Only a hash of the token is stored.
+type UserToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"column:user_id;not null;index" json:"user_id"`
+	Purpose   string     `gorm:"column:purpose;size:32;not null;index" json:"purpose"`
+	TokenHash string     `gorm:"column:token_hash;size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
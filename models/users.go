@@ -17,9 +17,17 @@ type User struct {
 	City          string    `json:"city" validate:"required,min=2,max=100"`
 	ContactNumber string    `json:"contact_number" validate:"required,min=10,max=15"`
 	PaypalID      string    `json:"paypal_id"`
-	Role          string    `json:"role" validate:"required,oneof=admin customer"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	Role          string    `json:"role" validate:"required,max=50"` // name of a Role
+	// EmailVerified is set once the user follows the link sent on registration
+	EmailVerified   bool       `gorm:"column:email_verified;not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"email_verified_at,omitempty"`
+	// MFAEnabled is set once the user confirms a TOTP authenticator
+	MFAEnabled      bool       `gorm:"column:mfa_enabled;not null;default:false" json:"mfa_enabled"`
+	MFAEnabledAt    *time.Time `gorm:"column:mfa_enabled_at" json:"mfa_enabled_at,omitempty"`
+	MFASecret       string     `gorm:"column:mfa_secret;size:255" json:"-"`              // encrypted TOTP secret
+	MFALastStep     int64      `gorm:"column:mfa_last_step;not null;default:0" json:"-"` // time step of the last accepted code, to reject replays
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 // UserRegisterRequest represents the request payload for user registration
@@ -51,6 +59,27 @@ type UserLoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// ForgotPasswordRequest represents the request payload for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents the request payload for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// VerifyEmailRequest represents the request payload for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest represents the request payload for resending the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 var validate *validator.Validate
 
 func init() {
@@ -1,9 +1,12 @@
 package repositories
 
 import (
+	"errors"
 	"health-store/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CartRepository handles database operations for carts
@@ -16,14 +19,34 @@ func NewCartRepository(db *gorm.DB) *CartRepository {
 	return &CartRepository{db: db}
 }
 
-// FindOrCreateCart finds a user's cart or creates one if it doesn't exist
-func (r *CartRepository) FindOrCreateCart(userID uint) (*models.Cart, error) {
+// ownerScope restricts a cart query to the carts of owner
+func ownerScope(owner models.CartOwner) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if owner.IsGuest() {
+			return db.Where("guest_token = ? AND user_id IS NULL", owner.GuestToken)
+		}
+		return db.Where("user_id = ?", owner.UserID)
+	}
+}
+
+// FindOrCreateCart finds an owner's cart or creates one if it doesn't exist
+func (r *CartRepository) FindOrCreateCart(owner models.CartOwner) (*models.Cart, error) {
+	if owner.IsGuest() && owner.GuestToken == "" {
+		return nil, errors.New("guest cart token required")
+	}
+
 	var cart models.Cart
-	err := r.db.Where("user_id = ?", userID).First(&cart).Error
+	err := r.db.Scopes(ownerScope(owner)).First(&cart).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// Create new cart
-			cart = models.Cart{UserID: userID}
+			if owner.IsGuest() {
+				token := owner.GuestToken
+				cart = models.Cart{GuestToken: &token}
+			} else {
+				userID := owner.UserID
+				cart = models.Cart{UserID: &userID}
+			}
 			if err := r.db.Create(&cart).Error; err != nil {
 				return nil, err
 			}
@@ -34,12 +57,13 @@ func (r *CartRepository) FindOrCreateCart(userID uint) (*models.Cart, error) {
 	return &cart, nil
 }
 
-// FindCartByUserID finds a cart with full product details (for order processing)
-func (r *CartRepository) FindCartByUserID(userID uint) (*models.Cart, error) {
+// FindCartByOwner finds an owner's cart with full product details
+func (r *CartRepository) FindCartByOwner(owner models.CartOwner) (*models.Cart, error) {
 	var cart models.Cart
 	err := r.db.
 		Preload("CartItems.Product").
-		Where("user_id = ?", userID).
+		Preload("CartItems.Variant").
+		Scopes(ownerScope(owner)).
 		First(&cart).Error
 
 	if err != nil {
@@ -48,10 +72,32 @@ func (r *CartRepository) FindCartByUserID(userID uint) (*models.Cart, error) {
 	return &cart, nil
 }
 
+// FindCartByUserID finds a cart with full product details (for order processing)
+func (r *CartRepository) FindCartByUserID(userID uint) (*models.Cart, error) {
+	return r.FindCartByOwner(models.CartOwner{UserID: userID})
+}
+
+// FindCartByGuestToken finds a guest cart with its items.
+// It returns nil without an error when no cart has the token.
+func (r *CartRepository) FindCartByGuestToken(token string) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.
+		Preload("CartItems").
+		Scopes(ownerScope(models.CartOwner{GuestToken: token})).
+		First(&cart).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
 // FindCartBasic finds a cart with only basic information (for lightweight operations)
-func (r *CartRepository) FindCartBasic(userID uint) (*models.Cart, error) {
+func (r *CartRepository) FindCartBasic(owner models.CartOwner) (*models.Cart, error) {
 	var cart models.Cart
-	err := r.db.Where("user_id = ?", userID).First(&cart).Error
+	err := r.db.Scopes(ownerScope(owner)).First(&cart).Error
 	if err != nil {
 		return nil, err
 	}
@@ -59,9 +105,9 @@ func (r *CartRepository) FindCartBasic(userID uint) (*models.Cart, error) {
 }
 
 // FindCartWithCount finds a cart with item count only (for performance-critical operations)
-func (r *CartRepository) FindCartWithCount(userID uint) (*models.Cart, int64, error) {
+func (r *CartRepository) FindCartWithCount(owner models.CartOwner) (*models.Cart, int64, error) {
 	var cart models.Cart
-	err := r.db.Where("user_id = ?", userID).First(&cart).Error
+	err := r.db.Scopes(ownerScope(owner)).First(&cart).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -72,6 +118,14 @@ func (r *CartRepository) FindCartWithCount(userID uint) (*models.Cart, int64, er
 	return &cart, count, countErr
 }
 
+// DeleteCart deletes a cart and its items
+func (r *CartRepository) DeleteCart(cartID uint) error {
+	if err := r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+	return r.db.Delete(&models.Cart{}, cartID).Error
+}
+
 // CreateCartItem creates a new cart item
 func (r *CartRepository) CreateCartItem(item *models.CartItem) error {
 	return r.db.Create(item).Error
@@ -80,13 +134,39 @@ func (r *CartRepository) CreateCartItem(item *models.CartItem) error {
 // FindCartItemByID finds a cart item by ID
 func (r *CartRepository) FindCartItemByID(id uint) (*models.CartItem, error) {
 	var item models.CartItem
-	err := r.db.Preload("Product").First(&item, id).Error
+	err := r.db.Preload("Product").Preload("Variant").First(&item, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &item, nil
 }
 
+// FindCartItemByProduct finds the line for a product, or for one of its
+// variants when variantID is not nil, in a cart.
+// It returns nil without an error when the cart has no line for it.
+func (r *CartRepository) FindCartItemByProduct(cartID, productID uint, variantID *uint) (*models.CartItem, error) {
+	var item models.CartItem
+	query := r.db.Where("cart_id = ? AND product_id = ?", cartID, productID)
+	if variantID != nil {
+		query = query.Where("variant_id = ?", *variantID)
+	} else {
+		query = query.Where("variant_id IS NULL")
+	}
+	err := query.First(&item).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// UpdateCartItem saves changes to a cart item without touching its product
+func (r *CartRepository) UpdateCartItem(item *models.CartItem) error {
+	return r.db.Omit(clause.Associations).Save(item).Error
+}
+
 // DeleteCartItem deletes a cart item
 func (r *CartRepository) DeleteCartItem(id uint) error {
 	return r.db.Delete(&models.CartItem{}, id).Error
@@ -103,3 +183,109 @@ func (r *CartRepository) GetCartItemCount(cartID uint) (int64, error) {
 	err := r.db.Model(&models.CartItem{}).Where("cart_id = ?", cartID).Count(&count).Error
 	return count, err
 }
+
+// FindReservedQuantities returns the quantity held by active (unexpired)
+// reservations per product. Reservations belonging to excludeCartID are left
+// out so a checkout does not compete with its own cart; pass 0 to include all.
+func (r *CartRepository) FindReservedQuantities(productIDs []uint, excludeCartID uint) (map[uint]int, error) {
+	var rows []struct {
+		ProductID uint
+		Reserved  int
+	}
+
+	query := r.db.Model(&models.CartItem{}).
+		Select("product_id, COALESCE(SUM(reserved_quantity), 0) AS reserved").
+		Where("reserved_quantity > 0 AND reserved_until > ?", time.Now())
+	if len(productIDs) > 0 {
+		query = query.Where("product_id IN ?", productIDs)
+	}
+	if excludeCartID != 0 {
+		query = query.Where("cart_id <> ?", excludeCartID)
+	}
+
+	if err := query.Group("product_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// FindReservedVariantQuantities returns the quantity held by active
+// (unexpired) reservations per variant, leaving out the reservations of
+// excludeCartID like FindReservedQuantities
+func (r *CartRepository) FindReservedVariantQuantities(variantIDs []uint, excludeCartID uint) (map[uint]int, error) {
+	var rows []struct {
+		VariantID uint
+		Reserved  int
+	}
+
+	query := r.db.Model(&models.CartItem{}).
+		Select("variant_id, COALESCE(SUM(reserved_quantity), 0) AS reserved").
+		Where("variant_id IS NOT NULL AND reserved_quantity > 0 AND reserved_until > ?", time.Now())
+	if len(variantIDs) > 0 {
+		query = query.Where("variant_id IN ?", variantIDs)
+	}
+	if excludeCartID != 0 {
+		query = query.Where("cart_id <> ?", excludeCartID)
+	}
+
+	if err := query.Group("variant_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		reserved[row.VariantID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// ReleaseExpiredReservations drops the hold of every reservation that expired
+// before now. The cart lines themselves are kept so the customer can still
+// check out if stock remains available.
+func (r *CartRepository) ReleaseExpiredReservations(now time.Time) (int64, error) {
+	result := r.db.Model(&models.CartItem{}).
+		Where("reserved_quantity > 0 AND reserved_until <= ?", now).
+		Update("reserved_quantity", 0)
+	return result.RowsAffected, result.Error
+}
+
+// ConvertLegacyCartItems turns cart items created before reservations existed
+// (their stock was already deducted on add) into reservations expiring at
+// until, returning the deducted stock to the products and recording it in
+// the stock ledger
+func (r *CartRepository) ConvertLegacyCartItems(until time.Time) (int64, error) {
+	var converted int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO stock_movements (product_id, quantity, reason, note, created_at)
+			SELECT c.product_id, SUM(c.quantity), ?, ?, ? FROM cart_items c
+			JOIN products p ON p.id = c.product_id
+			WHERE c.reserved_until IS NULL GROUP BY c.product_id`,
+			models.StockReasonCartRemove, "legacy cart converted to a reservation", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`UPDATE products p
+			JOIN (SELECT product_id, SUM(quantity) AS quantity FROM cart_items
+				WHERE reserved_until IS NULL GROUP BY product_id) c ON c.product_id = p.id
+			SET p.stock = p.stock + c.quantity`).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.CartItem{}).
+			Where("reserved_until IS NULL").
+			Updates(map[string]interface{}{
+				"reserved_quantity": gorm.Expr("quantity"),
+				"reserved_until":    until,
+			})
+		converted = result.RowsAffected
+		return result.Error
+	})
+	return converted, err
+}
@@ -31,6 +31,11 @@ func (r *FeedbackRepository) FindByID(id uint) (*models.Feedback, error) {
 	return &feedback, nil
 }
 
+// Delete deletes a feedback
+func (r *FeedbackRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Feedback{}, id).Error
+}
+
 // FindByProductID finds feedback by product ID
 func (r *FeedbackRepository) FindByProductID(productID uint) ([]models.Feedback, error) {
 	var feedbacks []models.Feedback
@@ -38,6 +43,12 @@ func (r *FeedbackRepository) FindByProductID(productID uint) ([]models.Feedback,
 	return feedbacks, err
 }
 
+// ListByProductID finds a page of the feedback on a product
+func (r *FeedbackRepository) ListByProductID(productID uint, params models.ListParams) (*models.Page[models.Feedback], error) {
+	query := r.db.Where("feedbacks.product_id = ?", productID).Preload("User")
+	return paginate[models.Feedback](query, models.FeedbackListSpec, params)
+}
+
 // FindByUserID finds feedback by user ID
 func (r *FeedbackRepository) FindByUserID(userID uint) ([]models.Feedback, error) {
 	var feedbacks []models.Feedback
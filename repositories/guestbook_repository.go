@@ -31,11 +31,9 @@ func (r *GuestBookRepository) FindByID(id uint) (*models.GuestBook, error) {
 	return &entry, nil
 }
 
-// FindAll finds all guest book entries
-func (r *GuestBookRepository) FindAll() ([]models.GuestBook, error) {
-	var entries []models.GuestBook
-	err := r.db.Order("created_at DESC").Find(&entries).Error
-	return entries, err
+// List finds a page of guest book entries
+func (r *GuestBookRepository) List(params models.ListParams) (*models.Page[models.GuestBook], error) {
+	return paginate[models.GuestBook](r.db, models.GuestBookListSpec, params)
 }
 
 // Delete deletes a guest book entry
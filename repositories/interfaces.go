@@ -1,6 +1,9 @@
 package repositories
 
-import "health-store/models"
+import (
+	"health-store/models"
+	"time"
+)
 
 // UserRepositoryInterface defines methods for user repository
 type UserRepositoryInterface interface {
@@ -9,8 +12,9 @@ type UserRepositoryInterface interface {
 	FindByUsername(username string) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
 	Update(user *models.User) error
+	UpdateRoleIf(id uint, from []string, role string) (bool, error)
 	Delete(id uint) error
-	FindAll() ([]models.User, error)
+	List(params models.ListParams) (*models.Page[models.User], error)
 	ExistsByUsername(username string) (bool, error)
 	ExistsByEmail(email string) (bool, error)
 	// Report-specific methods
@@ -25,9 +29,24 @@ type ProductRepositoryInterface interface {
 	Update(product *models.Product) error
 	Delete(id uint) error
 	FindAll() ([]models.Product, error)
+	List(params models.ListParams) (*models.Page[models.Product], error)
+	FindListedByID(id uint) (*models.Product, error)
 	FindByCategory(categoryID uint) ([]models.Product, error)
-	UpdateStock(productID uint, quantity int) error
+	FindByShopID(shopID uint) ([]models.Product, error)
+	Search(req models.ProductSearchRequest, sort string, after *models.ProductSearchCursor, limit int) ([]models.ProductSearchHit, error)
+	CountSearch(req models.ProductSearchRequest) (int64, error)
+	SearchCategoryFacets(req models.ProductSearchRequest) ([]models.CategoryFacet, error)
 	ReduceStock(productID uint, quantity int) error
+	FindByIDsForUpdate(ids []uint) ([]models.Product, error)
+	CreateVariant(variant *models.ProductVariant) error
+	FindVariantByID(productID, variantID uint) (*models.ProductVariant, error)
+	FindVariantsByProductID(productID uint) ([]models.ProductVariant, error)
+	ExistsVariantSKU(sku string, excludeID uint) (bool, error)
+	UpdateVariant(variant *models.ProductVariant) error
+	DeleteVariant(variantID uint) error
+	IsVariantOrdered(variantID uint) (bool, error)
+	ReduceVariantStock(variantID uint, quantity int) error
+	SyncVariantStock(productID uint) error
 	// Report-specific methods
 	GetTopSellingProducts(limit int) ([]models.TopProduct, error)
 	GetProductCount() (int64, error)
@@ -37,14 +56,21 @@ type ProductRepositoryInterface interface {
 type OrderRepositoryInterface interface {
 	Create(order *models.Order) error
 	FindByID(id uint) (*models.Order, error)
-	FindByUserID(userID uint) ([]models.Order, error)
-	FindAll() ([]models.Order, error)
+	ListByUserID(userID uint, params models.ListParams) (*models.Page[models.Order], error)
+	FindByPaymentTransactionIDs(ids []string) (*models.Order, error)
+	List(params models.ListParams) (*models.Page[models.Order], error)
 	Update(order *models.Order) error
 	UpdateStatus(orderID uint, status string) error
 	UpdateOrderFields(orderID uint, updates map[string]interface{}) error
+	FindByIDForUpdate(id uint) (*models.Order, error)
 	CreateOrderItem(item *models.OrderItem) error
+	CreateShopOrder(shopOrder *models.ShopOrder) error
+	FindShopOrderByID(id uint) (*models.ShopOrder, error)
+	FindShopOrdersByShopID(shopID uint) ([]models.ShopOrder, error)
+	UpdateShopOrderFields(shopOrderID uint, updates map[string]interface{}) error
+	UpdateShopOrdersByOrderID(orderID uint, updates map[string]interface{}) error
+	CountPendingShopOrders(orderID uint) (int64, error)
 	GetOrderStatistics() (int64, error)
-	GetDB() interface{} // For transactions
 	FindOrderItemsByOrderID(orderID uint) ([]models.OrderItem, error)
 	// Report-specific methods
 	GetRecentOrders(limit int) ([]models.Order, error)
@@ -57,15 +83,24 @@ type OrderRepositoryInterface interface {
 
 // CartRepositoryInterface defines methods for cart repository
 type CartRepositoryInterface interface {
-	FindOrCreateCart(userID uint) (*models.Cart, error)
+	FindOrCreateCart(owner models.CartOwner) (*models.Cart, error)
+	FindCartByOwner(owner models.CartOwner) (*models.Cart, error)
 	FindCartByUserID(userID uint) (*models.Cart, error)
-	FindCartBasic(userID uint) (*models.Cart, error)
-	FindCartWithCount(userID uint) (*models.Cart, int64, error)
+	FindCartByGuestToken(token string) (*models.Cart, error)
+	FindCartBasic(owner models.CartOwner) (*models.Cart, error)
+	FindCartWithCount(owner models.CartOwner) (*models.Cart, int64, error)
+	DeleteCart(cartID uint) error
 	CreateCartItem(item *models.CartItem) error
 	FindCartItemByID(id uint) (*models.CartItem, error)
+	FindCartItemByProduct(cartID, productID uint, variantID *uint) (*models.CartItem, error)
+	UpdateCartItem(item *models.CartItem) error
 	DeleteCartItem(id uint) error
 	ClearCart(cartID uint) error
 	GetCartItemCount(cartID uint) (int64, error)
+	FindReservedQuantities(productIDs []uint, excludeCartID uint) (map[uint]int, error)
+	FindReservedVariantQuantities(variantIDs []uint, excludeCartID uint) (map[uint]int, error)
+	ReleaseExpiredReservations(now time.Time) (int64, error)
+	ConvertLegacyCartItems(until time.Time) (int64, error)
 }
 
 // CategoryRepositoryInterface defines methods for category repository
@@ -81,7 +116,94 @@ type CategoryRepositoryInterface interface {
 type FeedbackRepositoryInterface interface {
 	Create(feedback *models.Feedback) error
 	FindByID(id uint) (*models.Feedback, error)
+	Delete(id uint) error
 	FindByProductID(productID uint) ([]models.Feedback, error)
+	ListByProductID(productID uint, params models.ListParams) (*models.Page[models.Feedback], error)
 	FindByUserID(userID uint) ([]models.Feedback, error)
 	FindAll() ([]models.Feedback, error)
 }
+
+// LedgerRepositoryInterface defines methods for ledger repository
+type LedgerRepositoryInterface interface {
+	CreateTransaction(transaction *models.LedgerTransaction) error
+	HasOrderTransaction(orderID uint, transactionType string) (bool, error)
+	FindOrderTransactions(orderID uint, transactionType string) ([]models.LedgerTransaction, error)
+	FindShopTransactions(shopID uint, from, to *time.Time) ([]models.LedgerTransaction, error)
+	GetSellerBalance(shopID uint, before *time.Time) (float64, error)
+	GetSellerBalances() ([]models.SellerBalance, error)
+	LockSellerAccounts() error
+	FindCommissionRules() ([]models.CommissionRule, error)
+	FindCommissionRuleByScope(shopID, categoryID *uint) (*models.CommissionRule, error)
+	SaveCommissionRule(rule *models.CommissionRule) error
+	DeleteCommissionRule(id uint) (bool, error)
+	CreatePayoutBatch(batch *models.PayoutBatch) error
+	FindPayoutBatches() ([]models.PayoutBatch, error)
+	FindPayoutBatchByID(id uint) (*models.PayoutBatch, error)
+	UpdatePayoutBatchFields(batchID uint, updates map[string]interface{}) error
+	CreatePayout(payout *models.Payout) error
+	FindPayoutByIDForUpdate(id uint) (*models.Payout, error)
+	UpdatePayoutFields(payoutID uint, updates map[string]interface{}) error
+	CountPendingPayouts(batchID uint) (int64, error)
+}
+
+// InventoryRepositoryInterface defines methods for inventory repository
+type InventoryRepositoryInterface interface {
+	CreateLot(lot *models.InventoryLot) error
+	FindLotByID(productID, lotID uint) (*models.InventoryLot, error)
+	FindLotsByProductID(productID uint) ([]models.InventoryLot, error)
+	FindLotByNumber(productID uint, variantID *uint, lotNumber string) (*models.InventoryLot, error)
+	ExistsLotNumber(productID uint, variantID *uint, lotNumber string, excludeID uint) (bool, error)
+	UpdateLot(lot *models.InventoryLot) error
+	HasLots(productID uint, variantID *uint) (bool, error)
+	FindSellableLotsForUpdate(productID uint, variantID *uint, today time.Time) ([]models.InventoryLot, error)
+	FindExpiredQuantities(productIDs []uint, today time.Time) (map[uint]int, error)
+	FindExpiredVariantQuantities(variantIDs []uint, today time.Time) (map[uint]int, error)
+	ReduceLotQuantity(lotID uint, quantity int) error
+	CreateOrderItemLots(lots []models.OrderItemLot) error
+	FindOrderItemLotsByOrderID(orderID uint) ([]models.OrderItemLot, error)
+	CountRecalledAllocations(orderID, shopOrderID uint) (int64, error)
+	FindExpiringLots(until time.Time) ([]models.ExpiringLot, error)
+	FindStockLevels(since time.Time) ([]models.ProductStockLevel, error)
+	FindLowStockNotifications() ([]models.LowStockNotification, error)
+	CreateLowStockNotifications(notifications []models.LowStockNotification) error
+	DeleteLowStockNotificationsExcept(productIDs []uint) error
+}
+
+// RecallRepositoryInterface defines methods for recall repository
+type RecallRepositoryInterface interface {
+	Create(recall *models.Recall) error
+	FindByID(id uint) (*models.Recall, error)
+	List(params models.ListParams) (*models.Page[models.Recall], error)
+	Update(recall *models.Recall) error
+	RecallProduct(productID, recallID uint) error
+	RecallVariant(variantID, recallID uint) error
+	RecallLot(lotID, recallID uint) error
+	ReleaseProducts(recallID uint) error
+	FindAffectedItems(items []models.RecallItem) ([]models.RecallAffectedItem, error)
+	FindNotifications(recallID uint) ([]models.RecallNotification, error)
+	SaveNotification(notification *models.RecallNotification) error
+}
+
+// PrescriptionRepositoryInterface defines methods for prescription repository
+type PrescriptionRepositoryInterface interface {
+	Create(prescription *models.Prescription) error
+	FindByID(id uint) (*models.Prescription, error)
+	List(params models.ListParams) (*models.Page[models.Prescription], error)
+	Update(prescription *models.Prescription) error
+	WithdrawPending(orderID uint) error
+}
+
+// StockMovementRepositoryInterface defines methods for stock movement repository
+type StockMovementRepositoryInterface interface {
+	Create(movement *models.StockMovement) error
+	ListByProductID(productID uint, params models.ListParams) (*models.Page[models.StockMovement], error)
+	RecordOpeningStock(now time.Time) (int64, error)
+	FindDiscrepancies() ([]models.StockDiscrepancy, error)
+	FindFlaggedDiscrepancies() ([]models.StockDiscrepancy, error)
+	ReplaceDiscrepancies(discrepancies []models.StockDiscrepancy) error
+}
+
+// UnitOfWorkInterface defines methods for running repository operations in a transaction
+type UnitOfWorkInterface interface {
+	Execute(fn func(repos *TxRepositories) error) error
+}
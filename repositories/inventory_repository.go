@@ -0,0 +1,248 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InventoryRepository handles database operations for inventory lots
+type InventoryRepository struct {
+	db *gorm.DB
+}
+
+// NewInventoryRepository creates a new inventory repository
+func NewInventoryRepository(db *gorm.DB) *InventoryRepository {
+	return &InventoryRepository{db: db}
+}
+
+// lotScope restricts a lot query to the lots of a product, or of one of its
+// variants when variantID is not nil
+func lotScope(productID uint, variantID *uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("inventory_lots.product_id = ?", productID)
+		if variantID != nil {
+			return db.Where("inventory_lots.variant_id = ?", *variantID)
+		}
+		return db.Where("inventory_lots.variant_id IS NULL")
+	}
+}
+
+// CreateLot creates a new inventory lot
+func (r *InventoryRepository) CreateLot(lot *models.InventoryLot) error {
+	return r.db.Create(lot).Error
+}
+
+// FindLotByID finds a lot of a product by ID
+func (r *InventoryRepository) FindLotByID(productID, lotID uint) (*models.InventoryLot, error) {
+	var lot models.InventoryLot
+	err := r.db.Where("product_id = ?", productID).First(&lot, lotID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// FindLotsByProductID finds the lots of a product and its variants, earliest expiry first
+func (r *InventoryRepository) FindLotsByProductID(productID uint) ([]models.InventoryLot, error) {
+	var lots []models.InventoryLot
+	err := r.db.Where("product_id = ?", productID).Order("expiry_date, id").Find(&lots).Error
+	return lots, err
+}
+
+// FindLotByNumber finds the lot of a product, or variant, with a lot number
+func (r *InventoryRepository) FindLotByNumber(productID uint, variantID *uint, lotNumber string) (*models.InventoryLot, error) {
+	var lot models.InventoryLot
+	err := r.db.Scopes(lotScope(productID, variantID)).Where("lot_number = ?", lotNumber).First(&lot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// ExistsLotNumber reports whether a lot other than excludeID of the same
+// product or variant uses lotNumber. Pass 0 to check all lots.
+func (r *InventoryRepository) ExistsLotNumber(productID uint, variantID *uint, lotNumber string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.InventoryLot{}).
+		Scopes(lotScope(productID, variantID)).
+		Where("lot_number = ? AND id <> ?", lotNumber, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateLot saves changes to a lot
+func (r *InventoryRepository) UpdateLot(lot *models.InventoryLot) error {
+	return r.db.Omit(clause.Associations).Save(lot).Error
+}
+
+// HasLots reports whether a product, or variant when variantID is not nil,
+// is tracked by lot
+func (r *InventoryRepository) HasLots(productID uint, variantID *uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.InventoryLot{}).Scopes(lotScope(productID, variantID)).Count(&count).Error
+	return count > 0, err
+}
+
+// FindSellableLotsForUpdate finds the lots of a product, or variant, with
+// units left that expire on or after today and are not recalled, earliest
+// expiry first, and locks them until the surrounding transaction ends
+func (r *InventoryRepository) FindSellableLotsForUpdate(productID uint, variantID *uint, today time.Time) ([]models.InventoryLot, error) {
+	var lots []models.InventoryLot
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(lotScope(productID, variantID)).
+		Where("quantity > 0 AND expiry_date >= ? AND recall_id IS NULL", today).
+		Order("expiry_date, id").
+		Find(&lots).Error
+	return lots, err
+}
+
+// FindExpiredQuantities returns the units left in lots that expired before
+// today and are not recalled, per product. Those units are still counted in
+// the stock of the product but can not be sold.
+func (r *InventoryRepository) FindExpiredQuantities(productIDs []uint, today time.Time) (map[uint]int, error) {
+	var rows []struct {
+		ProductID uint
+		Expired   int
+	}
+	err := r.db.Model(&models.InventoryLot{}).
+		Select("product_id, COALESCE(SUM(quantity), 0) AS expired").
+		Where("product_id IN ? AND quantity > 0 AND expiry_date < ? AND recall_id IS NULL", productIDs, today).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		expired[row.ProductID] = row.Expired
+	}
+	return expired, nil
+}
+
+// FindExpiredVariantQuantities returns the units left in expired lots per
+// variant, like FindExpiredQuantities
+func (r *InventoryRepository) FindExpiredVariantQuantities(variantIDs []uint, today time.Time) (map[uint]int, error) {
+	var rows []struct {
+		VariantID uint
+		Expired   int
+	}
+	err := r.db.Model(&models.InventoryLot{}).
+		Select("variant_id, COALESCE(SUM(quantity), 0) AS expired").
+		Where("variant_id IN ? AND quantity > 0 AND expiry_date < ? AND recall_id IS NULL", variantIDs, today).
+		Group("variant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		expired[row.VariantID] = row.Expired
+	}
+	return expired, nil
+}
+
+// ReduceLotQuantity reduces the units left in a lot by quantity
+func (r *InventoryRepository) ReduceLotQuantity(lotID uint, quantity int) error {
+	return r.db.Model(&models.InventoryLot{}).Where("id = ?", lotID).
+		Update("quantity", gorm.Expr("quantity - ?", quantity)).Error
+}
+
+// CreateOrderItemLots records the lots the units of order items were taken from
+func (r *InventoryRepository) CreateOrderItemLots(lots []models.OrderItemLot) error {
+	if len(lots) == 0 {
+		return nil
+	}
+	return r.db.Create(&lots).Error
+}
+
+// FindOrderItemLotsByOrderID finds the lots the units of an order were taken from
+func (r *InventoryRepository) FindOrderItemLotsByOrderID(orderID uint) ([]models.OrderItemLot, error) {
+	var lots []models.OrderItemLot
+	err := r.db.Preload("Lot").Joins("JOIN order_items ON order_items.id = order_item_lots.order_item_id").
+		Where("order_items.order_id = ?", orderID).
+		Find(&lots).Error
+	return lots, err
+}
+
+// CountRecalledAllocations counts the lots the units of an order were taken
+// from that have since been recalled, for the items of one of its sub-orders
+// when shopOrderID is not 0
+func (r *InventoryRepository) CountRecalledAllocations(orderID, shopOrderID uint) (int64, error) {
+	var count int64
+	query := r.db.Model(&models.OrderItemLot{}).
+		Joins("JOIN order_items ON order_items.id = order_item_lots.order_item_id").
+		Joins("JOIN inventory_lots ON inventory_lots.id = order_item_lots.lot_id").
+		Where("order_items.order_id = ? AND inventory_lots.recall_id IS NOT NULL", orderID)
+	if shopOrderID != 0 {
+		query = query.Where("order_items.shop_order_id = ?", shopOrderID)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// FindExpiringLots finds the lots with units left that expire before until
+// and are not recalled, soonest first, with the name of their product and
+// the SKU of their variant
+func (r *InventoryRepository) FindExpiringLots(until time.Time) ([]models.ExpiringLot, error) {
+	var lots []models.ExpiringLot
+	err := r.db.Model(&models.InventoryLot{}).
+		Select("inventory_lots.*, products.name AS product_name, COALESCE(product_variants.sku, '') AS sku").
+		Joins("JOIN products ON products.id = inventory_lots.product_id").
+		Joins("LEFT JOIN product_variants ON product_variants.id = inventory_lots.variant_id").
+		Where("inventory_lots.quantity > 0 AND inventory_lots.expiry_date < ? AND inventory_lots.recall_id IS NULL", until).
+		Order("inventory_lots.expiry_date, inventory_lots.id").
+		Scan(&lots).Error
+	return lots, err
+}
+
+// FindStockLevels finds the stock of the products that are not recalled with
+// the units they sold in orders placed since since that were not cancelled,
+// failed or returned. Products with no reorder threshold that sold nothing
+// are left out, as they can not raise a low-stock alert.
+func (r *InventoryRepository) FindStockLevels(since time.Time) ([]models.ProductStockLevel, error) {
+	sales := r.db.Session(&gorm.Session{NewDB: true}).Table("order_items").
+		Select("order_items.product_id, SUM(order_items.quantity) AS units_sold").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.created_at >= ? AND orders.status NOT IN ?", since, []string{"cancelled", "failed", "returned"}).
+		Group("order_items.product_id")
+
+	var levels []models.ProductStockLevel
+	err := r.db.Model(&models.Product{}).
+		Select("products.id AS product_id, products.name AS product_name, products.shop_id, products.stock, products.reorder_threshold, COALESCE(sales.units_sold, 0) AS units_sold").
+		Joins("LEFT JOIN (?) AS sales ON sales.product_id = products.id", sales).
+		Where("products.recall_id IS NULL AND (products.reorder_threshold > 0 OR sales.units_sold > 0)").
+		Order("products.id").
+		Scan(&levels).Error
+	return levels, err
+}
+
+// FindLowStockNotifications finds the products admins were notified of
+func (r *InventoryRepository) FindLowStockNotifications() ([]models.LowStockNotification, error) {
+	var notifications []models.LowStockNotification
+	err := r.db.Find(&notifications).Error
+	return notifications, err
+}
+
+// CreateLowStockNotifications records that admins were notified of products
+func (r *InventoryRepository) CreateLowStockNotifications(notifications []models.LowStockNotification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&notifications).Error
+}
+
+// DeleteLowStockNotificationsExcept forgets the notifications of every
+// product but productIDs, so products whose stock recovered are notified
+// again when it next runs low
+func (r *InventoryRepository) DeleteLowStockNotificationsExcept(productIDs []uint) error {
+	query := r.db.Where("1 = 1")
+	if len(productIDs) > 0 {
+		query = r.db.Where("product_id NOT IN ?", productIDs)
+	}
+	return query.Delete(&models.LowStockNotification{}).Error
+}
@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerRepository handles database operations for the seller ledger,
+// commission rules and payouts
+type LedgerRepository struct {
+	db *gorm.DB
+}
+
+// NewLedgerRepository creates a new ledger repository
+func NewLedgerRepository(db *gorm.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// CreateTransaction creates a ledger transaction together with its entries
+func (r *LedgerRepository) CreateTransaction(transaction *models.LedgerTransaction) error {
+	return r.db.Create(transaction).Error
+}
+
+// HasOrderTransaction checks if an order already has a transaction of the given type
+func (r *LedgerRepository) HasOrderTransaction(orderID uint, transactionType string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.LedgerTransaction{}).
+		Where("order_id = ? AND type = ?", orderID, transactionType).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FindOrderTransactions finds the transactions of the given type posted for an order
+func (r *LedgerRepository) FindOrderTransactions(orderID uint, transactionType string) ([]models.LedgerTransaction, error) {
+	var transactions []models.LedgerTransaction
+	err := r.db.Preload("Entries").
+		Where("order_id = ? AND type = ?", orderID, transactionType).
+		Order("id ASC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// FindShopTransactions finds the transactions of a shop, oldest first. A nil
+// bound leaves that side of the period open.
+func (r *LedgerRepository) FindShopTransactions(shopID uint, from, to *time.Time) ([]models.LedgerTransaction, error) {
+	var transactions []models.LedgerTransaction
+	query := r.db.Preload("Entries").Where("shop_id = ?", shopID)
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	err := query.Order("created_at ASC, id ASC").Find(&transactions).Error
+	return transactions, err
+}
+
+// GetSellerBalance sums what is owed to a shop, counting only transactions
+// before the given time when it is not nil
+func (r *LedgerRepository) GetSellerBalance(shopID uint, before *time.Time) (float64, error) {
+	var balance float64
+	query := r.db.Model(&models.LedgerEntry{}).
+		Select("COALESCE(SUM(ledger_entries.credit - ledger_entries.debit), 0)").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_entries.account = ? AND ledger_entries.shop_id = ?", models.LedgerAccountSellerPayable, shopID)
+	if before != nil {
+		query = query.Where("ledger_transactions.created_at < ?", *before)
+	}
+	err := query.Scan(&balance).Error
+	return balance, err
+}
+
+// GetSellerBalances sums what is owed to every shop with ledger activity
+func (r *LedgerRepository) GetSellerBalances() ([]models.SellerBalance, error) {
+	var balances []models.SellerBalance
+	err := r.db.Model(&models.LedgerEntry{}).
+		Select("shop_id, COALESCE(SUM(credit - debit), 0) AS balance").
+		Where("account = ? AND shop_id IS NOT NULL", models.LedgerAccountSellerPayable).
+		Group("shop_id").
+		Order("shop_id ASC").
+		Scan(&balances).Error
+	return balances, err
+}
+
+// LockSellerAccounts locks the shop rows so only one payout batch is created at a time
+func (r *LedgerRepository) LockSellerAccounts() error {
+	var ids []uint
+	return r.db.Model(&models.Shop{}).Clauses(clause.Locking{Strength: "UPDATE"}).Pluck("id", &ids).Error
+}
+
+// FindCommissionRules finds all commission rules
+func (r *LedgerRepository) FindCommissionRules() ([]models.CommissionRule, error) {
+	var rules []models.CommissionRule
+	err := r.db.Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// FindCommissionRuleByScope finds the rule of a shop or of a category
+func (r *LedgerRepository) FindCommissionRuleByScope(shopID, categoryID *uint) (*models.CommissionRule, error) {
+	var rule models.CommissionRule
+	query := r.db
+	if shopID != nil {
+		query = query.Where("shop_id = ?", *shopID)
+	} else {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	if err := query.First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SaveCommissionRule creates or updates a commission rule
+func (r *LedgerRepository) SaveCommissionRule(rule *models.CommissionRule) error {
+	return r.db.Save(rule).Error
+}
+
+// DeleteCommissionRule deletes a commission rule, reporting whether it existed
+func (r *LedgerRepository) DeleteCommissionRule(id uint) (bool, error) {
+	result := r.db.Delete(&models.CommissionRule{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreatePayoutBatch creates a payout batch
+func (r *LedgerRepository) CreatePayoutBatch(batch *models.PayoutBatch) error {
+	return r.db.Create(batch).Error
+}
+
+// FindPayoutBatches finds all payout batches, newest first
+func (r *LedgerRepository) FindPayoutBatches() ([]models.PayoutBatch, error) {
+	var batches []models.PayoutBatch
+	err := r.db.Order("created_at DESC").Find(&batches).Error
+	return batches, err
+}
+
+// FindPayoutBatchByID finds a payout batch with its payouts
+func (r *LedgerRepository) FindPayoutBatchByID(id uint) (*models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+	err := r.db.Preload("Payouts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("payouts.shop_id ASC")
+	}).First(&batch, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// UpdatePayoutBatchFields updates specific fields of a payout batch
+func (r *LedgerRepository) UpdatePayoutBatchFields(batchID uint, updates map[string]interface{}) error {
+	return r.db.Model(&models.PayoutBatch{}).Where("id = ?", batchID).Updates(updates).Error
+}
+
+// CreatePayout creates a payout
+func (r *LedgerRepository) CreatePayout(payout *models.Payout) error {
+	return r.db.Create(payout).Error
+}
+
+// FindPayoutByIDForUpdate finds a payout and locks its row until the transaction ends
+func (r *LedgerRepository) FindPayoutByIDForUpdate(id uint) (*models.Payout, error) {
+	var payout models.Payout
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payout, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// UpdatePayoutFields updates specific fields of a payout
+func (r *LedgerRepository) UpdatePayoutFields(payoutID uint, updates map[string]interface{}) error {
+	return r.db.Model(&models.Payout{}).Where("id = ?", payoutID).Updates(updates).Error
+}
+
+// CountPendingPayouts counts the payouts of a batch that are not settled yet
+func (r *LedgerRepository) CountPendingPayouts(batchID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Payout{}).
+		Where("batch_id = ? AND status = ?", batchID, "pending").
+		Count(&count).Error
+	return count, err
+}
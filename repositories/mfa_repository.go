@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MFARepository handles database operations for TOTP settings and recovery codes
+type MFARepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new MFA repository
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// SavePendingSecret stores the encrypted secret of an enrollment that has not been confirmed yet
+func (r *MFARepository) SavePendingSecret(userID uint, secret string) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ? AND mfa_enabled = ?", userID, false).
+		Updates(map[string]interface{}{
+			"mfa_secret":    secret,
+			"mfa_last_step": 0,
+		}).Error
+}
+
+// Enable turns MFA on for a user and replaces their recovery codes in a single transaction
+func (r *MFARepository) Enable(userID uint, step int64, codes []models.MFARecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"mfa_enabled":    true,
+			"mfa_enabled_at": time.Now(),
+			"mfa_last_step":  step,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+}
+
+// Disable turns MFA off for a user and removes their secret and recovery codes
+func (r *MFARepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"mfa_enabled":    false,
+			"mfa_enabled_at": nil,
+			"mfa_secret":     "",
+			"mfa_last_step":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+	})
+}
+
+// AdvanceStep records step as the last accepted TOTP time step. It returns
+// false when a code of the same or a later step was already accepted, which
+// means the code is being replayed.
+func (r *MFARepository) AdvanceStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND mfa_last_step < ?", userID, step).
+		Update("mfa_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes removes a user's recovery codes and stores new ones
+func (r *MFARepository) ReplaceRecoveryCodes(userID uint, codes []models.MFARecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used. It returns
+// false when no unused code matches.
+func (r *MFARepository) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	result := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountUnusedRecoveryCodes counts the recovery codes a user has left
+func (r *MFARepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes within tx
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []models.MFARecoveryCode) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
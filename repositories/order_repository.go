@@ -4,6 +4,7 @@ import (
 	"health-store/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OrderRepository handles database operations for orders
@@ -24,34 +25,57 @@ func (r *OrderRepository) Create(order *models.Order) error {
 // FindByID finds an order by ID
 func (r *OrderRepository) FindByID(id uint) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("User").Preload("OrderItems.Product").First(&order, id).Error
+	err := r.db.Preload("User").Preload("OrderItems.Product").Preload("OrderItems.Variant").Preload("OrderItems.Lots").Preload("ShopOrders").Preload("Prescription").First(&order, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &order, nil
 }
 
-// FindByUserID finds orders by user ID
-func (r *OrderRepository) FindByUserID(userID uint) ([]models.Order, error) {
-	var orders []models.Order
-	err := r.db.
+// FindByIDForUpdate finds an order by ID and locks its row until the
+// surrounding transaction ends
+func (r *OrderRepository) FindByIDForUpdate(id uint) (*models.Order, error) {
+	var order models.Order
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListByUserID finds a page of the orders of a user
+func (r *OrderRepository) ListByUserID(userID uint, params models.ListParams) (*models.Page[models.Order], error) {
+	query := r.db.
 		Preload("User").
 		Preload("OrderItems").
 		Preload("OrderItems.Product").
-		Where("user_id = ?", userID).
-		Find(&orders).Error
-	return orders, err
+		Preload("OrderItems.Variant").
+		Preload("OrderItems.Lots").
+		Preload("Prescription").
+		Where("orders.user_id = ?", userID)
+	return paginate[models.Order](query, models.OrderListSpec, params)
 }
 
-// FindAll finds all orders
-func (r *OrderRepository) FindAll() ([]models.Order, error) {
-	var orders []models.Order
-	err := r.db.
+// FindByPaymentTransactionIDs finds the order whose payment transaction ID is one of ids
+func (r *OrderRepository) FindByPaymentTransactionIDs(ids []string) (*models.Order, error) {
+	var order models.Order
+	err := r.db.Preload("Prescription").Where("payment_transaction_id IN ?", ids).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// List finds a page of orders
+func (r *OrderRepository) List(params models.ListParams) (*models.Page[models.Order], error) {
+	query := r.db.
 		Preload("User").
 		Preload("OrderItems").
 		Preload("OrderItems.Product").
-		Find(&orders).Error
-	return orders, err
+		Preload("OrderItems.Variant").
+		Preload("OrderItems.Lots").
+		Preload("Prescription")
+	return paginate[models.Order](query, models.OrderListSpec, params)
 }
 
 // Update updates an order (updates all fields)
@@ -74,6 +98,57 @@ func (r *OrderRepository) CreateOrderItem(item *models.OrderItem) error {
 	return r.db.Create(item).Error
 }
 
+// CreateShopOrder creates a shop sub-order
+func (r *OrderRepository) CreateShopOrder(shopOrder *models.ShopOrder) error {
+	return r.db.Create(shopOrder).Error
+}
+
+// FindShopOrderByID finds a shop sub-order by ID
+func (r *OrderRepository) FindShopOrderByID(id uint) (*models.ShopOrder, error) {
+	var shopOrder models.ShopOrder
+	err := r.db.Preload("OrderItems.Product").Preload("OrderItems.Variant").Preload("OrderItems.Lots").First(&shopOrder, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &shopOrder, nil
+}
+
+// FindShopOrdersByShopID finds the sub-orders a shop has to fulfil, newest first,
+// with the customer of each order
+func (r *OrderRepository) FindShopOrdersByShopID(shopID uint) ([]models.ShopOrder, error) {
+	var shopOrders []models.ShopOrder
+	err := r.db.
+		Preload("Order.User").
+		Preload("OrderItems.Product").
+		Preload("OrderItems.Variant").
+		Preload("OrderItems.Lots").
+		Where("shop_id = ?", shopID).
+		Order("created_at DESC").
+		Find(&shopOrders).Error
+	return shopOrders, err
+}
+
+// UpdateShopOrderFields updates specific fields of a shop sub-order
+func (r *OrderRepository) UpdateShopOrderFields(shopOrderID uint, updates map[string]interface{}) error {
+	return r.db.Model(&models.ShopOrder{}).Where("id = ?", shopOrderID).Updates(updates).Error
+}
+
+// UpdateShopOrdersByOrderID updates specific fields of the pending sub-orders of an order
+func (r *OrderRepository) UpdateShopOrdersByOrderID(orderID uint, updates map[string]interface{}) error {
+	return r.db.Model(&models.ShopOrder{}).
+		Where("order_id = ? AND status = ?", orderID, "pending").
+		Updates(updates).Error
+}
+
+// CountPendingShopOrders counts the sub-orders of an order that have not shipped yet
+func (r *OrderRepository) CountPendingShopOrders(orderID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ShopOrder{}).
+		Where("order_id = ? AND status = ?", orderID, "pending").
+		Count(&count).Error
+	return count, err
+}
+
 // GetOrderStatistics returns order statistics for reporting
 func (r *OrderRepository) GetOrderStatistics() (int64, error) {
 	var count int64
@@ -81,11 +156,6 @@ func (r *OrderRepository) GetOrderStatistics() (int64, error) {
 	return count, err
 }
 
-// GetDB returns the database instance for transactions
-func (r *OrderRepository) GetDB() interface{} {
-	return r.db
-}
-
 // FindOrderItemsByOrderID finds all order items for a specific order
 func (r *OrderRepository) FindOrderItemsByOrderID(orderID uint) ([]models.OrderItem, error) {
 	var orderItems []models.OrderItem
@@ -109,7 +179,7 @@ func (r *OrderRepository) GetTotalRevenue() (float64, error) {
 	var totalRevenue float64
 	err := r.db.Model(&models.Order{}).
 		Select("COALESCE(SUM(total_price), 0)").
-		Where("status != ?", "cancelled").
+		Where("status NOT IN ?", []string{"cancelled", "returned"}).
 		Scan(&totalRevenue).Error
 	return totalRevenue, err
 }
@@ -156,7 +226,7 @@ func (r *OrderRepository) GetTopCustomers(limit int) ([]models.TopCustomer, erro
 	err := r.db.Model(&models.Order{}).
 		Select("users.id as user_id, users.username, users.email, COUNT(orders.id) as order_count, COALESCE(SUM(orders.total_price), 0) as total_spent").
 		Joins("JOIN users ON users.id = orders.user_id").
-		Where("orders.status != ?", "cancelled").
+		Where("orders.status NOT IN ?", []string{"cancelled", "returned"}).
 		Group("users.id, users.username, users.email").
 		Order("total_spent DESC").
 		Limit(limit).
@@ -171,7 +241,7 @@ func (r *OrderRepository) GetRevenueByDateRange(startDate, endDate string) (floa
 	err := r.db.Model(&models.Order{}).
 		Select("COALESCE(SUM(total_price), 0)").
 		Where("created_at BETWEEN ? AND ?", startDate, endDate).
-		Where("status != ?", "cancelled").
+		Where("status NOT IN ?", []string{"cancelled", "returned"}).
 		Scan(&revenue).Error
 	return revenue, err
 }
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"health-store/models"
+
+	"gorm.io/gorm"
+)
+
+// paginate loads one page of query as described by params, which must have
+// been checked against spec. Items are ordered by the sort column and then
+// by ID, so every item appears on exactly one page even when sort values
+// repeat; the next cursor is set when there are more items.
+func paginate[T any](query *gorm.DB, spec models.ListSpec, params models.ListParams) (*models.Page[T], error) {
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	table := stmt.Schema.Table
+
+	for name, value := range params.Filters {
+		column := spec.Filters[name]
+		field := stmt.Schema.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("can not filter %s by %s", table, column)
+		}
+		filter, err := parseListValue(field.FieldType, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidListParams, name)
+		}
+		query = query.Where(fmt.Sprintf("%s.%s = ?", table, column), filter)
+	}
+
+	column := spec.Sorts[params.Sort]
+	field := stmt.Schema.LookUpField(column)
+	primary := stmt.Schema.PrioritizedPrimaryField
+	if field == nil || primary == nil {
+		return nil, fmt.Errorf("can not sort %s by %s", table, column)
+	}
+
+	sortColumn := fmt.Sprintf("%s.%s", table, column)
+	idColumn := fmt.Sprintf("%s.%s", table, primary.DBName)
+	operator, direction := ">", "ASC"
+	if params.Desc {
+		operator, direction = "<", "DESC"
+	}
+
+	if params.Cursor != nil {
+		value, err := parseListValue(field.FieldType, params.Cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cursor", models.ErrInvalidListParams)
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", sortColumn, operator, sortColumn, idColumn, operator),
+			value, value, params.Cursor.ID,
+		)
+	}
+
+	// Fetch one extra item to learn whether there is a next page
+	var items []T
+	err := query.Order(fmt.Sprintf("%s %s, %s %s", sortColumn, direction, idColumn, direction)).
+		Limit(params.Limit + 1).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.Page[T]{Data: items}
+	if len(items) > params.Limit {
+		page.Data = items[:params.Limit]
+		last := reflect.ValueOf(&page.Data[params.Limit-1]).Elem()
+		value, _ := field.ValueOf(context.Background(), last)
+		id, _ := primary.ValueOf(context.Background(), last)
+		page.NextCursor = models.ListCursor{
+			Sort:  params.Sort,
+			Desc:  params.Desc,
+			Value: formatCursorValue(value),
+			ID:    uint(reflect.ValueOf(id).Uint()),
+		}.Encode()
+	}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	page.Count = len(page.Data)
+	return page, nil
+}
+
+// formatCursorValue writes a sort value into a cursor
+func formatCursorValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseListValue reads a filter value, or a sort value written by
+// formatCursorValue, as the type of the field it is compared with, so
+// malformed values are rejected instead of being coerced by the database.
+// Integer fields only accept whole numbers that fit them.
+func parseListValue(fieldType reflect.Type, value string) (interface{}, error) {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	switch kind := fieldType.Kind(); {
+	case fieldType == reflect.TypeOf(time.Time{}):
+		return time.Parse(time.RFC3339Nano, value)
+	case kind == reflect.Bool:
+		return strconv.ParseBool(value)
+	case kind >= reflect.Int && kind <= reflect.Int64:
+		return strconv.ParseInt(value, 10, fieldType.Bits())
+	case kind >= reflect.Uint && kind <= reflect.Uint64:
+		return strconv.ParseUint(value, 10, fieldType.Bits())
+	case kind == reflect.Float32 || kind == reflect.Float64:
+		return strconv.ParseFloat(value, fieldType.Bits())
+	default:
+		return value, nil
+	}
+}
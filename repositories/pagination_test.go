@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseListValue(t *testing.T) {
+	var shopID *uint
+	cases := []struct {
+		name      string
+		fieldType reflect.Type
+		value     string
+		want      interface{}
+		wantErr   bool
+	}{
+		{name: "uint", fieldType: reflect.TypeOf(uint(0)), value: "42", want: uint64(42)},
+		{name: "uint pointer", fieldType: reflect.TypeOf(shopID), value: "7", want: uint64(7)},
+		{name: "fractional uint", fieldType: reflect.TypeOf(uint(0)), value: "1.5", wantErr: true},
+		{name: "fractional uint pointer", fieldType: reflect.TypeOf(shopID), value: "1.5", wantErr: true},
+		{name: "negative uint", fieldType: reflect.TypeOf(uint(0)), value: "-1", wantErr: true},
+		{name: "exponent uint", fieldType: reflect.TypeOf(uint(0)), value: "1e3", wantErr: true},
+		{name: "int", fieldType: reflect.TypeOf(0), value: "-3", want: int64(-3)},
+		{name: "fractional int", fieldType: reflect.TypeOf(0), value: "2.0", wantErr: true},
+		{name: "int out of range", fieldType: reflect.TypeOf(int8(0)), value: "300", wantErr: true},
+		{name: "float", fieldType: reflect.TypeOf(0.0), value: "19.99", want: 19.99},
+		{name: "bool", fieldType: reflect.TypeOf(false), value: "true", want: true},
+		{name: "time", fieldType: reflect.TypeOf(time.Time{}), value: "2024-01-20T15:00:00Z", want: time.Date(2024, 1, 20, 15, 0, 0, 0, time.UTC)},
+		{name: "malformed time", fieldType: reflect.TypeOf(time.Time{}), value: "yesterday", wantErr: true},
+		{name: "string", fieldType: reflect.TypeOf(""), value: "paid", want: "paid"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseListValue(tc.fieldType, tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseListValue(%q) = %v, want an error", tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListValue(%q): %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseListValue(%q) = %#v, want %#v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
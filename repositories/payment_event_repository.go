@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"time"
+
+	"health-store/models"
+
+	"gorm.io/gorm"
+)
+
+// PaymentEventRepository handles database operations for payment webhook events
+type PaymentEventRepository struct {
+	db *gorm.DB
+}
+
+// NewPaymentEventRepository creates a new payment event repository
+func NewPaymentEventRepository(db *gorm.DB) *PaymentEventRepository {
+	return &PaymentEventRepository{db: db}
+}
+
+// Create stores a new webhook event. It fails if the provider event ID was already stored.
+func (r *PaymentEventRepository) Create(event *models.PaymentWebhookEvent) error {
+	return r.db.Create(event).Error
+}
+
+// FindByID finds a webhook event by ID
+func (r *PaymentEventRepository) FindByID(id uint) (*models.PaymentWebhookEvent, error) {
+	var event models.PaymentWebhookEvent
+	err := r.db.First(&event, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// FindByProviderEventID finds a webhook event by its provider-assigned ID
+func (r *PaymentEventRepository) FindByProviderEventID(provider, eventID string) (*models.PaymentWebhookEvent, error) {
+	var event models.PaymentWebhookEvent
+	err := r.db.Where("provider = ? AND event_id = ?", provider, eventID).First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// FindAll finds webhook events, optionally filtered by status, newest first
+func (r *PaymentEventRepository) FindAll(status string) ([]models.PaymentWebhookEvent, error) {
+	var events []models.PaymentWebhookEvent
+	query := r.db.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// Claim marks a webhook event as processing if it was received but not
+// processed, failed, or was claimed before staleBefore by a delivery that never
+// finished. It reports whether the event was claimed, so only one delivery
+// processes it at a time.
+func (r *PaymentEventRepository) Claim(id uint, staleBefore time.Time) (bool, error) {
+	result := r.db.Model(&models.PaymentWebhookEvent{}).
+		Where("id = ?", id).
+		Where("status IN ? OR (status = ? AND updated_at < ?)", []string{"received", "failed"}, "processing", staleBefore).
+		Update("status", "processing")
+	return result.RowsAffected == 1, result.Error
+}
+
+// Update updates a webhook event
+func (r *PaymentEventRepository) Update(event *models.PaymentWebhookEvent) error {
+	return r.db.Save(event).Error
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"health-store/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PrescriptionRepository handles database operations for prescriptions
+type PrescriptionRepository struct {
+	db *gorm.DB
+}
+
+// NewPrescriptionRepository creates a new prescription repository
+func NewPrescriptionRepository(db *gorm.DB) *PrescriptionRepository {
+	return &PrescriptionRepository{db: db}
+}
+
+// Create creates a new prescription
+func (r *PrescriptionRepository) Create(prescription *models.Prescription) error {
+	return r.db.Create(prescription).Error
+}
+
+// FindByID finds a prescription by ID with its order, the customer and the
+// ordered products
+func (r *PrescriptionRepository) FindByID(id uint) (*models.Prescription, error) {
+	var prescription models.Prescription
+	err := r.db.Preload("Order.User").
+		Preload("Order.OrderItems.Product").
+		Preload("Order.OrderItems.Variant").
+		First(&prescription, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+// List finds a page of prescriptions with their order items
+func (r *PrescriptionRepository) List(params models.ListParams) (*models.Page[models.Prescription], error) {
+	query := r.db.Preload("Order.OrderItems.Product").Preload("Order.OrderItems.Variant")
+	return paginate[models.Prescription](query, models.PrescriptionListSpec, params)
+}
+
+// Update saves changes to a prescription, without its order
+func (r *PrescriptionRepository) Update(prescription *models.Prescription) error {
+	return r.db.Omit(clause.Associations).Save(prescription).Error
+}
+
+// WithdrawPending withdraws the prescription of an order if it has not been
+// reviewed yet
+func (r *PrescriptionRepository) WithdrawPending(orderID uint) error {
+	return r.db.Model(&models.Prescription{}).
+		Where("order_id = ? AND status = ?", orderID, models.PrescriptionStatusPending).
+		Update("status", models.PrescriptionStatusWithdrawn).Error
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Cache entry for products
@@ -37,21 +38,26 @@ func (r *ProductRepository) Create(product *models.Product) error {
 // FindByID finds a product by ID
 func (r *ProductRepository) FindByID(id uint) (*models.Product, error) {
 	var product models.Product
-	err := r.db.Preload("Category").First(&product, id).Error
+	err := r.db.Preload("Category").Preload("Variants", variantOrder).First(&product, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &product, nil
 }
 
-// Update updates a product
+// Update updates a product. Its variants are saved separately.
 func (r *ProductRepository) Update(product *models.Product) error {
-	return r.db.Save(product).Error
+	return r.db.Omit("Variants").Save(product).Error
 }
 
-// Delete deletes a product
+// Delete deletes a product and its variants
 func (r *ProductRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Product{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Product{}, id).Error
+	})
 }
 
 // FindAll finds all products
@@ -61,6 +67,36 @@ func (r *ProductRepository) FindAll() ([]models.Product, error) {
 	return products, err
 }
 
+// List finds a page of products, including products of inactive shops
+func (r *ProductRepository) List(params models.ListParams) (*models.Page[models.Product], error) {
+	return paginate[models.Product](r.db.Preload("Category").Preload("Variants", variantOrder), models.ProductListSpec, params)
+}
+
+// listed limits a product query to the products on sale: store products and
+// products of active shops that are not recalled
+func listed(db *gorm.DB) *gorm.DB {
+	return db.Joins("LEFT JOIN shops ON shops.id = products.shop_id").
+		Where("products.shop_id IS NULL OR shops.is_active = ?", true).
+		Where("products.recall_id IS NULL")
+}
+
+// FindListedByID finds a product by ID if it is on sale
+func (r *ProductRepository) FindListedByID(id uint) (*models.Product, error) {
+	var product models.Product
+	err := r.db.Scopes(listed).Preload("Category").Preload("Variants", variantOrder).First(&product, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// FindByShopID finds the products of a shop
+func (r *ProductRepository) FindByShopID(shopID uint) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.Preload("Category").Preload("Variants", variantOrder).Where("shop_id = ?", shopID).Find(&products).Error
+	return products, err
+}
+
 // FindAllCached finds all products with caching for better performance
 func (r *ProductRepository) FindAllCached() ([]models.Product, error) {
 	cacheKey := "products:all"
@@ -103,26 +139,108 @@ func (r *ProductRepository) InvalidateCache() {
 // FindByCategory finds products by category ID
 func (r *ProductRepository) FindByCategory(categoryID uint) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Where("category_id = ?", categoryID).Find(&products).Error
+	err := r.db.Preload("Variants", variantOrder).Where("category_id = ?", categoryID).Find(&products).Error
 	return products, err
 }
 
-// UpdateStock updates product stock
-func (r *ProductRepository) UpdateStock(productID uint, quantity int) error {
-	return r.db.Model(&models.Product{}).Where("id = ?", productID).
-		Update("stock", quantity).Error
-}
-
 // ReduceStock reduces product stock by the specified quantity
 func (r *ProductRepository) ReduceStock(productID uint, quantity int) error {
 	return r.db.Model(&models.Product{}).Where("id = ?", productID).
 		Update("stock", gorm.Expr("stock - ?", quantity)).Error
 }
 
+// variantOrder lists the variants of a product in the order they were added
+func variantOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// CreateVariant creates a new product variant
+func (r *ProductRepository) CreateVariant(variant *models.ProductVariant) error {
+	return r.db.Create(variant).Error
+}
+
+// FindVariantByID finds a variant of a product by ID
+func (r *ProductRepository) FindVariantByID(productID, variantID uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.Where("product_id = ?", productID).First(&variant, variantID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// FindVariantsByProductID finds the variants of a product
+func (r *ProductRepository) FindVariantsByProductID(productID uint) ([]models.ProductVariant, error) {
+	var variants []models.ProductVariant
+	err := r.db.Scopes(variantOrder).Where("product_id = ?", productID).Find(&variants).Error
+	return variants, err
+}
+
+// ExistsVariantSKU reports whether a variant other than excludeID uses sku.
+// Pass 0 to check all variants.
+func (r *ProductRepository) ExistsVariantSKU(sku string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", sku, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateVariant saves changes to a variant
+func (r *ProductRepository) UpdateVariant(variant *models.ProductVariant) error {
+	return r.db.Save(variant).Error
+}
+
+// DeleteVariant deletes a variant and the cart lines holding it
+func (r *ProductRepository) DeleteVariant(variantID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("variant_id = ?", variantID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ProductVariant{}, variantID).Error
+	})
+}
+
+// IsVariantOrdered reports whether a variant appears on any order
+func (r *ProductRepository) IsVariantOrdered(variantID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.OrderItem{}).Where("variant_id = ?", variantID).Count(&count).Error
+	return count > 0, err
+}
+
+// ReduceVariantStock reduces variant stock by the specified quantity
+func (r *ProductRepository) ReduceVariantStock(variantID uint, quantity int) error {
+	return r.db.Model(&models.ProductVariant{}).Where("id = ?", variantID).
+		Update("stock", gorm.Expr("stock - ?", quantity)).Error
+}
+
+// SyncVariantStock sets the stock of a product with variants to the total
+// stock of its variants
+func (r *ProductRepository) SyncVariantStock(productID uint) error {
+	total := r.db.Model(&models.ProductVariant{}).Select("COALESCE(SUM(stock), 0)").Where("product_id = ?", productID)
+	return r.db.Model(&models.Product{}).Where("id = ?", productID).
+		Update("stock", total).Error
+}
+
 // FindByIDs finds multiple products by their IDs in a single query (optimizes N+1 problem)
 func (r *ProductRepository) FindByIDs(ids []uint) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Preload("Category").Where("id IN ?", ids).Find(&products).Error
+	err := r.db.Preload("Category").Preload("Variants", variantOrder).Where("id IN ?", ids).Find(&products).Error
+	return products, err
+}
+
+// FindByIDsForUpdate finds multiple products by their IDs and locks the rows,
+// and the rows of their variants, (SELECT ... FOR UPDATE) until the
+// surrounding transaction ends. The shop of each product is loaded so callers
+// can check it is still selling.
+func (r *ProductRepository) FindByIDsForUpdate(ids []uint) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Shop").
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id")
+		}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&products).Error
 	return products, err
 }
 
@@ -148,7 +266,7 @@ func (r *ProductRepository) GetTopSellingProducts(limit int) ([]models.TopProduc
 		Select("products.id as product_id, products.name as product_name, SUM(order_items.quantity) as total_sold, SUM(order_items.quantity * order_items.price) as total_revenue").
 		Joins("JOIN products ON products.id = order_items.product_id").
 		Joins("JOIN orders ON orders.id = order_items.order_id").
-		Where("orders.status != ?", "cancelled").
+		Where("orders.status NOT IN ?", []string{"cancelled", "returned"}).
 		Group("products.id, products.name").
 		Order("total_sold DESC").
 		Limit(limit).
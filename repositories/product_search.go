@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// productMatch scores products against a full-text query using the
+// idx_products_search FULLTEXT index
+const productMatch = "MATCH(products.name, products.description) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// productSearchFilters limits a query on the products table to the listed
+// products matching the search. The category filter is left out when
+// withCategory is false, so facets can count the other categories.
+func productSearchFilters(req models.ProductSearchRequest, withCategory bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(listed)
+		if req.Query != "" {
+			db = db.Where(productMatch, req.Query)
+		}
+		if withCategory && req.CategoryID != nil {
+			db = db.Where("products.category_id = ?", *req.CategoryID)
+		}
+		if req.ShopID != nil {
+			db = db.Where("products.shop_id = ?", *req.ShopID)
+		}
+		if req.MinPrice != nil {
+			db = db.Where("products.price >= ?", *req.MinPrice)
+		}
+		if req.MaxPrice != nil {
+			db = db.Where("products.price <= ?", *req.MaxPrice)
+		}
+		if req.InStock {
+			db = db.Joins("LEFT JOIN (?) AS reservations ON reservations.product_id = products.id", productReservations(db)).
+				Joins("LEFT JOIN (?) AS expired_lots ON expired_lots.product_id = products.id", productExpiredUnits(db)).
+				Where("products.stock - COALESCE(expired_lots.expired, 0) - COALESCE(reservations.reserved, 0) > ?", 0)
+		}
+		if req.MinRating != nil {
+			db = db.Joins("LEFT JOIN (?) AS ratings ON ratings.product_id = products.id", productRatings(db)).
+				Where("COALESCE(ratings.average_rating, 0) >= ?", *req.MinRating)
+		}
+		return db
+	}
+}
+
+// productReservations sums the units of each product held by active cart
+// reservations, so the stock left to sell is stock minus reserved
+func productReservations(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Table("cart_items").
+		Select("product_id, SUM(reserved_quantity) AS reserved").
+		Where("reserved_quantity > 0 AND reserved_until > ?", time.Now()).
+		Group("product_id")
+}
+
+// productExpiredUnits sums the units left in the expired lots of each product
+// that are not recalled, which are counted in stock but can not be sold
+func productExpiredUnits(db *gorm.DB) *gorm.DB {
+	year, month, day := time.Now().Date()
+	return db.Session(&gorm.Session{NewDB: true}).Table("inventory_lots").
+		Select("product_id, SUM(quantity) AS expired").
+		Where("quantity > 0 AND expiry_date < ? AND recall_id IS NULL", time.Date(year, month, day, 0, 0, 0, 0, time.Local)).
+		Group("product_id")
+}
+
+// productRatings averages the feedback ratings of each product
+func productRatings(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Table("feedbacks").
+		Select("product_id, ROUND(AVG(rating), 4) AS average_rating").
+		Group("product_id")
+}
+
+// productSales sums the units sold of each product in orders that were not cancelled or returned
+func productSales(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Table("order_items").
+		Select("order_items.product_id, SUM(order_items.quantity) AS units_sold").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status NOT IN ?", []string{"cancelled", "returned"}).
+		Group("order_items.product_id")
+}
+
+// Search finds a page of listed products matching the search, ordered by
+// sort and starting after the cursor when it is not nil. Ties are broken by
+// product ID so every product appears on exactly one page.
+func (r *ProductRepository) Search(req models.ProductSearchRequest, sort string, after *models.ProductSearchCursor, limit int) ([]models.ProductSearchHit, error) {
+	matches := r.db.Table("products").Scopes(productSearchFilters(req, true))
+
+	switch sort {
+	case models.ProductSortRelevance:
+		// Rounded so the value survives the round trip through the cursor
+		matches = matches.Select("products.id AS id, ROUND("+productMatch+", 6) AS sort_value", req.Query)
+	case models.ProductSortPriceAsc, models.ProductSortPriceDesc:
+		matches = matches.Select("products.id AS id, products.price AS sort_value")
+	case models.ProductSortPopularity:
+		matches = matches.Joins("LEFT JOIN (?) AS sales ON sales.product_id = products.id", productSales(r.db)).
+			Select("products.id AS id, COALESCE(sales.units_sold, 0) AS sort_value")
+	case models.ProductSortRating:
+		// The min_rating filter has already joined the ratings
+		if req.MinRating == nil {
+			matches = matches.Joins("LEFT JOIN (?) AS ratings ON ratings.product_id = products.id", productRatings(r.db))
+		}
+		matches = matches.Select("products.id AS id, COALESCE(ratings.average_rating, 0) AS sort_value")
+	default:
+		matches = matches.Select("products.id AS id, UNIX_TIMESTAMP(products.created_at) AS sort_value")
+	}
+
+	page := r.db.Table("(?) AS matches", matches)
+	if sort == models.ProductSortPriceAsc {
+		if after != nil {
+			page = page.Where("sort_value > ? OR (sort_value = ? AND id > ?)", after.Value, after.Value, after.ID)
+		}
+		page = page.Order("sort_value ASC, id ASC")
+	} else {
+		if after != nil {
+			page = page.Where("sort_value < ? OR (sort_value = ? AND id < ?)", after.Value, after.Value, after.ID)
+		}
+		page = page.Order("sort_value DESC, id DESC")
+	}
+
+	var hits []models.ProductSearchHit
+	err := page.Select("id, sort_value").Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+// CountSearch counts the listed products matching the search
+func (r *ProductRepository) CountSearch(req models.ProductSearchRequest) (int64, error) {
+	var total int64
+	err := r.db.Table("products").Scopes(productSearchFilters(req, true)).Count(&total).Error
+	return total, err
+}
+
+// SearchCategoryFacets counts the products matching the search in each
+// category, ignoring the category filter
+func (r *ProductRepository) SearchCategoryFacets(req models.ProductSearchRequest) ([]models.CategoryFacet, error) {
+	var facets []models.CategoryFacet
+	err := r.db.Table("products").Scopes(productSearchFilters(req, false)).
+		Select("products.category_id AS category_id, categories.name AS name, COUNT(*) AS count").
+		Joins("JOIN categories ON categories.id = products.category_id").
+		Group("products.category_id, categories.name").
+		Order("count DESC, categories.name ASC").
+		Scan(&facets).Error
+	return facets, err
+}
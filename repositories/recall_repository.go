@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"health-store/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecallRepository handles database operations for product recalls
+type RecallRepository struct {
+	db *gorm.DB
+}
+
+// NewRecallRepository creates a new recall repository
+func NewRecallRepository(db *gorm.DB) *RecallRepository {
+	return &RecallRepository{db: db}
+}
+
+// Create creates a recall together with its items
+func (r *RecallRepository) Create(recall *models.Recall) error {
+	return r.db.Create(recall).Error
+}
+
+// FindByID finds a recall by ID with its items
+func (r *RecallRepository) FindByID(id uint) (*models.Recall, error) {
+	var recall models.Recall
+	err := r.db.Preload("Items").First(&recall, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &recall, nil
+}
+
+// List finds a page of recalls with their items
+func (r *RecallRepository) List(params models.ListParams) (*models.Page[models.Recall], error) {
+	return paginate[models.Recall](r.db.Preload("Items"), models.RecallListSpec, params)
+}
+
+// Update saves changes to a recall, without its items
+func (r *RecallRepository) Update(recall *models.Recall) error {
+	return r.db.Omit(clause.Associations).Save(recall).Error
+}
+
+// RecallProduct blocks every unit of a product from sale, unless another
+// recall already does
+func (r *RecallRepository) RecallProduct(productID, recallID uint) error {
+	return r.db.Model(&models.Product{}).
+		Where("id = ? AND recall_id IS NULL", productID).
+		Update("recall_id", recallID).Error
+}
+
+// RecallVariant blocks every unit of a variant from sale, unless another
+// recall already does
+func (r *RecallRepository) RecallVariant(variantID, recallID uint) error {
+	return r.db.Model(&models.ProductVariant{}).
+		Where("id = ? AND recall_id IS NULL", variantID).
+		Update("recall_id", recallID).Error
+}
+
+// RecallLot marks a lot as recalled
+func (r *RecallRepository) RecallLot(lotID, recallID uint) error {
+	return r.db.Model(&models.InventoryLot{}).
+		Where("id = ?", lotID).
+		Update("recall_id", recallID).Error
+}
+
+// ReleaseProducts puts the products and variants blocked by a recall back on
+// sale. Recalled lots stay recalled.
+func (r *RecallRepository) ReleaseProducts(recallID uint) error {
+	if err := r.db.Model(&models.Product{}).Where("recall_id = ?", recallID).
+		Update("recall_id", nil).Error; err != nil {
+		return err
+	}
+	return r.db.Model(&models.ProductVariant{}).Where("recall_id = ?", recallID).
+		Update("recall_id", nil).Error
+}
+
+// FindAffectedItems finds the units of non-cancelled orders covered by the
+// recall items, one row per order item and lot, with the customer who
+// bought them. Oldest orders come first.
+func (r *RecallRepository) FindAffectedItems(items []models.RecallItem) ([]models.RecallAffectedItem, error) {
+	var affected []models.RecallAffectedItem
+	if len(items) == 0 {
+		return affected, nil
+	}
+
+	conditions := make([]string, 0, len(items))
+	args := make([]interface{}, 0, len(items)*2)
+	for _, item := range items {
+		switch {
+		case item.LotID != nil:
+			conditions = append(conditions, "order_item_lots.lot_id = ?")
+			args = append(args, *item.LotID)
+		case item.VariantID != nil:
+			conditions = append(conditions, "(order_items.product_id = ? AND order_items.variant_id = ?)")
+			args = append(args, item.ProductID, *item.VariantID)
+		default:
+			conditions = append(conditions, "order_items.product_id = ?")
+			args = append(args, item.ProductID)
+		}
+	}
+
+	err := r.db.Table("order_items").
+		Select("orders.id AS order_id, orders.created_at AS ordered_at, orders.status AS order_status, "+
+			"users.id AS user_id, users.username, users.email, users.contact_number, users.address, users.city, "+
+			"order_items.product_id, products.name AS product_name, COALESCE(product_variants.sku, '') AS sku, "+
+			"COALESCE(order_item_lots.lot_number, '') AS lot_number, COALESCE(order_item_lots.quantity, order_items.quantity) AS quantity").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Joins("JOIN users ON users.id = orders.user_id").
+		Joins("JOIN products ON products.id = order_items.product_id").
+		Joins("LEFT JOIN product_variants ON product_variants.id = order_items.variant_id").
+		Joins("LEFT JOIN order_item_lots ON order_item_lots.order_item_id = order_items.id").
+		Where("orders.status NOT IN ?", []string{"cancelled", "failed", "returned"}).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Order("orders.created_at, orders.id, order_items.id, order_item_lots.id").
+		Scan(&affected).Error
+	return affected, err
+}
+
+// FindNotifications finds the notifications of a recall
+func (r *RecallRepository) FindNotifications(recallID uint) ([]models.RecallNotification, error) {
+	var notifications []models.RecallNotification
+	err := r.db.Where("recall_id = ?", recallID).Find(&notifications).Error
+	return notifications, err
+}
+
+// SaveNotification creates or updates a recall notification
+func (r *RecallRepository) SaveNotification(notification *models.RecallNotification) error {
+	return r.db.Save(notification).Error
+}
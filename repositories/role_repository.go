@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"health-store/models"
+
+	"gorm.io/gorm"
+)
+
+// RoleRepository handles database operations for roles and their permissions
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// FindAll finds all roles with their permissions
+func (r *RoleRepository) FindAll() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Preload("Grants").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// FindByID finds a role with its permissions by ID
+func (r *RoleRepository) FindByID(id uint) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Preload("Grants").First(&role, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindByName finds a role with its permissions by name.
+// It returns nil without an error when no role matches.
+func (r *RoleRepository) FindByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Preload("Grants").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create stores a role together with its permissions
+func (r *RoleRepository) Create(role *models.Role) error {
+	return r.db.Create(role).Error
+}
+
+// Update saves a role's fields and replaces its permissions in a single transaction
+func (r *RoleRepository) Update(role *models.Role, permissions []models.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Grants").Save(role).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		role.Grants = make([]models.RolePermission, 0, len(permissions))
+		for _, permission := range permissions {
+			role.Grants = append(role.Grants, models.RolePermission{RoleID: role.ID, Permission: permission})
+		}
+		if len(role.Grants) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Grants).Error
+	})
+}
+
+// Delete removes a role and its permissions
+func (r *RoleRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, id).Error
+	})
+}
+
+// CountUsers counts the users assigned to a role
+func (r *RoleRepository) CountUsers(name string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ?", name).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SecurityRepository handles database operations for login throttling and audit logs
+type SecurityRepository struct {
+	db *gorm.DB
+}
+
+// NewSecurityRepository creates a new security repository
+func NewSecurityRepository(db *gorm.DB) *SecurityRepository {
+	return &SecurityRepository{db: db}
+}
+
+// FindThrottles finds the throttles for the given keys. Keys without failures are absent from the result.
+func (r *SecurityRepository) FindThrottles(keys ...string) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	err := r.db.Where("throttle_key IN ?", keys).Find(&throttles).Error
+	return throttles, err
+}
+
+// UpdateThrottle locks the throttle for key (creating it if needed), lets
+// update modify it and saves the result, all in one transaction so
+// concurrent failures are counted correctly
+func (r *SecurityRepository) UpdateThrottle(key string, update func(throttle *models.LoginThrottle)) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists so it can be locked
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Key: key, LastFailureAt: time.Now()}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("throttle_key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+
+		update(&throttle)
+		return tx.Save(&throttle).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// DeleteThrottle removes the throttle for key, clearing its failures and lock
+func (r *SecurityRepository) DeleteThrottle(key string) error {
+	return r.db.Where("throttle_key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// DeleteStaleThrottles removes unlocked throttles whose last failure is older than before
+func (r *SecurityRepository) DeleteStaleThrottles(before time.Time) (int64, error) {
+	result := r.db.
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&models.LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
+
+// CreateAuditLog stores an audit log entry
+func (r *SecurityRepository) CreateAuditLog(entry *models.AuditLog) error {
+	return r.db.Create(entry).Error
+}
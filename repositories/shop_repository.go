@@ -31,25 +31,15 @@ func (r *ShopRequestRepository) FindByID(id uint) (*models.ShopRequest, error) {
 	return &request, nil
 }
 
-// FindByUserID finds shop requests by user ID
-func (r *ShopRequestRepository) FindByUserID(userID uint) ([]models.ShopRequest, error) {
-	var requests []models.ShopRequest
-	err := r.db.Where("user_id = ?", userID).Preload("User").Find(&requests).Error
-	return requests, err
+// ListByUserID finds a page of the shop requests of a user
+func (r *ShopRequestRepository) ListByUserID(userID uint, params models.ListParams) (*models.Page[models.ShopRequest], error) {
+	query := r.db.Where("shop_requests.user_id = ?", userID).Preload("User")
+	return paginate[models.ShopRequest](query, models.ShopRequestListSpec, params)
 }
 
-// FindAll finds all shop requests
-func (r *ShopRequestRepository) FindAll() ([]models.ShopRequest, error) {
-	var requests []models.ShopRequest
-	err := r.db.Preload("User").Order("created_at DESC").Find(&requests).Error
-	return requests, err
-}
-
-// FindByStatus finds shop requests by status
-func (r *ShopRequestRepository) FindByStatus(status string) ([]models.ShopRequest, error) {
-	var requests []models.ShopRequest
-	err := r.db.Where("status = ?", status).Preload("User").Order("created_at DESC").Find(&requests).Error
-	return requests, err
+// List finds a page of shop requests
+func (r *ShopRequestRepository) List(params models.ListParams) (*models.Page[models.ShopRequest], error) {
+	return paginate[models.ShopRequest](r.db.Preload("User"), models.ShopRequestListSpec, params)
 }
 
 // Update updates a shop request
@@ -64,6 +54,87 @@ func (r *ShopRequestRepository) HasPendingRequest(userID uint) (bool, error) {
 	return count > 0, err
 }
 
+// CountPendingRequests counts the shop requests of a user waiting for review
+func (r *ShopRequestRepository) CountPendingRequests(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ShopRequest{}).Where("user_id = ? AND status = ?", userID, "pending").Count(&count).Error
+	return count, err
+}
+
+// FindByIDWithDetails finds a shop request with its documents and comments
+func (r *ShopRequestRepository) FindByIDWithDetails(id uint) (*models.ShopRequest, error) {
+	var request models.ShopRequest
+	err := r.db.Preload("User").
+		Preload("Documents", func(db *gorm.DB) *gorm.DB {
+			return db.Order("shop_request_documents.created_at ASC")
+		}).
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("shop_request_comments.created_at ASC, shop_request_comments.id ASC")
+		}).
+		First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// UpdateStatusIf applies updates to a shop request only while its status is
+// one of from, reporting whether it did. Concurrent reviews of the same
+// request can not both succeed.
+func (r *ShopRequestRepository) UpdateStatusIf(id uint, from []string, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.ShopRequest{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateDocument attaches a document to a shop request
+func (r *ShopRequestRepository) CreateDocument(document *models.ShopRequestDocument) error {
+	return r.db.Create(document).Error
+}
+
+// FindDocumentByID finds a document of a shop request
+func (r *ShopRequestRepository) FindDocumentByID(requestID, documentID uint) (*models.ShopRequestDocument, error) {
+	var document models.ShopRequestDocument
+	err := r.db.Where("shop_request_id = ?", requestID).First(&document, documentID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// DeleteDocument deletes a document of a shop request
+func (r *ShopRequestRepository) DeleteDocument(documentID uint) error {
+	return r.db.Delete(&models.ShopRequestDocument{}, documentID).Error
+}
+
+// FindDocumentTypes lists the document types attached to a shop request
+func (r *ShopRequestRepository) FindDocumentTypes(requestID uint) ([]string, error) {
+	var types []string
+	err := r.db.Model(&models.ShopRequestDocument{}).Where("shop_request_id = ?", requestID).Distinct().Pluck("type", &types).Error
+	return types, err
+}
+
+// CreateComment adds a comment to a shop request
+func (r *ShopRequestRepository) CreateComment(comment *models.ShopRequestComment) error {
+	return r.db.Create(comment).Error
+}
+
+// FindComments finds the comments of a shop request, oldest first
+func (r *ShopRequestRepository) FindComments(requestID uint) ([]models.ShopRequestComment, error) {
+	var comments []models.ShopRequestComment
+	err := r.db.Where("shop_request_id = ?", requestID).Order("created_at ASC, id ASC").Find(&comments).Error
+	return comments, err
+}
+
+// FindCommentByID finds a comment of a shop request
+func (r *ShopRequestRepository) FindCommentByID(requestID, commentID uint) (*models.ShopRequestComment, error) {
+	var comment models.ShopRequestComment
+	err := r.db.Where("shop_request_id = ?", requestID).First(&comment, commentID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
 // ShopRepository handles database operations for shops
 type ShopRepository struct {
 	db *gorm.DB
@@ -130,6 +201,16 @@ func (r *ShopRepository) ExistsByUserID(userID uint) (bool, error) {
 	return count > 0, err
 }
 
+// HasProductsOrOrders checks if a shop still has products or sub-orders referring to it
+func (r *ShopRepository) HasProductsOrOrders(shopID uint) (bool, error) {
+	var count int64
+	if err := r.db.Model(&models.Product{}).Where("shop_id = ?", shopID).Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	err := r.db.Model(&models.ShopOrder{}).Where("shop_id = ?", shopID).Count(&count).Error
+	return count > 0, err
+}
+
 // FindByActiveStatus finds shops by active status
 func (r *ShopRepository) FindByActiveStatus(isActive bool) ([]models.Shop, error) {
 	var shops []models.Shop
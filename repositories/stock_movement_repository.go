@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockMovementRepository handles database operations for the stock ledger
+type StockMovementRepository struct {
+	db *gorm.DB
+}
+
+// NewStockMovementRepository creates a new stock movement repository
+func NewStockMovementRepository(db *gorm.DB) *StockMovementRepository {
+	return &StockMovementRepository{db: db}
+}
+
+// Create records a stock movement. Movements are never changed or deleted.
+func (r *StockMovementRepository) Create(movement *models.StockMovement) error {
+	return r.db.Create(movement).Error
+}
+
+// ListByProductID finds a page of the stock movements of a product and its variants
+func (r *StockMovementRepository) ListByProductID(productID uint, params models.ListParams) (*models.Page[models.StockMovement], error) {
+	return paginate[models.StockMovement](r.db.Where("product_id = ?", productID), models.StockMovementListSpec, params)
+}
+
+// RecordOpeningStock records the stock on hand of products that have no
+// stock movements yet as opening movements: one per variant, and one for
+// the stock a product holds apart from its variants. It returns the number
+// of products whose ledger was started.
+func (r *StockMovementRepository) RecordOpeningStock(now time.Time) (int64, error) {
+	var productIDs []uint
+	err := r.db.Model(&models.Product{}).
+		Where("NOT EXISTS (SELECT 1 FROM stock_movements WHERE stock_movements.product_id = products.id)").
+		Pluck("id", &productIDs).Error
+	if err != nil || len(productIDs) == 0 {
+		return 0, err
+	}
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO stock_movements (product_id, variant_id, quantity, reason, created_at)
+			SELECT product_id, id, stock, ?, ? FROM product_variants
+			WHERE product_id IN ? AND stock <> 0`,
+			models.StockReasonOpening, now, productIDs).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`INSERT INTO stock_movements (product_id, quantity, reason, created_at)
+			SELECT p.id, p.stock - COALESCE(v.stock, 0), ?, ? FROM products p
+			LEFT JOIN (SELECT product_id, SUM(stock) AS stock FROM product_variants GROUP BY product_id) v ON v.product_id = p.id
+			WHERE p.id IN ? AND p.stock <> COALESCE(v.stock, 0)`,
+			models.StockReasonOpening, now, productIDs).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(productIDs)), nil
+}
+
+// FindDiscrepancies compares the stock of every product and variant with the
+// sum of its stock movements and returns those that disagree
+func (r *StockMovementRepository) FindDiscrepancies() ([]models.StockDiscrepancy, error) {
+	var products []models.StockDiscrepancy
+	err := r.db.Model(&models.Product{}).
+		Select("products.id AS product_id, products.name AS product_name, products.stock, COALESCE(SUM(stock_movements.quantity), 0) AS ledger_stock").
+		Joins("LEFT JOIN stock_movements ON stock_movements.product_id = products.id").
+		Group("products.id, products.name, products.stock").
+		Having("products.stock <> COALESCE(SUM(stock_movements.quantity), 0)").
+		Order("products.id").
+		Scan(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []models.StockDiscrepancy
+	err = r.db.Model(&models.ProductVariant{}).
+		Select("product_variants.product_id, product_variants.id AS variant_id, products.name AS product_name, product_variants.sku, product_variants.stock, COALESCE(SUM(stock_movements.quantity), 0) AS ledger_stock").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Joins("LEFT JOIN stock_movements ON stock_movements.variant_id = product_variants.id").
+		Group("product_variants.id, product_variants.product_id, products.name, product_variants.sku, product_variants.stock").
+		Having("product_variants.stock <> COALESCE(SUM(stock_movements.quantity), 0)").
+		Order("product_variants.id").
+		Scan(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return append(products, variants...), nil
+}
+
+// FindFlaggedDiscrepancies finds the discrepancies of the last reconciliation
+func (r *StockMovementRepository) FindFlaggedDiscrepancies() ([]models.StockDiscrepancy, error) {
+	var discrepancies []models.StockDiscrepancy
+	err := r.db.Order("product_id, variant_id").Find(&discrepancies).Error
+	return discrepancies, err
+}
+
+// ReplaceDiscrepancies replaces the flagged discrepancies with those of a new
+// reconciliation
+func (r *StockMovementRepository) ReplaceDiscrepancies(discrepancies []models.StockDiscrepancy) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.StockDiscrepancy{}).Error; err != nil {
+			return err
+		}
+		if len(discrepancies) == 0 {
+			return nil
+		}
+		return tx.Create(&discrepancies).Error
+	})
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"errors"
+	"health-store/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errTokenAlreadyRotated = errors.New("refresh token already rotated")
+
+// TokenRepository handles database operations for refresh tokens, revoked access tokens and user tokens
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+// NewTokenRepository creates a new token repository
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *TokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindRefreshTokenByHash finds a refresh token by its hash.
+// It returns nil without an error when no token matches.
+func (r *TokenRepository) FindRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes old and stores its replacement in a single
+// transaction. It returns false when old had already been revoked, which
+// means the token was used twice.
+func (r *TokenRepository) RotateRefreshToken(old *models.RefreshToken, replacement *models.RefreshToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(replacement).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Updates(map[string]interface{}{
+				"revoked_at":  time.Now(),
+				"replaced_by": replacement.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Lost the race against another use of the same token
+			return errTokenAlreadyRotated
+		}
+
+		rotated = true
+		return nil
+	})
+	if err == errTokenAlreadyRotated {
+		return false, nil
+	}
+	return rotated, err
+}
+
+// RevokeFamily revokes every active refresh token of a family
+func (r *TokenRepository) RevokeFamily(familyID string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser revokes every active refresh token of a user
+func (r *TokenRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAccessToken records an access token ID as revoked. Revoking the same ID twice is not an error.
+func (r *TokenRepository) RevokeAccessToken(token *models.RevokedToken) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// IsAccessTokenRevoked reports whether an access token ID has been revoked
+func (r *TokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateUserToken stores a new password reset or email verification token
+func (r *TokenRepository) CreateUserToken(token *models.UserToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindUserToken finds a user token by purpose and hash.
+// It returns nil without an error when no token matches.
+func (r *TokenRepository) FindUserToken(purpose, hash string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.Where("purpose = ? AND token_hash = ?", purpose, hash).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ConsumeUserToken marks a user token as used. It returns false when the
+// token had already been used.
+func (r *TokenRepository) ConsumeUserToken(id uint) (bool, error) {
+	result := r.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// InvalidateUserTokens marks every unused token of a user for purpose as used
+func (r *TokenRepository) InvalidateUserTokens(userID uint, purpose string) error {
+	return r.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// DeleteExpired removes refresh tokens, revoked access token IDs and user tokens that expired before now
+func (r *TokenRepository) DeleteExpired(now time.Time) (int64, error) {
+	var deleted int64
+	for _, model := range []interface{}{&models.RefreshToken{}, &models.RevokedToken{}, &models.UserToken{}} {
+		result := r.db.Where("expires_at < ?", now).Delete(model)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, nil
+}
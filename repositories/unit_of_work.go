@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+)
+
+// TxRepositories groups the repositories that share a single database transaction
+type TxRepositories struct {
+	Orders         OrderRepositoryInterface
+	Carts          CartRepositoryInterface
+	Products       ProductRepositoryInterface
+	Ledger         LedgerRepositoryInterface
+	Inventory      InventoryRepositoryInterface
+	Recalls        RecallRepositoryInterface
+	Prescriptions  PrescriptionRepositoryInterface
+	StockMovements StockMovementRepositoryInterface
+	Users          UserRepositoryInterface
+	Shops          *ShopRepository
+	ShopRequests   *ShopRequestRepository
+}
+
+// UnitOfWork runs a set of repository operations atomically
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+// NewUnitOfWork creates a new unit of work
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Execute runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error or panics.
+func (u *UnitOfWork) Execute(fn func(repos *TxRepositories) error) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&TxRepositories{
+			Orders:         NewOrderRepository(tx),
+			Carts:          NewCartRepository(tx),
+			Products:       NewProductRepository(tx),
+			Ledger:         NewLedgerRepository(tx),
+			Inventory:      NewInventoryRepository(tx),
+			Recalls:        NewRecallRepository(tx),
+			Prescriptions:  NewPrescriptionRepository(tx),
+			StockMovements: NewStockMovementRepository(tx),
+			Users:          NewUserRepository(tx),
+			Shops:          NewShopRepository(tx),
+			ShopRequests:   NewShopRequestRepository(tx),
+		})
+	})
+}
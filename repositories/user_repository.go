@@ -56,16 +56,21 @@ func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
+// UpdateRoleIf sets the role of a user only while it is one of from,
+// reporting whether it did. Only the role column is written.
+func (r *UserRepository) UpdateRoleIf(id uint, from []string, role string) (bool, error) {
+	result := r.db.Model(&models.User{}).Where("id = ? AND role IN ?", id, from).Update("role", role)
+	return result.RowsAffected > 0, result.Error
+}
+
 // Delete deletes a user
 func (r *UserRepository) Delete(id uint) error {
 	return r.db.Delete(&models.User{}, id).Error
 }
 
-// FindAll finds all users
-func (r *UserRepository) FindAll() ([]models.User, error) {
-	var users []models.User
-	err := r.db.Find(&users).Error
-	return users, err
+// List finds a page of users
+func (r *UserRepository) List(params models.ListParams) (*models.Page[models.User], error) {
+	return paginate[models.User](r.db, models.UserListSpec, params)
 }
 
 // ExistsByUsername checks if a username already exists
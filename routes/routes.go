@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"health-store/auth/token"
 	"health-store/handlers"
 	"health-store/middleware"
 	"health-store/models"
@@ -14,7 +15,10 @@ import (
 func SetupRoutes(
 	r *gin.Engine,
 	db *gorm.DB,
+	tokenManager *token.Manager,
 	userService *service.UserService,
+	authService *service.AuthService,
+	accountService *service.AccountService,
 	productService *service.ProductService,
 	categoryService *service.CategoryService,
 	orderService *service.OrderService,
@@ -24,6 +28,14 @@ func SetupRoutes(
 	cloudinaryService *service.CloudinaryService,
 	shopService *service.ShopService,
 	guestBookService *service.GuestBookService,
+	paymentWebhookService *service.PaymentWebhookService,
+	loginGuard *service.LoginGuard,
+	mfaService *service.MFAService,
+	roleService *service.RoleService,
+	ledgerService *service.LedgerService,
+	inventoryService *service.InventoryService,
+	recallService *service.RecallService,
+	prescriptionService *service.PrescriptionService,
 ) {
 	// Health check
 	r.GET("/ping", func(c *gin.Context) {
@@ -32,15 +44,23 @@ func SetupRoutes(
 		})
 	})
 
+	// Public keys for verifying access tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKS(tokenManager))
+
 	// Setup route groups
 	setupPublicRoutes(r, productService, categoryService, feedbackService)
-	setupAuthRoutes(r, userService)
-	setupAdminRoutes(r, db, userService, productService, categoryService, reportService, cloudinaryService, shopService, guestBookService, feedbackService)
+	setupAuthRoutes(r, db, userService, authService, accountService, cartService, loginGuard, mfaService)
+	setupAdminRoutes(r, db, userService, loginGuard, roleService, productService, categoryService, reportService, cloudinaryService, shopService, guestBookService, feedbackService)
 	setupCartRoutes(r, db, cartService)
-	setupOrderRoutes(r, db, orderService)
-	setupAdminOrderRoutes(r, db, orderService)
+	setupOrderRoutes(r, db, orderService, cloudinaryService)
+	setupAdminOrderRoutes(r, db, orderService, paymentWebhookService)
+	setupWebhookRoutes(r, paymentWebhookService)
 	setupFeedbackRoutes(r, db, feedbackService)
-	setupShopRoutes(r, db, shopService)
+	setupFinanceRoutes(r, db, ledgerService)
+	setupInventoryRoutes(r, db, inventoryService)
+	setupRecallRoutes(r, db, recallService)
+	setupPrescriptionRoutes(r, db, prescriptionService)
+	setupShopRoutes(r, db, shopService, productService, orderService, ledgerService, cloudinaryService)
 	setupGuestBookRoutes(r, guestBookService)
 
 	// 404 handler
@@ -53,19 +73,37 @@ func SetupRoutes(
 func setupPublicRoutes(r *gin.Engine, productService *service.ProductService, categoryService *service.CategoryService, feedbackService *service.FeedbackService) {
 	publicRoutes := r.Group("/api")
 	{
-		publicRoutes.GET("/products", handlers.GetProducts(productService))
-		publicRoutes.GET("/products/:id", handlers.GetProduct(productService, feedbackService))
+		publicRoutes.GET("/products", handlers.GetCatalogProducts(productService))
+		publicRoutes.GET("/products/:id", handlers.GetCatalogProduct(productService, feedbackService))
 		publicRoutes.GET("/categories", handlers.GetCategories(categoryService))
 		publicRoutes.GET("/categories/:id", handlers.GetCategory(categoryService))
 	}
 }
 
 // setupAuthRoutes configures authentication routes
-func setupAuthRoutes(r *gin.Engine, userService *service.UserService) {
+func setupAuthRoutes(r *gin.Engine, db *gorm.DB, userService *service.UserService, authService *service.AuthService, accountService *service.AccountService, cartService *service.CartService, loginGuard *service.LoginGuard, mfaService *service.MFAService) {
 	authRoutes := r.Group("/auth")
 	{
-		authRoutes.POST("/register", handlers.Register(userService))
-		authRoutes.POST("/login", handlers.Login(userService))
+		authRoutes.POST("/register", handlers.Register(userService, accountService))
+		authRoutes.POST("/login", handlers.Login(userService, authService, accountService, cartService, loginGuard, mfaService))
+		authRoutes.POST("/login/mfa", handlers.LoginMFA(authService, cartService, mfaService, loginGuard))
+		authRoutes.POST("/refresh", handlers.RefreshToken(authService))
+		authRoutes.POST("/logout", middleware.AuthMiddlewareWithoutMFA(db, "customer", "admin", models.RolePharmacist), handlers.Logout(authService))
+		authRoutes.POST("/forgot-password", handlers.ForgotPassword(accountService))
+		authRoutes.POST("/reset-password", handlers.ResetPassword(accountService))
+		authRoutes.POST("/verify-email", handlers.VerifyEmail(accountService))
+		authRoutes.POST("/resend-verification", handlers.ResendVerification(accountService))
+	}
+
+	// MFA setup is reachable before MFA is passed, so users whose role requires it can enroll
+	mfaRoutes := r.Group("/auth/mfa")
+	mfaRoutes.Use(middleware.AuthMiddlewareWithoutMFA(db, "customer", "admin", models.RolePharmacist))
+	{
+		mfaRoutes.GET("", handlers.GetMFAStatus(userService, mfaService))
+		mfaRoutes.POST("/enroll", handlers.EnrollMFA(userService, mfaService))
+		mfaRoutes.POST("/confirm", handlers.ConfirmMFA(userService, authService, mfaService))
+		mfaRoutes.POST("/recovery-codes", handlers.RegenerateRecoveryCodes(userService, mfaService))
+		mfaRoutes.POST("/disable", handlers.DisableMFA(userService, mfaService))
 	}
 }
 
@@ -74,6 +112,8 @@ func setupAdminRoutes(
 	r *gin.Engine,
 	db *gorm.DB,
 	userService *service.UserService,
+	loginGuard *service.LoginGuard,
+	roleService *service.RoleService,
 	productService *service.ProductService,
 	categoryService *service.CategoryService,
 	reportService *service.ReportService,
@@ -88,8 +128,17 @@ func setupAdminRoutes(
 		// User management
 		adminRoutes.GET("/users", middleware.RequirePermission(models.PermissionReadUser), handlers.GetUsers(userService))
 		adminRoutes.GET("/users/:id", middleware.RequirePermission(models.PermissionReadUser), handlers.GetUser(userService))
-		adminRoutes.PUT("/users/:id", middleware.RequirePermission(models.PermissionUpdateUser), handlers.UpdateUser(userService))
+		adminRoutes.PUT("/users/:id", middleware.RequirePermission(models.PermissionUpdateUser), handlers.UpdateUser(userService, roleService))
 		adminRoutes.DELETE("/users/:id", middleware.RequirePermission(models.PermissionDeleteUser), handlers.DeleteUser(userService))
+		adminRoutes.POST("/users/:id/unlock", middleware.RequirePermission(models.PermissionUpdateUser), handlers.UnlockUser(userService, loginGuard))
+
+		// Role management
+		adminRoutes.GET("/roles", middleware.RequirePermission(models.PermissionReadRole), handlers.GetRoles(roleService))
+		adminRoutes.GET("/roles/:id", middleware.RequirePermission(models.PermissionReadRole), handlers.GetRole(roleService))
+		adminRoutes.POST("/roles", middleware.RequirePermission(models.PermissionManageRole), handlers.CreateRole(roleService))
+		adminRoutes.PUT("/roles/:id", middleware.RequirePermission(models.PermissionManageRole), handlers.UpdateRole(roleService))
+		adminRoutes.DELETE("/roles/:id", middleware.RequirePermission(models.PermissionManageRole), handlers.DeleteRole(roleService))
+		adminRoutes.GET("/permissions", middleware.RequirePermission(models.PermissionReadRole), handlers.GetPermissions())
 
 		// Product management
 		adminRoutes.POST("/products", middleware.RequirePermission(models.PermissionCreateProduct), handlers.CreateProduct(productService, cloudinaryService))
@@ -98,6 +147,13 @@ func setupAdminRoutes(
 		adminRoutes.PUT("/products/:id", middleware.RequirePermission(models.PermissionUpdateProduct), handlers.UpdateProduct(productService, cloudinaryService))
 		adminRoutes.DELETE("/products/:id", middleware.RequirePermission(models.PermissionDeleteProduct), handlers.DeleteProduct(productService, cloudinaryService))
 
+		// Product variant management
+		adminRoutes.GET("/products/:id/variants", middleware.RequirePermission(models.PermissionReadProduct), handlers.GetProductVariants(productService))
+		adminRoutes.GET("/products/:id/variants/:variantId", middleware.RequirePermission(models.PermissionReadProduct), handlers.GetProductVariant(productService))
+		adminRoutes.POST("/products/:id/variants", middleware.RequirePermission(models.PermissionCreateProduct), handlers.CreateProductVariant(productService, cloudinaryService))
+		adminRoutes.PUT("/products/:id/variants/:variantId", middleware.RequirePermission(models.PermissionUpdateProduct), handlers.UpdateProductVariant(productService, cloudinaryService))
+		adminRoutes.DELETE("/products/:id/variants/:variantId", middleware.RequirePermission(models.PermissionDeleteProduct), handlers.DeleteProductVariant(productService, cloudinaryService))
+
 		// Category management
 		adminRoutes.POST("/categories", middleware.RequirePermission(models.PermissionCreateCategory), handlers.CreateCategory(categoryService))
 		adminRoutes.GET("/categories", middleware.RequirePermission(models.PermissionReadCategory), handlers.GetCategories(categoryService))
@@ -125,30 +181,32 @@ func setupAdminRoutes(
 // setupCartRoutes configures cart routes
 func setupCartRoutes(r *gin.Engine, db *gorm.DB, cartService *service.CartService) {
 	cartRoutes := r.Group("/cart")
-	cartRoutes.Use(middleware.AuthMiddleware(db, "customer", "admin"))
+	// Anonymous visitors get a guest cart identified by a cart token
+	cartRoutes.Use(middleware.OptionalAuthMiddleware(db, "customer", "admin"))
 	cartRoutes.Use(middleware.RequirePermission(models.PermissionReadCart))
 	{
 		cartRoutes.GET("/", handlers.GetCart(cartService))
 		cartRoutes.POST("/", middleware.RequirePermission(models.PermissionUpdateCart), handlers.AddToCart(cartService))
-		cartRoutes.DELETE("/:id", middleware.RequirePermission(models.PermissionUpdateCart), handlers.RemoveFromCart(cartService))
+		cartRoutes.PATCH("/:id", middleware.RequirePermission(models.PermissionUpdateCart), middleware.Authorize(handlers.CartItemPolicy(cartService)), handlers.UpdateCartItem(cartService))
+		cartRoutes.DELETE("/:id", middleware.RequirePermission(models.PermissionUpdateCart), middleware.Authorize(handlers.CartItemPolicy(cartService)), handlers.RemoveFromCart(cartService))
 	}
 }
 
 // setupOrderRoutes configures customer order routes
-func setupOrderRoutes(r *gin.Engine, db *gorm.DB, orderService *service.OrderService) {
+func setupOrderRoutes(r *gin.Engine, db *gorm.DB, orderService *service.OrderService, cloudinaryService *service.CloudinaryService) {
 	orderRoutes := r.Group("/orders")
 	orderRoutes.Use(middleware.AuthMiddleware(db, "customer", "admin"))
 	{
-		orderRoutes.POST("/", middleware.RequirePermission(models.PermissionCreateOrder), handlers.PlaceOrder(orderService))
+		orderRoutes.POST("/", middleware.RequirePermission(models.PermissionCreateOrder), handlers.PlaceOrder(orderService, cloudinaryService))
 		orderRoutes.GET("/", handlers.GetUserOrders(orderService)) // Customer order history
-		orderRoutes.GET("/:id", middleware.RequirePermission(models.PermissionReadOrder), handlers.GetOrder(orderService))
-		orderRoutes.GET("/:id/receipt", middleware.RequirePermission(models.PermissionReadOrder), handlers.GeneratePurchaseReceipt(orderService))
-		orderRoutes.PUT("/:id/cancel", middleware.RequirePermission(models.PermissionUpdateOrder), handlers.CancelOrder(orderService))
+		orderRoutes.GET("/:id", middleware.RequirePermission(models.PermissionReadOrder), middleware.Authorize(handlers.OrderPolicy(orderService, models.PermissionReadAnyOrder)), handlers.GetOrder(orderService))
+		orderRoutes.GET("/:id/receipt", middleware.RequirePermission(models.PermissionReadOrder), middleware.Authorize(handlers.OrderPolicy(orderService, models.PermissionReadAnyOrder)), handlers.GeneratePurchaseReceipt(orderService))
+		orderRoutes.PUT("/:id/cancel", middleware.RequirePermission(models.PermissionUpdateOrder), middleware.Authorize(handlers.OrderPolicy(orderService, models.PermissionCancelAnyOrder)), handlers.CancelOrder(orderService))
 	}
 }
 
 // setupAdminOrderRoutes configures admin order management routes
-func setupAdminOrderRoutes(r *gin.Engine, db *gorm.DB, orderService *service.OrderService) {
+func setupAdminOrderRoutes(r *gin.Engine, db *gorm.DB, orderService *service.OrderService, paymentWebhookService *service.PaymentWebhookService) {
 	adminOrderRoutes := r.Group("/admin/orders")
 	adminOrderRoutes.Use(middleware.AuthMiddleware(db, "admin"))
 	adminOrderRoutes.Use(middleware.RequirePermission(models.PermissionReadOrder))
@@ -156,6 +214,90 @@ func setupAdminOrderRoutes(r *gin.Engine, db *gorm.DB, orderService *service.Ord
 		adminOrderRoutes.GET("/", handlers.GetAllOrders(orderService))
 		adminOrderRoutes.PUT("/:id/status", middleware.RequirePermission(models.PermissionUpdateOrder), handlers.UpdateOrderStatus(orderService))
 	}
+
+	adminPaymentRoutes := r.Group("/admin/payments")
+	adminPaymentRoutes.Use(middleware.AuthMiddleware(db, "admin"))
+	adminPaymentRoutes.Use(middleware.RequirePermission(models.PermissionReadOrder))
+	{
+		adminPaymentRoutes.GET("/events", handlers.GetPaymentEvents(paymentWebhookService))
+		adminPaymentRoutes.POST("/events/:id/replay", middleware.RequirePermission(models.PermissionUpdateOrder), handlers.ReplayPaymentEvent(paymentWebhookService))
+	}
+}
+
+// setupWebhookRoutes configures payment provider webhook routes (authenticated by signature)
+func setupWebhookRoutes(r *gin.Engine, paymentWebhookService *service.PaymentWebhookService) {
+	webhookRoutes := r.Group("/webhooks")
+	{
+		webhookRoutes.POST("/payments/:provider", handlers.PaymentWebhook(paymentWebhookService))
+	}
+}
+
+// setupFinanceRoutes configures commission, ledger and payout routes
+func setupFinanceRoutes(r *gin.Engine, db *gorm.DB, ledgerService *service.LedgerService) {
+	financeRoutes := r.Group("/admin")
+	financeRoutes.Use(middleware.AuthMiddleware(db, "admin"))
+	financeRoutes.Use(middleware.RequirePermission(models.PermissionReadFinance))
+	{
+		financeRoutes.GET("/commission-rules", handlers.GetCommissionRules(ledgerService))
+		financeRoutes.PUT("/commission-rules", middleware.RequirePermission(models.PermissionManageFinance), handlers.SaveCommissionRule(ledgerService))
+		financeRoutes.DELETE("/commission-rules/:id", middleware.RequirePermission(models.PermissionManageFinance), handlers.DeleteCommissionRule(ledgerService))
+
+		financeRoutes.GET("/ledger/balances", handlers.GetSellerBalances(ledgerService))
+
+		financeRoutes.GET("/payouts/batches", handlers.GetPayoutBatches(ledgerService))
+		financeRoutes.GET("/payouts/batches/:id", handlers.GetPayoutBatch(ledgerService))
+		financeRoutes.POST("/payouts/batches", middleware.RequirePermission(models.PermissionManageFinance), handlers.CreatePayoutBatch(ledgerService))
+		financeRoutes.PUT("/payouts/:id/status", middleware.RequirePermission(models.PermissionManageFinance), handlers.UpdatePayoutStatus(ledgerService))
+	}
+}
+
+// setupInventoryRoutes configures inventory lot and expiry routes
+func setupInventoryRoutes(r *gin.Engine, db *gorm.DB, inventoryService *service.InventoryService) {
+	inventoryRoutes := r.Group("/admin")
+	inventoryRoutes.Use(middleware.AuthMiddleware(db, "admin"))
+	inventoryRoutes.Use(middleware.RequirePermission(models.PermissionReadInventory))
+	{
+		inventoryRoutes.GET("/products/:id/lots", handlers.GetProductLots(inventoryService))
+		inventoryRoutes.POST("/products/:id/lots", middleware.RequirePermission(models.PermissionManageInventory), handlers.ReceiveInventoryLot(inventoryService))
+		inventoryRoutes.PUT("/products/:id/lots/:lotId", middleware.RequirePermission(models.PermissionManageInventory), handlers.UpdateInventoryLot(inventoryService))
+
+		inventoryRoutes.GET("/inventory/expiring-lots", handlers.GetExpiringLots(inventoryService))
+
+		inventoryRoutes.GET("/products/:id/stock-history", handlers.GetStockHistory(inventoryService))
+		inventoryRoutes.GET("/inventory/stock-discrepancies", handlers.GetStockDiscrepancies(inventoryService))
+		inventoryRoutes.GET("/inventory/alerts", handlers.GetLowStockAlerts(inventoryService))
+		inventoryRoutes.POST("/inventory/reconcile", middleware.RequirePermission(models.PermissionManageInventory), handlers.ReconcileStock(inventoryService))
+	}
+}
+
+// setupRecallRoutes configures product recall routes
+func setupRecallRoutes(r *gin.Engine, db *gorm.DB, recallService *service.RecallService) {
+	recallRoutes := r.Group("/admin/recalls")
+	recallRoutes.Use(middleware.AuthMiddleware(db, "admin"))
+	recallRoutes.Use(middleware.RequirePermission(models.PermissionReadRecall))
+	{
+		recallRoutes.GET("", handlers.GetRecalls(recallService))
+		recallRoutes.GET("/:id", handlers.GetRecall(recallService))
+		recallRoutes.POST("", middleware.RequirePermission(models.PermissionManageRecall), handlers.CreateRecall(recallService))
+		recallRoutes.POST("/:id/close", middleware.RequirePermission(models.PermissionManageRecall), handlers.CloseRecall(recallService))
+
+		recallRoutes.GET("/:id/affected", handlers.GetRecallAffected(recallService))
+		recallRoutes.POST("/:id/notify", middleware.RequirePermission(models.PermissionManageRecall), handlers.NotifyRecallCustomers(recallService))
+		recallRoutes.GET("/:id/report", handlers.GetRecallReport(recallService))
+	}
+}
+
+// setupPrescriptionRoutes configures the pharmacist prescription review routes
+func setupPrescriptionRoutes(r *gin.Engine, db *gorm.DB, prescriptionService *service.PrescriptionService) {
+	prescriptionRoutes := r.Group("/pharmacy/prescriptions")
+	prescriptionRoutes.Use(middleware.AuthMiddleware(db, "admin", models.RolePharmacist))
+	prescriptionRoutes.Use(middleware.RequirePermission(models.PermissionReadPrescription))
+	{
+		prescriptionRoutes.GET("", handlers.GetPrescriptions(prescriptionService))
+		prescriptionRoutes.GET("/:id", handlers.GetPrescription(prescriptionService))
+		prescriptionRoutes.POST("/:id/approve", middleware.RequirePermission(models.PermissionReviewPrescription), handlers.ApprovePrescription(prescriptionService))
+		prescriptionRoutes.POST("/:id/reject", middleware.RequirePermission(models.PermissionReviewPrescription), handlers.RejectPrescription(prescriptionService))
+	}
 }
 
 // setupFeedbackRoutes configures feedback routes
@@ -167,17 +309,21 @@ func setupFeedbackRoutes(r *gin.Engine, db *gorm.DB, feedbackService *service.Fe
 
 		// Protected route to submit feedback
 		feedbackRoutes.POST("/", middleware.AuthMiddleware(db, "customer", "admin"), middleware.RequirePermission(models.PermissionCreateFeedback), handlers.GiveFeedback(feedbackService))
+
+		// Authors and moderators can delete feedback
+		feedbackRoutes.DELETE("/:id", middleware.AuthMiddleware(db, "customer", "admin"), middleware.Authorize(handlers.FeedbackPolicy(feedbackService, models.PermissionDeleteFeedback)), handlers.DeleteFeedback(feedbackService))
 	}
 }
 
 // setupShopRoutes configures shop routes
-func setupShopRoutes(r *gin.Engine, db *gorm.DB, shopService *service.ShopService) {
+func setupShopRoutes(r *gin.Engine, db *gorm.DB, shopService *service.ShopService, productService *service.ProductService, orderService *service.OrderService, ledgerService *service.LedgerService, cloudinaryService *service.CloudinaryService) {
 	shopRoutes := r.Group("/shops")
 	{
 		// Public routes
 		shopRoutes.GET("/", handlers.GetAllShops(shopService))
 		shopRoutes.GET("/active", handlers.GetActiveShops(shopService))
 		shopRoutes.GET("/:id", handlers.GetShop(shopService))
+		shopRoutes.GET("/:id/products", handlers.GetShopProducts(shopService, productService))
 
 		// Protected routes for authenticated users
 		authenticated := shopRoutes.Group("")
@@ -187,9 +333,29 @@ func setupShopRoutes(r *gin.Engine, db *gorm.DB, shopService *service.ShopServic
 			authenticated.GET("/my/shops", handlers.GetMyShops(shopService))
 			authenticated.GET("/my/shop", handlers.GetMyShop(shopService))
 
-			// Update and delete (shop owners and admins)
-			authenticated.PUT("/:id", handlers.UpdateShop(shopService))
-			authenticated.DELETE("/:id", handlers.DeleteShop(shopService))
+			// Update and delete (shop owners and roles allowed to manage any shop)
+			authenticated.PUT("/:id", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionUpdateShop)), handlers.UpdateShop(shopService))
+			authenticated.DELETE("/:id", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionDeleteShop)), handlers.DeleteShop(shopService))
+
+			// Shop owners manage their own products and fulfil their sub-orders
+			authenticated.POST("/:id/products", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionCreateProduct)), handlers.CreateShopProduct(productService, cloudinaryService))
+			authenticated.PUT("/:id/products/:productId", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionUpdateProduct)), handlers.UpdateShopProduct(productService, cloudinaryService))
+			authenticated.DELETE("/:id/products/:productId", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionDeleteProduct)), handlers.DeleteShopProduct(productService, cloudinaryService))
+			authenticated.GET("/:id/orders", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionReadAnyOrder)), handlers.GetShopOrders(orderService))
+			authenticated.PUT("/:id/orders/:shopOrderId/ship", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionShipAnyOrder)), handlers.ShipShopOrder(orderService))
+			authenticated.GET("/:id/statement", middleware.Authorize(handlers.ShopPolicy(shopService, models.PermissionReadFinance)), handlers.GetSellerStatement(ledgerService))
+
+			// Customers apply for shops and follow up on their requests; reviewers can read them and join the conversation
+			authenticated.POST("/requests", middleware.RequirePermission(models.PermissionCreateShopRequest), handlers.CreateShopRequest(shopService))
+			authenticated.GET("/requests", handlers.GetMyShopRequests(shopService))
+			authenticated.GET("/requests/:id", middleware.Authorize(handlers.ShopRequestPolicy(shopService, models.PermissionReadShopRequest)), handlers.GetShopRequest(shopService))
+			authenticated.PUT("/requests/:id", middleware.Authorize(handlers.ShopRequestPolicy(shopService, "")), handlers.UpdateShopRequest(shopService))
+			authenticated.POST("/requests/:id/resubmit", middleware.Authorize(handlers.ShopRequestPolicy(shopService, "")), handlers.ResubmitShopRequest(shopService))
+			authenticated.POST("/requests/:id/withdraw", middleware.Authorize(handlers.ShopRequestPolicy(shopService, "")), handlers.WithdrawShopRequest(shopService))
+			authenticated.POST("/requests/:id/documents", middleware.Authorize(handlers.ShopRequestPolicy(shopService, "")), handlers.UploadShopRequestDocument(shopService, cloudinaryService))
+			authenticated.DELETE("/requests/:id/documents/:documentId", middleware.Authorize(handlers.ShopRequestPolicy(shopService, "")), handlers.DeleteShopRequestDocument(shopService, cloudinaryService))
+			authenticated.GET("/requests/:id/comments", middleware.Authorize(handlers.ShopRequestPolicy(shopService, models.PermissionReadShopRequest)), handlers.GetShopRequestComments(shopService))
+			authenticated.POST("/requests/:id/comments", middleware.Authorize(handlers.ShopRequestPolicy(shopService, models.PermissionApproveShop)), handlers.AddShopRequestComment(shopService))
 		}
 
 		// Admin only routes
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidUserToken is returned for unknown, expired or already used reset and verification tokens
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	// ErrEmailNotVerified is returned on login when email verification is required and still pending
+	ErrEmailNotVerified = errors.New("email address has not been verified")
+)
+
+// AccountService handles password recovery and email verification
+type AccountService struct {
+	userRepo  repositories.UserRepositoryInterface
+	tokenRepo *repositories.TokenRepository
+	mailer    Mailer
+	cfg       config.AccountConfig
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(userRepo repositories.UserRepositoryInterface, tokenRepo *repositories.TokenRepository, mailer Mailer, cfg config.AccountConfig) *AccountService {
+	return &AccountService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mailer:    mailer,
+		cfg:       cfg,
+	}
+}
+
+// RequestPasswordReset emails a password reset link to the account with the
+// given email. Unknown emails are ignored so callers can not probe which
+// addresses are registered.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	// Only the most recent link stays valid
+	if err := s.tokenRepo.InvalidateUserTokens(user.ID, models.UserTokenPasswordReset); err != nil {
+		return err
+	}
+
+	token, err := s.issueUserToken(user.ID, models.UserTokenPasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Reset your Health Store password",
+		Body: fmt.Sprintf("Hello %s,\n\nWe received a request to reset your password. Use the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %s and can be used once. If you did not ask for a reset, you can ignore this email.\n",
+			user.Username, s.link("/reset-password", token), s.cfg.PasswordResetTTL),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and ends all of the
+// user's sessions
+func (s *AccountService) ResetPassword(token, newPassword string) error {
+	record, err := s.consumeUserToken(models.UserTokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil {
+		return ErrInvalidUserToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+
+	// Receiving the reset email proves ownership of the address
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	return s.tokenRepo.RevokeAllForUser(user.ID)
+}
+
+// SendVerificationEmail emails an email verification link to a user
+func (s *AccountService) SendVerificationEmail(user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err := s.tokenRepo.InvalidateUserTokens(user.ID, models.UserTokenEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := s.issueUserToken(user.ID, models.UserTokenEmailVerification, s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Verify your Health Store email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, s.link("/verify-email", token), s.cfg.EmailVerificationTTL),
+	})
+}
+
+// ResendVerificationEmail sends a new verification link to the account with
+// the given email. Unknown or already verified emails are ignored.
+func (s *AccountService) ResendVerificationEmail(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil
+	}
+	return s.SendVerificationEmail(user)
+}
+
+// VerifyEmail marks the user's email as verified using a verification token
+func (s *AccountService) VerifyEmail(token string) (*models.User, error) {
+	record, err := s.consumeUserToken(models.UserTokenEmailVerification, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// CheckLoginAllowed rejects users whose email is unverified when verification is required
+func (s *AccountService) CheckLoginAllowed(user *models.User) error {
+	if s.cfg.RequireEmailVerification && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// issueUserToken stores the hash of a new single-use token and returns the token
+func (s *AccountService) issueUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepo.CreateUserToken(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashUserToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store token: %v", err)
+	}
+
+	return token, nil
+}
+
+// consumeUserToken validates a token and marks it as used
+func (s *AccountService) consumeUserToken(purpose, token string) (*models.UserToken, error) {
+	record, err := s.tokenRepo.FindUserToken(purpose, hashUserToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	consumed, err := s.tokenRepo.ConsumeUserToken(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		utils.Warnf("User token %d for user %d used concurrently", record.ID, record.UserID)
+		return nil, ErrInvalidUserToken
+	}
+
+	return record, nil
+}
+
+// link builds a frontend link carrying a token
+func (s *AccountService) link(path, token string) string {
+	return s.cfg.AppBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// hashUserToken returns the hash under which a user token is stored
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
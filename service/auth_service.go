@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"health-store/auth/token"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again; the whole token family is revoked in response
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, please log in again")
+)
+
+// AuthService issues, rotates and revokes access and refresh tokens
+type AuthService struct {
+	tokenRepo     *repositories.TokenRepository
+	userRepo      repositories.UserRepositoryInterface
+	tokens        *token.Manager
+	refreshSecret []byte
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(tokenRepo *repositories.TokenRepository, userRepo repositories.UserRepositoryInterface, tokens *token.Manager, cfg config.JWTConfig) *AuthService {
+	return &AuthService{
+		tokenRepo:     tokenRepo,
+		userRepo:      userRepo,
+		tokens:        tokens,
+		refreshSecret: []byte(cfg.RefreshSecret),
+		accessTTL:     cfg.Expiration,
+		refreshTTL:    cfg.RefreshExpiration,
+	}
+}
+
+// IssueTokens starts a new session for a user who just authenticated.
+// mfaVerified records whether the user also passed a second factor.
+func (s *AuthService) IssueTokens(user *models.User, mfaVerified bool, userAgent, ipAddress string) (*models.TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := s.newRefreshToken(user.ID, familyID, mfaVerified, userAgent, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepo.CreateRefreshToken(record); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	return s.tokenPair(user, refreshToken, mfaVerified)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token in the same family. The presented token can not be used again; if it
+// is, the whole family is revoked.
+func (s *AuthService) Refresh(refreshToken, userAgent, ipAddress string) (*models.TokenPair, error) {
+	record, err := s.tokenRepo.FindRefreshTokenByHash(s.hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if record.RevokedAt != nil {
+		// A rotated token was replayed: assume it was stolen and end the session
+		if record.ReplacedBy != nil {
+			if err := s.tokenRepo.RevokeFamily(record.FamilyID); err != nil {
+				return nil, err
+			}
+			utils.Warnf("Refresh token reuse detected for user %d, family %s revoked", record.UserID, record.FamilyID)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newToken, replacement, err := s.newRefreshToken(user.ID, record.FamilyID, record.MFAVerified, userAgent, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := s.tokenRepo.RotateRefreshToken(record, replacement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %v", err)
+	}
+	if !rotated {
+		// Another request used the same token first
+		if err := s.tokenRepo.RevokeFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		utils.Warnf("Concurrent refresh token reuse for user %d, family %s revoked", record.UserID, record.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	return s.tokenPair(user, newToken, record.MFAVerified)
+}
+
+// Logout revokes the access token identified by jti and, when a refresh token
+// is given, every refresh token of its session
+func (s *AuthService) Logout(userID uint, jti string, expiresAt time.Time, refreshToken string) error {
+	if jti != "" {
+		err := s.tokenRepo.RevokeAccessToken(&models.RevokedToken{
+			JTI:       jti,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke access token: %v", err)
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	record, err := s.tokenRepo.FindRefreshTokenByHash(s.hashRefreshToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if record == nil || record.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	return s.tokenRepo.RevokeFamily(record.FamilyID)
+}
+
+// IsAccessTokenRevoked reports whether an access token ID has been revoked
+func (s *AuthService) IsAccessTokenRevoked(jti string) (bool, error) {
+	return s.tokenRepo.IsAccessTokenRevoked(jti)
+}
+
+// StartTokenCleanup purges expired refresh tokens and revoked token IDs every
+// interval until ctx is cancelled
+func (s *AuthService) StartTokenCleanup(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "token-cleanup", interval, func() error {
+		deleted, err := s.tokenRepo.DeleteExpired(time.Now())
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			utils.Infof("Deleted %d expired tokens", deleted)
+		}
+		return nil
+	})
+}
+
+// tokenPair signs a new access token and pairs it with a refresh token
+func (s *AuthService) tokenPair(user *models.User, refreshToken string, mfaVerified bool) (*models.TokenPair, error) {
+	accessToken, err := s.generateAccessToken(user, mfaVerified)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// generateAccessToken signs a short-lived access token with a unique ID (jti)
+// so it can be revoked before it expires
+func (s *AuthService) generateAccessToken(user *models.User, mfaVerified bool) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &token.Claims{
+		Username: user.Username,
+		Role:     user.Role,
+		MFA:      mfaVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   fmt.Sprintf("%d", user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}
+
+	return s.tokens.Sign(claims)
+}
+
+// newRefreshToken generates a refresh token and the record storing its hash
+func (s *AuthService) newRefreshToken(userID uint, familyID string, mfaVerified bool, userAgent, ipAddress string) (string, *models.RefreshToken, error) {
+	raw, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	return raw, &models.RefreshToken{
+		UserID:      userID,
+		TokenHash:   s.hashRefreshToken(raw),
+		FamilyID:    familyID,
+		ExpiresAt:   time.Now().Add(s.refreshTTL),
+		UserAgent:   userAgent,
+		IPAddress:   ipAddress,
+		MFAVerified: mfaVerified,
+	}, nil
+}
+
+// hashRefreshToken returns the keyed hash under which a refresh token is stored
+func (s *AuthService) hashRefreshToken(token string) string {
+	mac := hmac.New(sha256.New, s.refreshSecret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"health-store/auth/token"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+
+	"gorm.io/gorm"
+)
+
+func newTestAuthService(t *testing.T, db *gorm.DB) *AuthService {
+	t.Helper()
+	cfg := config.JWTConfig{
+		SigningMethod:     "HS256",
+		KeyID:             "test",
+		SecretKey:         "test-secret-of-at-least-32-characters",
+		Expiration:        15 * time.Minute,
+		RefreshSecret:     "test-refresh-secret",
+		RefreshExpiration: 24 * time.Hour,
+	}
+	tokens, err := token.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return NewAuthService(repositories.NewTokenRepository(db), repositories.NewUserRepository(db), tokens, cfg)
+}
+
+// familyTokens loads the refresh tokens of the session a refresh token belongs to
+func familyTokens(t *testing.T, db *gorm.DB, auth *AuthService, refreshToken string) []models.RefreshToken {
+	t.Helper()
+	var record models.RefreshToken
+	if err := db.Where("token_hash = ?", auth.hashRefreshToken(refreshToken)).First(&record).Error; err != nil {
+		t.Fatalf("load refresh token: %v", err)
+	}
+	var family []models.RefreshToken
+	if err := db.Where("family_id = ?", record.FamilyID).Order("id").Find(&family).Error; err != nil {
+		t.Fatalf("load family: %v", err)
+	}
+	return family
+}
+
+func assertFamilyRevoked(t *testing.T, family []models.RefreshToken) {
+	t.Helper()
+	for _, record := range family {
+		if record.RevokedAt == nil {
+			t.Errorf("refresh token %d of the family is still active", record.ID)
+		}
+	}
+}
+
+func TestRefreshRotatesTokenAndDetectsReuse(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db)
+	user := createTestCustomer(t, db, "mia")
+
+	login, err := auth.IssueTokens(user, false, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	refreshed, err := auth.Refresh(login.RefreshToken, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.RefreshToken == login.RefreshToken || refreshed.AccessToken == login.AccessToken {
+		t.Error("refresh returned the tokens it was given")
+	}
+
+	family := familyTokens(t, db, auth, login.RefreshToken)
+	if len(family) != 2 || family[0].RevokedAt == nil || family[0].ReplacedBy == nil || *family[0].ReplacedBy != family[1].ID || family[1].RevokedAt != nil {
+		t.Fatalf("family = %+v, want the first token replaced by an active second", family)
+	}
+
+	// Replaying the rotated token ends the session, including its newest token
+	if _, err := auth.Refresh(login.RefreshToken, "test", "127.0.0.1"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	assertFamilyRevoked(t, familyTokens(t, db, auth, login.RefreshToken))
+	if _, err := auth.Refresh(refreshed.RefreshToken, "test", "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after reuse error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	if _, err := auth.Refresh("unknown", "test", "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+// TestRefreshRevokesFamilyWhenRotationRaces rotates the token in another
+// request after Refresh has read it, so only the conditional update of the
+// rotation can tell that it was used twice
+func TestRefreshRevokesFamilyWhenRotationRaces(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db)
+	user := createTestCustomer(t, db, "noah")
+
+	login, err := auth.IssueTokens(user, false, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	original := familyTokens(t, db, auth, login.RefreshToken)[0]
+
+	raced := false
+	err = db.Callback().Query().After("gorm:query").Register("test:concurrent_rotation", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "refresh_tokens" {
+			return
+		}
+		raced = true
+		_, other, err := auth.newRefreshToken(user.ID, original.FamilyID, false, "other", "127.0.0.2")
+		if err == nil {
+			_, err = repositories.NewTokenRepository(db).RotateRefreshToken(&original, other)
+		}
+		if err != nil {
+			t.Errorf("concurrent rotation: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if _, err := auth.Refresh(login.RefreshToken, "test", "127.0.0.1"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	family := familyTokens(t, db, auth, login.RefreshToken)
+	if len(family) != 2 {
+		t.Errorf("family has %d tokens, want only the original and the other request's replacement", len(family))
+	}
+	assertFamilyRevoked(t, family)
+}
+
+func TestLogoutRevokesAccessTokenAndSession(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db)
+	user := createTestCustomer(t, db, "olga")
+
+	login, err := auth.IssueTokens(user, false, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	claims, err := auth.tokens.Parse(login.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatal("access token has no jti")
+	}
+
+	if err := auth.Logout(user.ID, claims.ID, claims.ExpiresAt.Time, login.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if revoked, err := auth.IsAccessTokenRevoked(claims.ID); err != nil || !revoked {
+		t.Errorf("IsAccessTokenRevoked = %v, %v, want true", revoked, err)
+	}
+	assertFamilyRevoked(t, familyTokens(t, db, auth, login.RefreshToken))
+	if _, err := auth.Refresh(login.RefreshToken, "test", "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after logout error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"health-store/utils"
+	"time"
+)
+
+// runPeriodically runs task every interval until ctx is cancelled. Errors are
+// logged and do not stop the loop.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, task func() error) {
+	if interval <= 0 {
+		utils.Warnf("Background job %s disabled: interval must be positive", name)
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		utils.Infof("Background job %s started (every %v)", name, interval)
+		for {
+			select {
+			case <-ctx.Done():
+				utils.Infof("Background job %s stopped", name)
+				return
+			case <-ticker.C:
+				if err := task(); err != nil {
+					utils.LogError(err, "Background job "+name+" failed")
+				}
+			}
+		}
+	}()
+}
@@ -1,67 +1,282 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"health-store/models"
 	"health-store/repositories"
+	"health-store/utils"
+	"time"
 )
 
+// ErrCartItemNotFound is returned for unknown cart items
+var ErrCartItemNotFound = errors.New("cart item not found")
+
 // CartService handles business logic for carts
 type CartService struct {
-	cartRepo    repositories.CartRepositoryInterface
-	productRepo repositories.ProductRepositoryInterface
+	cartRepo       repositories.CartRepositoryInterface
+	productRepo    repositories.ProductRepositoryInterface
+	uow            repositories.UnitOfWorkInterface
+	reservationTTL time.Duration
+	guestTokenTTL  time.Duration
 }
 
-// NewCartService creates a new cart service
-func NewCartService(cartRepo repositories.CartRepositoryInterface, productRepo repositories.ProductRepositoryInterface) *CartService {
+// NewCartService creates a new cart service. Items added to a cart hold their
+// stock for reservationTTL before the sweeper releases it; guest cart tokens
+// are handed to clients for guestTokenTTL.
+func NewCartService(
+	cartRepo repositories.CartRepositoryInterface,
+	productRepo repositories.ProductRepositoryInterface,
+	uow repositories.UnitOfWorkInterface,
+	reservationTTL time.Duration,
+	guestTokenTTL time.Duration,
+) *CartService {
 	return &CartService{
-		cartRepo:    cartRepo,
-		productRepo: productRepo,
+		cartRepo:       cartRepo,
+		productRepo:    productRepo,
+		uow:            uow,
+		reservationTTL: reservationTTL,
+		guestTokenTTL:  guestTokenTTL,
 	}
 }
 
-// GetOrCreateCart gets or creates a cart for a user
-func (s *CartService) GetOrCreateCart(userID uint) (*models.Cart, error) {
-	return s.cartRepo.FindOrCreateCart(userID)
+// GetOrCreateCart gets or creates a cart for a user or guest
+func (s *CartService) GetOrCreateCart(owner models.CartOwner) (*models.Cart, error) {
+	return s.cartRepo.FindOrCreateCart(owner)
+}
+
+// GetCart gets a cart with its items
+func (s *CartService) GetCart(owner models.CartOwner) (*models.Cart, error) {
+	return s.cartRepo.FindCartByOwner(owner)
 }
 
-// GetCartByUserID gets a cart by user ID
-func (s *CartService) GetCartByUserID(userID uint) (*models.Cart, error) {
-	return s.cartRepo.FindCartByUserID(userID)
+// NewGuestToken generates an opaque token identifying a guest cart
+func (s *CartService) NewGuestToken() (string, error) {
+	return randomHex(32)
 }
 
-// In AddToCart service method
-func (s *CartService) AddToCart(userID uint, cartItem models.CartItem) error {
-	// Validate product exists and has stock
-	product, err := s.productRepo.FindByID(cartItem.ProductID)
+// GuestTokenTTL returns how long a guest cart token stays valid on the client
+func (s *CartService) GuestTokenTTL() time.Duration {
+	return s.guestTokenTTL
+}
+
+// GetCartSummary gets the cart with per-line subtotals and the cart total.
+// A guest that has not added anything yet gets an empty cart.
+func (s *CartService) GetCartSummary(owner models.CartOwner) (*models.CartResponse, error) {
+	var cart *models.Cart
+	var err error
+	if owner.IsGuest() {
+		cart, err = s.cartRepo.FindCartByGuestToken(owner.GuestToken)
+		if err == nil && cart != nil {
+			cart, err = s.cartRepo.FindCartByOwner(owner)
+		}
+	} else {
+		cart, err = s.cartRepo.FindCartByOwner(owner)
+	}
 	if err != nil {
-		return errors.New("product not found")
+		return nil, err
+	}
+	if cart == nil {
+		return &models.CartResponse{Items: []models.CartItemResponse{}}, nil
 	}
 
-	if product.Stock < cartItem.Quantity {
-		return errors.New("insufficient stock")
+	response := &models.CartResponse{
+		ID:        cart.ID,
+		UserID:    cart.UserID,
+		Items:     make([]models.CartItemResponse, 0, len(cart.CartItems)),
+		CreatedAt: cart.CreatedAt,
+		UpdatedAt: cart.UpdatedAt,
 	}
 
-	// Reduce stock immediately
-	err = s.productRepo.ReduceStock(cartItem.ProductID, cartItem.Quantity)
+	var total float64
+	for _, item := range cart.CartItems {
+		subtotal := item.UnitPrice() * float64(item.Quantity)
+		total += subtotal
+		response.ItemCount += item.Quantity
+		response.Items = append(response.Items, models.CartItemResponse{
+			CartItem: item,
+			Subtotal: roundCents(subtotal),
+		})
+	}
+	response.Total = roundCents(total)
+
+	return response, nil
+}
+
+// AddToCart adds an item to the user's cart and reserves its stock.
+// Adding a product (or variant) that is already in the cart increases the
+// quantity of the existing line instead of creating a new one. Products with
+// variants are added by variant.
+// Stock is not deducted here; the reservation only keeps other customers from
+// claiming it until it expires or the order is placed.
+func (s *CartService) AddToCart(owner models.CartOwner, cartItem models.CartItem) error {
+	if cartItem.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	return s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		cart, err := repos.Carts.FindOrCreateCart(owner)
+		if err != nil {
+			return err
+		}
+
+		existing, err := repos.Carts.FindCartItemByProduct(cart.ID, cartItem.ProductID, cartItem.VariantID)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil {
+			if err := s.checkAvailability(repos, cart.ID, cartItem.ProductID, cartItem.VariantID, cartItem.Quantity); err != nil {
+				return err
+			}
+			item := models.CartItem{CartID: cart.ID, ProductID: cartItem.ProductID, VariantID: cartItem.VariantID}
+			s.reserve(&item, cartItem.Quantity)
+			return repos.Carts.CreateCartItem(&item)
+		}
+
+		quantity := existing.Quantity + cartItem.Quantity
+		if err := s.checkAvailability(repos, cart.ID, existing.ProductID, existing.VariantID, quantity); err != nil {
+			return err
+		}
+		s.reserve(existing, quantity)
+		return repos.Carts.UpdateCartItem(existing)
+	})
+}
+
+// UpdateCartItemQuantity sets the quantity of a cart line and renews its
+// reservation. A quantity of 0 removes the line.
+func (s *CartService) UpdateCartItemQuantity(cartItemID uint, owner models.CartOwner, quantity int) (*models.CartItem, error) {
+	if quantity < 0 {
+		return nil, errors.New("quantity cannot be negative")
+	}
+	if quantity == 0 {
+		return nil, s.RemoveFromCart(cartItemID, owner)
+	}
+
+	var updated *models.CartItem
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		item, err := repos.Carts.FindCartItemByID(cartItemID)
+		if err != nil {
+			return errors.New("cart item not found")
+		}
+
+		cart, err := repos.Carts.FindCartBasic(owner)
+		if err != nil {
+			return errors.New("cart not found")
+		}
+
+		if item.CartID != cart.ID {
+			return errors.New("unauthorized to update this item")
+		}
+
+		if err := s.checkAvailability(repos, cart.ID, item.ProductID, item.VariantID, quantity); err != nil {
+			return err
+		}
+
+		s.reserve(item, quantity)
+		if err := repos.Carts.UpdateCartItem(item); err != nil {
+			return err
+		}
+
+		updated = item
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Create cart item
-	cart, err := s.cartRepo.FindOrCreateCart(userID)
+	return updated, nil
+}
+
+// checkAvailability locks the product row, so concurrent reservations are
+// serialized, and verifies that quantity of the product, or of its variant
+// when variantID is not nil, can be reserved for the cart on top of what
+// other carts already hold
+func (s *CartService) checkAvailability(repos *repositories.TxRepositories, cartID, productID uint, variantID *uint, quantity int) error {
+	available, err := s.lockAvailable(repos, cartID, productID, variantID)
 	if err != nil {
-		// Rollback stock if cart creation fails
-		s.productRepo.UpdateStock(cartItem.ProductID, product.Stock)
 		return err
 	}
+	if available < quantity {
+		return errors.New("insufficient stock")
+	}
+	return nil
+}
+
+// lockAvailable locks the product row and returns the quantity the cart can
+// reserve: on-hand stock of the product, or of its variant, minus the units
+// of expired lots and the reservations of other carts
+func (s *CartService) lockAvailable(repos *repositories.TxRepositories, cartID, productID uint, variantID *uint) (int, error) {
+	products, err := repos.Products.FindByIDsForUpdate([]uint{productID})
+	if err != nil {
+		return 0, err
+	}
+	if len(products) == 0 {
+		return 0, errors.New("product not found")
+	}
+	if !products[0].IsSellable() {
+		return 0, ErrProductUnavailable
+	}
 
-	cartItem.CartID = cart.ID
-	return s.cartRepo.CreateCartItem(&cartItem)
+	variant, err := resolveVariant(&products[0], variantID)
+	if err != nil {
+		return 0, err
+	}
+	if variant != nil && !variant.IsSellable() {
+		return 0, ErrProductUnavailable
+	}
+	today := startOfDay(time.Now())
+	if variant != nil {
+		reserved, err := repos.Carts.FindReservedVariantQuantities([]uint{variant.ID}, cartID)
+		if err != nil {
+			return 0, err
+		}
+		expired, err := repos.Inventory.FindExpiredVariantQuantities([]uint{variant.ID}, today)
+		if err != nil {
+			return 0, err
+		}
+		return variant.Stock - expired[variant.ID] - reserved[variant.ID], nil
+	}
+
+	reserved, err := repos.Carts.FindReservedQuantities([]uint{productID}, cartID)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := repos.Inventory.FindExpiredQuantities([]uint{productID}, today)
+	if err != nil {
+		return 0, err
+	}
+	return products[0].Stock - expired[productID] - reserved[productID], nil
+}
+
+// reserve sets the quantity of a cart line and holds it for the reservation TTL
+func (s *CartService) reserve(item *models.CartItem, quantity int) {
+	reservedUntil := time.Now().Add(s.reservationTTL)
+	item.Quantity = quantity
+	item.ReservedQuantity = quantity
+	item.ReservedUntil = &reservedUntil
+}
+
+// IsCartItemOwner reports whether a cart item belongs to owner's cart. It
+// returns ErrCartItemNotFound when the item does not exist.
+func (s *CartService) IsCartItemOwner(cartItemID uint, owner models.CartOwner) (bool, error) {
+	item, err := s.cartRepo.FindCartItemByID(cartItemID)
+	if err != nil {
+		return false, ErrCartItemNotFound
+	}
+
+	if owner.IsGuest() && owner.GuestToken == "" {
+		return false, nil
+	}
+	cart, err := s.cartRepo.FindCartBasic(owner)
+	if err != nil {
+		return false, nil
+	}
+	return item.CartID == cart.ID, nil
 }
 
-// RemoveFromCart removes an item from the cart
-func (s *CartService) RemoveFromCart(cartItemID uint, userID uint) error {
+// RemoveFromCart removes an item from the cart, releasing its reservation
+func (s *CartService) RemoveFromCart(cartItemID uint, owner models.CartOwner) error {
 	// Get cart item
 	item, err := s.cartRepo.FindCartItemByID(cartItemID)
 	if err != nil {
@@ -69,7 +284,7 @@ func (s *CartService) RemoveFromCart(cartItemID uint, userID uint) error {
 	}
 
 	// Verify ownership
-	cart, err := s.cartRepo.FindCartByUserID(userID)
+	cart, err := s.cartRepo.FindCartBasic(owner)
 	if err != nil {
 		return errors.New("cart not found")
 	}
@@ -77,21 +292,136 @@ func (s *CartService) RemoveFromCart(cartItemID uint, userID uint) error {
 	if item.CartID != cart.ID {
 		return errors.New("unauthorized to remove this item")
 	}
-	// Restore stock (add back the quantity)
-	err = s.productRepo.ReduceStock(item.ProductID, -item.Quantity) // Negative = increase stock
+
+	return s.cartRepo.DeleteCartItem(cartItemID)
+}
+
+// MergeGuestCart moves the lines of a guest cart into the user's cart and
+// deletes the guest cart. Lines for a product already in the user's cart are
+// combined; when the combined quantity is no longer available the line is
+// reduced to what can be reserved (or dropped) and reported as an adjustment.
+// Lines whose variant no longer exists, or that can no longer be bought, are
+// dropped the same way.
+func (s *CartService) MergeGuestCart(guestToken string, userID uint) (*models.CartMergeResult, error) {
+	result := &models.CartMergeResult{}
+	if guestToken == "" {
+		return result, nil
+	}
+
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		guestCart, err := repos.Carts.FindCartByGuestToken(guestToken)
+		if err != nil {
+			return err
+		}
+		if guestCart == nil {
+			return nil
+		}
+
+		userCart, err := repos.Carts.FindOrCreateCart(models.CartOwner{UserID: userID})
+		if err != nil {
+			return err
+		}
+
+		// Drop the guest cart first so its reservations no longer count
+		// against the stock available to the user's cart
+		if err := repos.Carts.DeleteCart(guestCart.ID); err != nil {
+			return err
+		}
+
+		for _, guestItem := range guestCart.CartItems {
+			existing, err := repos.Carts.FindCartItemByProduct(userCart.ID, guestItem.ProductID, guestItem.VariantID)
+			if err != nil {
+				return err
+			}
+
+			requested := guestItem.Quantity
+			if existing != nil {
+				requested += existing.Quantity
+			}
+
+			available, err := s.lockAvailable(repos, userCart.ID, guestItem.ProductID, guestItem.VariantID)
+			if errors.Is(err, ErrVariantRequired) || errors.Is(err, ErrVariantNotFound) || errors.Is(err, ErrProductUnavailable) {
+				available = 0
+			} else if err != nil {
+				return err
+			}
+
+			quantity := requested
+			if quantity > available {
+				quantity = available
+				if quantity < 0 {
+					quantity = 0
+				}
+				result.Adjustments = append(result.Adjustments, models.CartMergeAdjustment{
+					ProductID: guestItem.ProductID,
+					VariantID: guestItem.VariantID,
+					Requested: requested,
+					Quantity:  quantity,
+				})
+			}
+
+			switch {
+			case existing != nil && quantity > 0:
+				s.reserve(existing, quantity)
+				err = repos.Carts.UpdateCartItem(existing)
+			case existing != nil:
+				err = repos.Carts.DeleteCartItem(existing.ID)
+			case quantity > 0:
+				item := models.CartItem{CartID: userCart.ID, ProductID: guestItem.ProductID, VariantID: guestItem.VariantID}
+				s.reserve(&item, quantity)
+				err = repos.Carts.CreateCartItem(&item)
+			}
+			if err != nil {
+				return err
+			}
+			result.MergedItems++
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.cartRepo.DeleteCartItem(cartItemID)
+	return result, nil
+}
+
+// ReleaseExpiredReservations releases the stock held by expired reservations
+func (s *CartService) ReleaseExpiredReservations() (int64, error) {
+	return s.cartRepo.ReleaseExpiredReservations(time.Now())
+}
+
+// StartReservationSweeper releases expired reservations every interval until
+// ctx is cancelled
+func (s *CartService) StartReservationSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "cart-reservation-sweeper", interval, func() error {
+		released, err := s.ReleaseExpiredReservations()
+		if err != nil {
+			return err
+		}
+		if released > 0 {
+			utils.Infof("Released %d expired cart reservations", released)
+		}
+		return nil
+	})
+}
+
+// MigrateLegacyReservations converts cart items whose stock was deducted on
+// add (before reservations were introduced) into regular reservations
+func (s *CartService) MigrateLegacyReservations() (int64, error) {
+	return s.cartRepo.ConvertLegacyCartItems(time.Now().Add(s.reservationTTL))
 }
 
 // ClearCart clears all items from a cart
-func (s *CartService) ClearCart(userID uint) error {
-	cart, err := s.cartRepo.FindCartByUserID(userID)
+func (s *CartService) ClearCart(owner models.CartOwner) error {
+	cart, err := s.cartRepo.FindCartBasic(owner)
 	if err != nil {
 		return err
 	}
 
 	return s.cartRepo.ClearCart(cart.ID)
 }
+
+// roundCents rounds an amount to whole cents
+func roundCents(amount float64) float64 {
+	return float64(toMinorUnits(amount)) / 100
+}
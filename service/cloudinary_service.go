@@ -53,6 +53,26 @@ func (s *CloudinaryService) UploadImage(ctx context.Context, file multipart.File
 	return uploadResult.SecureURL, nil
 }
 
+// UploadDocument uploads a document (an image or PDF scan) to Cloudinary
+// without resizing it and returns the URL
+func (s *CloudinaryService) UploadDocument(ctx context.Context, file multipart.File, filename, folder string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	publicID := fmt.Sprintf("%d_%s", time.Now().UnixNano(), strings.TrimSuffix(filename, ext))
+
+	// PDFs are stored as image resources, so they can be deleted with DeleteImage
+	uploadResult, err := s.cld.Upload.Upload(ctx, file, uploader.UploadParams{
+		PublicID:     publicID,
+		Folder:       "health-store/" + folder,
+		ResourceType: "image",
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to upload document to Cloudinary: %w", err)
+	}
+
+	return uploadResult.SecureURL, nil
+}
+
 // DeleteImage deletes an image from Cloudinary
 func (s *CloudinaryService) DeleteImage(ctx context.Context, imageURL string) error {
 	// Extract public ID from the URL
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"health-store/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDialector is SQLite without the MySQL FULLTEXT index product search uses
+type testDialector struct {
+	gorm.Dialector
+}
+
+func (d testDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return testMigrator{d.Dialector.Migrator(db)}
+}
+
+type testMigrator struct {
+	gorm.Migrator
+}
+
+func (m testMigrator) CreateIndex(value interface{}, name string) error {
+	if name == "idx_products_search" {
+		return nil
+	}
+	return m.Migrator.CreateIndex(value, name)
+}
+
+// newTestDB opens a fresh in-memory database with the schema migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(testDialector{sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.MFARecoveryCode{},
+		&models.Category{},
+		&models.Product{},
+		&models.ProductVariant{},
+		&models.InventoryLot{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderItemLot{},
+		&models.Prescription{},
+		&models.StockMovement{},
+		&models.Recall{},
+		&models.RecallItem{},
+		&models.ShopOrder{},
+		&models.Shop{},
+		&models.ShopRequest{},
+		&models.ShopRequestDocument{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.CommissionRule{},
+		&models.PayoutBatch{},
+		&models.Payout{},
+		&models.PaymentWebhookEvent{},
+	)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	return db
+}
+
+// failDeletesFrom makes every delete from table fail, standing in for an
+// error part way through a transaction
+func failDeletesFrom(t *testing.T, db *gorm.DB, table string) {
+	t.Helper()
+	err := db.Callback().Delete().Before("gorm:delete").Register("test:fail_delete_"+table, func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			tx.AddError(errors.New("injected failure"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+}
+
+// failUpdatesOf makes every update of table fail
+func failUpdatesOf(t *testing.T, db *gorm.DB, table string) {
+	t.Helper()
+	err := db.Callback().Update().Before("gorm:update").Register("test:fail_update_"+table, func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			tx.AddError(errors.New("injected failure"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+}
+
+// recordLockedTables records the tables read with a locking clause and
+// returns a function reporting whether a table was. SQLite has no row locks
+// and leaves FOR UPDATE out of its SQL, so tests can only check that the
+// lock was asked for.
+func recordLockedTables(t *testing.T, db *gorm.DB) func(table string) bool {
+	t.Helper()
+	var mu sync.Mutex
+	locked := make(map[string]bool)
+	err := db.Callback().Query().Before("gorm:query").Register("test:record_locks", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Clauses["FOR"]; ok {
+			mu.Lock()
+			locked[tx.Statement.Table] = true
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return func(table string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return locked[table]
+	}
+}
@@ -25,11 +25,21 @@ func (s *FeedbackService) GetFeedbackByID(id uint) (*models.Feedback, error) {
 	return s.feedbackRepo.FindByID(id)
 }
 
+// DeleteFeedback deletes a feedback
+func (s *FeedbackService) DeleteFeedback(id uint) error {
+	return s.feedbackRepo.Delete(id)
+}
+
 // GetFeedbackByProductID gets feedback by product ID
 func (s *FeedbackService) GetFeedbackByProductID(productID uint) ([]models.Feedback, error) {
 	return s.feedbackRepo.FindByProductID(productID)
 }
 
+// ListProductFeedback gets a page of the feedback on a product
+func (s *FeedbackService) ListProductFeedback(productID uint, params models.ListParams) (*models.Page[models.Feedback], error) {
+	return s.feedbackRepo.ListByProductID(productID, params)
+}
+
 // GetFeedbackByUserID gets feedback by user ID
 func (s *FeedbackService) GetFeedbackByUserID(userID uint) ([]models.Feedback, error) {
 	return s.feedbackRepo.FindByUserID(userID)
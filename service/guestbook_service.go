@@ -31,9 +31,9 @@ func (s *GuestBookService) CreateEntry(req *models.GuestBookCreateRequest) (*mod
 	return entry, nil
 }
 
-// GetAllEntries gets all guest book entries
-func (s *GuestBookService) GetAllEntries() ([]models.GuestBook, error) {
-	return s.guestBookRepo.FindAll()
+// ListEntries gets a page of guest book entries
+func (s *GuestBookService) ListEntries(params models.ListParams) (*models.Page[models.GuestBook], error) {
+	return s.guestBookRepo.List(params)
 }
 
 // GetEntryByID gets a guest book entry by ID
@@ -0,0 +1,548 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrLotNotFound is returned for unknown lots and for lots of another product
+	ErrLotNotFound = errors.New("inventory lot not found")
+	// ErrLotNumberTaken is returned when a product or variant already has a lot with the lot number
+	ErrLotNumberTaken = errors.New("lot number is already used for this product")
+	// ErrInvalidLotDate is returned for malformed lot dates
+	ErrInvalidLotDate = errors.New("invalid date, use YYYY-MM-DD")
+	// ErrLotExpired is returned when receiving a lot that has already expired
+	ErrLotExpired = errors.New("lot has already expired")
+	// ErrInsufficientUnexpiredStock is returned when the unexpired lots of a product can not cover an order
+	ErrInsufficientUnexpiredStock = errors.New("not enough unexpired stock")
+)
+
+// Reporting window of the expiring lots report, in days
+const (
+	DefaultExpiringLotDays = 30
+	MaxExpiringLotDays     = 365
+)
+
+// InventoryService tracks stock by lot number and expiry date, keeps the
+// stock ledger and raises low-stock alerts
+type InventoryService struct {
+	inventoryRepo repositories.InventoryRepositoryInterface
+	productRepo   repositories.ProductRepositoryInterface
+	stockRepo     repositories.StockMovementRepositoryInterface
+	uow           repositories.UnitOfWorkInterface
+	notifier      StockAlertNotifier
+	cfg           config.InventoryConfig
+}
+
+// NewInventoryService creates a new inventory service
+func NewInventoryService(
+	inventoryRepo repositories.InventoryRepositoryInterface,
+	productRepo repositories.ProductRepositoryInterface,
+	stockRepo repositories.StockMovementRepositoryInterface,
+	uow repositories.UnitOfWorkInterface,
+	notifier StockAlertNotifier,
+	cfg config.InventoryConfig,
+) *InventoryService {
+	return &InventoryService{
+		inventoryRepo: inventoryRepo,
+		productRepo:   productRepo,
+		stockRepo:     stockRepo,
+		uow:           uow,
+		notifier:      notifier,
+		cfg:           cfg,
+	}
+}
+
+// GetProductLots gets the lots of a product and its variants, earliest expiry first
+func (s *InventoryService) GetProductLots(productID uint) ([]models.InventoryLot, error) {
+	if _, err := s.productRepo.FindByID(productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+	return s.inventoryRepo.FindLotsByProductID(productID)
+}
+
+// ReceiveLot records a lot received into stock and adds its units to the
+// stock of the product, or of the variant it names. Products with variants
+// receive lots by variant.
+func (s *InventoryService) ReceiveLot(productID uint, req models.InventoryLotCreateRequest) (*models.InventoryLot, error) {
+	expiryDate, err := parseLotDate(req.ExpiryDate)
+	if err != nil {
+		return nil, err
+	}
+	receivedAt := startOfDay(time.Now())
+	if req.ReceivedAt != "" {
+		if receivedAt, err = parseLotDate(req.ReceivedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	lot := &models.InventoryLot{
+		ProductID:  productID,
+		VariantID:  req.VariantID,
+		LotNumber:  req.LotNumber,
+		ExpiryDate: expiryDate,
+		Quantity:   req.Quantity,
+		ReceivedAt: receivedAt,
+	}
+	if lot.IsExpired(time.Now()) {
+		return nil, ErrLotExpired
+	}
+
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		// Lock the product so the stock and lots change together
+		products, err := repos.Products.FindByIDsForUpdate([]uint{productID})
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return ErrProductNotFound
+		}
+		if _, err := resolveVariant(&products[0], req.VariantID); err != nil {
+			return err
+		}
+
+		if err := checkLotNumber(repos, lot, 0); err != nil {
+			return err
+		}
+		if err := repos.Inventory.CreateLot(lot); err != nil {
+			return err
+		}
+		return moveStock(repos, &models.StockMovement{
+			ProductID: productID,
+			VariantID: req.VariantID,
+			Quantity:  lot.Quantity,
+			Reason:    models.StockReasonLotReceive,
+			LotID:     &lot.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lot, nil
+}
+
+// UpdateLot corrects the lot number, expiry date or units left of a lot. A
+// change in units, such as writing off an expired lot by setting it to 0, is
+// applied to the stock as well, except for recalled lots, whose units are
+// already out of stock.
+func (s *InventoryService) UpdateLot(productID, lotID uint, req models.InventoryLotUpdateRequest) (*models.InventoryLot, error) {
+	var lot *models.InventoryLot
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		if _, err := repos.Products.FindByIDsForUpdate([]uint{productID}); err != nil {
+			return err
+		}
+
+		var err error
+		lot, err = repos.Inventory.FindLotByID(productID, lotID)
+		if err != nil {
+			return ErrLotNotFound
+		}
+
+		if req.LotNumber != "" && req.LotNumber != lot.LotNumber {
+			lot.LotNumber = req.LotNumber
+			if err := checkLotNumber(repos, lot, lot.ID); err != nil {
+				return err
+			}
+		}
+		if req.ExpiryDate != "" {
+			if lot.ExpiryDate, err = parseLotDate(req.ExpiryDate); err != nil {
+				return err
+			}
+		}
+		if req.Quantity != nil && *req.Quantity != lot.Quantity {
+			// Units of recalled lots are already out of stock
+			if lot.RecallID == nil {
+				if err := moveStock(repos, &models.StockMovement{
+					ProductID: lot.ProductID,
+					VariantID: lot.VariantID,
+					Quantity:  *req.Quantity - lot.Quantity,
+					Reason:    models.StockReasonAdminAdjust,
+					LotID:     &lot.ID,
+					Note:      "lot " + lot.LotNumber + " corrected",
+				}); err != nil {
+					return err
+				}
+			}
+			lot.Quantity = *req.Quantity
+		}
+
+		return repos.Inventory.UpdateLot(lot)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lot, nil
+}
+
+// GetExpiringLots reports the lots with units left that expire within days
+// days, including lots that have already expired
+func (s *InventoryService) GetExpiringLots(days int) (*models.ExpiringLotsReport, error) {
+	now := time.Now()
+	start := startOfDay(now)
+	lots, err := s.inventoryRepo.FindExpiringLots(start.AddDate(0, 0, days+1))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ExpiringLotsReport{
+		Days:        days,
+		GeneratedAt: now,
+		Lots:        make([]models.ExpiringLot, 0, len(lots)),
+	}
+	for _, lot := range lots {
+		lot.DaysLeft = daysBetween(start, lot.ExpiryDate)
+		lot.Expired = lot.IsExpired(now)
+		report.Units += lot.Quantity
+		report.Lots = append(report.Lots, lot)
+	}
+	report.Count = len(report.Lots)
+	return report, nil
+}
+
+// GetStockHistory gets a page of the stock movements of a product and its
+// variants, newest first by default
+func (s *InventoryService) GetStockHistory(productID uint, params models.ListParams) (*models.Page[models.StockMovement], error) {
+	if _, err := s.productRepo.FindByID(productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+	return s.stockRepo.ListByProductID(productID, params)
+}
+
+// RecordOpeningStock starts the stock ledger of products that have none with
+// their stock on hand, so that databases created before the ledger existed
+// reconcile. It returns the number of products whose ledger was started.
+func (s *InventoryService) RecordOpeningStock() (int64, error) {
+	return s.stockRepo.RecordOpeningStock(time.Now())
+}
+
+// ReconcileStock compares the stock of every product and variant with the sum
+// of its stock movements and flags those that disagree, replacing the flags
+// of the previous reconciliation
+func (s *InventoryService) ReconcileStock() (*models.StockReconciliation, error) {
+	discrepancies, err := s.stockRepo.FindDiscrepancies()
+	if err != nil {
+		return nil, err
+	}
+	flagged, err := s.stockRepo.FindFlaggedDiscrepancies()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep when discrepancies that are still there were first detected
+	type key struct {
+		productID uint
+		variantID uint
+	}
+	keyOf := func(d models.StockDiscrepancy) key {
+		k := key{productID: d.ProductID}
+		if d.VariantID != nil {
+			k.variantID = *d.VariantID
+		}
+		return k
+	}
+	detectedAt := make(map[key]time.Time, len(flagged))
+	for _, d := range flagged {
+		detectedAt[keyOf(d)] = d.DetectedAt
+	}
+
+	now := time.Now()
+	for i := range discrepancies {
+		discrepancies[i].Difference = discrepancies[i].Stock - discrepancies[i].LedgerStock
+		discrepancies[i].CheckedAt = now
+		discrepancies[i].DetectedAt = now
+		if at, ok := detectedAt[keyOf(discrepancies[i])]; ok {
+			discrepancies[i].DetectedAt = at
+		}
+	}
+
+	if err := s.stockRepo.ReplaceDiscrepancies(discrepancies); err != nil {
+		return nil, err
+	}
+	return &models.StockReconciliation{
+		CheckedAt:     now,
+		Discrepancies: discrepancies,
+		Count:         len(discrepancies),
+	}, nil
+}
+
+// GetStockDiscrepancies gets the discrepancies flagged by the last reconciliation
+func (s *InventoryService) GetStockDiscrepancies() ([]models.StockDiscrepancy, error) {
+	return s.stockRepo.FindFlaggedDiscrepancies()
+}
+
+// StartStockReconciler reconciles stock with the ledger every interval until
+// ctx is cancelled
+func (s *InventoryService) StartStockReconciler(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "stock-reconciler", interval, func() error {
+		result, err := s.ReconcileStock()
+		if err != nil {
+			return err
+		}
+		if result.Count > 0 {
+			utils.Warnf("Stock reconciliation flagged %d products or variants whose stock disagrees with the ledger", result.Count)
+		}
+		return nil
+	})
+}
+
+// GetLowStockReport lists the products below their reorder threshold or
+// with fewer days of cover than configured at the rate they sold over the
+// sales window, with the units to reorder to restock to the reorder days of
+// cover above the threshold
+func (s *InventoryService) GetLowStockReport() (*models.LowStockReport, error) {
+	now := time.Now()
+	levels, err := s.inventoryRepo.FindStockLevels(now.Add(-s.cfg.SalesWindow))
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := s.inventoryRepo.FindLowStockNotifications()
+	if err != nil {
+		return nil, err
+	}
+	notifiedAt := make(map[uint]time.Time, len(notifications))
+	for _, n := range notifications {
+		notifiedAt[n.ProductID] = n.NotifiedAt
+	}
+
+	windowDays := s.cfg.SalesWindow.Hours() / 24
+	report := &models.LowStockReport{
+		GeneratedAt:      now,
+		SalesWindowDays:  int(math.Round(windowDays)),
+		CoverDays:        s.cfg.LowStockCoverDays,
+		ReorderCoverDays: s.cfg.ReorderCoverDays,
+		Alerts:           []models.LowStockAlert{},
+	}
+	for _, level := range levels {
+		alert := models.LowStockAlert{
+			ProductStockLevel: level,
+			DailySales:        float64(level.UnitsSold) / windowDays,
+		}
+		belowThreshold := level.ReorderThreshold > 0 && level.Stock < level.ReorderThreshold
+		shortCover := false
+		if alert.DailySales > 0 {
+			cover := math.Max(float64(level.Stock), 0) / alert.DailySales
+			alert.DaysOfCover = &cover
+			shortCover = cover < float64(s.cfg.LowStockCoverDays)
+		}
+		if !belowThreshold && !shortCover {
+			continue
+		}
+
+		target := int(math.Ceil(alert.DailySales*float64(s.cfg.ReorderCoverDays))) + level.ReorderThreshold
+		if target > level.Stock {
+			alert.SuggestedReorder = target - level.Stock
+		}
+		if at, ok := notifiedAt[level.ProductID]; ok {
+			alert.NotifiedAt = &at
+		}
+		report.Alerts = append(report.Alerts, alert)
+	}
+
+	// Fewest days of cover first, products that did not sell after those that did
+	sort.SliceStable(report.Alerts, func(i, j int) bool {
+		a, b := report.Alerts[i].DaysOfCover, report.Alerts[j].DaysOfCover
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+	report.Count = len(report.Alerts)
+	return report, nil
+}
+
+// NotifyLowStock notifies admins of the low-stock alerts they have not been
+// notified of, and forgets the notifications of products whose stock
+// recovered so they are notified again when it next runs low. It returns the
+// number of alerts notified.
+func (s *InventoryService) NotifyLowStock() (int, error) {
+	report, err := s.GetLowStockReport()
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []models.LowStockAlert
+	productIDs := make([]uint, 0, len(report.Alerts))
+	for _, alert := range report.Alerts {
+		productIDs = append(productIDs, alert.ProductID)
+		if alert.NotifiedAt == nil {
+			pending = append(pending, alert)
+		}
+	}
+
+	if len(pending) > 0 {
+		// Alerts are only recorded once notified, so a failed notification is retried
+		if err := s.notifier.NotifyLowStock(pending); err != nil {
+			return 0, err
+		}
+		notifications := make([]models.LowStockNotification, 0, len(pending))
+		for _, alert := range pending {
+			notifications = append(notifications, models.LowStockNotification{ProductID: alert.ProductID, NotifiedAt: report.GeneratedAt})
+		}
+		if err := s.inventoryRepo.CreateLowStockNotifications(notifications); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.inventoryRepo.DeleteLowStockNotificationsExcept(productIDs); err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// StartLowStockMonitor checks stock levels and notifies admins of new
+// low-stock alerts every interval until ctx is cancelled
+func (s *InventoryService) StartLowStockMonitor(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "low-stock-monitor", interval, func() error {
+		notified, err := s.NotifyLowStock()
+		if err != nil {
+			return err
+		}
+		if notified > 0 {
+			utils.Infof("Notified admins of %d products low on stock", notified)
+		}
+		return nil
+	})
+}
+
+// allocateLots takes the units of an order item from the unexpired lots of
+// its product (or variant), earliest expiry first, and records the lots on
+// the item. Products that have never had a lot are not tracked by lot.
+func allocateLots(repos *repositories.TxRepositories, item *models.OrderItem, now time.Time) error {
+	lots, err := repos.Inventory.FindSellableLotsForUpdate(item.ProductID, item.VariantID, startOfDay(now))
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		tracked, err := repos.Inventory.HasLots(item.ProductID, item.VariantID)
+		if err != nil || !tracked {
+			return err
+		}
+	}
+
+	remaining := item.Quantity
+	var allocations []models.OrderItemLot
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+		quantity := lot.Quantity
+		if quantity > remaining {
+			quantity = remaining
+		}
+		if err := repos.Inventory.ReduceLotQuantity(lot.ID, quantity); err != nil {
+			return err
+		}
+		allocations = append(allocations, models.OrderItemLot{
+			OrderItemID: item.ID,
+			LotID:       lot.ID,
+			LotNumber:   lot.LotNumber,
+			ExpiryDate:  lot.ExpiryDate,
+			Quantity:    quantity,
+		})
+		remaining -= quantity
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%w (available: %d, requested: %d)", ErrInsufficientUnexpiredStock, item.Quantity-remaining, item.Quantity)
+	}
+
+	if err := repos.Inventory.CreateOrderItemLots(allocations); err != nil {
+		return err
+	}
+	item.Lots = allocations
+	return nil
+}
+
+// restoreLots returns the units an order took from lots to those lots. Units
+// of recalled lots are kept out of the stock the order returned them to.
+func restoreLots(repos *repositories.TxRepositories, orderID uint) error {
+	allocations, err := repos.Inventory.FindOrderItemLotsByOrderID(orderID)
+	if err != nil {
+		return err
+	}
+	for _, allocation := range allocations {
+		if err := repos.Inventory.ReduceLotQuantity(allocation.LotID, -allocation.Quantity); err != nil {
+			return err
+		}
+		if lot := allocation.Lot; lot != nil && lot.RecallID != nil {
+			if err := moveStock(repos, &models.StockMovement{
+				ProductID: lot.ProductID,
+				VariantID: lot.VariantID,
+				Quantity:  -allocation.Quantity,
+				Reason:    models.StockReasonRecall,
+				OrderID:   &orderID,
+				LotID:     &lot.ID,
+				RecallID:  lot.RecallID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveStock applies a stock movement to the stock of its product, and of its
+// variant when it names one, and records it in the stock ledger. The
+// product's stock stays the total of its variants.
+func moveStock(repos *repositories.TxRepositories, movement *models.StockMovement) error {
+	if movement.Quantity == 0 {
+		return nil
+	}
+	if err := repos.Products.ReduceStock(movement.ProductID, -movement.Quantity); err != nil {
+		return fmt.Errorf("failed to update stock for product %d: %v", movement.ProductID, err)
+	}
+	if movement.VariantID != nil {
+		if err := repos.Products.ReduceVariantStock(*movement.VariantID, -movement.Quantity); err != nil {
+			return fmt.Errorf("failed to update stock for variant %d: %v", *movement.VariantID, err)
+		}
+	}
+	if err := repos.StockMovements.Create(movement); err != nil {
+		return fmt.Errorf("failed to record stock movement for product %d: %v", movement.ProductID, err)
+	}
+	return nil
+}
+
+// checkLotNumber verifies that no lot of the same product or variant other
+// than excludeID uses the lot number of lot
+func checkLotNumber(repos *repositories.TxRepositories, lot *models.InventoryLot, excludeID uint) error {
+	taken, err := repos.Inventory.ExistsLotNumber(lot.ProductID, lot.VariantID, lot.LotNumber, excludeID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrLotNumberTaken
+	}
+	return nil
+}
+
+// parseLotDate reads a YYYY-MM-DD lot date
+func parseLotDate(value string) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, ErrInvalidLotDate
+	}
+	return date, nil
+}
+
+// startOfDay returns the start of the day of now
+func startOfDay(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
+
+// daysBetween counts the calendar days from one date to another, negative when to is before from
+func daysBetween(from, to time.Time) int {
+	fromYear, fromMonth, fromDay := from.Date()
+	toYear, toMonth, toDay := to.Date()
+	start := time.Date(fromYear, fromMonth, fromDay, 0, 0, 0, 0, time.UTC)
+	end := time.Date(toYear, toMonth, toDay, 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
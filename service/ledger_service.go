@@ -0,0 +1,584 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"time"
+)
+
+var (
+	// ErrInvalidCommissionRule is returned for rules that do not name exactly one shop or category
+	ErrInvalidCommissionRule = errors.New("commission rule must apply to exactly one shop or category")
+	// ErrCommissionRuleNotFound is returned for unknown commission rules
+	ErrCommissionRuleNotFound = errors.New("commission rule not found")
+	// ErrCommissionScopeNotFound is returned when the shop or category of a rule does not exist
+	ErrCommissionScopeNotFound = errors.New("shop or category not found")
+	// ErrNoPayoutsDue is returned when no shop is owed enough for a payout
+	ErrNoPayoutsDue = errors.New("no shop balance is due for payout")
+	// ErrPayoutBatchNotFound is returned for unknown payout batches
+	ErrPayoutBatchNotFound = errors.New("payout batch not found")
+	// ErrPayoutNotFound is returned for unknown payouts
+	ErrPayoutNotFound = errors.New("payout not found")
+	// ErrPayoutSettled is returned when recording the outcome of a payout twice
+	ErrPayoutSettled = errors.New("payout has already been settled")
+	// ErrInvalidStatementPeriod is returned for malformed statement dates
+	ErrInvalidStatementPeriod = errors.New("invalid statement period, use YYYY-MM-DD dates with the start before the end")
+)
+
+// LedgerService keeps the double-entry ledger of what the platform owes shops,
+// manages commission rules and pays shops out in batches
+type LedgerService struct {
+	ledgerRepo   repositories.LedgerRepositoryInterface
+	shopRepo     *repositories.ShopRepository
+	categoryRepo repositories.CategoryRepositoryInterface
+	uow          repositories.UnitOfWorkInterface
+	config       config.MarketplaceConfig
+}
+
+// NewLedgerService creates a new ledger service
+func NewLedgerService(
+	ledgerRepo repositories.LedgerRepositoryInterface,
+	shopRepo *repositories.ShopRepository,
+	categoryRepo repositories.CategoryRepositoryInterface,
+	uow repositories.UnitOfWorkInterface,
+	cfg config.MarketplaceConfig,
+) *LedgerService {
+	return &LedgerService{
+		ledgerRepo:   ledgerRepo,
+		shopRepo:     shopRepo,
+		categoryRepo: categoryRepo,
+		uow:          uow,
+		config:       cfg,
+	}
+}
+
+// postOrderSale records the revenue of a paid order, one transaction per
+// sub-order. Payments for shop items are split between what the shop is owed
+// and the platform commission; items sold by the store are booked as store
+// sales. Orders that were already posted are skipped.
+func (s *LedgerService) postOrderSale(repos *repositories.TxRepositories, orderID uint) error {
+	// Lock the order so concurrent payment confirmations post it only once
+	if _, err := repos.Orders.FindByIDForUpdate(orderID); err != nil {
+		return fmt.Errorf("failed to lock order: %v", err)
+	}
+	posted, err := repos.Ledger.HasOrderTransaction(orderID, models.LedgerTypeSale)
+	if err != nil || posted {
+		return err
+	}
+
+	order, err := repos.Orders.FindByID(orderID)
+	if err != nil {
+		return fmt.Errorf("failed to load order: %v", err)
+	}
+	rates, err := s.commissionRates(repos.Ledger)
+	if err != nil {
+		return err
+	}
+
+	// Orders placed before sub-orders existed only hold store items
+	if len(order.ShopOrders) == 0 {
+		return postTransaction(repos.Ledger, &models.LedgerTransaction{
+			Type:        models.LedgerTypeSale,
+			OrderID:     &order.ID,
+			Description: fmt.Sprintf("Order #%d", order.ID),
+			Entries: []models.LedgerEntry{
+				{Account: models.LedgerAccountCash, Debit: roundCents(order.TotalPrice)},
+				{Account: models.LedgerAccountStoreSales, Credit: roundCents(order.TotalPrice)},
+			},
+		})
+	}
+
+	for _, shopOrder := range order.ShopOrders {
+		transaction := &models.LedgerTransaction{
+			Type:        models.LedgerTypeSale,
+			OrderID:     &order.ID,
+			ShopOrderID: &shopOrder.ID,
+			ShopID:      shopOrder.ShopID,
+			Description: fmt.Sprintf("Order #%d", order.ID),
+		}
+
+		if shopOrder.ShopID == nil {
+			transaction.Entries = []models.LedgerEntry{
+				{Account: models.LedgerAccountCash, Debit: shopOrder.Subtotal},
+				{Account: models.LedgerAccountStoreSales, Credit: shopOrder.Subtotal},
+			}
+		} else {
+			var commission float64
+			for _, item := range order.OrderItems {
+				if item.ShopOrderID != nil && *item.ShopOrderID == shopOrder.ID {
+					commission += item.Price * float64(item.Quantity) * rates.rate(*shopOrder.ShopID, item.Product.CategoryID)
+				}
+			}
+			commission = roundCents(commission)
+
+			transaction.Entries = []models.LedgerEntry{
+				{Account: models.LedgerAccountCash, ShopID: shopOrder.ShopID, Debit: shopOrder.Subtotal},
+				{Account: models.LedgerAccountSellerPayable, ShopID: shopOrder.ShopID, Credit: roundCents(shopOrder.Subtotal - commission)},
+				{Account: models.LedgerAccountCommission, ShopID: shopOrder.ShopID, Credit: commission},
+			}
+		}
+
+		if err := postTransaction(repos.Ledger, transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postOrderRefund reverses the sale transactions of a cancelled order. Orders
+// that were never posted or were already reversed are skipped.
+func (s *LedgerService) postOrderRefund(repos *repositories.TxRepositories, orderID uint) error {
+	refunded, err := repos.Ledger.HasOrderTransaction(orderID, models.LedgerTypeRefund)
+	if err != nil || refunded {
+		return err
+	}
+
+	sales, err := repos.Ledger.FindOrderTransactions(orderID, models.LedgerTypeSale)
+	if err != nil {
+		return fmt.Errorf("failed to load order transactions: %v", err)
+	}
+
+	for _, sale := range sales {
+		refund := &models.LedgerTransaction{
+			Type:        models.LedgerTypeRefund,
+			OrderID:     sale.OrderID,
+			ShopOrderID: sale.ShopOrderID,
+			ShopID:      sale.ShopID,
+			Description: fmt.Sprintf("Refund of order #%d", orderID),
+		}
+		for _, entry := range sale.Entries {
+			refund.Entries = append(refund.Entries, models.LedgerEntry{
+				Account: entry.Account,
+				ShopID:  entry.ShopID,
+				Debit:   entry.Credit,
+				Credit:  entry.Debit,
+			})
+		}
+		if err := postTransaction(repos.Ledger, refund); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postTransaction saves a transaction after dropping empty entries and
+// checking that its debits and credits balance
+func postTransaction(ledger repositories.LedgerRepositoryInterface, transaction *models.LedgerTransaction) error {
+	var entries []models.LedgerEntry
+	var debits, credits int64
+	for _, entry := range transaction.Entries {
+		if toMinorUnits(entry.Debit) == 0 && toMinorUnits(entry.Credit) == 0 {
+			continue
+		}
+		debits += toMinorUnits(entry.Debit)
+		credits += toMinorUnits(entry.Credit)
+		entries = append(entries, entry)
+	}
+	if debits != credits {
+		return fmt.Errorf("unbalanced ledger transaction %q: debits %.2f, credits %.2f",
+			transaction.Description, float64(debits)/100, float64(credits)/100)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	transaction.Entries = entries
+	if err := ledger.CreateTransaction(transaction); err != nil {
+		return fmt.Errorf("failed to post ledger transaction: %v", err)
+	}
+	return nil
+}
+
+// commissionTable resolves the commission rate of a sale
+type commissionTable struct {
+	shops       map[uint]float64
+	categories  map[uint]float64
+	defaultRate float64
+}
+
+// rate returns the rate of the shop rule, else of the category rule, else the default rate
+func (t commissionTable) rate(shopID, categoryID uint) float64 {
+	if rate, ok := t.shops[shopID]; ok {
+		return rate
+	}
+	if rate, ok := t.categories[categoryID]; ok {
+		return rate
+	}
+	return t.defaultRate
+}
+
+// commissionRates loads the commission rules
+func (s *LedgerService) commissionRates(ledger repositories.LedgerRepositoryInterface) (commissionTable, error) {
+	table := commissionTable{
+		shops:       map[uint]float64{},
+		categories:  map[uint]float64{},
+		defaultRate: s.config.CommissionRate,
+	}
+
+	rules, err := ledger.FindCommissionRules()
+	if err != nil {
+		return table, fmt.Errorf("failed to load commission rules: %v", err)
+	}
+	for _, rule := range rules {
+		if rule.ShopID != nil {
+			table.shops[*rule.ShopID] = rule.Rate
+		} else if rule.CategoryID != nil {
+			table.categories[*rule.CategoryID] = rule.Rate
+		}
+	}
+	return table, nil
+}
+
+// GetCommissionRules gets all commission rules and the default rate
+func (s *LedgerService) GetCommissionRules() ([]models.CommissionRule, float64, error) {
+	rules, err := s.ledgerRepo.FindCommissionRules()
+	return rules, s.config.CommissionRate, err
+}
+
+// SaveCommissionRule sets the commission rate of a shop or category, replacing
+// its previous rule. The new rate applies to orders paid from now on.
+func (s *LedgerService) SaveCommissionRule(req models.CommissionRuleRequest) (*models.CommissionRule, error) {
+	if (req.ShopID == nil) == (req.CategoryID == nil) {
+		return nil, ErrInvalidCommissionRule
+	}
+	if req.ShopID != nil {
+		if _, err := s.shopRepo.FindByID(*req.ShopID); err != nil {
+			return nil, ErrCommissionScopeNotFound
+		}
+	} else if _, err := s.categoryRepo.FindByID(*req.CategoryID); err != nil {
+		return nil, ErrCommissionScopeNotFound
+	}
+
+	rule, err := s.ledgerRepo.FindCommissionRuleByScope(req.ShopID, req.CategoryID)
+	if err != nil {
+		rule = &models.CommissionRule{ShopID: req.ShopID, CategoryID: req.CategoryID}
+	}
+	rule.Rate = *req.Rate
+
+	if err := s.ledgerRepo.SaveCommissionRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to save commission rule: %v", err)
+	}
+	return rule, nil
+}
+
+// DeleteCommissionRule deletes a commission rule, so the default rate applies again
+func (s *LedgerService) DeleteCommissionRule(id uint) error {
+	deleted, err := s.ledgerRepo.DeleteCommissionRule(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCommissionRuleNotFound
+	}
+	return nil
+}
+
+// GetSellerBalances gets what is currently owed to every shop
+func (s *LedgerService) GetSellerBalances() ([]models.SellerBalance, error) {
+	balances, err := s.ledgerRepo.GetSellerBalances()
+	for i := range balances {
+		balances[i].Balance = roundCents(balances[i].Balance)
+	}
+	return balances, err
+}
+
+// CreatePayoutBatch pays out every shop owed at least the minimum payout. The
+// amounts move from the shops' balances to payouts in transit until each
+// payout is marked paid or failed.
+func (s *LedgerService) CreatePayoutBatch() (*models.PayoutBatch, error) {
+	var batch *models.PayoutBatch
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		// Lock the shops so two batches can not pay the same balance
+		if err := repos.Ledger.LockSellerAccounts(); err != nil {
+			return fmt.Errorf("failed to lock seller accounts: %v", err)
+		}
+
+		balances, err := repos.Ledger.GetSellerBalances()
+		if err != nil {
+			return fmt.Errorf("failed to load seller balances: %v", err)
+		}
+
+		var due []models.SellerBalance
+		for _, balance := range balances {
+			balance.Balance = roundCents(balance.Balance)
+			if balance.Balance > 0 && balance.Balance >= s.config.MinPayout {
+				due = append(due, balance)
+			}
+		}
+		if len(due) == 0 {
+			return ErrNoPayoutsDue
+		}
+
+		batch = &models.PayoutBatch{Status: "processing"}
+		if err := repos.Ledger.CreatePayoutBatch(batch); err != nil {
+			return fmt.Errorf("failed to create payout batch: %v", err)
+		}
+
+		for _, balance := range due {
+			shopID := balance.ShopID
+			payout := models.Payout{
+				BatchID: batch.ID,
+				ShopID:  shopID,
+				Amount:  balance.Balance,
+				Status:  "pending",
+			}
+			if err := repos.Ledger.CreatePayout(&payout); err != nil {
+				return fmt.Errorf("failed to create payout: %v", err)
+			}
+
+			if err := postTransaction(repos.Ledger, &models.LedgerTransaction{
+				Type:        models.LedgerTypePayout,
+				ShopID:      &shopID,
+				PayoutID:    &payout.ID,
+				Description: fmt.Sprintf("Payout #%d", payout.ID),
+				Entries: []models.LedgerEntry{
+					{Account: models.LedgerAccountSellerPayable, ShopID: &shopID, Debit: payout.Amount},
+					{Account: models.LedgerAccountPayoutsInTransit, ShopID: &shopID, Credit: payout.Amount},
+				},
+			}); err != nil {
+				return err
+			}
+
+			batch.Payouts = append(batch.Payouts, payout)
+			batch.TotalAmount += payout.Amount
+		}
+
+		batch.TotalAmount = roundCents(batch.TotalAmount)
+		batch.PayoutCount = len(batch.Payouts)
+		return repos.Ledger.UpdatePayoutBatchFields(batch.ID, map[string]interface{}{
+			"total_amount": batch.TotalAmount,
+			"payout_count": batch.PayoutCount,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// GetPayoutBatches gets all payout batches
+func (s *LedgerService) GetPayoutBatches() ([]models.PayoutBatch, error) {
+	return s.ledgerRepo.FindPayoutBatches()
+}
+
+// GetPayoutBatch gets a payout batch with its payouts
+func (s *LedgerService) GetPayoutBatch(id uint) (*models.PayoutBatch, error) {
+	batch, err := s.ledgerRepo.FindPayoutBatchByID(id)
+	if err != nil {
+		return nil, ErrPayoutBatchNotFound
+	}
+	return batch, nil
+}
+
+// UpdatePayoutStatus records whether a payout reached the shop. A paid payout
+// leaves the platform's cash; a failed one is owed to the shop again and will
+// be part of the next batch. The batch completes once all its payouts settle.
+func (s *LedgerService) UpdatePayoutStatus(payoutID uint, req models.PayoutStatusRequest) (*models.Payout, error) {
+	var payout *models.Payout
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		payout, err = repos.Ledger.FindPayoutByIDForUpdate(payoutID)
+		if err != nil {
+			return ErrPayoutNotFound
+		}
+		if payout.Status != "pending" {
+			return ErrPayoutSettled
+		}
+
+		shopID := payout.ShopID
+		transaction := &models.LedgerTransaction{
+			Type:     models.LedgerTypePayoutSettled,
+			ShopID:   &shopID,
+			PayoutID: &payout.ID,
+			Entries: []models.LedgerEntry{
+				{Account: models.LedgerAccountPayoutsInTransit, ShopID: &shopID, Debit: payout.Amount},
+				{Account: models.LedgerAccountCash, ShopID: &shopID, Credit: payout.Amount},
+			},
+			Description: fmt.Sprintf("Payout #%d paid", payout.ID),
+		}
+		if req.Status == "failed" {
+			transaction.Type = models.LedgerTypePayoutFailed
+			transaction.Entries[1].Account = models.LedgerAccountSellerPayable
+			transaction.Description = fmt.Sprintf("Payout #%d failed", payout.ID)
+		}
+		if err := postTransaction(repos.Ledger, transaction); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		payout.Status = req.Status
+		payout.Reference = req.Reference
+		payout.FailureReason = req.FailureReason
+		payout.SettledAt = &now
+		if err := repos.Ledger.UpdatePayoutFields(payout.ID, map[string]interface{}{
+			"status":         payout.Status,
+			"reference":      payout.Reference,
+			"failure_reason": payout.FailureReason,
+			"settled_at":     now,
+		}); err != nil {
+			return err
+		}
+
+		pending, err := repos.Ledger.CountPendingPayouts(payout.BatchID)
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			return repos.Ledger.UpdatePayoutBatchFields(payout.BatchID, map[string]interface{}{
+				"status":       "completed",
+				"completed_at": now,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+// StartPayoutScheduler creates a payout batch every interval until ctx is cancelled
+func (s *LedgerService) StartPayoutScheduler(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "payout-scheduler", interval, func() error {
+		batch, err := s.CreatePayoutBatch()
+		if errors.Is(err, ErrNoPayoutsDue) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		utils.Infof("Created payout batch %d with %d payouts totalling %.2f", batch.ID, batch.PayoutCount, batch.TotalAmount)
+		return nil
+	})
+}
+
+// GetSellerStatement lists what a shop earned, was refunded and was paid out
+// over a period. Dates are YYYY-MM-DD and both are inclusive; either may be
+// left out.
+func (s *LedgerService) GetSellerStatement(shopID uint, startDate, endDate *string) (*models.SellerStatement, error) {
+	shop, err := s.shopRepo.FindByID(shopID)
+	if err != nil {
+		return nil, errors.New("shop not found")
+	}
+
+	from, to, err := parseStatementPeriod(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var opening float64
+	if from != nil {
+		if opening, err = s.ledgerRepo.GetSellerBalance(shopID, from); err != nil {
+			return nil, fmt.Errorf("failed to load opening balance: %v", err)
+		}
+	}
+
+	transactions, err := s.ledgerRepo.FindShopTransactions(shopID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ledger transactions: %v", err)
+	}
+
+	statement := &models.SellerStatement{
+		ShopID:         shop.ID,
+		ShopName:       shop.ShopName,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		OpeningBalance: roundCents(opening),
+		Lines:          []models.SellerStatementLine{},
+		GeneratedAt:    time.Now(),
+	}
+
+	balance := opening
+	for _, transaction := range transactions {
+		// Confirmed payouts do not change what the shop is owed
+		if transaction.Type == models.LedgerTypePayoutSettled {
+			continue
+		}
+
+		var gross, commission, net float64
+		for _, entry := range transaction.Entries {
+			switch entry.Account {
+			case models.LedgerAccountSellerPayable:
+				net += entry.Credit - entry.Debit
+			case models.LedgerAccountCommission:
+				commission += entry.Credit - entry.Debit
+			case models.LedgerAccountCash:
+				gross += entry.Debit - entry.Credit
+			}
+		}
+		if transaction.Type != models.LedgerTypeSale && transaction.Type != models.LedgerTypeRefund {
+			gross = net
+		}
+		balance += net
+
+		switch transaction.Type {
+		case models.LedgerTypeSale:
+			statement.Sales += gross
+		case models.LedgerTypeRefund:
+			statement.Refunds -= gross
+		case models.LedgerTypePayout, models.LedgerTypePayoutFailed:
+			statement.Payouts -= net
+		}
+		statement.Commission += commission
+
+		statement.Lines = append(statement.Lines, models.SellerStatementLine{
+			Date:        transaction.CreatedAt,
+			Type:        transaction.Type,
+			OrderID:     transaction.OrderID,
+			PayoutID:    transaction.PayoutID,
+			Description: transaction.Description,
+			Gross:       roundCents(gross),
+			Commission:  roundCents(commission),
+			Net:         roundCents(net),
+			Balance:     roundCents(balance),
+		})
+	}
+
+	statement.Sales = roundCents(statement.Sales)
+	statement.Refunds = roundCents(statement.Refunds)
+	statement.Commission = roundCents(statement.Commission)
+	statement.Payouts = roundCents(statement.Payouts)
+	statement.ClosingBalance = roundCents(balance)
+	return statement, nil
+}
+
+// parseStatementPeriod turns inclusive YYYY-MM-DD dates into a half-open time range
+func parseStatementPeriod(startDate, endDate *string) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+	if startDate != nil {
+		start, err := time.ParseInLocation("2006-01-02", *startDate, time.Local)
+		if err != nil {
+			return nil, nil, ErrInvalidStatementPeriod
+		}
+		from = &start
+	}
+	if endDate != nil {
+		end, err := time.ParseInLocation("2006-01-02", *endDate, time.Local)
+		if err != nil {
+			return nil, nil, ErrInvalidStatementPeriod
+		}
+		end = end.AddDate(0, 0, 1)
+		to = &end
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, ErrInvalidStatementPeriod
+	}
+	return from, to, nil
+}
+
+// ExportSellerStatement renders a seller statement as csv or pdf
+func (s *LedgerService) ExportSellerStatement(statement *models.SellerStatement, format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return generateStatementCSV(statement)
+	case "pdf":
+		fallthrough
+	default:
+		return generateStatementPDF(statement)
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"health-store/models"
+	"health-store/repositories"
+
+	"gorm.io/gorm"
+)
+
+// createTestShopProduct creates a shop with one product
+func createTestShopProduct(t *testing.T, db *gorm.DB, name string, price float64, stock int) (*models.Shop, *models.Product) {
+	t.Helper()
+	shop := &models.Shop{ShopName: name + " Shop", Description: "Shop selling " + name, IsActive: true}
+	if err := db.Create(shop).Error; err != nil {
+		t.Fatalf("create shop: %v", err)
+	}
+	product := createTestProduct(t, db, name, price, stock)
+	if err := db.Model(product).Update("shop_id", shop.ID).Error; err != nil {
+		t.Fatalf("assign product to shop: %v", err)
+	}
+	product.ShopID = &shop.ID
+	return shop, product
+}
+
+// placeTestOrder checks out the products in a new customer's cart
+func placeTestOrder(t *testing.T, db *gorm.DB, orders *OrderService, name string, quantities map[*models.Product]int) *models.Order {
+	t.Helper()
+	user := createTestCustomer(t, db, name)
+	fillTestCart(t, db, user, quantities)
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if order.Status != "paid" {
+		t.Fatalf("order status = %q, want paid", order.Status)
+	}
+	return order
+}
+
+// ledgerTransactions loads every ledger transaction of a type with its entries
+func ledgerTransactions(t *testing.T, db *gorm.DB, transactionType string) []models.LedgerTransaction {
+	t.Helper()
+	var transactions []models.LedgerTransaction
+	if err := db.Preload("Entries").Where("type = ?", transactionType).Order("id").Find(&transactions).Error; err != nil {
+		t.Fatalf("load ledger transactions: %v", err)
+	}
+	return transactions
+}
+
+// assertLedgerBalanced checks that the debits of every transaction equal its credits
+func assertLedgerBalanced(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	var transactions []models.LedgerTransaction
+	if err := db.Preload("Entries").Find(&transactions).Error; err != nil {
+		t.Fatalf("load ledger transactions: %v", err)
+	}
+	for _, transaction := range transactions {
+		var debits, credits int64
+		for _, entry := range transaction.Entries {
+			debits += toMinorUnits(entry.Debit)
+			credits += toMinorUnits(entry.Credit)
+		}
+		if debits != credits {
+			t.Errorf("transaction %q debits %d cents, credits %d cents", transaction.Description, debits, credits)
+		}
+	}
+}
+
+// accountTotal sums credits less debits of an account, for one shop or, when
+// shopID is nil, for entries without a shop
+func accountTotal(t *testing.T, db *gorm.DB, account string, shopID *uint) float64 {
+	t.Helper()
+	query := db.Model(&models.LedgerEntry{}).Where("account = ?", account)
+	if shopID != nil {
+		query = query.Where("shop_id = ?", *shopID)
+	} else {
+		query = query.Where("shop_id IS NULL")
+	}
+	var total float64
+	if err := query.Select("COALESCE(SUM(credit - debit), 0)").Scan(&total).Error; err != nil {
+		t.Fatalf("sum account %s: %v", account, err)
+	}
+	return roundCents(total)
+}
+
+func sellerBalance(t *testing.T, ledger *LedgerService, shopID uint) float64 {
+	t.Helper()
+	balances, err := ledger.GetSellerBalances()
+	if err != nil {
+		t.Fatalf("GetSellerBalances: %v", err)
+	}
+	for _, balance := range balances {
+		if balance.ShopID == shopID {
+			return balance.Balance
+		}
+	}
+	return 0
+}
+
+func TestPostOrderSaleSplitsCommission(t *testing.T) {
+	db := newTestDB(t)
+	orders, _ := newTestOrderService(db)
+	ledger := orders.ledger
+	plasters := createTestProduct(t, db, "Plasters", 20.00, 10)
+	teaShop, tea := createTestShopProduct(t, db, "Herbal Tea", 25.00, 10)
+	oilShop, oil := createTestShopProduct(t, db, "Fish Oil", 12.99, 10)
+
+	// The shop rule wins over the rule of the product's category
+	rate := 0.2
+	if _, err := ledger.SaveCommissionRule(models.CommissionRuleRequest{CategoryID: &oil.CategoryID, Rate: &rate}); err != nil {
+		t.Fatalf("SaveCommissionRule: %v", err)
+	}
+	shopRate := 0.05
+	if _, err := ledger.SaveCommissionRule(models.CommissionRuleRequest{ShopID: &oilShop.ID, Rate: &shopRate}); err != nil {
+		t.Fatalf("SaveCommissionRule: %v", err)
+	}
+
+	order := placeTestOrder(t, db, orders, "sam", map[*models.Product]int{plasters: 1, tea: 2, oil: 3})
+
+	if sales := ledgerTransactions(t, db, models.LedgerTypeSale); len(sales) != 3 {
+		t.Fatalf("sale transactions = %d, want one per sub-order", len(sales))
+	}
+	assertLedgerBalanced(t, db)
+
+	tests := []struct {
+		name       string
+		shopID     *uint
+		payable    float64
+		commission float64
+	}{
+		// 2 x 25.00 at the default 10%
+		{name: "default rate", shopID: &teaShop.ID, payable: 45.00, commission: 5.00},
+		// 3 x 12.99 = 38.97 at 5%, 1.95 after rounding
+		{name: "shop rule", shopID: &oilShop.ID, payable: 37.02, commission: 1.95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accountTotal(t, db, models.LedgerAccountSellerPayable, tt.shopID); got != tt.payable {
+				t.Errorf("seller payable = %.2f, want %.2f", got, tt.payable)
+			}
+			if got := accountTotal(t, db, models.LedgerAccountCommission, tt.shopID); got != tt.commission {
+				t.Errorf("commission = %.2f, want %.2f", got, tt.commission)
+			}
+		})
+	}
+	if got := accountTotal(t, db, models.LedgerAccountStoreSales, nil); got != 20.00 {
+		t.Errorf("store sales = %.2f, want 20.00", got)
+	}
+
+	// Posting the order again, as a repeated payment confirmation would, changes nothing
+	entries := countRows(t, db, &models.LedgerEntry{})
+	err := orders.uow.Execute(func(repos *repositories.TxRepositories) error {
+		return ledger.postOrderSale(repos, order.ID)
+	})
+	if err != nil {
+		t.Fatalf("postOrderSale: %v", err)
+	}
+	if got := countRows(t, db, &models.LedgerEntry{}); got != entries {
+		t.Errorf("ledger entries = %d after posting again, want %d", got, entries)
+	}
+}
+
+func TestRefundAfterPayoutLeavesShopOwingTheRefund(t *testing.T) {
+	db := newTestDB(t)
+	orders, _ := newTestOrderService(db)
+	ledger := orders.ledger
+	shop, tea := createTestShopProduct(t, db, "Green Tea", 25.00, 10)
+
+	order := placeTestOrder(t, db, orders, "tara", map[*models.Product]int{tea: 2})
+	if got := sellerBalance(t, ledger, shop.ID); got != 45.00 {
+		t.Fatalf("seller balance = %.2f, want 45.00", got)
+	}
+
+	batch, err := ledger.CreatePayoutBatch()
+	if err != nil {
+		t.Fatalf("CreatePayoutBatch: %v", err)
+	}
+	if batch.PayoutCount != 1 || batch.TotalAmount != 45.00 || batch.Payouts[0].ShopID != shop.ID {
+		t.Fatalf("batch = %d payouts totalling %.2f, want one payout of 45.00", batch.PayoutCount, batch.TotalAmount)
+	}
+	if got := sellerBalance(t, ledger, shop.ID); got != 0 {
+		t.Errorf("seller balance after payout = %.2f, want 0", got)
+	}
+	if _, err := ledger.CreatePayoutBatch(); !errors.Is(err, ErrNoPayoutsDue) {
+		t.Errorf("second batch error = %v, want %v", err, ErrNoPayoutsDue)
+	}
+
+	payout, err := ledger.UpdatePayoutStatus(batch.Payouts[0].ID, models.PayoutStatusRequest{Status: "paid", Reference: "TRF-1"})
+	if err != nil {
+		t.Fatalf("UpdatePayoutStatus: %v", err)
+	}
+	if payout.Status != "paid" || payout.SettledAt == nil {
+		t.Errorf("payout = %q settled at %v, want paid", payout.Status, payout.SettledAt)
+	}
+	if _, err := ledger.UpdatePayoutStatus(payout.ID, models.PayoutStatusRequest{Status: "failed"}); !errors.Is(err, ErrPayoutSettled) {
+		t.Errorf("settling again error = %v, want %v", err, ErrPayoutSettled)
+	}
+	if settled, _ := ledger.GetPayoutBatch(batch.ID); settled.Status != "completed" {
+		t.Errorf("batch status = %q, want completed", settled.Status)
+	}
+	if got := accountTotal(t, db, models.LedgerAccountPayoutsInTransit, &shop.ID); got != 0 {
+		t.Errorf("payouts in transit = %.2f, want 0", got)
+	}
+
+	// The shop was already paid, so the refund leaves it owing its share
+	if err := orders.CancelOrder(order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if got := sellerBalance(t, ledger, shop.ID); got != -45.00 {
+		t.Errorf("seller balance after refund = %.2f, want -45.00", got)
+	}
+	if got := accountTotal(t, db, models.LedgerAccountCommission, &shop.ID); got != 0 {
+		t.Errorf("commission after refund = %.2f, want 0", got)
+	}
+	assertLedgerBalanced(t, db)
+
+	// Negative balances are not paid out, and the refund is only posted once
+	if _, err := ledger.CreatePayoutBatch(); !errors.Is(err, ErrNoPayoutsDue) {
+		t.Errorf("batch after refund error = %v, want %v", err, ErrNoPayoutsDue)
+	}
+	err = orders.uow.Execute(func(repos *repositories.TxRepositories) error {
+		return ledger.postOrderRefund(repos, order.ID)
+	})
+	if err != nil {
+		t.Fatalf("postOrderRefund: %v", err)
+	}
+	if refunds := ledgerTransactions(t, db, models.LedgerTypeRefund); len(refunds) != 1 {
+		t.Errorf("refund transactions = %d, want 1", len(refunds))
+	}
+}
+
+func TestFailedPayoutIsOwedAgain(t *testing.T) {
+	db := newTestDB(t)
+	orders, _ := newTestOrderService(db)
+	ledger := orders.ledger
+	shop, tea := createTestShopProduct(t, db, "Mint Tea", 10.00, 10)
+
+	placeTestOrder(t, db, orders, "uma", map[*models.Product]int{tea: 1})
+	batch, err := ledger.CreatePayoutBatch()
+	if err != nil {
+		t.Fatalf("CreatePayoutBatch: %v", err)
+	}
+
+	payout, err := ledger.UpdatePayoutStatus(batch.Payouts[0].ID, models.PayoutStatusRequest{Status: "failed", FailureReason: "account closed"})
+	if err != nil {
+		t.Fatalf("UpdatePayoutStatus: %v", err)
+	}
+	if payout.Status != "failed" || payout.FailureReason != "account closed" {
+		t.Errorf("payout = %q (%q), want failed", payout.Status, payout.FailureReason)
+	}
+	if got := sellerBalance(t, ledger, shop.ID); got != 9.00 {
+		t.Errorf("seller balance after failed payout = %.2f, want 9.00", got)
+	}
+	if got := accountTotal(t, db, models.LedgerAccountPayoutsInTransit, &shop.ID); got != 0 {
+		t.Errorf("payouts in transit = %.2f, want 0", got)
+	}
+
+	next, err := ledger.CreatePayoutBatch()
+	if err != nil {
+		t.Fatalf("CreatePayoutBatch: %v", err)
+	}
+	if next.TotalAmount != 9.00 {
+		t.Errorf("next batch total = %.2f, want 9.00", next.TotalAmount)
+	}
+	assertLedgerBalanced(t, db)
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"strings"
+	"time"
+)
+
+// LoginThrottledError is returned when a login attempt is refused because of
+// earlier failures for the account or the client address
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts, please try again later"
+}
+
+// LoginGuard throttles failed logins per account and per client address.
+// Each account failure doubles the delay before the next attempt is accepted,
+// and accounts and addresses are locked for a while once they reach their
+// failure limit. Unknown usernames are throttled the same way as existing
+// ones so the responses do not reveal which accounts exist.
+type LoginGuard struct {
+	repo     *repositories.SecurityRepository
+	userRepo repositories.UserRepositoryInterface
+	cfg      config.SecurityConfig
+}
+
+// NewLoginGuard creates a new login guard
+func NewLoginGuard(repo *repositories.SecurityRepository, userRepo repositories.UserRepositoryInterface, cfg config.SecurityConfig) *LoginGuard {
+	return &LoginGuard{
+		repo:     repo,
+		userRepo: userRepo,
+		cfg:      cfg,
+	}
+}
+
+// Check returns a *LoginThrottledError when a login for username from
+// ipAddress must not be attempted yet
+func (g *LoginGuard) Check(username, ipAddress string) error {
+	throttles, err := g.repo.FindThrottles(accountKey(username), addressKey(ipAddress))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if d := g.retryAfter(&throttle, now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login against the account and the client
+// address and writes an audit entry
+func (g *LoginGuard) RecordFailure(username, ipAddress, userAgent string) error {
+	now := time.Now()
+
+	account, err := g.repo.UpdateThrottle(accountKey(username), func(t *models.LoginThrottle) {
+		g.countFailure(t, now, g.cfg.LoginMaxAccountFailures)
+	})
+	if err != nil {
+		return err
+	}
+
+	address, err := g.repo.UpdateThrottle(addressKey(ipAddress), func(t *models.LoginThrottle) {
+		g.countFailure(t, now, g.cfg.LoginMaxIPFailures)
+	})
+	if err != nil {
+		return err
+	}
+
+	var userID *uint
+	if user, err := g.userRepo.FindByUsername(username); err == nil {
+		userID = &user.ID
+	}
+
+	g.audit(&models.AuditLog{
+		Action:    models.AuditLoginFailed,
+		UserID:    userID,
+		Username:  username,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Details:   fmt.Sprintf("account failures: %d, address failures: %d", account.Failures, address.Failures),
+	})
+
+	for _, locked := range []*models.LoginThrottle{account, address} {
+		if locked.LockedUntil != nil && locked.LockedUntil.Equal(now.Add(g.cfg.LoginLockoutDuration)) {
+			g.audit(&models.AuditLog{
+				Action:    models.AuditLoginLocked,
+				UserID:    userID,
+				Username:  username,
+				IPAddress: ipAddress,
+				UserAgent: userAgent,
+				Details:   fmt.Sprintf("%s locked until %s", locked.Key, locked.LockedUntil.Format(time.RFC3339)),
+			})
+		}
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the failures of an account after a successful login.
+// Address failures are kept so a valid account can not be used to reset them.
+func (g *LoginGuard) RecordSuccess(username string) error {
+	return g.repo.DeleteThrottle(accountKey(username))
+}
+
+// UnlockUser clears the failures and lock of a user's account
+func (g *LoginGuard) UnlockUser(userID, actorID uint, ipAddress string) (*models.User, error) {
+	user, err := g.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.repo.DeleteThrottle(accountKey(user.Username)); err != nil {
+		return nil, err
+	}
+
+	g.audit(&models.AuditLog{
+		Action:    models.AuditAccountUnlocked,
+		UserID:    &user.ID,
+		ActorID:   &actorID,
+		Username:  user.Username,
+		IPAddress: ipAddress,
+	})
+
+	return user, nil
+}
+
+// StartCleanup removes stale throttles every interval until ctx is cancelled
+func (g *LoginGuard) StartCleanup(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "login-throttle-cleanup", interval, func() error {
+		_, err := g.repo.DeleteStaleThrottles(time.Now().Add(-g.cfg.LoginFailureWindow))
+		return err
+	})
+}
+
+// countFailure adds a failure to a throttle, forgetting failures outside the
+// window, and locks it once max failures are reached
+func (g *LoginGuard) countFailure(t *models.LoginThrottle, now time.Time, max int) {
+	if now.Sub(t.LastFailureAt) > g.cfg.LoginFailureWindow {
+		t.Failures = 0
+	}
+	t.Failures++
+	t.LastFailureAt = now
+
+	if max > 0 && t.Failures >= max {
+		lockedUntil := now.Add(g.cfg.LoginLockoutDuration)
+		t.LockedUntil = &lockedUntil
+		t.Failures = 0
+	}
+}
+
+// retryAfter returns how long a throttle still refuses logins
+func (g *LoginGuard) retryAfter(t *models.LoginThrottle, now time.Time) time.Duration {
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now)
+	}
+
+	// Exponential backoff only applies to accounts; addresses can be shared
+	if !strings.HasPrefix(t.Key, "user:") || t.Failures == 0 || now.Sub(t.LastFailureAt) > g.cfg.LoginFailureWindow {
+		return 0
+	}
+
+	delay := g.cfg.LoginBackoffBase << (t.Failures - 1)
+	if delay > g.cfg.LoginBackoffMax || delay <= 0 {
+		delay = g.cfg.LoginBackoffMax
+	}
+
+	if next := t.LastFailureAt.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// audit stores an audit entry, logging instead of failing when it can not be written
+func (g *LoginGuard) audit(entry *models.AuditLog) {
+	if len(entry.UserAgent) > 255 {
+		entry.UserAgent = entry.UserAgent[:255]
+	}
+	if err := g.repo.CreateAuditLog(entry); err != nil {
+		utils.LogError(err, "Failed to write audit log")
+	}
+}
+
+// accountKey returns the throttle key of an account
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// addressKey returns the throttle key of a client address
+func addressKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"health-store/config"
+	"health-store/utils"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a plain-text email message
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(email Email) error
+}
+
+// NewMailer creates the mailer selected by the mail configuration
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	case "", "log":
+		return NewLogMailer(cfg.LogFile, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading to TLS when the
+// server supports STARTTLS
+type SMTPMailer struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	envelope string // bare sender address for the SMTP envelope
+}
+
+// NewSMTPMailer creates a new SMTP mailer. Authentication is skipped when username is empty.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	envelope := from
+	if addr, err := mail.ParseAddress(from); err == nil {
+		envelope = addr.Address
+	}
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		auth:     auth,
+		from:     from,
+		envelope: envelope,
+	}
+}
+
+// Send sends an email
+func (m *SMTPMailer) Send(email Email) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.envelope, []string{email.To}, formatEmail(m.from, email)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %v", email.To, err)
+	}
+	return nil
+}
+
+// LogMailer writes emails to a file, or to the application log when no file
+// is configured, instead of delivering them. It is meant for development and tests.
+type LogMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer(path, from string) *LogMailer {
+	return &LogMailer{path: path, from: from}
+}
+
+// Send records an email
+func (m *LogMailer) Send(email Email) error {
+	if m.path == "" {
+		utils.Infof("Email to %s: %s\n%s", email.To, email.Subject, email.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\n\n---\n", formatEmail(m.from, email))
+	return err
+}
+
+// formatEmail renders an email with its headers
+func formatEmail(from string, email Email) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", email.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", email.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"health-store/auth/token"
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has MFA
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned for MFA operations on a user without MFA
+	ErrMFANotEnabled = errors.New("multi-factor authentication is not enabled")
+	// ErrMFANotEnrolled is returned when confirming before enrollment was started
+	ErrMFANotEnrolled = errors.New("multi-factor authentication enrollment has not been started")
+	// ErrInvalidMFACode is returned for wrong, replayed or already used codes
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+	// ErrInvalidMFAToken is returned for unknown or expired mfa pending tokens
+	ErrInvalidMFAToken = errors.New("invalid or expired mfa token")
+)
+
+// recoveryCodeCount is the number of recovery codes handed out at a time
+const recoveryCodeCount = 10
+
+// MFAService handles TOTP enrollment, recovery codes and the second step of logins
+type MFAService struct {
+	mfaRepo   *repositories.MFARepository
+	userRepo  repositories.UserRepositoryInterface
+	tokens    *token.Manager
+	issuer    string
+	secretKey [32]byte
+	pending   time.Duration
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(mfaRepo *repositories.MFARepository, userRepo repositories.UserRepositoryInterface, tokens *token.Manager, cfg config.SecurityConfig) *MFAService {
+	return &MFAService{
+		mfaRepo:   mfaRepo,
+		userRepo:  userRepo,
+		tokens:    tokens,
+		issuer:    cfg.MFAIssuer,
+		secretKey: sha256.Sum256([]byte(cfg.MFASecretKey)),
+		pending:   cfg.MFAPendingTTL,
+	}
+}
+
+// Enroll generates a new TOTP secret for a user. MFA is only turned on once
+// the user confirms a code from the authenticator with Confirm.
+func (s *MFAService) Enroll(user *models.User) (*models.MFAEnrollment, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := s.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SavePendingSecret(user.ID, sealed); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpURI(s.issuer, user.Username, secret),
+	}, nil
+}
+
+// Confirm turns MFA on once the user proves the authenticator works, and
+// returns the user's recovery codes. They are only shown this once.
+func (s *MFAService) Confirm(user *models.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	secret, err := s.openSecret(user.MFASecret)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok, err := matchTOTP(secret, code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, records, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.Enable(user.ID, step, records); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyCode checks a TOTP code or, failing that, consumes a recovery code.
+// TOTP codes are accepted once; replaying a code returns ErrInvalidMFACode.
+func (s *MFAService) VerifyCode(user *models.User, code string) error {
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+
+	secret, err := s.openSecret(user.MFASecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok, err := matchTOTP(secret, code, time.Now())
+	if err != nil {
+		return err
+	}
+	if ok {
+		advanced, err := s.mfaRepo.AdvanceStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(user.ID, hashRecoveryCode(user.ID, code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a code
+func (s *MFAService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if err := s.VerifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, records, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(user.ID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RemainingRecoveryCodes counts the recovery codes a user has not used yet
+func (s *MFAService) RemainingRecoveryCodes(user *models.User) (int64, error) {
+	return s.mfaRepo.CountUnusedRecoveryCodes(user.ID)
+}
+
+// Disable turns MFA off after checking the user's password and a code
+func (s *MFAService) Disable(user *models.User, password, code string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.VerifyCode(user, code); err != nil {
+		return err
+	}
+	return s.mfaRepo.Disable(user.ID)
+}
+
+// IssuePendingToken signs a short-lived token proving the user passed the
+// password step of a login. It can only be exchanged with CompleteLogin.
+func (s *MFAService) IssuePendingToken(user *models.User) (string, int64, error) {
+	now := time.Now()
+	claims := &token.Claims{
+		Username: user.Username,
+		Role:     user.Role,
+		Purpose:  token.PurposeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprintf("%d", user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.pending)),
+		},
+	}
+
+	signed, err := s.tokens.Sign(claims)
+	if err != nil {
+		return "", 0, err
+	}
+	return signed, int64(s.pending.Seconds()), nil
+}
+
+// PendingUser returns the user an mfa pending token was issued to
+func (s *MFAService) PendingUser(pendingToken string) (*models.User, error) {
+	claims, err := s.tokens.Parse(pendingToken)
+	if err != nil || claims.Purpose != token.PurposeMFAPending {
+		return nil, ErrInvalidMFAToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.userRepo.FindByID(uint(userID))
+	if err != nil || !user.MFAEnabled {
+		return nil, ErrInvalidMFAToken
+	}
+	return user, nil
+}
+
+// newRecoveryCodes generates recovery codes and the records storing their hashes
+func (s *MFAService) newRecoveryCodes(userID uint) ([]string, []models.MFARecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := totpEncoding.EncodeToString(buf) // 8 characters
+		code := raw[:4] + "-" + raw[4:]
+
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashRecoveryCode(userID, code),
+		})
+	}
+	return codes, records, nil
+}
+
+// sealSecret encrypts a TOTP secret for storage
+func (s *MFAService) sealSecret(secret string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a stored TOTP secret
+func (s *MFAService) openSecret(stored string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("stored MFA secret is malformed")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt MFA secret")
+	}
+	return string(secret), nil
+}
+
+// cipher returns the AEAD used to encrypt TOTP secrets
+func (s *MFAService) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.secretKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// hashRecoveryCode returns the hash under which a user's recovery code is
+// stored. Codes are compared without dashes, spaces or case.
+func hashRecoveryCode(userID uint, code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", userID, normalized)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+
+	"gorm.io/gorm"
+)
+
+// rfcTOTPSecret is the SHA-1 seed of the RFC 6238 test vectors, base32 encoded
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestMatchTOTP(t *testing.T) {
+	// RFC 6238 gives 94287082 at 59s; the last six digits are the 6-digit code
+	at := time.Unix(59, 0)
+	if code, err := totpCode(rfcTOTPSecret, totpStep(at)); err != nil || code != "287082" {
+		t.Fatalf("totpCode = %q, %v, want 287082", code, err)
+	}
+
+	now := time.Unix(1111111109, 0)
+	codeAt := func(offset time.Duration) string {
+		code, err := totpCode(rfcTOTPSecret, totpStep(now.Add(offset)))
+		if err != nil {
+			t.Fatalf("totpCode: %v", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantOK   bool
+		wantStep int64
+	}{
+		{name: "current step", code: codeAt(0), wantOK: true, wantStep: totpStep(now)},
+		{name: "previous step", code: codeAt(-totpPeriod * time.Second), wantOK: true, wantStep: totpStep(now) - 1},
+		{name: "next step", code: codeAt(totpPeriod * time.Second), wantOK: true, wantStep: totpStep(now) + 1},
+		{name: "two steps ago", code: codeAt(-2 * totpPeriod * time.Second)},
+		{name: "two steps ahead", code: codeAt(2 * totpPeriod * time.Second)},
+		{name: "surrounding spaces", code: " " + codeAt(0) + " ", wantOK: true, wantStep: totpStep(now)},
+		{name: "wrong length", code: codeAt(0)[:5]},
+		{name: "empty", code: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok, err := matchTOTP(rfcTOTPSecret, tt.code, now)
+			if err != nil {
+				t.Fatalf("matchTOTP: %v", err)
+			}
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("matchTOTP = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func newTestMFAService(db *gorm.DB) *MFAService {
+	return NewMFAService(repositories.NewMFARepository(db), repositories.NewUserRepository(db), nil, config.SecurityConfig{
+		MFAIssuer:     "Health Store",
+		MFASecretKey:  "test-mfa-secret",
+		MFAPendingTTL: 5 * time.Minute,
+	})
+}
+
+// reloadUser reads a user again to pick up the MFA state the service stored
+func reloadUser(t *testing.T, db *gorm.DB, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	return &user
+}
+
+// enableTestMFA enrolls user and confirms the enrollment with the current
+// code, returning the TOTP secret and the recovery codes
+func enableTestMFA(t *testing.T, db *gorm.DB, mfa *MFAService, user *models.User) (string, []string) {
+	t.Helper()
+	enrollment, err := mfa.Enroll(user)
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	code, err := totpCode(enrollment.Secret, totpStep(time.Now()))
+	if err != nil {
+		t.Fatalf("totpCode: %v", err)
+	}
+	codes, err := mfa.Confirm(reloadUser(t, db, user.ID), code)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestVerifyCodeRejectsReplayedTOTPCodes(t *testing.T) {
+	db := newTestDB(t)
+	mfa := newTestMFAService(db)
+	user := createTestCustomer(t, db, "pia")
+
+	secret, _ := enableTestMFA(t, db, mfa, user)
+	user = reloadUser(t, db, user.ID)
+	if !user.MFAEnabled || user.MFASecret == "" || strings.Contains(user.MFASecret, secret) {
+		t.Fatalf("user MFA state = enabled %v, secret %q, want enabled with the secret encrypted", user.MFAEnabled, user.MFASecret)
+	}
+
+	// The code confirming the enrollment cannot be used again
+	confirmStep := user.MFALastStep
+	confirmCode, _ := totpCode(secret, confirmStep)
+	if err := mfa.VerifyCode(user, confirmCode); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed enrollment code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	// The next step's code is inside the window and is accepted once
+	nextCode, _ := totpCode(secret, confirmStep+1)
+	if err := mfa.VerifyCode(user, nextCode); err != nil {
+		t.Fatalf("VerifyCode: %v", err)
+	}
+	if err := mfa.VerifyCode(user, nextCode); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if err := mfa.VerifyCode(user, confirmCode); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("older code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	if err := mfa.VerifyCode(user, "12345a"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestRecoveryCodesAreHashedAndSingleUse(t *testing.T) {
+	db := newTestDB(t)
+	mfa := newTestMFAService(db)
+	user := createTestCustomer(t, db, "quinn")
+
+	_, codes := enableTestMFA(t, db, mfa, user)
+	user = reloadUser(t, db, user.ID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	var stored []models.MFARecoveryCode
+	if err := db.Where("user_id = ?", user.ID).Find(&stored).Error; err != nil {
+		t.Fatalf("load recovery codes: %v", err)
+	}
+	if len(stored) != len(codes) {
+		t.Fatalf("stored %d recovery codes, want %d", len(stored), len(codes))
+	}
+	hashes := make(map[string]bool)
+	for _, record := range stored {
+		hashes[record.CodeHash] = true
+	}
+	for _, code := range codes {
+		if hashes[code] || !hashes[hashRecoveryCode(user.ID, code)] {
+			t.Errorf("recovery code %s is not stored as its hash", code)
+		}
+	}
+
+	// Codes are matched without case or dashes, and only once
+	typed := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+	if err := mfa.VerifyCode(user, typed); err != nil {
+		t.Fatalf("VerifyCode with recovery code: %v", err)
+	}
+	if err := mfa.VerifyCode(user, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("reused recovery code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if remaining, err := mfa.RemainingRecoveryCodes(user); err != nil || remaining != recoveryCodeCount-1 {
+		t.Errorf("RemainingRecoveryCodes = %d, %v, want %d", remaining, err, recoveryCodeCount-1)
+	}
+
+	// Another user cannot use them
+	other := createTestCustomer(t, db, "rosa")
+	enableTestMFA(t, db, mfa, other)
+	if err := mfa.VerifyCode(reloadUser(t, db, other.ID), codes[1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("other user's recovery code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	// Regenerating replaces every old code
+	fresh, err := mfa.RegenerateRecoveryCodes(user, codes[2])
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if err := mfa.VerifyCode(user, codes[3]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replaced recovery code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if err := mfa.VerifyCode(user, fresh[0]); err != nil {
+		t.Errorf("VerifyCode with new recovery code: %v", err)
+	}
+}
@@ -6,17 +6,35 @@ import (
 	"fmt"
 	"health-store/models"
 	"health-store/repositories"
-	"math/rand"
+	"health-store/utils"
 	"time"
 
 	"github.com/unidoc/unipdf/v3/creator"
 )
 
+var (
+	// ErrShopOrderNotFound is returned for unknown sub-orders and sub-orders of another shop
+	ErrShopOrderNotFound = errors.New("shop order not found")
+	// ErrShopOrderNotPending is returned when shipping a sub-order that already shipped or was cancelled
+	ErrShopOrderNotPending = errors.New("shop order is not awaiting shipment")
+	// ErrOrderNotPaid is returned when shipping a sub-order of an order that is not paid
+	ErrOrderNotPaid = errors.New("order must be paid before it ships")
+	// ErrPrescriptionRequired is returned when checking out prescription-only products without a prescription
+	ErrPrescriptionRequired = errors.New("a prescription is required for prescription-only products")
+	// ErrAwaitingVerification is returned when changing the status of an order whose prescription has not been reviewed
+	ErrAwaitingVerification = errors.New("order is awaiting prescription verification")
+	// ErrRecalledLotShipment is returned when shipping items whose units were taken from a lot that has since been recalled
+	ErrRecalledLotShipment = errors.New("order holds units of a recalled lot and can not ship")
+)
+
 // OrderService handles business logic for orders
 type OrderService struct {
 	orderRepo   repositories.OrderRepositoryInterface
 	cartRepo    repositories.CartRepositoryInterface
 	productRepo repositories.ProductRepositoryInterface
+	uow         repositories.UnitOfWorkInterface
+	gateway     PaymentGateway
+	ledger      *LedgerService
 }
 
 // NewOrderService creates a new order service
@@ -24,115 +42,487 @@ func NewOrderService(
 	orderRepo repositories.OrderRepositoryInterface,
 	cartRepo repositories.CartRepositoryInterface,
 	productRepo repositories.ProductRepositoryInterface,
+	uow repositories.UnitOfWorkInterface,
+	gateway PaymentGateway,
+	ledger *LedgerService,
 ) *OrderService {
 	return &OrderService{
 		orderRepo:   orderRepo,
 		cartRepo:    cartRepo,
 		productRepo: productRepo,
+		uow:         uow,
+		gateway:     gateway,
+		ledger:      ledger,
 	}
 }
 
-// PlaceOrder places a new order from user's cart with simulated payment
+// PlaceOrder places a new order from user's cart.
+// The payment is authorized against a quote of the cart first, then the stock
+// check, order creation, stock deduction and cart clearing (which turns the
+// cart's reservations into committed stock) run in a single transaction so a
+// failure at any step leaves no partial order behind. The payment is only
+// captured once the order has been committed, or for orders with
+// prescription-only products, once a pharmacist approves the prescription.
 func (s *OrderService) PlaceOrder(userID uint, req models.PlaceOrderRequest) (*models.Order, error) {
-	// Get user's cart with items and products
+	// Quote the cart so the payment can be authorized before any rows are locked
 	cart, err := s.cartRepo.FindCartByUserID(userID)
 	if err != nil {
 		return nil, errors.New("cart not found or empty")
 	}
-
-	// Check if cart has items
 	if len(cart.CartItems) == 0 {
 		return nil, errors.New("cannot place order with empty cart")
 	}
 
-	// Calculate total price and validate stock
-	var totalPrice float64
-	var orderItems []models.OrderItem
+	var quote float64
+	for _, cartItem := range cart.CartItems {
+		quote += cartItem.UnitPrice() * float64(cartItem.Quantity)
+		if cartItem.Product.RequiresPrescription && req.PrescriptionURL == "" {
+			return nil, fmt.Errorf("%w: %s", ErrPrescriptionRequired, cartItem.Product.Name)
+		}
+	}
 
-	// Collect all product IDs for batch loading (fixes N+1 query problem)
-	productIDs := make([]uint, len(cart.CartItems))
-	for i, cartItem := range cart.CartItems {
-		productIDs[i] = cartItem.ProductID
+	payment, err := s.authorizePayment(userID, req, quote)
+	if err != nil {
+		return nil, err
 	}
 
-	// Batch load all products in a single query
-	products, err := s.productRepo.FindByIDs(productIDs)
+	var order *models.Order
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		// Re-read the cart inside the transaction
+		cart, err := repos.Carts.FindCartByUserID(userID)
+		if err != nil {
+			return errors.New("cart not found or empty")
+		}
+
+		// Check if cart has items
+		if len(cart.CartItems) == 0 {
+			return errors.New("cannot place order with empty cart")
+		}
+
+		// Collect all product IDs for batch loading (fixes N+1 query problem)
+		productIDs := make([]uint, len(cart.CartItems))
+		var variantIDs []uint
+		for i, cartItem := range cart.CartItems {
+			productIDs[i] = cartItem.ProductID
+			if cartItem.VariantID != nil {
+				variantIDs = append(variantIDs, *cartItem.VariantID)
+			}
+		}
+
+		// Lock the product and variant rows so concurrent checkouts see a consistent stock level
+		products, err := repos.Products.FindByIDsForUpdate(productIDs)
+		if err != nil {
+			return fmt.Errorf("failed to load products: %v", err)
+		}
+
+		// Create product map for efficient lookup
+		productMap := make(map[uint]*models.Product)
+		for i := range products {
+			productMap[products[i].ID] = &products[i]
+		}
+
+		// Stock held by other carts is not available to this checkout
+		reserved, err := repos.Carts.FindReservedQuantities(productIDs, cart.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load reservations: %v", err)
+		}
+		variantReserved := map[uint]int{}
+		if len(variantIDs) > 0 {
+			variantReserved, err = repos.Carts.FindReservedVariantQuantities(variantIDs, cart.ID)
+			if err != nil {
+				return fmt.Errorf("failed to load reservations: %v", err)
+			}
+		}
+
+		// Units of expired lots are still counted in stock but can not be sold
+		today := startOfDay(time.Now())
+		expired, err := repos.Inventory.FindExpiredQuantities(productIDs, today)
+		if err != nil {
+			return fmt.Errorf("failed to load expired lots: %v", err)
+		}
+		variantExpired := map[uint]int{}
+		if len(variantIDs) > 0 {
+			variantExpired, err = repos.Inventory.FindExpiredVariantQuantities(variantIDs, today)
+			if err != nil {
+				return fmt.Errorf("failed to load expired lots: %v", err)
+			}
+		}
+
+		// Calculate total price and validate stock
+		var totalPrice float64
+		var orderItems []models.OrderItem
+		requiresPrescription := false
+		for _, cartItem := range cart.CartItems {
+			product, exists := productMap[cartItem.ProductID]
+			if !exists {
+				return fmt.Errorf("product not found: %d", cartItem.ProductID)
+			}
+			if !product.IsSellable() {
+				return fmt.Errorf("%w: %s", ErrProductUnavailable, product.Name)
+			}
+			if product.RequiresPrescription {
+				if req.PrescriptionURL == "" {
+					return fmt.Errorf("%w: %s", ErrPrescriptionRequired, product.Name)
+				}
+				requiresPrescription = true
+			}
+
+			// Products with variants are sold at the price and from the stock of the variant
+			variant, err := resolveVariant(product, cartItem.VariantID)
+			if err != nil {
+				return fmt.Errorf("%w: %s", err, product.Name)
+			}
+			name, price := product.Name, product.Price
+			available := product.Stock - expired[cartItem.ProductID] - reserved[cartItem.ProductID]
+			if variant != nil {
+				if !variant.IsSellable() {
+					return fmt.Errorf("%w: %s (%s)", ErrProductUnavailable, product.Name, variant.SKU)
+				}
+				name, price = product.Name+" ("+variant.SKU+")", variant.Price
+				available = variant.Stock - variantExpired[variant.ID] - variantReserved[variant.ID]
+			}
+
+			// Check stock availability
+			if available < cartItem.Quantity {
+				return fmt.Errorf("insufficient stock for product: %s (available: %d, requested: %d)",
+					name, available, cartItem.Quantity)
+			}
+
+			// Calculate item total
+			itemTotal := price * float64(cartItem.Quantity)
+			totalPrice += itemTotal
+
+			orderItems = append(orderItems, models.OrderItem{
+				ProductID: cartItem.ProductID,
+				VariantID: cartItem.VariantID,
+				Quantity:  cartItem.Quantity,
+				Price:     price,
+			})
+		}
+
+		// The authorized amount must match what we are about to charge
+		if toMinorUnits(totalPrice) != toMinorUnits(quote) {
+			return errors.New("cart changed during checkout, please review your cart and try again")
+		}
+
+		// Prescription orders wait for verification once their payment is
+		// authorized, so an authorization the customer still has to complete
+		// comes first
+		status := "pending"
+		if requiresPrescription {
+			status = "pending_verification"
+		}
+		if payment != nil && payment.Status == PaymentStatusPending {
+			status = "awaiting_payment"
+		}
+
+		order = &models.Order{
+			UserID:        userID,
+			Status:        status,
+			TotalPrice:    totalPrice,
+			PaymentMethod: req.PaymentMethod,
+			BankName:      req.BankName,
+		}
+		if payment != nil {
+			order.PaymentProvider = payment.Provider
+			order.PaymentTransactionID = payment.TransactionID
+		}
+
+		if err := repos.Orders.Create(order); err != nil {
+			return fmt.Errorf("failed to create order: %v", err)
+		}
+
+		// Hold the order for a pharmacist to verify the prescription
+		if requiresPrescription {
+			order.Prescription = &models.Prescription{
+				OrderID:     order.ID,
+				UserID:      userID,
+				DocumentURL: req.PrescriptionURL,
+				Status:      models.PrescriptionStatusPending,
+			}
+			if err := repos.Prescriptions.Create(order.Prescription); err != nil {
+				return fmt.Errorf("failed to save prescription: %v", err)
+			}
+		}
+
+		// Split the order into one sub-order per shop for fulfilment
+		shopOrders, err := createShopOrders(repos, order.ID, orderItems, productMap)
+		if err != nil {
+			return err
+		}
+		order.ShopOrders = shopOrders
+
+		// Create order items and commit their stock, taking lot-tracked units
+		// from the lots that expire first
+		now := time.Now()
+		for i := range orderItems {
+			orderItems[i].OrderID = order.ID
+			if err := repos.Orders.CreateOrderItem(&orderItems[i]); err != nil {
+				return fmt.Errorf("failed to create order item: %v", err)
+			}
+			if err := moveStock(repos, &models.StockMovement{
+				ProductID: orderItems[i].ProductID,
+				VariantID: orderItems[i].VariantID,
+				Quantity:  -orderItems[i].Quantity,
+				Reason:    models.StockReasonOrderPlace,
+				OrderID:   &order.ID,
+			}); err != nil {
+				return err
+			}
+			if err := allocateLots(repos, &orderItems[i], now); err != nil {
+				return fmt.Errorf("failed to allocate lots for product %s: %w", productMap[orderItems[i].ProductID].Name, err)
+			}
+		}
+		order.OrderItems = orderItems
+
+		// Clearing the cart releases its reservations, now that the stock is committed
+		if err := repos.Carts.ClearCart(cart.ID); err != nil {
+			return fmt.Errorf("failed to clear cart: %v", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to load products: %v", err)
+		if payment != nil {
+			s.voidPayment(payment.TransactionID)
+		}
+		return nil, err
 	}
 
-	// Create product map for efficient lookup
-	productMap := make(map[uint]*models.Product)
-	for i := range products {
-		productMap[products[i].ID] = &products[i]
+	// Cash on delivery orders stay pending until shipped, payments the
+	// provider confirms asynchronously are completed by its webhook, and
+	// orders awaiting verification are captured once approved
+	if payment == nil || payment.Status == PaymentStatusPending || order.Status == "pending_verification" {
+		return order, nil
 	}
 
-	// Process cart items using batch-loaded products
-	for _, cartItem := range cart.CartItems {
-		product, exists := productMap[cartItem.ProductID]
+	if err := s.capturePayment(order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// createShopOrders creates a sub-order for every shop selling items of an
+// order, and one for items sold by the store itself, and links the items to
+// their sub-order
+func createShopOrders(repos *repositories.TxRepositories, orderID uint, items []models.OrderItem, products map[uint]*models.Product) ([]models.ShopOrder, error) {
+	var shopOrders []models.ShopOrder
+	index := make(map[uint]int) // shop ID (0 for the store) to position in shopOrders
+	for _, item := range items {
+		shopID := products[item.ProductID].ShopID
+		var key uint
+		if shopID != nil {
+			key = *shopID
+		}
+
+		i, exists := index[key]
 		if !exists {
-			return nil, fmt.Errorf("product not found: %d", cartItem.ProductID)
+			i = len(shopOrders)
+			index[key] = i
+			shopOrders = append(shopOrders, models.ShopOrder{
+				OrderID: orderID,
+				ShopID:  shopID,
+				Status:  "pending",
+			})
 		}
+		shopOrders[i].Subtotal += item.Price * float64(item.Quantity)
+	}
 
-		// Check stock availability
-		if product.Stock < cartItem.Quantity {
-			return nil, fmt.Errorf("insufficient stock for product: %s (available: %d, requested: %d)",
-				product.Name, product.Stock, cartItem.Quantity)
+	for i := range shopOrders {
+		shopOrders[i].Subtotal = roundCents(shopOrders[i].Subtotal)
+		if err := repos.Orders.CreateShopOrder(&shopOrders[i]); err != nil {
+			return nil, fmt.Errorf("failed to create shop order: %v", err)
 		}
+	}
 
-		// Calculate item total
-		itemTotal := product.Price * float64(cartItem.Quantity)
-		totalPrice += itemTotal
+	for i := range items {
+		var key uint
+		if shopID := products[items[i].ProductID].ShopID; shopID != nil {
+			key = *shopID
+		}
+		items[i].ShopOrderID = &shopOrders[index[key]].ID
+	}
+
+	return shopOrders, nil
+}
 
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID: cartItem.ProductID,
-			Quantity:  cartItem.Quantity,
-			Price:     product.Price,
-		})
+// authorizePayment authorizes the order amount with the payment gateway.
+// Cash on delivery needs no authorization and returns a nil result. A pending
+// result means the provider will confirm the payment through a webhook.
+func (s *OrderService) authorizePayment(userID uint, req models.PlaceOrderRequest, amount float64) (*PaymentResult, error) {
+	if req.PaymentMethod == "cod" {
+		return nil, nil
 	}
 
-	// Simulate payment processing based on payment method
-	orderStatus, err := s.simulatePayment(req.PaymentMethod)
+	ctx, cancel := paymentContext()
+	defer cancel()
+
+	result, err := s.gateway.Authorize(ctx, PaymentRequest{
+		Amount:    amount,
+		Method:    req.PaymentMethod,
+		Token:     req.PaymentToken,
+		Reference: fmt.Sprintf("user-%d-%d", userID, time.Now().UnixNano()),
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("payment failed: %w", err)
 	}
-
-	// Create order
-	order := &models.Order{
-		UserID:        userID,
-		Status:        orderStatus,
-		TotalPrice:    totalPrice,
-		PaymentMethod: req.PaymentMethod,
-		BankName:      req.BankName,
+	if result.Status != PaymentStatusAuthorized && result.Status != PaymentStatusPending {
+		return nil, fmt.Errorf("payment failed: unexpected payment status %s", result.Status)
 	}
 
-	// Create order first
-	err = s.orderRepo.Create(order)
+	return result, nil
+}
+
+// capturePayment captures the authorized payment of a committed order and
+// marks it paid, or awaiting_payment when the provider settles the capture
+// asynchronously. Paid orders are posted to the seller ledger. The order is
+// locked while its payment is captured, and is only captured if it is still
+// in the status the caller loaded it in (pending, awaiting_payment or
+// pending_verification), so an order captured or cancelled by another
+// request is left alone. If the capture fails the order is cancelled and its
+// stock restored.
+func (s *OrderService) capturePayment(order *models.Order) error {
+	var captureErr error
+	status, transactionID := order.Status, order.PaymentTransactionID
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		locked, err := repos.Orders.FindByIDForUpdate(order.ID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+		if locked.Status != order.Status || locked.PaymentTransactionID != order.PaymentTransactionID {
+			return fmt.Errorf("cannot capture payment of %s order", locked.Status)
+		}
+
+		ctx, cancel := paymentContext()
+		defer cancel()
+
+		result, err := s.gateway.Capture(ctx, order.PaymentTransactionID, order.TotalPrice)
+		if err != nil {
+			captureErr = err
+			return restoreOrder(repos, order.ID, "cancelled")
+		}
+
+		status = "paid"
+		if result.Status == PaymentStatusPending {
+			status = "awaiting_payment"
+		}
+		transactionID = result.TransactionID
+		if err := repos.Orders.UpdateOrderFields(order.ID, map[string]interface{}{
+			"status":                 status,
+			"payment_transaction_id": transactionID,
+		}); err != nil {
+			return err
+		}
+		if status != "paid" {
+			return nil
+		}
+		return s.ledger.postOrderSale(repos, order.ID)
+	})
+	if captureErr != nil {
+		s.voidPayment(order.PaymentTransactionID)
+		if err != nil {
+			utils.LogError(err, fmt.Sprintf("Failed to cancel order %d after capture failure", order.ID))
+		}
+		return fmt.Errorf("payment failed: %w", captureErr)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %v", err)
+		return err
 	}
 
-	// Create order items (stock already reduced when added to cart)
-	for _, item := range orderItems {
-		item.OrderID = order.ID
+	order.Status, order.PaymentTransactionID = status, transactionID
+	return nil
+}
 
-		// Create order item
-		err = s.orderRepo.CreateOrderItem(&item)
+// ApplyPaymentEvent moves the order a webhook event refers to through its
+// payment states. It returns the order ID (0 if none matched) and whether the
+// event changed anything. The order is locked and its status checked again
+// before it changes, so events that no longer apply, including repeated and
+// concurrent deliveries, are ignored.
+func (s *OrderService) ApplyPaymentEvent(event *PaymentEvent) (uint, bool, error) {
+	if event.Status == "" || len(event.TransactionIDs) == 0 {
+		return 0, false, nil
+	}
+
+	found, err := s.orderRepo.FindByPaymentTransactionIDs(event.TransactionIDs)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	var order *models.Order
+	applied := false
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		order, err = lockOrder(repos, found.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create order item: %v", err)
+			return err
 		}
 
-		// Stock is already reduced when item was added to cart
-		// No need to reduce again during order placement
-	}
+		resourceID := event.ResourceID
+		if resourceID == "" {
+			resourceID = order.PaymentTransactionID
+		}
 
-	// Clear cart
-	err = s.cartRepo.ClearCart(cart.ID)
+		switch event.Status {
+		case PaymentStatusAuthorized:
+			if order.Status != "awaiting_payment" {
+				return nil
+			}
+			applied = true
+			order.PaymentTransactionID = resourceID
+			// Prescription orders are captured once a pharmacist approves
+			// them, the others once this transaction commits
+			if order.Prescription != nil && order.Prescription.Status == models.PrescriptionStatusPending {
+				order.Status = "pending_verification"
+			}
+			return repos.Orders.UpdateOrderFields(order.ID, map[string]interface{}{
+				"status":                 order.Status,
+				"payment_transaction_id": resourceID,
+			})
+
+		case PaymentStatusCaptured:
+			// Orders awaiting verification are only paid once approved
+			if order.Status == "pending_verification" || !s.isValidStatusTransition(order.Status, "paid") {
+				return nil
+			}
+			applied = true
+			if err := repos.Orders.UpdateOrderFields(order.ID, map[string]interface{}{
+				"status":                 "paid",
+				"payment_transaction_id": resourceID,
+			}); err != nil {
+				return err
+			}
+			return s.ledger.postOrderSale(repos, order.ID)
+
+		case PaymentStatusFailed:
+			if !s.isValidStatusTransition(order.Status, "failed") {
+				return nil
+			}
+			applied = true
+			return restoreOrder(repos, order.ID, "failed")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to clear cart: %v", err)
+		return found.ID, false, err
 	}
 
-	return order, nil
+	if applied && event.Status == PaymentStatusAuthorized && order.Status == "awaiting_payment" {
+		if err := s.capturePayment(order); err != nil {
+			return order.ID, true, err
+		}
+	}
+	return order.ID, applied, nil
+}
+
+// voidPayment releases an authorization that will not be captured
+func (s *OrderService) voidPayment(transactionID string) {
+	ctx, cancel := paymentContext()
+	defer cancel()
+
+	if _, err := s.gateway.Void(ctx, transactionID); err != nil {
+		utils.LogError(err, "Failed to void payment "+transactionID)
+	}
 }
 
 // GetOrderByID gets an order by ID
@@ -140,72 +530,307 @@ func (s *OrderService) GetOrderByID(id uint) (*models.Order, error) {
 	return s.orderRepo.FindByID(id)
 }
 
-// GetAllOrders gets all orders
-func (s *OrderService) GetAllOrders() ([]models.Order, error) {
-	return s.orderRepo.FindAll()
+// ListOrders gets a page of orders
+func (s *OrderService) ListOrders(params models.ListParams) (*models.Page[models.Order], error) {
+	return s.orderRepo.List(params)
 }
 
-// GetOrdersByUserID gets orders by user ID (for customer order history)
-func (s *OrderService) GetOrdersByUserID(userID uint) ([]models.Order, error) {
-	return s.orderRepo.FindByUserID(userID)
+// ListUserOrders gets a page of the orders of a user (for customer order history)
+func (s *OrderService) ListUserOrders(userID uint, params models.ListParams) (*models.Page[models.Order], error) {
+	return s.orderRepo.ListByUserID(userID, params)
 }
 
-// CancelOrder cancels an order and restores stock
-func (s *OrderService) CancelOrder(orderID uint, userID uint) error {
-	order, err := s.orderRepo.FindByID(orderID)
+// CancelOrder cancels an order, restores stock and refunds captured payments,
+// reversing the order's ledger entries.
+// Callers check that the user may cancel it (see handlers.OrderPolicy).
+func (s *OrderService) CancelOrder(orderID uint) error {
+	return s.cancelOrder(orderID, func(order *models.Order) error {
+		if !s.isValidStatusTransition(order.Status, "cancelled") {
+			return errors.New("cannot cancel order in current status")
+		}
+		return nil
+	})
+}
+
+// cancelOrder cancels an order once check accepts it: the order is locked,
+// its items return to stock and its ledger entries are reversed in one
+// transaction, then its payment is voided or refunded
+func (s *OrderService) cancelOrder(orderID uint, check func(order *models.Order) error) error {
+	var order *models.Order
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		order, err = lockOrder(repos, orderID)
+		if err != nil {
+			return err
+		}
+
+		if err := check(order); err != nil {
+			return err
+		}
+		for _, shopOrder := range order.ShopOrders {
+			if shopOrder.Status == "shipped" {
+				return errors.New("cannot cancel order with shipped items")
+			}
+		}
+
+		if err := restoreOrder(repos, order.ID, "cancelled"); err != nil {
+			return err
+		}
+		return s.ledger.postOrderRefund(repos, order.ID)
+	})
 	if err != nil {
-		return errors.New("order not found")
+		return err
+	}
+
+	if (order.Status == "awaiting_payment" || order.Status == "pending_verification") && order.PaymentTransactionID != "" {
+		s.voidPayment(order.PaymentTransactionID)
 	}
 
-	if order.UserID != userID {
-		return errors.New("unauthorized to cancel this order")
+	if order.Status == "paid" {
+		return s.refundPayment(order, "cancelled")
 	}
 
-	if order.Status == "shipped" || order.Status == "cancelled" {
-		return errors.New("cannot cancel order in current status")
+	return nil
+}
+
+// returnOrder takes a shipped order back once check accepts it: its items
+// return to stock and its ledger entries are reversed in one transaction,
+// then its payment is refunded
+func (s *OrderService) returnOrder(orderID uint, check func(order *models.Order) error) error {
+	var order *models.Order
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		order, err = repos.Orders.FindByIDForUpdate(orderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+		if err := check(order); err != nil {
+			return err
+		}
+
+		if err := restoreOrder(repos, order.ID, "returned"); err != nil {
+			return err
+		}
+		return s.ledger.postOrderRefund(repos, order.ID)
+	})
+	if err != nil {
+		return err
 	}
 
+	return s.refundPayment(order, "returned")
+}
+
+// refundPayment refunds the captured payment of an order that was cancelled
+// or returned. Cash on delivery orders have no payment to refund.
+func (s *OrderService) refundPayment(order *models.Order, status string) error {
+	if order.PaymentTransactionID == "" {
+		return nil
+	}
+
+	ctx, cancel := paymentContext()
+	defer cancel()
+
+	if _, err := s.gateway.Refund(ctx, order.PaymentTransactionID, order.TotalPrice); err != nil {
+		utils.LogError(err, fmt.Sprintf("Failed to refund %s order %d", status, order.ID))
+		return fmt.Errorf("order %s but refund failed: %v", status, err)
+	}
+	return nil
+}
+
+// lockOrder locks an order and then loads it with its items, sub-orders and
+// prescription, so concurrent cancellations, shipments and payment events see
+// each other's changes
+func lockOrder(repos *repositories.TxRepositories, orderID uint) (*models.Order, error) {
+	if _, err := repos.Orders.FindByIDForUpdate(orderID); err != nil {
+		return nil, errors.New("order not found")
+	}
+	order, err := repos.Orders.FindByID(orderID)
+	if err != nil {
+		return nil, errors.New("order not found")
+	}
+	return order, nil
+}
+
+// restoreOrder returns the items of an order to stock and moves it to a
+// terminal status (cancelled, failed or returned)
+func restoreOrder(repos *repositories.TxRepositories, orderID uint, status string) error {
 	// Get order items to restore stock
-	orderItems, err := s.orderRepo.FindOrderItemsByOrderID(orderID)
+	orderItems, err := repos.Orders.FindOrderItemsByOrderID(orderID)
 	if err != nil {
 		return fmt.Errorf("failed to get order items: %v", err)
 	}
 
-	// Restore stock for each item (use negative reduction to add back)
+	reason := models.StockReasonOrderCancel
+	if status == "returned" {
+		reason = models.StockReasonReturn
+	}
+
+	// Restore stock for each item
 	for _, item := range orderItems {
-		err = s.productRepo.ReduceStock(item.ProductID, -item.Quantity) // Negative = restore stock
-		if err != nil {
-			return fmt.Errorf("failed to restore stock for product %d: %v", item.ProductID, err)
+		if err := moveStock(repos, &models.StockMovement{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Reason:    reason,
+			OrderID:   &orderID,
+			Note:      "order " + status,
+		}); err != nil {
+			return err
 		}
 	}
+	if err := restoreLots(repos, orderID); err != nil {
+		return fmt.Errorf("failed to restore lots: %v", err)
+	}
+	if err := repos.Prescriptions.WithdrawPending(orderID); err != nil {
+		return fmt.Errorf("failed to withdraw prescription: %v", err)
+	}
 
-	order.Status = "cancelled"
-	return s.orderRepo.UpdateStatus(order.ID, "cancelled")
+	if err := repos.Orders.UpdateShopOrdersByOrderID(orderID, map[string]interface{}{"status": status}); err != nil {
+		return fmt.Errorf("failed to update shop orders: %v", err)
+	}
+
+	return repos.Orders.UpdateStatus(orderID, status)
 }
 
-// UpdateOrderStatus updates order status (admin only)
+// UpdateOrderStatus updates order status (admin only). Cancelling an order
+// takes the same path as CancelOrder, so its stock and payment are returned,
+// and returning a shipped order restocks and refunds it the same way.
 func (s *OrderService) UpdateOrderStatus(orderID uint, status string) error {
-	order, err := s.orderRepo.FindByID(orderID)
-	if err != nil {
-		return errors.New("order not found")
+	checkTransition := func(order *models.Order) error {
+		// Only a pharmacist's review, or the customer cancelling it, moves an
+		// order awaiting verification on
+		if order.Status == "pending_verification" {
+			return ErrAwaitingVerification
+		}
+		if !s.isValidStatusTransition(order.Status, status) {
+			return errors.New("invalid status transition")
+		}
+		return nil
 	}
 
-	// Validate status transition
-	if !s.isValidStatusTransition(order.Status, status) {
-		return errors.New("invalid status transition")
+	switch status {
+	case "cancelled":
+		return s.cancelOrder(orderID, checkTransition)
+	case "returned":
+		return s.returnOrder(orderID, checkTransition)
 	}
 
-	order.Status = status
-	return s.orderRepo.UpdateStatus(order.ID, status)
+	return s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		order, err := repos.Orders.FindByIDForUpdate(orderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+		if err := checkTransition(order); err != nil {
+			return err
+		}
+
+		// Shipping the whole order settles its pending sub-orders, and paying
+		// it posts to the seller ledger
+		switch status {
+		case "paid":
+			if err := s.ledger.postOrderSale(repos, order.ID); err != nil {
+				return err
+			}
+		case "shipped":
+			if err := checkNoRecalledLots(repos, order.ID, 0); err != nil {
+				return err
+			}
+			if err := repos.Orders.UpdateShopOrdersByOrderID(order.ID, map[string]interface{}{
+				"status":     "shipped",
+				"shipped_at": time.Now(),
+			}); err != nil {
+				return err
+			}
+		}
+		return repos.Orders.UpdateStatus(order.ID, status)
+	})
+}
+
+// GetShopOrders gets the sub-orders a shop has to fulfil
+func (s *OrderService) GetShopOrders(shopID uint) ([]models.ShopOrder, error) {
+	return s.orderRepo.FindShopOrdersByShopID(shopID)
+}
+
+// ShipShopOrder marks a shop's sub-order shipped once its order is paid.
+// When the last sub-order of an order ships, the order itself is shipped.
+func (s *OrderService) ShipShopOrder(shopID, shopOrderID uint) (*models.ShopOrder, error) {
+	var shopOrder *models.ShopOrder
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		shopOrder, err = repos.Orders.FindShopOrderByID(shopOrderID)
+		if err != nil || shopOrder.ShopID == nil || *shopOrder.ShopID != shopID {
+			return ErrShopOrderNotFound
+		}
+
+		// Lock the order so concurrent shipments of its sub-orders see each other
+		order, err := repos.Orders.FindByIDForUpdate(shopOrder.OrderID)
+		if err != nil {
+			return ErrShopOrderNotFound
+		}
+		if order.Status != "paid" {
+			return ErrOrderNotPaid
+		}
+		if shopOrder.Status != "pending" {
+			return ErrShopOrderNotPending
+		}
+		if err := checkNoRecalledLots(repos, order.ID, shopOrder.ID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := repos.Orders.UpdateShopOrderFields(shopOrder.ID, map[string]interface{}{
+			"status":     "shipped",
+			"shipped_at": now,
+		}); err != nil {
+			return err
+		}
+		shopOrder.Status = "shipped"
+		shopOrder.ShippedAt = &now
+
+		pending, err := repos.Orders.CountPendingShopOrders(order.ID)
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			return repos.Orders.UpdateStatus(order.ID, "shipped")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shopOrder, nil
+}
+
+// checkNoRecalledLots refuses to ship the items of an order, or of one of its
+// sub-orders when shopOrderID is not 0, taken from a lot recalled since. The
+// order is held until it is cancelled and refunded.
+func checkNoRecalledLots(repos *repositories.TxRepositories, orderID, shopOrderID uint) error {
+	recalled, err := repos.Inventory.CountRecalledAllocations(orderID, shopOrderID)
+	if err != nil {
+		return err
+	}
+	if recalled > 0 {
+		return ErrRecalledLotShipment
+	}
+	return nil
 }
 
 // isValidStatusTransition validates order status transitions
 func (s *OrderService) isValidStatusTransition(from, to string) bool {
 	transitions := map[string][]string{
-		"pending":   {"paid", "cancelled"},
-		"paid":      {"shipped", "cancelled"},
-		"shipped":   {}, // Final state
-		"cancelled": {}, // Final state
+		// Held until a pharmacist reviews the prescription: approval releases
+		// it for payment or delivery, and rejection or the customer cancels it
+		// (see PrescriptionService and CancelOrder). A failed payment fails it
+		// and withdraws the prescription.
+		"pending_verification": {"pending", "awaiting_payment", "paid", "cancelled", "failed"},
+		"pending":              {"paid", "cancelled"},
+		"awaiting_payment":     {"pending_verification", "paid", "failed", "cancelled"},
+		"paid":                 {"shipped", "cancelled"},
+		"shipped":              {"returned"},
+		"returned":             {}, // Final state
+		"cancelled":            {}, // Final state
+		"failed":               {}, // Final state
 	}
 
 	validStatuses, exists := transitions[from]
@@ -222,42 +847,6 @@ func (s *OrderService) isValidStatusTransition(from, to string) bool {
 	return false
 }
 
-// simulatePayment simulates payment processing for demo purposes
-func (s *OrderService) simulatePayment(paymentMethod string) (string, error) {
-	// Seed random number generator
-	rand.Seed(time.Now().UnixNano())
-
-	switch paymentMethod {
-	case "cod":
-		// Cash on delivery - always successful
-		return "pending", nil
-
-	case "paypal":
-		// Simulate PayPal processing (95% success rate)
-		if rand.Float32() < 0.95 {
-			return "paid", nil
-		}
-		return "", errors.New("payment failed: insufficient funds")
-
-	case "debit":
-		// Simulate debit card processing (90% success rate)
-		if rand.Float32() < 0.90 {
-			return "paid", nil
-		}
-		return "", errors.New("payment failed: card declined")
-
-	case "cc":
-		// Simulate credit card processing (92% success rate)
-		if rand.Float32() < 0.92 {
-			return "paid", nil
-		}
-		return "", errors.New("payment failed: credit limit exceeded")
-
-	default:
-		return "", errors.New("unsupported payment method")
-	}
-}
-
 // GetOrderStatistics gets order statistics for reporting
 func (s *OrderService) GetOrderStatistics() (int64, error) {
 	return s.orderRepo.GetOrderStatistics()
@@ -372,7 +961,14 @@ func (s *OrderService) GeneratePurchaseReceiptPDF(orderID uint) ([]byte, error)
 	var subtotal float64
 	for _, item := range order.OrderItems {
 		addTableCell(table, fmt.Sprintf("%d", item.ProductID), false)
-		addTableCell(table, item.Product.Name, false)
+		name := item.Product.Name
+		if item.Variant != nil {
+			name += fmt.Sprintf(" (SKU %s)", item.Variant.SKU)
+		}
+		for _, lot := range item.Lots {
+			name += fmt.Sprintf("\nLot %s, exp. %s, qty %d", lot.LotNumber, lot.ExpiryDate.Format("2006-01-02"), lot.Quantity)
+		}
+		addTableCell(table, name, false)
 		addTableCell(table, fmt.Sprintf("%d", item.Quantity), false)
 		itemTotal := item.Price * float64(item.Quantity)
 		addTableCell(table, fmt.Sprintf("$%.2f", itemTotal), false)
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"health-store/config"
+	"health-store/models"
+	"health-store/repositories"
+
+	"gorm.io/gorm"
+)
+
+// newTestOrderService creates an order service over db that pays through the fake gateway
+func newTestOrderService(db *gorm.DB) (*OrderService, *FakePaymentGateway) {
+	uow := repositories.NewUnitOfWork(db)
+	ledger := NewLedgerService(
+		repositories.NewLedgerRepository(db),
+		repositories.NewShopRepository(db),
+		repositories.NewCategoryRepository(db),
+		uow,
+		config.MarketplaceConfig{CommissionRate: 0.10},
+	)
+	gateway := NewFakePaymentGateway("test-webhook-secret")
+	orders := NewOrderService(
+		repositories.NewOrderRepository(db),
+		repositories.NewCartRepository(db),
+		repositories.NewProductRepository(db),
+		uow,
+		gateway,
+		ledger,
+	)
+	return orders, gateway
+}
+
+func createTestCustomer(t *testing.T, db *gorm.DB, name string) *models.User {
+	t.Helper()
+	user := &models.User{Username: name, Email: name + "@example.com", Role: "customer"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func createTestProduct(t *testing.T, db *gorm.DB, name string, price float64, stock int) *models.Product {
+	t.Helper()
+	category := models.Category{Name: "Category for " + name}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	product := &models.Product{CategoryID: category.ID, Name: name, Description: name, Price: price, Stock: stock}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	return product
+}
+
+// fillTestCart puts quantities of products in the cart of a user without
+// reserving stock, so carts compete for stock at checkout
+func fillTestCart(t *testing.T, db *gorm.DB, user *models.User, quantities map[*models.Product]int) *models.Cart {
+	t.Helper()
+	cart := &models.Cart{UserID: &user.ID}
+	if err := db.Create(cart).Error; err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	for product, quantity := range quantities {
+		if err := db.Create(&models.CartItem{CartID: cart.ID, ProductID: product.ID, Quantity: quantity}).Error; err != nil {
+			t.Fatalf("create cart item: %v", err)
+		}
+	}
+	return cart
+}
+
+func countRows(t *testing.T, db *gorm.DB, model interface{}) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(model).Count(&count).Error; err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	return count
+}
+
+func productStock(t *testing.T, db *gorm.DB, productID uint) int {
+	t.Helper()
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		t.Fatalf("load product: %v", err)
+	}
+	return product.Stock
+}
+
+// assertPaymentsVoided checks that every payment of a failed checkout was released
+func assertPaymentsVoided(t *testing.T, gateway *FakePaymentGateway) {
+	t.Helper()
+	if len(gateway.transactions) == 0 {
+		t.Error("no payment was authorized")
+	}
+	for id, txn := range gateway.transactions {
+		if txn.status != PaymentStatusVoided {
+			t.Errorf("payment %s status = %q, want %q", id, txn.status, PaymentStatusVoided)
+		}
+	}
+}
+
+func TestPlaceOrderCommitsOrderAndClearsCart(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	user := createTestCustomer(t, db, "alice")
+	vitamins := createTestProduct(t, db, "Vitamin C", 12.50, 10)
+	cart := fillTestCart(t, db, user, map[*models.Product]int{vitamins: 3})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	if order.Status != "paid" {
+		t.Errorf("order status = %q, want paid", order.Status)
+	}
+	if order.TotalPrice != 37.50 {
+		t.Errorf("order total = %.2f, want 37.50", order.TotalPrice)
+	}
+	if got := countRows(t, db, &models.OrderItem{}); got != 1 {
+		t.Errorf("order items = %d, want 1", got)
+	}
+	if got := productStock(t, db, vitamins.ID); got != 7 {
+		t.Errorf("stock = %d, want 7", got)
+	}
+	if got := countRows(t, db.Where("cart_id = ?", cart.ID), &models.CartItem{}); got != 0 {
+		t.Errorf("cart items = %d, want the cart cleared", got)
+	}
+	if status := gateway.transactions[order.PaymentTransactionID].status; status != PaymentStatusCaptured {
+		t.Errorf("payment status = %q, want %q", status, PaymentStatusCaptured)
+	}
+}
+
+func TestPlaceOrderRollsBackWhenAStepFails(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	user := createTestCustomer(t, db, "bob")
+	bandages := createTestProduct(t, db, "Bandages", 4.00, 10)
+	syrup := createTestProduct(t, db, "Cough Syrup", 8.00, 3)
+	cart := fillTestCart(t, db, user, map[*models.Product]int{bandages: 2, syrup: 1})
+
+	// Clearing the cart is the last step, so the order, its items and the
+	// stock have been written when it fails
+	failDeletesFrom(t, db, "cart_items")
+
+	if _, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"}); err == nil {
+		t.Fatal("PlaceOrder succeeded, want the injected failure")
+	}
+
+	for name, model := range map[string]interface{}{
+		"orders":          &models.Order{},
+		"order items":     &models.OrderItem{},
+		"stock movements": &models.StockMovement{},
+	} {
+		if got := countRows(t, db, model); got != 0 {
+			t.Errorf("%s = %d, want 0 after rollback", name, got)
+		}
+	}
+	if got := productStock(t, db, bandages.ID); got != 10 {
+		t.Errorf("bandages stock = %d, want 10", got)
+	}
+	if got := productStock(t, db, syrup.ID); got != 3 {
+		t.Errorf("syrup stock = %d, want 3", got)
+	}
+	if got := countRows(t, db.Where("cart_id = ?", cart.ID), &models.CartItem{}); got != 2 {
+		t.Errorf("cart items = %d, want the cart kept", got)
+	}
+	assertPaymentsVoided(t, gateway)
+}
+
+// TestPlaceOrderRejectsOverselling checks out more units than are in stock
+// over several carts. SQLite runs the checkouts one at a time, so this shows
+// that each checkout re-checks stock inside its transaction and asks for the
+// product rows to be locked; MySQL holds those locks until the order commits.
+func TestPlaceOrderRejectsOverselling(t *testing.T) {
+	db := newTestDB(t)
+	locked := recordLockedTables(t, db)
+	orders, gateway := newTestOrderService(db)
+	thermometers := createTestProduct(t, db, "Thermometer", 15.00, 5)
+
+	const customers = 4
+	placed := 0
+	for i := 0; i < customers; i++ {
+		user := createTestCustomer(t, db, fmt.Sprintf("customer%d", i))
+		fillTestCart(t, db, user, map[*models.Product]int{thermometers: 2})
+
+		_, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"})
+		switch {
+		case err == nil:
+			placed++
+		case !strings.Contains(err.Error(), "insufficient stock"):
+			t.Errorf("PlaceOrder error = %v, want insufficient stock", err)
+		}
+	}
+
+	if placed != 2 {
+		t.Errorf("placed %d orders, want 2 of 2 units each from 5 in stock", placed)
+	}
+	if got := productStock(t, db, thermometers.ID); got != 1 {
+		t.Errorf("stock = %d, want 1", got)
+	}
+	if !locked("products") {
+		t.Error("products were not read with FOR UPDATE")
+	}
+
+	voided := 0
+	for _, txn := range gateway.transactions {
+		if txn.status == PaymentStatusVoided {
+			voided++
+		}
+	}
+	if voided != customers-placed {
+		t.Errorf("voided %d payments, want %d", voided, customers-placed)
+	}
+}
+
+func TestUpdateOrderStatusReturnsShippedOrder(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	user := createTestCustomer(t, db, "dana")
+	vitamins := createTestProduct(t, db, "Vitamin D", 9.00, 10)
+	fillTestCart(t, db, user, map[*models.Product]int{vitamins: 3})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if err := orders.UpdateOrderStatus(order.ID, "returned"); err == nil {
+		t.Fatal("returned an order that was not shipped")
+	}
+	if err := orders.UpdateOrderStatus(order.ID, "shipped"); err != nil {
+		t.Fatalf("ship order: %v", err)
+	}
+
+	if err := orders.UpdateOrderStatus(order.ID, "returned"); err != nil {
+		t.Fatalf("return order: %v", err)
+	}
+
+	returned, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if returned.Status != "returned" {
+		t.Errorf("order status = %q, want returned", returned.Status)
+	}
+	if got := productStock(t, db, vitamins.ID); got != 10 {
+		t.Errorf("stock = %d, want 10", got)
+	}
+	var movements []models.StockMovement
+	if err := db.Where("reason = ?", models.StockReasonReturn).Find(&movements).Error; err != nil {
+		t.Fatalf("load movements: %v", err)
+	}
+	if len(movements) != 1 || movements[0].Quantity != 3 || movements[0].OrderID == nil || *movements[0].OrderID != order.ID {
+		t.Errorf("return movements = %+v, want 3 units of order %d", movements, order.ID)
+	}
+	if status := gateway.transactions[order.PaymentTransactionID].status; status != PaymentStatusRefunded {
+		t.Errorf("payment status = %q, want %q", status, PaymentStatusRefunded)
+	}
+	if err := orders.UpdateOrderStatus(order.ID, "shipped"); err == nil {
+		t.Error("moved a returned order on")
+	}
+	if err := orders.CancelOrder(order.ID); err == nil {
+		t.Error("cancelled a returned order")
+	}
+	if got := productStock(t, db, vitamins.ID); got != 10 {
+		t.Errorf("stock = %d after cancelling the returned order, want 10", got)
+	}
+}
+
+func TestUpdateOrderStatusHoldsOrdersFromRecalledLots(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	recalls := NewRecallService(repositories.NewRecallRepository(db), repositories.NewUnitOfWork(db), NewLogMailer(filepath.Join(t.TempDir(), "mail.log"), "recalls@example.com"))
+	user := createTestCustomer(t, db, "lena")
+	insulin := createTestProduct(t, db, "Insulin Pen", 30.00, 5)
+	today := startOfDay(time.Now())
+	lot := &models.InventoryLot{ProductID: insulin.ID, LotNumber: "IP-1", ExpiryDate: today.AddDate(1, 0, 0), Quantity: 5, ReceivedAt: today}
+	if err := db.Create(lot).Error; err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+	fillTestCart(t, db, user, map[*models.Product]int{insulin: 2})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc"})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if _, err := recalls.CreateRecall(models.RecallCreateRequest{
+		Reason:   "Faulty dose selector in lot IP-1",
+		Severity: "class_ii",
+		Items:    []models.RecallItemRequest{{ProductID: insulin.ID, LotNumber: "IP-1"}},
+	}); err != nil {
+		t.Fatalf("CreateRecall: %v", err)
+	}
+
+	if err := orders.UpdateOrderStatus(order.ID, "shipped"); !errors.Is(err, ErrRecalledLotShipment) {
+		t.Fatalf("ship error = %v, want %v", err, ErrRecalledLotShipment)
+	}
+	held, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if held.Status != "paid" {
+		t.Errorf("order status = %q, want paid", held.Status)
+	}
+	for _, shopOrder := range held.ShopOrders {
+		if shopOrder.Status != "pending" {
+			t.Errorf("shop order %d status = %q, want pending", shopOrder.ID, shopOrder.Status)
+		}
+	}
+
+	// The held order is cancelled and refunded instead
+	if err := orders.CancelOrder(order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if status := gateway.transactions[order.PaymentTransactionID].status; status != PaymentStatusRefunded {
+		t.Errorf("payment status = %q, want %q", status, PaymentStatusRefunded)
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Test tokens understood by the fake gateway. Any other token (or none) is approved.
+const (
+	FakeTokenDeclined          = "tok_declined"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenCaptureFails      = "tok_capture_fails"
+	FakeTokenPending           = "tok_pending" // confirmed later through a webhook
+)
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook payload
+const FakeSignatureHeader = "X-Fake-Signature"
+
+type fakeTransaction struct {
+	amount   float64
+	captured float64
+	refunded float64
+	status   string
+	token    string
+}
+
+// fakeWebhookEvent is the webhook payload understood by the fake gateway
+type fakeWebhookEvent struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"` // payment.authorized, payment.captured or payment.failed
+	TransactionID string `json:"transaction_id"`
+}
+
+// FakePaymentGateway is a deterministic in-memory gateway for development and tests
+type FakePaymentGateway struct {
+	webhookSecret string
+
+	mutex        sync.Mutex
+	nextID       int
+	transactions map[string]*fakeTransaction
+}
+
+// NewFakePaymentGateway creates a new fake payment gateway
+func NewFakePaymentGateway(webhookSecret string) *FakePaymentGateway {
+	return &FakePaymentGateway{
+		webhookSecret: webhookSecret,
+		transactions:  make(map[string]*fakeTransaction),
+	}
+}
+
+// Name returns the provider name
+func (g *FakePaymentGateway) Name() string {
+	return "fake"
+}
+
+// Authorize approves the payment unless a declining test token is used
+func (g *FakePaymentGateway) Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	switch req.Token {
+	case FakeTokenDeclined:
+		return nil, fmt.Errorf("%w: card declined", ErrPaymentDeclined)
+	case FakeTokenInsufficientFunds:
+		return nil, fmt.Errorf("%w: insufficient funds", ErrPaymentDeclined)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	status := PaymentStatusAuthorized
+	if req.Token == FakeTokenPending {
+		status = PaymentStatusPending
+	}
+
+	g.nextID++
+	id := fmt.Sprintf("fake_txn_%d", g.nextID)
+	g.transactions[id] = &fakeTransaction{amount: req.Amount, status: status, token: req.Token}
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: id, Status: status}, nil
+}
+
+// Capture captures a previously authorized amount
+func (g *FakePaymentGateway) Capture(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	txn, ok := g.transactions[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("transaction not found: %s", transactionID)
+	}
+	if txn.status != PaymentStatusAuthorized {
+		return nil, fmt.Errorf("cannot capture transaction in status %s", txn.status)
+	}
+	if txn.token == FakeTokenCaptureFails {
+		return nil, fmt.Errorf("%w: capture rejected by issuer", ErrPaymentDeclined)
+	}
+	if toMinorUnits(amount) > toMinorUnits(txn.amount) {
+		return nil, fmt.Errorf("capture amount %.2f exceeds authorized amount %.2f", amount, txn.amount)
+	}
+
+	txn.captured = amount
+	txn.status = PaymentStatusCaptured
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusCaptured}, nil
+}
+
+// Refund refunds part or all of a captured amount
+func (g *FakePaymentGateway) Refund(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	txn, ok := g.transactions[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("transaction not found: %s", transactionID)
+	}
+	if txn.status != PaymentStatusCaptured {
+		return nil, fmt.Errorf("cannot refund transaction in status %s", txn.status)
+	}
+	if toMinorUnits(txn.refunded+amount) > toMinorUnits(txn.captured) {
+		return nil, fmt.Errorf("refund amount %.2f exceeds captured amount %.2f", amount, txn.captured-txn.refunded)
+	}
+
+	txn.refunded += amount
+	if toMinorUnits(txn.refunded) == toMinorUnits(txn.captured) {
+		txn.status = PaymentStatusRefunded
+	}
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusRefunded}, nil
+}
+
+// Void cancels an authorization that has not been captured
+func (g *FakePaymentGateway) Void(ctx context.Context, transactionID string) (*PaymentResult, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	txn, ok := g.transactions[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("transaction not found: %s", transactionID)
+	}
+	if txn.status != PaymentStatusAuthorized && txn.status != PaymentStatusPending {
+		return nil, fmt.Errorf("cannot void transaction in status %s", txn.status)
+	}
+
+	txn.status = PaymentStatusVoided
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusVoided}, nil
+}
+
+// Sign returns the signature header value for a fake webhook payload
+func (g *FakePaymentGateway) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(g.webhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the HMAC signature of a fake webhook delivery
+func (g *FakePaymentGateway) VerifyWebhook(ctx context.Context, payload []byte, headers http.Header) error {
+	signature, err := hex.DecodeString(headers.Get(FakeSignatureHeader))
+	if err != nil || len(signature) == 0 {
+		return errors.New("missing or malformed signature")
+	}
+
+	expected, _ := hex.DecodeString(g.Sign(payload))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// DecodeWebhook parses a fake webhook payload. A payment.authorized event also
+// moves the in-memory transaction out of pending, as the real provider would.
+func (g *FakePaymentGateway) DecodeWebhook(payload []byte) (*PaymentEvent, error) {
+	var raw fakeWebhookEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if raw.ID == "" {
+		return nil, errors.New("webhook event ID is required")
+	}
+
+	event := &PaymentEvent{
+		ID:             raw.ID,
+		Type:           raw.Type,
+		TransactionIDs: nonEmpty(raw.TransactionID),
+		ResourceID:     raw.TransactionID,
+	}
+
+	switch raw.Type {
+	case "payment.authorized":
+		event.Status = PaymentStatusAuthorized
+		g.mutex.Lock()
+		if txn, ok := g.transactions[raw.TransactionID]; ok && txn.status == PaymentStatusPending {
+			txn.status = PaymentStatusAuthorized
+		}
+		g.mutex.Unlock()
+	case "payment.captured":
+		event.Status = PaymentStatusCaptured
+	case "payment.failed":
+		event.Status = PaymentStatusFailed
+	}
+
+	return event, nil
+}
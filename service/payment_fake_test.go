@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeGatewayStep is an operation of a fake gateway script and its outcome
+type fakeGatewayStep struct {
+	Status        string
+	TransactionID string
+	Declined      bool
+	Failed        bool
+}
+
+// runFakeGatewayScript runs the same payments through a new fake gateway
+func runFakeGatewayScript(t *testing.T) []fakeGatewayStep {
+	t.Helper()
+	ctx := context.Background()
+	g := NewFakePaymentGateway("test-webhook-secret")
+
+	var steps []fakeGatewayStep
+	record := func(result *PaymentResult, err error) {
+		step := fakeGatewayStep{Declined: errors.Is(err, ErrPaymentDeclined), Failed: err != nil}
+		if result != nil {
+			step.Status, step.TransactionID = result.Status, result.TransactionID
+		}
+		steps = append(steps, step)
+	}
+
+	record(g.Authorize(ctx, PaymentRequest{Amount: 25, Method: "cc"}))                               // fake_txn_1
+	record(g.Capture(ctx, "fake_txn_1", 25))                                                         // captured
+	record(g.Refund(ctx, "fake_txn_1", 10))                                                          // partly refunded
+	record(g.Refund(ctx, "fake_txn_1", 20))                                                          // more than is left
+	record(g.Authorize(ctx, PaymentRequest{Amount: 25, Method: "cc", Token: FakeTokenDeclined}))     // declined
+	record(g.Authorize(ctx, PaymentRequest{Amount: 25, Method: "cc", Token: FakeTokenCaptureFails})) // fake_txn_2
+	record(g.Capture(ctx, "fake_txn_2", 25))                                                         // capture declined
+	record(g.Void(ctx, "fake_txn_2"))                                                                // voided
+	record(g.Authorize(ctx, PaymentRequest{Amount: 25, Method: "paypal", Token: FakeTokenPending}))  // fake_txn_3
+	record(g.Capture(ctx, "fake_txn_3", 25))                                                         // not authorized yet
+	record(g.Void(ctx, "fake_txn_3"))                                                                // voided
+	return steps
+}
+
+func TestFakePaymentGatewayIsDeterministic(t *testing.T) {
+	want := []fakeGatewayStep{
+		{Status: PaymentStatusAuthorized, TransactionID: "fake_txn_1"},
+		{Status: PaymentStatusCaptured, TransactionID: "fake_txn_1"},
+		{Status: PaymentStatusRefunded, TransactionID: "fake_txn_1"},
+		{Failed: true},
+		{Failed: true, Declined: true},
+		{Status: PaymentStatusAuthorized, TransactionID: "fake_txn_2"},
+		{Failed: true, Declined: true},
+		{Status: PaymentStatusVoided, TransactionID: "fake_txn_2"},
+		{Status: PaymentStatusPending, TransactionID: "fake_txn_3"},
+		{Failed: true},
+		{Status: PaymentStatusVoided, TransactionID: "fake_txn_3"},
+	}
+
+	for run := 1; run <= 3; run++ {
+		if got := runFakeGatewayScript(t); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d:\n got %+v\nwant %+v", run, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"health-store/config"
+)
+
+// Payment statuses reported by a gateway
+const (
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusPending    = "pending"
+	PaymentStatusFailed     = "failed"
+)
+
+// ErrPaymentDeclined is returned (wrapped) when the provider refuses a payment
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// PaymentRequest describes a payment to authorize
+type PaymentRequest struct {
+	Amount    float64
+	Currency  string
+	Method    string // paypal, debit, cc
+	Token     string // provider payment method / source token
+	Reference string // merchant reference, also used as idempotency key
+}
+
+// PaymentResult is the outcome of a gateway operation
+type PaymentResult struct {
+	Provider      string
+	TransactionID string
+	Status        string
+	Message       string
+}
+
+// PaymentEvent is an asynchronous payment notification decoded from a webhook
+type PaymentEvent struct {
+	ID     string
+	Type   string
+	Status string // authorized, captured or failed; empty for events we do not act on
+	// TransactionIDs lists every provider ID the event relates to. An order is
+	// matched when its stored transaction ID is one of them.
+	TransactionIDs []string
+	// ResourceID is the transaction ID to store on the order from now on
+	// (e.g. the capture ID once a PayPal authorization is captured)
+	ResourceID string
+}
+
+// PaymentGateway is implemented by every payment provider adapter
+type PaymentGateway interface {
+	Name() string
+	Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error)
+	Capture(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error)
+	Refund(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error)
+	Void(ctx context.Context, transactionID string) (*PaymentResult, error)
+	// VerifyWebhook checks that a webhook delivery was signed by the provider
+	VerifyWebhook(ctx context.Context, payload []byte, headers http.Header) error
+	// DecodeWebhook parses a (verified) webhook payload into a payment event
+	DecodeWebhook(payload []byte) (*PaymentEvent, error)
+}
+
+// NewPaymentGateway creates the payment gateway selected by configuration
+func NewPaymentGateway(cfg config.PaymentConfig) (PaymentGateway, error) {
+	httpClient := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Provider {
+	case "", "fake":
+		return NewFakePaymentGateway(cfg.FakeWebhookSecret), nil
+	case "stripe":
+		if cfg.StripeSecretKey == "" {
+			return nil, errors.New("stripe secret key is required")
+		}
+		return NewStripePaymentGateway(cfg.StripeBaseURL, cfg.StripeSecretKey, cfg.StripeWebhookSecret, cfg.Currency, httpClient), nil
+	case "paypal":
+		if cfg.PayPalClientID == "" || cfg.PayPalSecret == "" {
+			return nil, errors.New("paypal client ID and secret are required")
+		}
+		return NewPayPalPaymentGateway(cfg.PayPalBaseURL, cfg.PayPalClientID, cfg.PayPalSecret, cfg.PayPalWebhookID, cfg.Currency, httpClient), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider: %s", cfg.Provider)
+	}
+}
+
+// toMinorUnits converts an amount to the smallest currency unit (e.g. cents)
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// paymentContext returns a context bounded by a sane timeout for gateway calls
+func paymentContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 30*time.Second)
+}
+
+// nonEmpty returns the non-empty values in ids
+func nonEmpty(ids ...string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
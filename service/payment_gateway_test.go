@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// standInResponse is what a stand-in provider server answers on a path
+type standInResponse struct {
+	status int
+	body   string
+	// check inspects the request the adapter sent, when set
+	check func(t *testing.T, r *http.Request, body []byte)
+}
+
+// gatewayCase drives one gateway operation against a stand-in server
+type gatewayCase struct {
+	name      string
+	call      func(ctx context.Context, g PaymentGateway) (*PaymentResult, error)
+	responses map[string]standInResponse // by request path
+	// wantStatus and wantTransactionID describe a successful result;
+	// wantStatus is empty when the call must fail
+	wantStatus        string
+	wantTransactionID string
+	// wantDeclined requires the error to wrap ErrPaymentDeclined, and its
+	// absence requires an error that does not
+	wantDeclined bool
+}
+
+// runGatewayCases runs cases against gateways created by newGateway for a
+// stand-in server. Paths without a response fail the test.
+func runGatewayCases(t *testing.T, newGateway func(baseURL string) PaymentGateway, cases []gatewayCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response, ok := tc.responses[r.URL.Path]
+				if !ok {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if r.Method != http.MethodPost {
+					t.Errorf("%s used %s, want POST", r.URL.Path, r.Method)
+				}
+				body, _ := io.ReadAll(r.Body)
+				if response.check != nil {
+					response.check(t, r, body)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(response.status)
+				io.WriteString(w, response.body)
+			}))
+			defer server.Close()
+
+			result, err := tc.call(context.Background(), newGateway(server.URL))
+
+			if tc.wantStatus != "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.Status != tc.wantStatus {
+					t.Errorf("status = %q, want %q", result.Status, tc.wantStatus)
+				}
+				if result.TransactionID != tc.wantTransactionID {
+					t.Errorf("transaction ID = %q, want %q", result.TransactionID, tc.wantTransactionID)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected an error, got result %+v", result)
+			}
+			if declined := errors.Is(err, ErrPaymentDeclined); declined != tc.wantDeclined {
+				t.Errorf("error %q wraps ErrPaymentDeclined = %t, want %t", err, declined, tc.wantDeclined)
+			}
+		})
+	}
+}
+
+func authorizeCall(amount float64, token string) func(context.Context, PaymentGateway) (*PaymentResult, error) {
+	return func(ctx context.Context, g PaymentGateway) (*PaymentResult, error) {
+		return g.Authorize(ctx, PaymentRequest{Amount: amount, Method: "cc", Token: token, Reference: "user-1-1"})
+	}
+}
+
+func captureCall(transactionID string, amount float64) func(context.Context, PaymentGateway) (*PaymentResult, error) {
+	return func(ctx context.Context, g PaymentGateway) (*PaymentResult, error) {
+		return g.Capture(ctx, transactionID, amount)
+	}
+}
+
+func refundCall(transactionID string, amount float64) func(context.Context, PaymentGateway) (*PaymentResult, error) {
+	return func(ctx context.Context, g PaymentGateway) (*PaymentResult, error) {
+		return g.Refund(ctx, transactionID, amount)
+	}
+}
+
+func voidCall(transactionID string) func(context.Context, PaymentGateway) (*PaymentResult, error) {
+	return func(ctx context.Context, g PaymentGateway) (*PaymentResult, error) {
+		return g.Void(ctx, transactionID)
+	}
+}
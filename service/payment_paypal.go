@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PayPalPaymentGateway talks to the PayPal Orders and Payments v2 APIs
+type PayPalPaymentGateway struct {
+	baseURL    string
+	clientID   string
+	secret     string
+	webhookID  string
+	currency   string
+	httpClient *http.Client
+
+	mutex       sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// paypalAmount is the PayPal money object
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// paypalOrder is the subset of the PayPal order object we rely on
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		Payments struct {
+			Authorizations []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"authorizations"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
+// paypalPayment is the response for capture, refund and authorization calls
+type paypalPayment struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// NewPayPalPaymentGateway creates a new PayPal gateway. baseURL can point at a
+// local stand-in server; it defaults to the PayPal sandbox.
+func NewPayPalPaymentGateway(baseURL, clientID, secret, webhookID, currency string, httpClient *http.Client) *PayPalPaymentGateway {
+	if baseURL == "" {
+		baseURL = "https://api-m.sandbox.paypal.com"
+	}
+	return &PayPalPaymentGateway{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		clientID:   clientID,
+		secret:     secret,
+		webhookID:  webhookID,
+		currency:   strings.ToUpper(currency),
+		httpClient: httpClient,
+	}
+}
+
+// Name returns the provider name
+func (g *PayPalPaymentGateway) Name() string {
+	return "paypal"
+}
+
+// Authorize creates an AUTHORIZE-intent order for the vaulted payment token and
+// authorizes it. Orders that still need payer approval are reported as pending.
+func (g *PayPalPaymentGateway) Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	currency := g.currency
+	if req.Currency != "" {
+		currency = strings.ToUpper(req.Currency)
+	}
+
+	payload := map[string]interface{}{
+		"intent": "AUTHORIZE",
+		"purchase_units": []map[string]interface{}{
+			{
+				"reference_id": req.Reference,
+				"amount":       paypalAmount{CurrencyCode: currency, Value: fmt.Sprintf("%.2f", req.Amount)},
+			},
+		},
+	}
+	if req.Token != "" {
+		payload["payment_source"] = map[string]interface{}{
+			"token": map[string]string{"id": req.Token, "type": "BILLING_AGREEMENT"},
+		}
+	}
+
+	var order paypalOrder
+	if err := g.call(ctx, http.MethodPost, "/v2/checkout/orders", payload, req.Reference, &order); err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case "APPROVED":
+		if err := g.call(ctx, http.MethodPost, "/v2/checkout/orders/"+url.PathEscape(order.ID)+"/authorize", nil, "authorize-"+order.ID, &order); err != nil {
+			return nil, err
+		}
+	case "COMPLETED":
+	case "CREATED", "PAYER_ACTION_REQUIRED", "SAVED":
+		return &PaymentResult{Provider: g.Name(), TransactionID: order.ID, Status: PaymentStatusPending}, nil
+	default:
+		return nil, fmt.Errorf("%w: paypal order %s", ErrPaymentDeclined, strings.ToLower(order.Status))
+	}
+
+	for _, unit := range order.PurchaseUnits {
+		for _, auth := range unit.Payments.Authorizations {
+			if auth.Status == "CREATED" || auth.Status == "PENDING" {
+				return &PaymentResult{Provider: g.Name(), TransactionID: auth.ID, Status: PaymentStatusAuthorized}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: paypal authorization was not created", ErrPaymentDeclined)
+}
+
+// Capture captures an authorization. The returned transaction ID is the
+// capture ID, which is what refunds must reference.
+func (g *PayPalPaymentGateway) Capture(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	payload := map[string]interface{}{
+		"amount":        paypalAmount{CurrencyCode: g.currency, Value: fmt.Sprintf("%.2f", amount)},
+		"final_capture": true,
+	}
+
+	var capture paypalPayment
+	if err := g.call(ctx, http.MethodPost, "/v2/payments/authorizations/"+url.PathEscape(transactionID)+"/capture", payload, "capture-"+transactionID, &capture); err != nil {
+		return nil, err
+	}
+
+	switch capture.Status {
+	case "COMPLETED":
+		return &PaymentResult{Provider: g.Name(), TransactionID: capture.ID, Status: PaymentStatusCaptured}, nil
+	case "PENDING":
+		return &PaymentResult{Provider: g.Name(), TransactionID: capture.ID, Status: PaymentStatusPending}, nil
+	default:
+		return nil, fmt.Errorf("%w: paypal capture %s", ErrPaymentDeclined, strings.ToLower(capture.Status))
+	}
+}
+
+// Refund refunds a capture
+func (g *PayPalPaymentGateway) Refund(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	payload := map[string]interface{}{
+		"amount": paypalAmount{CurrencyCode: g.currency, Value: fmt.Sprintf("%.2f", amount)},
+	}
+
+	var refund paypalPayment
+	if err := g.call(ctx, http.MethodPost, "/v2/payments/captures/"+url.PathEscape(transactionID)+"/refund", payload, "refund-"+transactionID, &refund); err != nil {
+		return nil, err
+	}
+
+	if refund.Status == "FAILED" || refund.Status == "CANCELLED" {
+		return nil, fmt.Errorf("paypal refund %s", strings.ToLower(refund.Status))
+	}
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusRefunded}, nil
+}
+
+// Void voids an authorization
+func (g *PayPalPaymentGateway) Void(ctx context.Context, transactionID string) (*PaymentResult, error) {
+	if err := g.call(ctx, http.MethodPost, "/v2/payments/authorizations/"+url.PathEscape(transactionID)+"/void", nil, "void-"+transactionID, nil); err != nil {
+		return nil, err
+	}
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusVoided}, nil
+}
+
+// VerifyWebhook asks PayPal to verify the transmission signature of a webhook
+func (g *PayPalPaymentGateway) VerifyWebhook(ctx context.Context, payload []byte, headers http.Header) error {
+	if g.webhookID == "" {
+		return errors.New("paypal webhook ID is not configured")
+	}
+
+	request := map[string]interface{}{
+		"auth_algo":         headers.Get("Paypal-Auth-Algo"),
+		"cert_url":          headers.Get("Paypal-Cert-Url"),
+		"transmission_id":   headers.Get("Paypal-Transmission-Id"),
+		"transmission_sig":  headers.Get("Paypal-Transmission-Sig"),
+		"transmission_time": headers.Get("Paypal-Transmission-Time"),
+		"webhook_id":        g.webhookID,
+		"webhook_event":     json.RawMessage(payload),
+	}
+
+	var result struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := g.call(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", request, "", &result); err != nil {
+		return err
+	}
+	if result.VerificationStatus != "SUCCESS" {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// DecodeWebhook parses a PayPal authorization or capture event
+func (g *PayPalPaymentGateway) DecodeWebhook(payload []byte) (*PaymentEvent, error) {
+	var raw struct {
+		ID        string `json:"id"`
+		EventType string `json:"event_type"`
+		Resource  struct {
+			ID                string `json:"id"`
+			SupplementaryData struct {
+				RelatedIDs struct {
+					OrderID         string `json:"order_id"`
+					AuthorizationID string `json:"authorization_id"`
+				} `json:"related_ids"`
+			} `json:"supplementary_data"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if raw.ID == "" {
+		return nil, errors.New("webhook event ID is required")
+	}
+
+	related := raw.Resource.SupplementaryData.RelatedIDs
+	event := &PaymentEvent{
+		ID:             raw.ID,
+		Type:           raw.EventType,
+		TransactionIDs: nonEmpty(raw.Resource.ID, related.AuthorizationID, related.OrderID),
+		ResourceID:     raw.Resource.ID,
+	}
+
+	switch raw.EventType {
+	case "PAYMENT.AUTHORIZATION.CREATED":
+		event.Status = PaymentStatusAuthorized
+	case "PAYMENT.CAPTURE.COMPLETED":
+		event.Status = PaymentStatusCaptured
+	case "PAYMENT.CAPTURE.DENIED", "PAYMENT.AUTHORIZATION.VOIDED", "CHECKOUT.PAYMENT-APPROVAL.REVERSED":
+		event.Status = PaymentStatusFailed
+	}
+
+	return event, nil
+}
+
+// token returns a cached OAuth access token, refreshing it when expired
+func (g *PayPalPaymentGateway) token(ctx context.Context) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.accessToken != "" && time.Now().Before(g.tokenExpiry) {
+		return g.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(g.clientID, g.secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("paypal token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("paypal token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode paypal token response: %w", err)
+	}
+
+	g.accessToken = tokenResp.AccessToken
+	// Refresh a minute early so in-flight requests never carry an expired token
+	g.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+
+	return g.accessToken, nil
+}
+
+// call sends a JSON request to the PayPal API and decodes the response
+func (g *PayPalPaymentGateway) call(ctx context.Context, method, path string, payload interface{}, requestID string, out interface{}) error {
+	accessToken, err := g.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", "return=representation")
+	if requestID != "" {
+		req.Header.Set("PayPal-Request-Id", requestID)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("paypal request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read paypal response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(respBody, &apiErr)
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			return fmt.Errorf("%w: %s", ErrPaymentDeclined, apiErr.Message)
+		}
+		return fmt.Errorf("paypal error (%d): %s", resp.StatusCode, apiErr.Message)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode paypal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func newTestPayPalGateway(baseURL string) PaymentGateway {
+	return NewPayPalPaymentGateway(baseURL, "client-id", "client-secret", "WH-1", "USD", http.DefaultClient)
+}
+
+// withPayPalToken adds the OAuth token endpoint every PayPal call starts with,
+// and requires the other requests to carry its token
+func withPayPalToken(responses map[string]standInResponse) map[string]standInResponse {
+	withToken := map[string]standInResponse{
+		"/v1/oauth2/token": {
+			status: http.StatusOK,
+			body:   `{"access_token":"A21AA-test","expires_in":32400}`,
+			check: func(t *testing.T, r *http.Request, body []byte) {
+				if id, secret, _ := r.BasicAuth(); id != "client-id" || secret != "client-secret" {
+					t.Errorf("token requested with %q:%q, want the client credentials", id, secret)
+				}
+			},
+		},
+	}
+	for path, response := range responses {
+		check := response.check
+		response.check = func(t *testing.T, r *http.Request, body []byte) {
+			if got := r.Header.Get("Authorization"); got != "Bearer A21AA-test" {
+				t.Errorf("Authorization = %q, want the access token", got)
+			}
+			if check != nil {
+				check(t, r, body)
+			}
+		}
+		withToken[path] = response
+	}
+	return withToken
+}
+
+// paypalAmountOf reads the amount of a PayPal request body
+func paypalAmountOf(t *testing.T, body []byte) string {
+	t.Helper()
+	var request struct {
+		Amount        paypalAmount `json:"amount"`
+		PurchaseUnits []struct {
+			Amount paypalAmount `json:"amount"`
+		} `json:"purchase_units"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	if len(request.PurchaseUnits) > 0 {
+		return request.PurchaseUnits[0].Amount.CurrencyCode + " " + request.PurchaseUnits[0].Amount.Value
+	}
+	return request.Amount.CurrencyCode + " " + request.Amount.Value
+}
+
+func TestPayPalPaymentGateway(t *testing.T) {
+	const (
+		declined = `{"name":"UNPROCESSABLE_ENTITY","message":"The instrument presented was declined."}`
+		apiError = `{"name":"INTERNAL_SERVER_ERROR","message":"An internal server error occurred."}`
+	)
+	checkAmount := func(t *testing.T, r *http.Request, body []byte) {
+		if got := paypalAmountOf(t, body); got != "USD 19.99" {
+			t.Errorf("amount = %q, want USD 19.99", got)
+		}
+	}
+
+	runGatewayCases(t, newTestPayPalGateway, []gatewayCase{
+		{
+			name: "authorize succeeds",
+			call: authorizeCall(19.99, "B-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/checkout/orders": {status: http.StatusCreated, body: `{"id":"O-1","status":"APPROVED"}`, check: checkAmount},
+				"/v2/checkout/orders/O-1/authorize": {
+					status: http.StatusCreated,
+					body:   `{"id":"O-1","status":"COMPLETED","purchase_units":[{"payments":{"authorizations":[{"id":"AUTH-1","status":"CREATED"}]}}]}`,
+				},
+			}),
+			wantStatus:        PaymentStatusAuthorized,
+			wantTransactionID: "AUTH-1",
+		},
+		{
+			name: "authorize needing payer approval is pending",
+			call: authorizeCall(19.99, ""),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/checkout/orders": {status: http.StatusCreated, body: `{"id":"O-2","status":"PAYER_ACTION_REQUIRED"}`},
+			}),
+			wantStatus:        PaymentStatusPending,
+			wantTransactionID: "O-2",
+		},
+		{
+			name: "authorize declined",
+			call: authorizeCall(19.99, "B-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/checkout/orders":               {status: http.StatusCreated, body: `{"id":"O-1","status":"APPROVED"}`},
+				"/v2/checkout/orders/O-1/authorize": {status: http.StatusUnprocessableEntity, body: declined},
+			}),
+			wantDeclined: true,
+		},
+		{
+			name: "authorize fails",
+			call: authorizeCall(19.99, "B-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/checkout/orders": {status: http.StatusInternalServerError, body: apiError},
+			}),
+		},
+		{
+			name: "capture succeeds",
+			call: captureCall("AUTH-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/capture": {status: http.StatusCreated, body: `{"id":"CAP-1","status":"COMPLETED"}`, check: checkAmount},
+			}),
+			wantStatus:        PaymentStatusCaptured,
+			wantTransactionID: "CAP-1",
+		},
+		{
+			name: "capture declined",
+			call: captureCall("AUTH-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/capture": {status: http.StatusCreated, body: `{"id":"CAP-1","status":"DECLINED"}`},
+			}),
+			wantDeclined: true,
+		},
+		{
+			name: "capture fails",
+			call: captureCall("AUTH-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/capture": {status: http.StatusInternalServerError, body: apiError},
+			}),
+		},
+		{
+			name: "refund succeeds",
+			call: refundCall("CAP-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/captures/CAP-1/refund": {status: http.StatusCreated, body: `{"id":"REF-1","status":"COMPLETED"}`, check: checkAmount},
+			}),
+			wantStatus:        PaymentStatusRefunded,
+			wantTransactionID: "CAP-1",
+		},
+		{
+			name: "refund declined",
+			call: refundCall("CAP-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/captures/CAP-1/refund": {status: http.StatusUnprocessableEntity, body: declined},
+			}),
+			wantDeclined: true,
+		},
+		{
+			name: "refund fails",
+			call: refundCall("CAP-1", 19.99),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/captures/CAP-1/refund": {status: http.StatusInternalServerError, body: apiError},
+			}),
+		},
+		{
+			name: "void succeeds",
+			call: voidCall("AUTH-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/void": {status: http.StatusNoContent},
+			}),
+			wantStatus:        PaymentStatusVoided,
+			wantTransactionID: "AUTH-1",
+		},
+		{
+			name: "void declined",
+			call: voidCall("AUTH-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/void": {status: http.StatusUnprocessableEntity, body: declined},
+			}),
+			wantDeclined: true,
+		},
+		{
+			name: "void fails",
+			call: voidCall("AUTH-1"),
+			responses: withPayPalToken(map[string]standInResponse{
+				"/v2/payments/authorizations/AUTH-1/void": {status: http.StatusInternalServerError, body: apiError},
+			}),
+		},
+	})
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripeSignatureTolerance is how old a signed webhook timestamp may be
+const stripeSignatureTolerance = 5 * time.Minute
+
+// StripePaymentGateway talks to the Stripe PaymentIntents API
+type StripePaymentGateway struct {
+	baseURL       string
+	secretKey     string
+	webhookSecret string
+	currency      string
+	httpClient    *http.Client
+}
+
+// stripePaymentIntent is the subset of the PaymentIntent object we rely on
+type stripePaymentIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	LastPaymentError *struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+// stripeRefund is the subset of the Refund object we rely on
+type stripeRefund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// stripeError is the error envelope returned by the Stripe API
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewStripePaymentGateway creates a new Stripe gateway. baseURL can point at a
+// local stand-in server; it defaults to the public Stripe API.
+func NewStripePaymentGateway(baseURL, secretKey, webhookSecret, currency string, httpClient *http.Client) *StripePaymentGateway {
+	if baseURL == "" {
+		baseURL = "https://api.stripe.com"
+	}
+	return &StripePaymentGateway{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		currency:      strings.ToLower(currency),
+		httpClient:    httpClient,
+	}
+}
+
+// Name returns the provider name
+func (g *StripePaymentGateway) Name() string {
+	return "stripe"
+}
+
+// Authorize creates and confirms a manual-capture PaymentIntent
+func (g *StripePaymentGateway) Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	currency := g.currency
+	if req.Currency != "" {
+		currency = strings.ToLower(req.Currency)
+	}
+
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(toMinorUnits(req.Amount), 10))
+	form.Set("currency", currency)
+	form.Set("payment_method", req.Token)
+	form.Set("confirm", "true")
+	form.Set("capture_method", "manual")
+	form.Set("metadata[reference]", req.Reference)
+
+	var intent stripePaymentIntent
+	if err := g.post(ctx, "/v1/payment_intents", form, req.Reference, &intent); err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(&intent)
+}
+
+// Capture captures an authorized PaymentIntent
+func (g *StripePaymentGateway) Capture(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.FormatInt(toMinorUnits(amount), 10))
+
+	var intent stripePaymentIntent
+	if err := g.post(ctx, "/v1/payment_intents/"+url.PathEscape(transactionID)+"/capture", form, "capture-"+transactionID, &intent); err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(&intent)
+}
+
+// Refund refunds a captured PaymentIntent
+func (g *StripePaymentGateway) Refund(ctx context.Context, transactionID string, amount float64) (*PaymentResult, error) {
+	form := url.Values{}
+	form.Set("payment_intent", transactionID)
+	form.Set("amount", strconv.FormatInt(toMinorUnits(amount), 10))
+
+	var refund stripeRefund
+	if err := g.post(ctx, "/v1/refunds", form, "refund-"+transactionID, &refund); err != nil {
+		return nil, err
+	}
+
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return nil, fmt.Errorf("stripe refund %s", refund.Status)
+	}
+
+	return &PaymentResult{Provider: g.Name(), TransactionID: transactionID, Status: PaymentStatusRefunded}, nil
+}
+
+// Void cancels an uncaptured PaymentIntent
+func (g *StripePaymentGateway) Void(ctx context.Context, transactionID string) (*PaymentResult, error) {
+	var intent stripePaymentIntent
+	if err := g.post(ctx, "/v1/payment_intents/"+url.PathEscape(transactionID)+"/cancel", url.Values{}, "void-"+transactionID, &intent); err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(&intent)
+}
+
+// VerifyWebhook checks the Stripe-Signature header (t=timestamp,v1=signature)
+func (g *StripePaymentGateway) VerifyWebhook(ctx context.Context, payload []byte, headers http.Header) error {
+	if g.webhookSecret == "" {
+		return errors.New("stripe webhook secret is not configured")
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(headers.Get("Stripe-Signature"), ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("missing or malformed signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("malformed signature timestamp")
+	}
+	if time.Since(time.Unix(seconds, 0)).Abs() > stripeSignatureTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(g.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// DecodeWebhook parses a Stripe event for a PaymentIntent
+func (g *StripePaymentGateway) DecodeWebhook(payload []byte) (*PaymentEvent, error) {
+	var raw struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object stripePaymentIntent `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if raw.ID == "" {
+		return nil, errors.New("webhook event ID is required")
+	}
+
+	intentID := raw.Data.Object.ID
+	event := &PaymentEvent{
+		ID:             raw.ID,
+		Type:           raw.Type,
+		TransactionIDs: nonEmpty(intentID),
+		ResourceID:     intentID,
+	}
+
+	switch raw.Type {
+	case "payment_intent.amount_capturable_updated":
+		event.Status = PaymentStatusAuthorized
+	case "payment_intent.succeeded":
+		event.Status = PaymentStatusCaptured
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		event.Status = PaymentStatusFailed
+	}
+
+	return event, nil
+}
+
+// intentResult maps a PaymentIntent status to a gateway result
+func (g *StripePaymentGateway) intentResult(intent *stripePaymentIntent) (*PaymentResult, error) {
+	result := &PaymentResult{Provider: g.Name(), TransactionID: intent.ID}
+
+	switch intent.Status {
+	case "requires_capture":
+		result.Status = PaymentStatusAuthorized
+	case "succeeded":
+		result.Status = PaymentStatusCaptured
+	case "canceled":
+		result.Status = PaymentStatusVoided
+	case "processing", "requires_action":
+		result.Status = PaymentStatusPending
+	default:
+		message := intent.Status
+		if intent.LastPaymentError != nil && intent.LastPaymentError.Message != "" {
+			message = intent.LastPaymentError.Message
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPaymentDeclined, message)
+	}
+
+	return result, nil
+}
+
+// post sends a form-encoded request to the Stripe API and decodes the response
+func (g *StripePaymentGateway) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read stripe response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr stripeError
+		_ = json.Unmarshal(body, &apiErr)
+		if apiErr.Error.Type == "card_error" || resp.StatusCode == http.StatusPaymentRequired {
+			return fmt.Errorf("%w: %s", ErrPaymentDeclined, apiErr.Error.Message)
+		}
+		return fmt.Errorf("stripe error (%d): %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode stripe response: %w", err)
+	}
+	return nil
+}
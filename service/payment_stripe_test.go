@@ -0,0 +1,168 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func newTestStripeGateway(baseURL string) PaymentGateway {
+	return NewStripePaymentGateway(baseURL, "sk_test_123", "whsec_test", "USD", http.DefaultClient)
+}
+
+func TestStripePaymentGateway(t *testing.T) {
+	const (
+		cardDeclined = `{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined."}}`
+		apiError     = `{"error":{"type":"api_error","message":"Something went wrong"}}`
+	)
+
+	runGatewayCases(t, newTestStripeGateway, []gatewayCase{
+		{
+			name: "authorize succeeds",
+			call: authorizeCall(19.99, "pm_card_visa"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents": {
+					status: http.StatusOK,
+					body:   `{"id":"pi_1","status":"requires_capture"}`,
+					check: func(t *testing.T, r *http.Request, body []byte) {
+						if key, _, _ := r.BasicAuth(); key != "sk_test_123" {
+							t.Errorf("authenticated with %q, want the secret key", key)
+						}
+						if got := r.Header.Get("Idempotency-Key"); got != "user-1-1" {
+							t.Errorf("Idempotency-Key = %q, want the payment reference", got)
+						}
+						form, _ := url.ParseQuery(string(body))
+						for field, want := range map[string]string{
+							"amount":         "1999",
+							"currency":       "usd",
+							"payment_method": "pm_card_visa",
+							"capture_method": "manual",
+							"confirm":        "true",
+						} {
+							if got := form.Get(field); got != want {
+								t.Errorf("%s = %q, want %q", field, got, want)
+							}
+						}
+					},
+				},
+			},
+			wantStatus:        PaymentStatusAuthorized,
+			wantTransactionID: "pi_1",
+		},
+		{
+			name: "authorize needing customer action is pending",
+			call: authorizeCall(19.99, "pm_card_3ds"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents": {status: http.StatusOK, body: `{"id":"pi_2","status":"requires_action"}`},
+			},
+			wantStatus:        PaymentStatusPending,
+			wantTransactionID: "pi_2",
+		},
+		{
+			name: "authorize declined",
+			call: authorizeCall(19.99, "pm_card_chargeDeclined"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents": {status: http.StatusPaymentRequired, body: cardDeclined},
+			},
+			wantDeclined: true,
+		},
+		{
+			name: "authorize fails",
+			call: authorizeCall(19.99, "pm_card_visa"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents": {status: http.StatusInternalServerError, body: apiError},
+			},
+		},
+		{
+			name: "capture succeeds",
+			call: captureCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/capture": {
+					status: http.StatusOK,
+					body:   `{"id":"pi_1","status":"succeeded"}`,
+					check: func(t *testing.T, r *http.Request, body []byte) {
+						form, _ := url.ParseQuery(string(body))
+						if got := form.Get("amount_to_capture"); got != "1999" {
+							t.Errorf("amount_to_capture = %q, want 1999", got)
+						}
+					},
+				},
+			},
+			wantStatus:        PaymentStatusCaptured,
+			wantTransactionID: "pi_1",
+		},
+		{
+			name: "capture declined",
+			call: captureCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/capture": {status: http.StatusPaymentRequired, body: cardDeclined},
+			},
+			wantDeclined: true,
+		},
+		{
+			name: "capture fails",
+			call: captureCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/capture": {status: http.StatusInternalServerError, body: apiError},
+			},
+		},
+		{
+			name: "refund succeeds",
+			call: refundCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/refunds": {
+					status: http.StatusOK,
+					body:   `{"id":"re_1","status":"succeeded"}`,
+					check: func(t *testing.T, r *http.Request, body []byte) {
+						form, _ := url.ParseQuery(string(body))
+						if form.Get("payment_intent") != "pi_1" || form.Get("amount") != "1999" {
+							t.Errorf("refund form = %v, want pi_1 for 1999", form)
+						}
+					},
+				},
+			},
+			wantStatus:        PaymentStatusRefunded,
+			wantTransactionID: "pi_1",
+		},
+		{
+			name: "refund declined",
+			call: refundCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/refunds": {status: http.StatusOK, body: `{"id":"re_1","status":"failed"}`},
+			},
+		},
+		{
+			name: "refund fails",
+			call: refundCall("pi_1", 19.99),
+			responses: map[string]standInResponse{
+				"/v1/refunds": {status: http.StatusInternalServerError, body: apiError},
+			},
+		},
+		{
+			name: "void succeeds",
+			call: voidCall("pi_1"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/cancel": {status: http.StatusOK, body: `{"id":"pi_1","status":"canceled"}`},
+			},
+			wantStatus:        PaymentStatusVoided,
+			wantTransactionID: "pi_1",
+		},
+		{
+			name: "void declined",
+			call: voidCall("pi_1"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/cancel": {
+					status: http.StatusBadRequest,
+					body:   `{"error":{"type":"invalid_request_error","code":"payment_intent_unexpected_state","message":"This PaymentIntent has already been captured."}}`,
+				},
+			},
+		},
+		{
+			name: "void fails",
+			call: voidCall("pi_1"),
+			responses: map[string]standInResponse{
+				"/v1/payment_intents/pi_1/cancel": {status: http.StatusInternalServerError, body: apiError},
+			},
+		},
+	})
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"health-store/models"
+	"health-store/repositories"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrUnknownPaymentProvider is returned for webhooks of a provider that is not configured
+	ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+	// ErrInvalidWebhook is returned when a webhook fails signature verification or parsing
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// webhookClaimTimeout is how long a delivery may hold an event before another
+// delivery takes it over; it outlasts the payment calls processing makes
+const webhookClaimTimeout = 5 * time.Minute
+
+// PaymentWebhookService handles asynchronous payment confirmations
+type PaymentWebhookService struct {
+	eventRepo    *repositories.PaymentEventRepository
+	gateway      PaymentGateway
+	orderService *OrderService
+}
+
+// NewPaymentWebhookService creates a new payment webhook service
+func NewPaymentWebhookService(eventRepo *repositories.PaymentEventRepository, gateway PaymentGateway, orderService *OrderService) *PaymentWebhookService {
+	return &PaymentWebhookService{
+		eventRepo:    eventRepo,
+		gateway:      gateway,
+		orderService: orderService,
+	}
+}
+
+// HandleWebhook verifies, stores and processes a webhook delivery. Deliveries
+// of an event that was already processed or ignored are acknowledged without
+// side effects; events that failed, or were stored but never finished
+// processing, are processed again by one delivery at a time.
+func (s *PaymentWebhookService) HandleWebhook(provider string, payload []byte, headers http.Header) error {
+	if provider != s.gateway.Name() {
+		return ErrUnknownPaymentProvider
+	}
+
+	ctx, cancel := paymentContext()
+	defer cancel()
+
+	if err := s.gateway.VerifyWebhook(ctx, payload, headers); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	event, err := s.gateway.DecodeWebhook(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	record := &models.PaymentWebhookEvent{
+		Provider:  provider,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		Status:    "received",
+	}
+	if len(event.TransactionIDs) > 0 {
+		record.TransactionID = event.TransactionIDs[0]
+	}
+
+	if err := s.eventRepo.Create(record); err != nil {
+		// The unique (provider, event_id) index rejects duplicate deliveries
+		existing, findErr := s.eventRepo.FindByProviderEventID(provider, event.ID)
+		if findErr != nil {
+			return err
+		}
+		record = existing
+	}
+
+	// Deliveries of an event that is finished, or being processed by another
+	// delivery, are acknowledged without applying it again
+	claimed, err := s.eventRepo.Claim(record.ID, time.Now().Add(-webhookClaimTimeout))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+	record.Status = "processing"
+
+	return s.process(record, event)
+}
+
+// ReplayEvent processes a stored webhook event again without re-verifying its signature
+func (s *PaymentWebhookService) ReplayEvent(id uint) (*models.PaymentWebhookEvent, error) {
+	record, err := s.eventRepo.FindByID(id)
+	if err != nil {
+		return nil, errors.New("payment event not found")
+	}
+	if record.Provider != s.gateway.Name() {
+		return nil, ErrUnknownPaymentProvider
+	}
+
+	event, err := s.gateway.DecodeWebhook([]byte(record.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	err = s.process(record, event)
+	return record, err
+}
+
+// GetEvents gets stored webhook events, optionally filtered by status
+func (s *PaymentWebhookService) GetEvents(status string) ([]models.PaymentWebhookEvent, error) {
+	return s.eventRepo.FindAll(status)
+}
+
+// process applies an event to its order and records the outcome
+func (s *PaymentWebhookService) process(record *models.PaymentWebhookEvent, event *PaymentEvent) error {
+	orderID, applied, err := s.orderService.ApplyPaymentEvent(event)
+
+	now := time.Now()
+	record.ProcessedAt = &now
+	record.Error = ""
+	if orderID != 0 {
+		record.OrderID = &orderID
+	}
+
+	switch {
+	case err != nil:
+		record.Status = "failed"
+		record.Error = err.Error()
+	case applied:
+		record.Status = "processed"
+	default:
+		record.Status = "ignored"
+	}
+
+	if updateErr := s.eventRepo.Update(record); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
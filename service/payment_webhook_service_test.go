@@ -0,0 +1,179 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"health-store/models"
+	"health-store/repositories"
+)
+
+func TestHandleWebhookReprocessesUnfinishedEvents(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	webhooks := NewPaymentWebhookService(repositories.NewPaymentEventRepository(db), gateway, orders)
+	user := createTestCustomer(t, db, "erin")
+	fillTestCart(t, db, user, map[*models.Product]int{createTestProduct(t, db, "Zinc", 6.00, 5): 1})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc", PaymentToken: FakeTokenPending})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if order.Status != "awaiting_payment" {
+		t.Fatalf("order status = %q, want awaiting_payment", order.Status)
+	}
+
+	// The first delivery was stored but never finished processing
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","transaction_id":"` + order.PaymentTransactionID + `"}`)
+	stored := &models.PaymentWebhookEvent{Provider: gateway.Name(), EventID: "evt_1", EventType: "payment.captured", Payload: string(payload), Status: "received"}
+	if err := db.Create(stored).Error; err != nil {
+		t.Fatalf("store event: %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Set(FakeSignatureHeader, gateway.Sign(payload))
+	if err := webhooks.HandleWebhook(gateway.Name(), payload, headers); err != nil {
+		t.Fatalf("HandleWebhook: %v", err)
+	}
+
+	paid, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if paid.Status != "paid" {
+		t.Errorf("order status = %q, want paid", paid.Status)
+	}
+	if err := db.First(stored, stored.ID).Error; err != nil {
+		t.Fatalf("load event: %v", err)
+	}
+	if stored.Status != "processed" {
+		t.Errorf("event status = %q, want processed", stored.Status)
+	}
+
+	// Later deliveries of the processed event change nothing
+	if err := webhooks.HandleWebhook(gateway.Name(), payload, headers); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if got := countRows(t, db, &models.PaymentWebhookEvent{}); got != 1 {
+		t.Errorf("stored events = %d, want 1", got)
+	}
+}
+
+func TestHandleWebhookSkipsEventsBeingProcessed(t *testing.T) {
+	db := newTestDB(t)
+	orders, gateway := newTestOrderService(db)
+	webhooks := NewPaymentWebhookService(repositories.NewPaymentEventRepository(db), gateway, orders)
+	user := createTestCustomer(t, db, "frank")
+	fillTestCart(t, db, user, map[*models.Product]int{createTestProduct(t, db, "Iron", 7.00, 5): 1})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc", PaymentToken: FakeTokenPending})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	// Another delivery of the event claimed it and is still processing it
+	payload := []byte(`{"id":"evt_2","type":"payment.captured","transaction_id":"` + order.PaymentTransactionID + `"}`)
+	stored := &models.PaymentWebhookEvent{Provider: gateway.Name(), EventID: "evt_2", EventType: "payment.captured", Payload: string(payload), Status: "processing"}
+	if err := db.Create(stored).Error; err != nil {
+		t.Fatalf("store event: %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Set(FakeSignatureHeader, gateway.Sign(payload))
+	if err := webhooks.HandleWebhook(gateway.Name(), payload, headers); err != nil {
+		t.Fatalf("HandleWebhook: %v", err)
+	}
+	if got, _ := orders.GetOrderByID(order.ID); got.Status != "awaiting_payment" {
+		t.Errorf("order status = %q, want awaiting_payment while the event is claimed", got.Status)
+	}
+
+	// A claim that outlived the timeout was left by a delivery that died
+	stale := time.Now().Add(-2 * webhookClaimTimeout)
+	if err := db.Model(stored).UpdateColumn("updated_at", stale).Error; err != nil {
+		t.Fatalf("age claim: %v", err)
+	}
+	if err := webhooks.HandleWebhook(gateway.Name(), payload, headers); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if got, _ := orders.GetOrderByID(order.ID); got.Status != "paid" {
+		t.Errorf("order status = %q, want paid after the stale claim is taken over", got.Status)
+	}
+}
+
+func TestApplyPaymentEventIgnoresCancelledOrder(t *testing.T) {
+	db := newTestDB(t)
+	locked := recordLockedTables(t, db)
+	orders, _ := newTestOrderService(db)
+	user := createTestCustomer(t, db, "grace")
+	magnesium := createTestProduct(t, db, "Magnesium", 5.00, 5)
+	fillTestCart(t, db, user, map[*models.Product]int{magnesium: 2})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc", PaymentToken: FakeTokenPending})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	// A copy loaded before the order was cancelled
+	loaded, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if err := orders.CancelOrder(order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	if _, applied, err := orders.ApplyPaymentEvent(&PaymentEvent{Status: PaymentStatusFailed, TransactionIDs: []string{order.PaymentTransactionID}}); err != nil || applied {
+		t.Errorf("failed event applied = %v, err = %v, want it ignored", applied, err)
+	}
+	if err := orders.capturePayment(loaded); err == nil {
+		t.Error("captured the payment of a cancelled order")
+	}
+
+	if got := productStock(t, db, magnesium.ID); got != 5 {
+		t.Errorf("stock = %d, want 5 restored once", got)
+	}
+	if got := countRows(t, db.Where("reason = ?", models.StockReasonOrderCancel), &models.StockMovement{}); got != 1 {
+		t.Errorf("cancel movements = %d, want 1", got)
+	}
+	if !locked("orders") {
+		t.Error("orders were not read with FOR UPDATE")
+	}
+}
+
+func TestApplyPaymentEventFailsOrderAwaitingVerification(t *testing.T) {
+	db := newTestDB(t)
+	orders, _ := newTestOrderService(db)
+	user := createTestCustomer(t, db, "hana")
+	antibiotic := createTestProduct(t, db, "Amoxicillin", 11.00, 5)
+	if err := db.Model(antibiotic).Update("requires_prescription", true).Error; err != nil {
+		t.Fatalf("require prescription: %v", err)
+	}
+	fillTestCart(t, db, user, map[*models.Product]int{antibiotic: 2})
+
+	order, err := orders.PlaceOrder(user.ID, models.PlaceOrderRequest{PaymentMethod: "cc", PrescriptionURL: "/uploads/rx.pdf"})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if order.Status != "pending_verification" {
+		t.Fatalf("order status = %q, want pending_verification", order.Status)
+	}
+
+	_, applied, err := orders.ApplyPaymentEvent(&PaymentEvent{Status: PaymentStatusFailed, TransactionIDs: []string{order.PaymentTransactionID}})
+	if err != nil || !applied {
+		t.Fatalf("failed event applied = %v, err = %v, want it applied", applied, err)
+	}
+
+	failed, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if failed.Status != "failed" {
+		t.Errorf("order status = %q, want failed", failed.Status)
+	}
+	if failed.Prescription == nil || failed.Prescription.Status != models.PrescriptionStatusWithdrawn {
+		t.Errorf("prescription = %+v, want it withdrawn", failed.Prescription)
+	}
+	if got := productStock(t, db, antibiotic.ID); got != 5 {
+		t.Errorf("stock = %d, want 5", got)
+	}
+}
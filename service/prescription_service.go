@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"health-store/models"
+	"health-store/repositories"
+	"health-store/utils"
+	"time"
+)
+
+var (
+	// ErrPrescriptionNotFound is returned for unknown prescriptions
+	ErrPrescriptionNotFound = errors.New("prescription not found")
+	// ErrPrescriptionReviewed is returned when reviewing a prescription that is no longer awaiting review
+	ErrPrescriptionReviewed = errors.New("prescription is not awaiting review")
+)
+
+// PrescriptionService runs the pharmacist review of prescriptions that hold
+// orders of prescription-only products
+type PrescriptionService struct {
+	prescriptionRepo repositories.PrescriptionRepositoryInterface
+	uow              repositories.UnitOfWorkInterface
+	orders           *OrderService
+	mailer           Mailer
+}
+
+// NewPrescriptionService creates a new prescription service
+func NewPrescriptionService(
+	prescriptionRepo repositories.PrescriptionRepositoryInterface,
+	uow repositories.UnitOfWorkInterface,
+	orders *OrderService,
+	mailer Mailer,
+) *PrescriptionService {
+	return &PrescriptionService{
+		prescriptionRepo: prescriptionRepo,
+		uow:              uow,
+		orders:           orders,
+		mailer:           mailer,
+	}
+}
+
+// ListPrescriptions lists prescriptions, oldest first by default so the
+// review queue is worked in order
+func (s *PrescriptionService) ListPrescriptions(params models.ListParams) (*models.Page[models.Prescription], error) {
+	return s.prescriptionRepo.List(params)
+}
+
+// GetPrescription gets a prescription with its order and customer
+func (s *PrescriptionService) GetPrescription(id uint) (*models.Prescription, error) {
+	prescription, err := s.prescriptionRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrPrescriptionNotFound
+	}
+	return prescription, nil
+}
+
+// ApprovePrescription approves a prescription and releases its order: cash
+// on delivery orders become pending, and authorized payments are captured.
+func (s *PrescriptionService) ApprovePrescription(id, reviewerID uint) (*models.Prescription, error) {
+	var prescription *models.Prescription
+	var order *models.Order
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		prescription, order, err = s.startReview(repos, id, reviewerID)
+		if err != nil {
+			return err
+		}
+
+		prescription.Status = models.PrescriptionStatusApproved
+		if err := repos.Prescriptions.Update(prescription); err != nil {
+			return err
+		}
+
+		// Orders with a payment leave verification when it is captured
+		if order.PaymentTransactionID != "" {
+			return nil
+		}
+		order.Status = "pending"
+		return repos.Orders.UpdateStatus(order.ID, order.Status)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.PaymentTransactionID != "" {
+		if err := s.orders.capturePayment(order); err != nil {
+			return prescription, err
+		}
+	}
+	return prescription, nil
+}
+
+// RejectPrescription rejects a prescription, cancels its order, returns the
+// items to stock and voids the payment. The customer is told the reason.
+func (s *PrescriptionService) RejectPrescription(id, reviewerID uint, req models.PrescriptionRejectRequest) (*models.Prescription, error) {
+	var prescription *models.Prescription
+	var order *models.Order
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		prescription, order, err = s.startReview(repos, id, reviewerID)
+		if err != nil {
+			return err
+		}
+
+		prescription.Status = models.PrescriptionStatusRejected
+		prescription.RejectionReason = req.Reason
+		if err := repos.Prescriptions.Update(prescription); err != nil {
+			return err
+		}
+		return restoreOrder(repos, order.ID, "cancelled")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.PaymentTransactionID != "" {
+		s.orders.voidPayment(order.PaymentTransactionID)
+	}
+
+	// The order is already cancelled, so a failed email is only logged
+	if prescription.Order != nil {
+		customer := prescription.Order.User
+		if err := s.mailer.Send(Email{
+			To:      customer.Email,
+			Subject: fmt.Sprintf("Your Health Store order #%d was cancelled", order.ID),
+			Body: fmt.Sprintf("Hello %s,\n\nOur pharmacist could not accept the prescription for order #%d, so the order was cancelled "+
+				"and any payment was released.\n\nReason: %s\n\nYou are welcome to order again with a valid prescription.\n",
+				customer.Username, order.ID, req.Reason),
+		}); err != nil {
+			utils.LogError(err, fmt.Sprintf("Failed to email rejection of prescription %d", prescription.ID))
+		}
+	}
+	return prescription, nil
+}
+
+// startReview loads a prescription awaiting review and locks its order, and
+// records who reviews it and when
+func (s *PrescriptionService) startReview(repos *repositories.TxRepositories, id, reviewerID uint) (*models.Prescription, *models.Order, error) {
+	prescription, err := repos.Prescriptions.FindByID(id)
+	if err != nil {
+		return nil, nil, ErrPrescriptionNotFound
+	}
+	if prescription.Status != models.PrescriptionStatusPending {
+		return nil, nil, ErrPrescriptionReviewed
+	}
+
+	order, err := repos.Orders.FindByIDForUpdate(prescription.OrderID)
+	if err != nil {
+		return nil, nil, ErrPrescriptionNotFound
+	}
+	if order.Status != "pending_verification" {
+		return nil, nil, ErrPrescriptionReviewed
+	}
+
+	now := time.Now()
+	prescription.ReviewerID = &reviewerID
+	prescription.ReviewedAt = &now
+	return prescription, order, nil
+}
@@ -1,22 +1,57 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"health-store/models"
 	"health-store/repositories"
+	"time"
 )
 
+var (
+	// ErrProductNotFound is returned for unknown products and for products of another shop
+	ErrProductNotFound = errors.New("product not found")
+	// ErrProductUnavailable is returned when buying a product whose shop is inactive, or a recalled product or variant
+	ErrProductUnavailable = errors.New("product is not available")
+	// ErrInvalidProductCursor is returned for search cursors that were not issued for the requested sort order
+	ErrInvalidProductCursor = errors.New("invalid cursor")
+	// ErrVariantNotFound is returned for unknown variants and for variants of another product
+	ErrVariantNotFound = errors.New("product variant not found")
+	// ErrVariantRequired is returned when buying a product with variants without choosing one
+	ErrVariantRequired = errors.New("a variant must be chosen for this product")
+	// ErrVariantSKUTaken is returned when a variant SKU is already used by another variant
+	ErrVariantSKUTaken = errors.New("SKU is already in use")
+	// ErrVariantOrdered is returned when deleting a variant that appears on orders
+	ErrVariantOrdered = errors.New("variant has been ordered and can not be deleted, set its stock to 0 instead")
+	// ErrVariantStockManaged is returned when setting the stock of a product with variants directly
+	ErrVariantStockManaged = errors.New("stock of a product with variants is managed per variant")
+	// ErrLotStockManaged is returned when setting the stock of a product or variant tracked by lot directly
+	ErrLotStockManaged = errors.New("stock tracked by lot is changed by receiving or correcting its lots")
+)
+
+// defaultProductSearchLimit is the page size of catalog searches that do not set one
+const defaultProductSearchLimit = 20
+
 // ProductService handles business logic for products
 type ProductService struct {
-	productRepo  repositories.ProductRepositoryInterface
-	categoryRepo repositories.CategoryRepositoryInterface
+	productRepo   repositories.ProductRepositoryInterface
+	categoryRepo  repositories.CategoryRepositoryInterface
+	cartRepo      repositories.CartRepositoryInterface
+	inventoryRepo repositories.InventoryRepositoryInterface
+	shopRepo      *repositories.ShopRepository
+	uow           repositories.UnitOfWorkInterface
 }
 
 // NewProductService creates a new product service
-func NewProductService(productRepo repositories.ProductRepositoryInterface, categoryRepo repositories.CategoryRepositoryInterface) *ProductService {
+func NewProductService(productRepo repositories.ProductRepositoryInterface, categoryRepo repositories.CategoryRepositoryInterface, cartRepo repositories.CartRepositoryInterface, inventoryRepo repositories.InventoryRepositoryInterface, shopRepo *repositories.ShopRepository, uow repositories.UnitOfWorkInterface) *ProductService {
 	return &ProductService{
-		productRepo:  productRepo,
-		categoryRepo: categoryRepo,
+		productRepo:   productRepo,
+		categoryRepo:  categoryRepo,
+		cartRepo:      cartRepo,
+		inventoryRepo: inventoryRepo,
+		shopRepo:      shopRepo,
+		uow:           uow,
 	}
 }
 
@@ -28,16 +63,40 @@ func (s *ProductService) CreateProduct(req models.ProductCreateRequest) (*models
 		return nil, errors.New("category not found")
 	}
 
+	// Validate that shop exists if the product is sold by a shop
+	if req.ShopID != nil {
+		if _, err := s.shopRepo.FindByID(*req.ShopID); err != nil {
+			return nil, errors.New("shop not found")
+		}
+	}
+
 	product := &models.Product{
-		CategoryID:  req.CategoryID,
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
-		ImageURL:    req.ImageURL,
+		CategoryID:           req.CategoryID,
+		ShopID:               req.ShopID,
+		Name:                 req.Name,
+		Description:          req.Description,
+		Price:                req.Price,
+		Stock:                req.Stock,
+		ImageURL:             req.ImageURL,
+		RequiresPrescription: req.RequiresPrescription,
+		ReorderThreshold:     req.ReorderThreshold,
 	}
 
-	err = s.productRepo.Create(product)
+	// The initial stock opens the product's stock ledger
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		if err := repos.Products.Create(product); err != nil {
+			return err
+		}
+		if product.Stock == 0 {
+			return nil
+		}
+		return repos.StockMovements.Create(&models.StockMovement{
+			ProductID: product.ID,
+			Quantity:  product.Stock,
+			Reason:    models.StockReasonAdminAdjust,
+			Note:      "initial stock",
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -47,17 +106,241 @@ func (s *ProductService) CreateProduct(req models.ProductCreateRequest) (*models
 
 // GetProductByID gets a product by ID
 func (s *ProductService) GetProductByID(id uint) (*models.Product, error) {
-	return s.productRepo.FindByID(id)
+	product, err := s.productRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []models.Product{*product}
+	if err := s.setAvailableStock(products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// ListProducts gets a page of products, including products of inactive shops
+func (s *ProductService) ListProducts(params models.ListParams) (*models.Page[models.Product], error) {
+	page, err := s.productRepo.List(params)
+	if err != nil {
+		return nil, err
+	}
+	return page, s.setAvailableStock(page.Data)
+}
+
+// SearchCatalogProducts finds a page of the products on sale matching the
+// search, with the total number of matches and how many fall in each category
+func (s *ProductService) SearchCatalogProducts(req models.ProductSearchRequest) (*models.ProductSearchResult, error) {
+	sort := req.Sort
+	if sort == "" || (sort == models.ProductSortRelevance && req.Query == "") {
+		sort = models.ProductSortNewest
+		if req.Query != "" {
+			sort = models.ProductSortRelevance
+		}
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultProductSearchLimit
+	}
+
+	var after *models.ProductSearchCursor
+	if req.Cursor != "" {
+		cursor, err := decodeProductCursor(req.Cursor)
+		if err != nil || cursor.Sort != sort {
+			return nil, ErrInvalidProductCursor
+		}
+		after = cursor
+	}
+
+	// Fetch one extra hit to learn whether there is a next page
+	hits, err := s.productRepo.Search(req, sort, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.ProductSearchResult{Products: []models.Product{}}
+	if len(hits) > limit {
+		hits = hits[:limit]
+		last := hits[len(hits)-1]
+		result.NextCursor = encodeProductCursor(models.ProductSearchCursor{Sort: sort, Value: last.SortValue, ID: last.ID})
+	}
+
+	if len(hits) > 0 {
+		ids := make([]uint, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.ID
+		}
+		products, err := s.productRepo.FindByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		// Put the products back in search order
+		byID := make(map[uint]models.Product, len(products))
+		for _, product := range products {
+			byID[product.ID] = product
+		}
+		for _, id := range ids {
+			if product, ok := byID[id]; ok {
+				result.Products = append(result.Products, product)
+			}
+		}
+		if err := s.setAvailableStock(result.Products); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Total, err = s.productRepo.CountSearch(req); err != nil {
+		return nil, err
+	}
+	if result.Facets.Categories, err = s.productRepo.SearchCategoryFacets(req); err != nil {
+		return nil, err
+	}
+	if result.Facets.Categories == nil {
+		result.Facets.Categories = []models.CategoryFacet{}
+	}
+
+	return result, nil
+}
+
+// encodeProductCursor turns a search position into an opaque cursor
+func encodeProductCursor(cursor models.ProductSearchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeProductCursor reads a cursor made by encodeProductCursor
+func decodeProductCursor(value string) (*models.ProductSearchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor models.ProductSearchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// GetCatalogProduct gets a product if it is on sale
+func (s *ProductService) GetCatalogProduct(id uint) (*models.Product, error) {
+	product, err := s.productRepo.FindListedByID(id)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	products := []models.Product{*product}
+	if err := s.setAvailableStock(products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// GetShopProducts gets the products of a shop
+func (s *ProductService) GetShopProducts(shopID uint) ([]models.Product, error) {
+	products, err := s.productRepo.FindByShopID(shopID)
+	if err != nil {
+		return nil, err
+	}
+	return products, s.setAvailableStock(products)
 }
 
-// GetAllProducts gets all products
-func (s *ProductService) GetAllProducts() ([]models.Product, error) {
-	return s.productRepo.FindAll()
+// GetShopProduct gets a product of a shop. Products of other shops are not found.
+func (s *ProductService) GetShopProduct(shopID, productID uint) (*models.Product, error) {
+	product, err := s.GetProductByID(productID)
+	if err != nil || product.ShopID == nil || *product.ShopID != shopID {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
 }
 
 // GetProductsByCategory gets products by category
 func (s *ProductService) GetProductsByCategory(categoryID uint) ([]models.Product, error) {
-	return s.productRepo.FindByCategory(categoryID)
+	products, err := s.productRepo.FindByCategory(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return products, s.setAvailableStock(products)
+}
+
+// setAvailableStock fills AvailableStock with on-hand stock minus the units
+// of expired lots and the quantity held by active cart reservations
+func (s *ProductService) setAvailableStock(products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(products))
+	for i := range products {
+		ids[i] = products[i].ID
+	}
+
+	reserved, err := s.cartRepo.FindReservedQuantities(ids, 0)
+	if err != nil {
+		return err
+	}
+	expired, err := s.inventoryRepo.FindExpiredQuantities(ids, startOfDay(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	var variants []models.ProductVariant
+	for i := range products {
+		available := products[i].Stock - expired[products[i].ID] - reserved[products[i].ID]
+		if available < 0 {
+			available = 0
+		}
+		products[i].AvailableStock = available
+		variants = append(variants, products[i].Variants...)
+	}
+	if len(variants) == 0 {
+		return nil
+	}
+
+	// Copy the variant stock back into the products
+	if err := s.setVariantAvailableStock(variants); err != nil {
+		return err
+	}
+	available := make(map[uint]int, len(variants))
+	for _, variant := range variants {
+		available[variant.ID] = variant.AvailableStock
+	}
+	for i := range products {
+		for j := range products[i].Variants {
+			products[i].Variants[j].AvailableStock = available[products[i].Variants[j].ID]
+		}
+	}
+	return nil
+}
+
+// setVariantAvailableStock fills AvailableStock of variants with on-hand
+// stock minus the units of expired lots and the quantity held by active cart
+// reservations
+func (s *ProductService) setVariantAvailableStock(variants []models.ProductVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(variants))
+	for i := range variants {
+		ids[i] = variants[i].ID
+	}
+
+	reserved, err := s.cartRepo.FindReservedVariantQuantities(ids, 0)
+	if err != nil {
+		return err
+	}
+	expired, err := s.inventoryRepo.FindExpiredVariantQuantities(ids, startOfDay(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	for i := range variants {
+		available := variants[i].Stock - expired[variants[i].ID] - reserved[variants[i].ID]
+		if available < 0 {
+			available = 0
+		}
+		variants[i].AvailableStock = available
+	}
+	return nil
 }
 
 // UpdateProduct updates a product
@@ -85,14 +368,42 @@ func (s *ProductService) UpdateProduct(id uint, req models.ProductUpdateRequest)
 	if req.Price != 0 {
 		product.Price = req.Price
 	}
-	if req.Stock != 0 {
-		product.Stock = req.Stock
+	if req.Stock != 0 && len(product.Variants) > 0 {
+		return nil, ErrVariantStockManaged
 	}
 	if req.ImageURL != "" {
 		product.ImageURL = req.ImageURL
 	}
+	if req.RequiresPrescription != nil {
+		product.RequiresPrescription = *req.RequiresPrescription
+	}
+	if req.ReorderThreshold != nil {
+		product.ReorderThreshold = *req.ReorderThreshold
+	}
 
-	err = s.productRepo.Update(product)
+	// Lock the product so orders placed meanwhile are not overwritten, and
+	// record a change of stock in the ledger
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		locked, err := lockProduct(repos, product.ID)
+		if err != nil {
+			return err
+		}
+		product.Stock = locked.Stock
+		if req.Stock != 0 && req.Stock != locked.Stock {
+			if err := checkStockNotLotTracked(repos, product.ID, nil); err != nil {
+				return err
+			}
+			product.Stock = req.Stock
+			if err := repos.StockMovements.Create(&models.StockMovement{
+				ProductID: product.ID,
+				Quantity:  req.Stock - locked.Stock,
+				Reason:    models.StockReasonAdminAdjust,
+			}); err != nil {
+				return err
+			}
+		}
+		return repos.Products.Update(product)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +411,19 @@ func (s *ProductService) UpdateProduct(id uint, req models.ProductUpdateRequest)
 	return product, nil
 }
 
+// checkStockNotLotTracked refuses to set the stock of a product, or variant,
+// tracked by lot, as its stock must stay the units left in its lots
+func checkStockNotLotTracked(repos *repositories.TxRepositories, productID uint, variantID *uint) error {
+	tracked, err := repos.Inventory.HasLots(productID, variantID)
+	if err != nil {
+		return err
+	}
+	if tracked {
+		return ErrLotStockManaged
+	}
+	return nil
+}
+
 // DeleteProduct deletes a product
 func (s *ProductService) DeleteProduct(id uint) error {
 	_, err := s.productRepo.FindByID(id)
@@ -124,7 +448,261 @@ func (s *ProductService) CheckProductStock(productID uint, quantity int) error {
 	return nil
 }
 
-// ReduceProductStock reduces product stock
-func (s *ProductService) ReduceProductStock(productID uint, quantity int) error {
-	return s.productRepo.ReduceStock(productID, quantity)
+// GetProductVariants gets the variants of a product
+func (s *ProductService) GetProductVariants(productID uint) ([]models.ProductVariant, error) {
+	if _, err := s.productRepo.FindByID(productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	variants, err := s.productRepo.FindVariantsByProductID(productID)
+	if err != nil {
+		return nil, err
+	}
+	return variants, s.setVariantAvailableStock(variants)
+}
+
+// GetProductVariant gets a variant of a product. Variants of other products are not found.
+func (s *ProductService) GetProductVariant(productID, variantID uint) (*models.ProductVariant, error) {
+	variant, err := s.productRepo.FindVariantByID(productID, variantID)
+	if err != nil {
+		return nil, ErrVariantNotFound
+	}
+
+	variants := []models.ProductVariant{*variant}
+	if err := s.setVariantAvailableStock(variants); err != nil {
+		return nil, err
+	}
+	return &variants[0], nil
+}
+
+// CreateProductVariant adds a variant to a product. The product's stock
+// becomes the total stock of its variants.
+func (s *ProductService) CreateProductVariant(productID uint, req models.ProductVariantCreateRequest) (*models.ProductVariant, error) {
+	if _, err := s.productRepo.FindByID(productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+	if err := s.checkVariantSKU(req.SKU, 0); err != nil {
+		return nil, err
+	}
+
+	variant := &models.ProductVariant{
+		ProductID: productID,
+		SKU:       req.SKU,
+		Attributes: models.VariantAttributes{
+			Size:      req.Size,
+			Color:     req.Color,
+			PackCount: req.PackCount,
+		},
+		Price:    req.Price,
+		Stock:    req.Stock,
+		ImageURL: req.ImageURL,
+	}
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		product, err := lockProduct(repos, productID)
+		if err != nil {
+			return err
+		}
+		if err := repos.Products.CreateVariant(variant); err != nil {
+			return err
+		}
+		if variant.Stock != 0 {
+			if err := repos.StockMovements.Create(&models.StockMovement{
+				ProductID: productID,
+				VariantID: &variant.ID,
+				Quantity:  variant.Stock,
+				Reason:    models.StockReasonAdminAdjust,
+				Note:      "variant created",
+			}); err != nil {
+				return err
+			}
+		}
+		return syncVariantStock(repos, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	variant.AvailableStock = variant.Stock
+	return variant, nil
+}
+
+// UpdateProductVariant updates a variant of a product
+func (s *ProductService) UpdateProductVariant(productID, variantID uint, req models.ProductVariantUpdateRequest) (*models.ProductVariant, error) {
+	variant, err := s.productRepo.FindVariantByID(productID, variantID)
+	if err != nil {
+		return nil, ErrVariantNotFound
+	}
+
+	if req.SKU != "" && req.SKU != variant.SKU {
+		if err := s.checkVariantSKU(req.SKU, variant.ID); err != nil {
+			return nil, err
+		}
+		variant.SKU = req.SKU
+	}
+	if req.Size != nil {
+		variant.Attributes.Size = *req.Size
+	}
+	if req.Color != nil {
+		variant.Attributes.Color = *req.Color
+	}
+	if req.PackCount != nil {
+		variant.Attributes.PackCount = *req.PackCount
+	}
+	if req.Price != nil {
+		variant.Price = *req.Price
+	}
+	if req.ImageURL != "" {
+		variant.ImageURL = req.ImageURL
+	}
+
+	// Lock the product and its variants so orders placed meanwhile are not
+	// overwritten, and record a change of stock in the ledger
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		product, err := lockProduct(repos, productID)
+		if err != nil {
+			return err
+		}
+		locked := product.FindVariant(variant.ID)
+		if locked == nil {
+			return ErrVariantNotFound
+		}
+		variant.Stock = locked.Stock
+		if req.Stock != nil && *req.Stock != locked.Stock {
+			if err := checkStockNotLotTracked(repos, productID, &variant.ID); err != nil {
+				return err
+			}
+			variant.Stock = *req.Stock
+			if err := repos.StockMovements.Create(&models.StockMovement{
+				ProductID: productID,
+				VariantID: &variant.ID,
+				Quantity:  *req.Stock - locked.Stock,
+				Reason:    models.StockReasonAdminAdjust,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := repos.Products.UpdateVariant(variant); err != nil {
+			return err
+		}
+		return syncVariantStock(repos, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	variants := []models.ProductVariant{*variant}
+	if err := s.setVariantAvailableStock(variants); err != nil {
+		return nil, err
+	}
+	return &variants[0], nil
+}
+
+// DeleteProductVariant deletes a variant of a product and the cart lines
+// holding it. Variants that were ordered are kept for the order history.
+func (s *ProductService) DeleteProductVariant(productID, variantID uint) error {
+	variant, err := s.productRepo.FindVariantByID(productID, variantID)
+	if err != nil {
+		return ErrVariantNotFound
+	}
+
+	ordered, err := s.productRepo.IsVariantOrdered(variant.ID)
+	if err != nil {
+		return err
+	}
+	if ordered {
+		return ErrVariantOrdered
+	}
+
+	return s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		product, err := lockProduct(repos, productID)
+		if err != nil {
+			return err
+		}
+		locked := product.FindVariant(variant.ID)
+		if locked == nil {
+			return ErrVariantNotFound
+		}
+		if err := repos.Products.DeleteVariant(variant.ID); err != nil {
+			return err
+		}
+		if locked.Stock != 0 {
+			if err := repos.StockMovements.Create(&models.StockMovement{
+				ProductID: productID,
+				VariantID: &variant.ID,
+				Quantity:  -locked.Stock,
+				Reason:    models.StockReasonAdminAdjust,
+				Note:      "variant deleted",
+			}); err != nil {
+				return err
+			}
+		}
+		return syncVariantStock(repos, product)
+	})
+}
+
+// lockProduct finds a product with its variants and locks them until the
+// surrounding transaction ends
+func lockProduct(repos *repositories.TxRepositories, productID uint) (*models.Product, error) {
+	products, err := repos.Products.FindByIDsForUpdate([]uint{productID})
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, ErrProductNotFound
+	}
+	return &products[0], nil
+}
+
+// syncVariantStock sets the stock of a product to the total stock of its
+// variants after the stock of a variant moved. product is the product as it
+// was locked before. Stock the product held apart from its variants, as it
+// does before its first variant is added, is written off in the ledger.
+func syncVariantStock(repos *repositories.TxRepositories, product *models.Product) error {
+	if err := repos.Products.SyncVariantStock(product.ID); err != nil {
+		return err
+	}
+
+	apart := product.Stock
+	for _, variant := range product.Variants {
+		apart -= variant.Stock
+	}
+	if apart == 0 {
+		return nil
+	}
+	return repos.StockMovements.Create(&models.StockMovement{
+		ProductID: product.ID,
+		Quantity:  -apart,
+		Reason:    models.StockReasonAdminAdjust,
+		Note:      "stock managed per variant",
+	})
+}
+
+// checkVariantSKU verifies that no variant other than excludeID uses sku
+func (s *ProductService) checkVariantSKU(sku string, excludeID uint) error {
+	taken, err := s.productRepo.ExistsVariantSKU(sku, excludeID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrVariantSKUTaken
+	}
+	return nil
+}
+
+// resolveVariant returns the variant a cart line buys: nil for products
+// without variants, or the variant named by variantID, which products with
+// variants require. Variants of the product must be loaded.
+func resolveVariant(product *models.Product, variantID *uint) (*models.ProductVariant, error) {
+	if variantID == nil {
+		if len(product.Variants) > 0 {
+			return nil, ErrVariantRequired
+		}
+		return nil, nil
+	}
+
+	variant := product.FindVariant(*variantID)
+	if variant == nil {
+		return nil, ErrVariantNotFound
+	}
+	return variant, nil
 }
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"health-store/models"
+	"health-store/repositories"
+)
+
+func TestExpiredLotUnitsAreNotAvailable(t *testing.T) {
+	db := newTestDB(t)
+	uow := repositories.NewUnitOfWork(db)
+	products := NewProductService(
+		repositories.NewProductRepository(db),
+		repositories.NewCategoryRepository(db),
+		repositories.NewCartRepository(db),
+		repositories.NewInventoryRepository(db),
+		repositories.NewShopRepository(db),
+		uow,
+	)
+	carts := NewCartService(repositories.NewCartRepository(db), repositories.NewProductRepository(db), uow, 30*time.Minute, time.Hour)
+	user := createTestCustomer(t, db, "ivan")
+	drops := createTestProduct(t, db, "Eye Drops", 6.50, 5)
+
+	// 3 of the 5 units in stock are in a lot that expired yesterday
+	today := startOfDay(time.Now())
+	for _, lot := range []models.InventoryLot{
+		{ProductID: drops.ID, LotNumber: "ED-OLD", ExpiryDate: today.AddDate(0, 0, -1), Quantity: 3, ReceivedAt: today.AddDate(0, -6, 0)},
+		{ProductID: drops.ID, LotNumber: "ED-NEW", ExpiryDate: today.AddDate(0, 6, 0), Quantity: 2, ReceivedAt: today},
+	} {
+		if err := db.Create(&lot).Error; err != nil {
+			t.Fatalf("create lot: %v", err)
+		}
+	}
+
+	product, err := products.GetProductByID(drops.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID: %v", err)
+	}
+	if product.Stock != 5 || product.AvailableStock != 2 {
+		t.Errorf("stock = %d, available = %d, want 5 and 2", product.Stock, product.AvailableStock)
+	}
+
+	owner := models.CartOwner{UserID: user.ID}
+	if err := carts.AddToCart(owner, models.CartItem{ProductID: drops.ID, Quantity: 3}); err == nil {
+		t.Error("added units of an expired lot to the cart")
+	}
+	if err := carts.AddToCart(owner, models.CartItem{ProductID: drops.ID, Quantity: 2}); err != nil {
+		t.Errorf("AddToCart of the unexpired units: %v", err)
+	}
+
+	// Stock tracked by lot only changes through its lots
+	if _, err := products.UpdateProduct(drops.ID, models.ProductUpdateRequest{Stock: 10}); !errors.Is(err, ErrLotStockManaged) {
+		t.Errorf("UpdateProduct stock error = %v, want %v", err, ErrLotStockManaged)
+	}
+	if got := productStock(t, db, drops.ID); got != 5 {
+		t.Errorf("stock = %d after the refused update, want 5", got)
+	}
+}
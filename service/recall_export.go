@@ -0,0 +1,283 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"health-store/models"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/creator"
+)
+
+// recallCoverage describes what a recall item covers
+func recallCoverage(item models.RecallItem) string {
+	switch {
+	case item.LotID != nil:
+		return "Lot " + item.LotNumber
+	case item.VariantID != nil:
+		return fmt.Sprintf("Variant #%d", *item.VariantID)
+	default:
+		return "All units"
+	}
+}
+
+// recallNotifiedAt formats when a customer was notified, or "No"
+func recallNotifiedAt(customer models.RecallCustomer) string {
+	if customer.NotifiedAt == nil {
+		return "No"
+	}
+	return customer.NotifiedAt.Format("2006-01-02 15:04")
+}
+
+// recallOrderIDs lists the order IDs of a customer
+func recallOrderIDs(customer models.RecallCustomer) string {
+	ids := make([]string, 0, len(customer.OrderIDs))
+	for _, id := range customer.OrderIDs {
+		ids = append(ids, "#"+strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(ids, " ")
+}
+
+// generateRecallReportCSV creates a CSV recall report
+func generateRecallReportCSV(report *models.RecallReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	recall := report.Recall
+
+	// Write header information
+	writer.Write([]string{"Medical Equipment Store - Recall Report"})
+	writer.Write([]string{"Recall ID", strconv.FormatUint(uint64(recall.ID), 10)})
+	writer.Write([]string{"Severity", recallSeverityLabel(recall.Severity)})
+	writer.Write([]string{"Status", recall.Status})
+	writer.Write([]string{"Reason", recall.Reason})
+	writer.Write([]string{"Issued", recall.CreatedAt.Format("2006-01-02 15:04:05")})
+	writer.Write([]string{"Generated", report.GeneratedAt.Format("2006-01-02 15:04:05")})
+	writer.Write([]string{}) // Empty line
+
+	// Recalled products
+	writer.Write([]string{"Recalled Products"})
+	writer.Write([]string{"Product ID", "Product Name", "Coverage"})
+	for _, item := range recall.Items {
+		writer.Write([]string{
+			strconv.FormatUint(uint64(item.ProductID), 10),
+			item.ProductName,
+			recallCoverage(item),
+		})
+	}
+	writer.Write([]string{}) // Empty line
+
+	// Summary Section
+	writer.Write([]string{"Summary"})
+	writer.Write([]string{"Affected Orders", strconv.Itoa(report.Orders)})
+	writer.Write([]string{"Affected Customers", strconv.Itoa(len(report.Customers))})
+	writer.Write([]string{"Units Sold", strconv.Itoa(report.Units)})
+	writer.Write([]string{"Customers Notified", strconv.Itoa(report.Notified)})
+	writer.Write([]string{}) // Empty line
+
+	// Customers
+	writer.Write([]string{"Customers"})
+	writer.Write([]string{"User ID", "Username", "Email", "Contact Number", "Address", "City", "Orders", "Units", "Notified"})
+	for _, customer := range report.Customers {
+		writer.Write([]string{
+			strconv.FormatUint(uint64(customer.UserID), 10),
+			customer.Username,
+			customer.Email,
+			customer.ContactNumber,
+			customer.Address,
+			customer.City,
+			recallOrderIDs(customer),
+			strconv.Itoa(customer.Units),
+			recallNotifiedAt(customer),
+		})
+	}
+	writer.Write([]string{}) // Empty line
+
+	// Affected order items
+	writer.Write([]string{"Affected Orders"})
+	writer.Write([]string{"Order ID", "Order Date", "Status", "User ID", "Product ID", "Product Name", "SKU", "Lot", "Quantity"})
+	for _, item := range report.Items {
+		writer.Write([]string{
+			strconv.FormatUint(uint64(item.OrderID), 10),
+			item.OrderedAt.Format("2006-01-02 15:04:05"),
+			item.OrderStatus,
+			strconv.FormatUint(uint64(item.UserID), 10),
+			strconv.FormatUint(uint64(item.ProductID), 10),
+			item.ProductName,
+			item.SKU,
+			item.LotNumber,
+			strconv.Itoa(item.Quantity),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// generateRecallReportPDF creates a PDF recall report
+func generateRecallReportPDF(report *models.RecallReport) ([]byte, error) {
+	c := creator.New()
+	c.SetPageMargins(50, 50, 50, 50)
+	recall := report.Recall
+
+	title := c.NewParagraph(fmt.Sprintf("Recall Report #%d", recall.ID))
+	title.SetFontSize(24)
+	title.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+	c.Draw(title)
+
+	// Recall metadata
+	meta := c.NewParagraph(fmt.Sprintf("Severity: %s\nStatus: %s\nIssued: %s\nGenerated: %s\n\nReason: %s",
+		recallSeverityLabel(recall.Severity),
+		recall.Status,
+		recall.CreatedAt.Format("2006-01-02 15:04:05"),
+		report.GeneratedAt.Format("2006-01-02 15:04:05"),
+		recall.Reason))
+	meta.SetFontSize(10)
+	c.Draw(meta)
+
+	spacer := c.NewParagraph("\n")
+	c.Draw(spacer)
+
+	addTableCell := func(table *creator.Table, text string, isHeader bool) {
+		p := c.NewParagraph(text)
+		if isHeader {
+			p.SetFontSize(10)
+			p.SetColor(creator.ColorRGBFrom8bit(255, 255, 255))
+		} else {
+			p.SetFontSize(9)
+		}
+		cell := table.NewCell()
+		if isHeader {
+			cell.SetBackgroundColor(creator.ColorRGBFrom8bit(0, 51, 102))
+		} else {
+			cell.SetBackgroundColor(creator.ColorRGBFrom8bit(240, 240, 240))
+		}
+		cell.SetBorder(creator.CellBorderSideAll, creator.CellBorderStyleSingle, 1)
+		cell.SetContent(p)
+	}
+
+	// Recalled products and summary
+	productsTable := c.NewTable(3)
+	productsTable.SetColumnWidths(0.15, 0.55, 0.3)
+
+	addTableCell(productsTable, "Product ID", true)
+	addTableCell(productsTable, "Product Name", true)
+	addTableCell(productsTable, "Coverage", true)
+
+	for _, item := range recall.Items {
+		addTableCell(productsTable, fmt.Sprintf("%d", item.ProductID), false)
+		addTableCell(productsTable, item.ProductName, false)
+		addTableCell(productsTable, recallCoverage(item), false)
+	}
+
+	c.Draw(productsTable)
+
+	spacer2 := c.NewParagraph("\n")
+	c.Draw(spacer2)
+
+	summaryTable := c.NewTable(2)
+	summaryTable.SetColumnWidths(0.5, 0.5)
+
+	addTableCell(summaryTable, "Item", true)
+	addTableCell(summaryTable, "Count", true)
+
+	summary := []struct {
+		label string
+		count int
+	}{
+		{"Affected Orders", report.Orders},
+		{"Affected Customers", len(report.Customers)},
+		{"Units Sold", report.Units},
+		{"Customers Notified", report.Notified},
+	}
+	for _, row := range summary {
+		addTableCell(summaryTable, row.label, false)
+		addTableCell(summaryTable, fmt.Sprintf("%d", row.count), false)
+	}
+
+	c.Draw(summaryTable)
+
+	// Customers Table
+	if len(report.Customers) > 0 {
+		c.NewPage()
+
+		customersTitle := c.NewParagraph("Affected Customers")
+		customersTitle.SetFontSize(18)
+		customersTitle.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+		c.Draw(customersTitle)
+
+		spacer3 := c.NewParagraph("\n")
+		c.Draw(spacer3)
+
+		customersTable := c.NewTable(5)
+		customersTable.SetColumnWidths(0.2, 0.3, 0.2, 0.15, 0.15)
+
+		addTableCell(customersTable, "Customer", true)
+		addTableCell(customersTable, "Contact", true)
+		addTableCell(customersTable, "Orders", true)
+		addTableCell(customersTable, "Units", true)
+		addTableCell(customersTable, "Notified", true)
+
+		for _, customer := range report.Customers {
+			addTableCell(customersTable, fmt.Sprintf("%s (#%d)", customer.Username, customer.UserID), false)
+			addTableCell(customersTable, fmt.Sprintf("%s\n%s\n%s, %s", customer.Email, customer.ContactNumber, customer.Address, customer.City), false)
+			addTableCell(customersTable, recallOrderIDs(customer), false)
+			addTableCell(customersTable, fmt.Sprintf("%d", customer.Units), false)
+			addTableCell(customersTable, recallNotifiedAt(customer), false)
+		}
+
+		c.Draw(customersTable)
+	}
+
+	// Affected Orders Table
+	if len(report.Items) > 0 {
+		c.NewPage()
+
+		itemsTitle := c.NewParagraph("Affected Orders")
+		itemsTitle.SetFontSize(18)
+		itemsTitle.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+		c.Draw(itemsTitle)
+
+		spacer4 := c.NewParagraph("\n")
+		c.Draw(spacer4)
+
+		itemsTable := c.NewTable(6)
+		itemsTable.SetColumnWidths(0.1, 0.15, 0.12, 0.33, 0.18, 0.12)
+
+		addTableCell(itemsTable, "Order", true)
+		addTableCell(itemsTable, "Date", true)
+		addTableCell(itemsTable, "Status", true)
+		addTableCell(itemsTable, "Product", true)
+		addTableCell(itemsTable, "Lot", true)
+		addTableCell(itemsTable, "Quantity", true)
+
+		for _, item := range report.Items {
+			name := item.ProductName
+			if item.SKU != "" {
+				name += fmt.Sprintf(" (SKU %s)", item.SKU)
+			}
+			addTableCell(itemsTable, fmt.Sprintf("#%d", item.OrderID), false)
+			addTableCell(itemsTable, item.OrderedAt.Format("2006-01-02"), false)
+			addTableCell(itemsTable, item.OrderStatus, false)
+			addTableCell(itemsTable, name, false)
+			addTableCell(itemsTable, item.LotNumber, false)
+			addTableCell(itemsTable, fmt.Sprintf("%d", item.Quantity), false)
+		}
+
+		c.Draw(itemsTable)
+	}
+
+	// Write to buffer
+	var buf bytes.Buffer
+	err := c.Write(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
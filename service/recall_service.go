@@ -0,0 +1,351 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"health-store/models"
+	"health-store/repositories"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRecallNotFound is returned for unknown recalls
+	ErrRecallNotFound = errors.New("recall not found")
+	// ErrRecallClosed is returned when closing or notifying for a recall that is already closed
+	ErrRecallClosed = errors.New("recall is closed")
+)
+
+// RecallService issues product recalls, blocks recalled stock from sale and
+// notifies the customers who bought it
+type RecallService struct {
+	recallRepo repositories.RecallRepositoryInterface
+	uow        repositories.UnitOfWorkInterface
+	mailer     Mailer
+}
+
+// NewRecallService creates a new recall service
+func NewRecallService(recallRepo repositories.RecallRepositoryInterface, uow repositories.UnitOfWorkInterface, mailer Mailer) *RecallService {
+	return &RecallService{
+		recallRepo: recallRepo,
+		uow:        uow,
+		mailer:     mailer,
+	}
+}
+
+// ListRecalls lists recalls, newest first by default
+func (s *RecallService) ListRecalls(params models.ListParams) (*models.Page[models.Recall], error) {
+	return s.recallRepo.List(params)
+}
+
+// GetRecall gets a recall with its items
+func (s *RecallService) GetRecall(id uint) (*models.Recall, error) {
+	recall, err := s.recallRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrRecallNotFound
+	}
+	return recall, nil
+}
+
+// CreateRecall issues a recall and blocks the stock it covers from sale.
+// Recalled products and variants are taken off sale; the units left in
+// recalled lots are taken out of stock.
+func (s *RecallService) CreateRecall(req models.RecallCreateRequest) (*models.Recall, error) {
+	recall := &models.Recall{
+		Reason:   req.Reason,
+		Severity: req.Severity,
+		Status:   models.RecallStatusActive,
+	}
+
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		// Lock the products so their stock and lots change together
+		productIDs := make([]uint, 0, len(req.Items))
+		for _, item := range req.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		products, err := repos.Products.FindByIDsForUpdate(productIDs)
+		if err != nil {
+			return err
+		}
+		productMap := make(map[uint]*models.Product, len(products))
+		for i := range products {
+			productMap[products[i].ID] = &products[i]
+		}
+
+		lots := map[uint]*models.InventoryLot{}
+		for _, itemReq := range req.Items {
+			product, exists := productMap[itemReq.ProductID]
+			if !exists {
+				return ErrProductNotFound
+			}
+			if itemReq.VariantID != nil && product.FindVariant(*itemReq.VariantID) == nil {
+				return ErrVariantNotFound
+			}
+
+			item := models.RecallItem{
+				ProductID:   product.ID,
+				VariantID:   itemReq.VariantID,
+				ProductName: product.Name,
+			}
+			if itemReq.LotNumber != "" {
+				lot, err := repos.Inventory.FindLotByNumber(product.ID, itemReq.VariantID, itemReq.LotNumber)
+				if err != nil {
+					return fmt.Errorf("%w: %s", ErrLotNotFound, itemReq.LotNumber)
+				}
+				item.LotID = &lot.ID
+				item.LotNumber = lot.LotNumber
+				lots[lot.ID] = lot
+			}
+			recall.Items = append(recall.Items, item)
+		}
+
+		if err := repos.Recalls.Create(recall); err != nil {
+			return err
+		}
+
+		for _, item := range recall.Items {
+			var err error
+			switch {
+			case item.LotID != nil:
+				err = recallLot(repos, lots[*item.LotID], recall.ID)
+			case item.VariantID != nil:
+				err = repos.Recalls.RecallVariant(*item.VariantID, recall.ID)
+			default:
+				err = repos.Recalls.RecallProduct(item.ProductID, recall.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recall, nil
+}
+
+// CloseRecall closes a recall once it has been dealt with. The products and
+// variants it blocked go back on sale; recalled lots are never sold.
+func (s *RecallService) CloseRecall(id uint) (*models.Recall, error) {
+	var recall *models.Recall
+	err := s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		var err error
+		recall, err = repos.Recalls.FindByID(id)
+		if err != nil {
+			return ErrRecallNotFound
+		}
+		if recall.Status == models.RecallStatusClosed {
+			return ErrRecallClosed
+		}
+
+		now := time.Now()
+		recall.Status = models.RecallStatusClosed
+		recall.ClosedAt = &now
+		if err := repos.Recalls.Update(recall); err != nil {
+			return err
+		}
+		return repos.Recalls.ReleaseProducts(recall.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recall, nil
+}
+
+// GetRecallReport lists the orders and customers affected by a recall
+func (s *RecallService) GetRecallReport(id uint) (*models.RecallReport, error) {
+	recall, err := s.GetRecall(id)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.recallRepo.FindAffectedItems(recall.Items)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := s.recallRepo.FindNotifications(recall.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifiedAt := make(map[uint]*time.Time, len(notifications))
+	for _, notification := range notifications {
+		notifiedAt[notification.UserID] = notification.SentAt
+	}
+
+	report := &models.RecallReport{
+		Recall:      recall,
+		GeneratedAt: time.Now(),
+		Items:       items,
+		Customers:   []models.RecallCustomer{},
+	}
+
+	// Group the items by customer, in the order of their first affected order
+	customerIndex := map[uint]int{}
+	orders := map[uint]bool{}
+	for _, item := range items {
+		i, exists := customerIndex[item.UserID]
+		if !exists {
+			i = len(report.Customers)
+			customerIndex[item.UserID] = i
+			report.Customers = append(report.Customers, models.RecallCustomer{
+				UserID:        item.UserID,
+				Username:      item.Username,
+				Email:         item.Email,
+				ContactNumber: item.ContactNumber,
+				Address:       item.Address,
+				City:          item.City,
+				NotifiedAt:    notifiedAt[item.UserID],
+			})
+		}
+
+		customer := &report.Customers[i]
+		if !orders[item.OrderID] {
+			orders[item.OrderID] = true
+			customer.OrderIDs = append(customer.OrderIDs, item.OrderID)
+		}
+		customer.Units += item.Quantity
+		report.Units += item.Quantity
+	}
+	report.Orders = len(orders)
+	for _, customer := range report.Customers {
+		if customer.NotifiedAt != nil {
+			report.Notified++
+		}
+	}
+
+	return report, nil
+}
+
+// NotifyCustomers emails the affected customers of an active recall who have
+// not been notified yet. Failed deliveries are recorded and retried on the
+// next dispatch.
+func (s *RecallService) NotifyCustomers(id uint) (*models.RecallNotifyResult, error) {
+	report, err := s.GetRecallReport(id)
+	if err != nil {
+		return nil, err
+	}
+	recall := report.Recall
+	if recall.Status == models.RecallStatusClosed {
+		return nil, ErrRecallClosed
+	}
+
+	notifications, err := s.recallRepo.FindNotifications(recall.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[uint]*models.RecallNotification, len(notifications))
+	for i := range notifications {
+		existing[notifications[i].UserID] = &notifications[i]
+	}
+
+	result := &models.RecallNotifyResult{}
+	for _, customer := range report.Customers {
+		notification, exists := existing[customer.UserID]
+		if exists && notification.SentAt != nil {
+			result.Skipped++
+			continue
+		}
+		if !exists {
+			notification = &models.RecallNotification{RecallID: recall.ID, UserID: customer.UserID}
+		}
+		notification.Email = customer.Email
+
+		if err := s.mailer.Send(recallEmail(recall, customer, report.Items)); err != nil {
+			notification.Error = err.Error()
+			result.Failed++
+		} else {
+			now := time.Now()
+			notification.Error = ""
+			notification.SentAt = &now
+			result.Sent++
+		}
+		if err := s.recallRepo.SaveNotification(notification); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Sent > 0 {
+		now := time.Now()
+		recall.NotifiedAt = &now
+		if err := s.recallRepo.Update(recall); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ExportRecallReport exports a recall report as csv or pdf
+func (s *RecallService) ExportRecallReport(report *models.RecallReport, format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return generateRecallReportCSV(report)
+	case "pdf":
+		fallthrough
+	default:
+		return generateRecallReportPDF(report)
+	}
+}
+
+// recallLot takes the units left in a lot out of stock and marks it recalled
+func recallLot(repos *repositories.TxRepositories, lot *models.InventoryLot, recallID uint) error {
+	if lot.RecallID != nil {
+		return nil
+	}
+	if err := repos.Recalls.RecallLot(lot.ID, recallID); err != nil {
+		return err
+	}
+	if err := moveStock(repos, &models.StockMovement{
+		ProductID: lot.ProductID,
+		VariantID: lot.VariantID,
+		Quantity:  -lot.Quantity,
+		Reason:    models.StockReasonRecall,
+		LotID:     &lot.ID,
+		RecallID:  &recallID,
+	}); err != nil {
+		return err
+	}
+	lot.RecallID = &recallID
+	return nil
+}
+
+// recallEmail builds the notification of a customer affected by a recall,
+// listing what they bought that is recalled
+func recallEmail(recall *models.Recall, customer models.RecallCustomer, items []models.RecallAffectedItem) Email {
+	var purchases strings.Builder
+	for _, item := range items {
+		if item.UserID != customer.UserID {
+			continue
+		}
+		fmt.Fprintf(&purchases, "- %s", item.ProductName)
+		if item.SKU != "" {
+			fmt.Fprintf(&purchases, " (SKU %s)", item.SKU)
+		}
+		if item.LotNumber != "" {
+			fmt.Fprintf(&purchases, ", lot %s", item.LotNumber)
+		}
+		fmt.Fprintf(&purchases, ", qty %d, order #%d of %s\n", item.Quantity, item.OrderID, item.OrderedAt.Format("2006-01-02"))
+	}
+
+	return Email{
+		To:      customer.Email,
+		Subject: "Important: recall of a product you bought from Health Store",
+		Body: fmt.Sprintf("Hello %s,\n\nThe manufacturer has recalled a product you bought from us (%s):\n\n%s\n"+
+			"Reason: %s\n\nPlease stop using the product and contact us to arrange a return or refund, quoting recall #%d.\n",
+			customer.Username, recallSeverityLabel(recall.Severity), purchases.String(), recall.Reason, recall.ID),
+	}
+}
+
+// recallSeverityLabel describes a recall severity for customers and reports
+func recallSeverityLabel(severity string) string {
+	switch severity {
+	case models.RecallSeverityClassI:
+		return "Class I, use may cause serious harm"
+	case models.RecallSeverityClassII:
+		return "Class II, use may cause temporary or reversible harm"
+	case models.RecallSeverityClassIII:
+		return "Class III, use is unlikely to cause harm"
+	default:
+		return severity
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"health-store/models"
+	"health-store/repositories"
+	"regexp"
+)
+
+var (
+	// ErrRoleNotFound is returned for unknown roles
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists is returned when creating a role whose name is taken
+	ErrRoleExists = errors.New("role already exists")
+	// ErrBuiltInRole is returned when deleting a built-in role or changing what makes it built-in
+	ErrBuiltInRole = errors.New("built-in roles can not be deleted, and their base role and the admin permissions can not be changed")
+	// ErrRoleInUse is returned when deleting a role that is still assigned to users
+	ErrRoleInUse = errors.New("role is still assigned to users")
+	// ErrInvalidRole is returned for malformed role names and unknown permissions
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// RoleService manages roles and their permissions
+type RoleService struct {
+	roleRepo *repositories.RoleRepository
+	onChange func() // called after roles change, to drop cached permissions
+}
+
+// NewRoleService creates a new role service. onChange may be nil.
+func NewRoleService(roleRepo *repositories.RoleRepository, onChange func()) *RoleService {
+	return &RoleService{
+		roleRepo: roleRepo,
+		onChange: onChange,
+	}
+}
+
+// SeedDefaultRoles creates the built-in roles with their default permissions
+// when they do not exist yet. Existing roles keep the permissions admins gave
+// them, except admin which always holds every permission.
+func (s *RoleService) SeedDefaultRoles() error {
+	for name, permissions := range models.RolePermissions {
+		role, err := s.roleRepo.FindByName(name)
+		if err != nil {
+			return err
+		}
+
+		if role == nil {
+			role = &models.Role{
+				Name:        name,
+				Description: fmt.Sprintf("Built-in %s role", name),
+				BaseRole:    models.BuiltInBaseRole(name),
+				BuiltIn:     true,
+			}
+			for _, permission := range permissions {
+				role.Grants = append(role.Grants, models.RolePermission{Permission: permission})
+			}
+			if err := s.roleRepo.Create(role); err != nil {
+				return fmt.Errorf("failed to seed role %s: %v", name, err)
+			}
+			continue
+		}
+
+		if name == models.RoleAdmin && len(role.Grants) != len(models.AllPermissions) {
+			if err := s.roleRepo.Update(role, models.AllPermissions); err != nil {
+				return fmt.Errorf("failed to update admin permissions: %v", err)
+			}
+		}
+	}
+
+	s.changed()
+	return nil
+}
+
+// GetRoles returns all roles with their permissions
+func (s *RoleService) GetRoles() ([]models.Role, error) {
+	roles, err := s.roleRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		roles[i].Permissions = roles[i].PermissionNames()
+	}
+	return roles, nil
+}
+
+// GetRole returns a role with its permissions
+func (s *RoleService) GetRole(id uint) (*models.Role, error) {
+	role, err := s.roleRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+	role.Permissions = role.PermissionNames()
+	return role, nil
+}
+
+// RoleExists reports whether a role with the given name exists
+func (s *RoleService) RoleExists(name string) (bool, error) {
+	role, err := s.roleRepo.FindByName(name)
+	return role != nil, err
+}
+
+// CreateRole creates a custom role
+func (s *RoleService) CreateRole(req models.CreateRoleRequest) (*models.Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name must start with a lowercase letter and contain only lowercase letters, digits, '_' and '-'", ErrInvalidRole)
+	}
+	permissions, err := validatePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.roleRepo.FindByName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrRoleExists
+	}
+
+	role := &models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		BaseRole:    req.BaseRole,
+	}
+	for _, permission := range permissions {
+		role.Grants = append(role.Grants, models.RolePermission{Permission: permission})
+	}
+	if err := s.roleRepo.Create(role); err != nil {
+		return nil, err
+	}
+
+	s.changed()
+	role.Permissions = role.PermissionNames()
+	return role, nil
+}
+
+// UpdateRole changes a role's description, base role or permissions
+func (s *RoleService) UpdateRole(id uint, req models.UpdateRoleRequest) (*models.Role, error) {
+	role, err := s.roleRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.BaseRole != nil && *req.BaseRole != role.BaseRole {
+		if role.BuiltIn {
+			return nil, ErrBuiltInRole
+		}
+		role.BaseRole = *req.BaseRole
+	}
+
+	permissions := role.PermissionNames()
+	if req.Permissions != nil {
+		if role.Name == models.RoleAdmin {
+			return nil, ErrBuiltInRole
+		}
+		if permissions, err = validatePermissions(req.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.roleRepo.Update(role, permissions); err != nil {
+		return nil, err
+	}
+
+	s.changed()
+	role.Permissions = role.PermissionNames()
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that is no longer assigned to any user
+func (s *RoleService) DeleteRole(id uint) error {
+	role, err := s.roleRepo.FindByID(id)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+	if role.BuiltIn {
+		return ErrBuiltInRole
+	}
+
+	users, err := s.roleRepo.CountUsers(role.Name)
+	if err != nil {
+		return err
+	}
+	if users > 0 {
+		return ErrRoleInUse
+	}
+
+	if err := s.roleRepo.Delete(role.ID); err != nil {
+		return err
+	}
+
+	s.changed()
+	return nil
+}
+
+// changed notifies the listener that roles were modified
+func (s *RoleService) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// validatePermissions rejects unknown permissions and removes duplicates
+func validatePermissions(permissions []models.Permission) ([]models.Permission, error) {
+	seen := make(map[models.Permission]bool, len(permissions))
+	result := make([]models.Permission, 0, len(permissions))
+	for _, permission := range permissions {
+		if !models.IsValidPermission(permission) {
+			return nil, fmt.Errorf("%w: unknown permission %s", ErrInvalidRole, permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
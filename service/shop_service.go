@@ -2,31 +2,70 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"health-store/models"
 	"health-store/repositories"
+	"health-store/utils"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrShopInUse is returned when deleting a shop that still has products or orders
+	ErrShopInUse = errors.New("shop still has products or orders, deactivate it instead")
+	// ErrShopRequestNotFound is returned for unknown shop requests
+	ErrShopRequestNotFound = errors.New("shop request not found")
+	// ErrShopRequestProcessed is returned when reviewing a request that is not pending
+	ErrShopRequestProcessed = errors.New("shop request has already been processed")
+	// ErrShopRequestNotEditable is returned when changing a request that is no longer pending or rejected
+	ErrShopRequestNotEditable = errors.New("only pending or rejected shop requests can be changed")
+	// ErrShopRequestNotRejected is returned when resubmitting a request that was not rejected
+	ErrShopRequestNotRejected = errors.New("only rejected shop requests can be resubmitted")
+	// ErrShopRequestIncomplete is returned when a request lacks required documents
+	ErrShopRequestIncomplete = errors.New("shop request is missing required documents")
+	// ErrShopRequestDocumentNotFound is returned for unknown documents of a shop request
+	ErrShopRequestDocumentNotFound = errors.New("shop request document not found")
+	// ErrShopRequestCommentNotFound is returned when replying to an unknown comment
+	ErrShopRequestCommentNotFound = errors.New("shop request comment not found")
+	// ErrTooManyShopRequests is returned when a user already has the maximum number of requests waiting for review
+	ErrTooManyShopRequests = errors.New("too many shop requests are waiting for review, withdraw one or wait for a decision")
 )
 
 // ShopService handles business logic for shops and shop requests
 type ShopService struct {
 	shopRequestRepo *repositories.ShopRequestRepository
 	shopRepo        *repositories.ShopRepository
+	userRepo        repositories.UserRepositoryInterface
+	uow             repositories.UnitOfWorkInterface
+	mailer          Mailer
+	maxPending      int // shop requests a user may have waiting for review at once
 }
 
 // NewShopService creates a new shop service
-func NewShopService(shopRequestRepo *repositories.ShopRequestRepository, shopRepo *repositories.ShopRepository) *ShopService {
+func NewShopService(shopRequestRepo *repositories.ShopRequestRepository, shopRepo *repositories.ShopRepository, userRepo repositories.UserRepositoryInterface, uow repositories.UnitOfWorkInterface, mailer Mailer, maxPending int) *ShopService {
 	return &ShopService{
 		shopRequestRepo: shopRequestRepo,
 		shopRepo:        shopRepo,
+		userRepo:        userRepo,
+		uow:             uow,
+		mailer:          mailer,
+		maxPending:      maxPending,
 	}
 }
 
-// CreateShopRequest creates a new shop creation request (no restrictions on multiple requests/shops)
+// CreateShopRequest creates a new shop creation request. Users may own several
+// shops, but only have a limited number of requests waiting for review.
 func (s *ShopService) CreateShopRequest(userID uint, req *models.ShopRequestCreateRequest) (*models.ShopRequest, error) {
+	if err := s.checkPendingLimit(userID); err != nil {
+		return nil, err
+	}
+
 	shopRequest := &models.ShopRequest{
 		UserID:      userID,
 		ShopName:    req.ShopName,
 		Description: req.Description,
 		Status:      "pending",
+		Submissions: 1,
 	}
 
 	err := s.shopRequestRepo.Create(shopRequest)
@@ -42,32 +81,39 @@ func (s *ShopService) GetShopRequestByID(id uint) (*models.ShopRequest, error) {
 	return s.shopRequestRepo.FindByID(id)
 }
 
-// GetAllShopRequests gets all shop requests
-func (s *ShopService) GetAllShopRequests() ([]models.ShopRequest, error) {
-	return s.shopRequestRepo.FindAll()
+// GetShopRequestDetails gets a shop request with its documents and comments
+func (s *ShopService) GetShopRequestDetails(id uint) (*models.ShopRequest, error) {
+	shopRequest, err := s.shopRequestRepo.FindByIDWithDetails(id)
+	if err != nil {
+		return nil, ErrShopRequestNotFound
+	}
+	return shopRequest, nil
 }
 
-// GetShopRequestsByStatus gets shop requests by status
-func (s *ShopService) GetShopRequestsByStatus(status string) ([]models.ShopRequest, error) {
-	return s.shopRequestRepo.FindByStatus(status)
+// ListShopRequests gets a page of shop requests
+func (s *ShopService) ListShopRequests(params models.ListParams) (*models.Page[models.ShopRequest], error) {
+	return s.shopRequestRepo.List(params)
 }
 
-// GetUserShopRequests gets shop requests for a specific user
-func (s *ShopService) GetUserShopRequests(userID uint) ([]models.ShopRequest, error) {
-	return s.shopRequestRepo.FindByUserID(userID)
+// ListUserShopRequests gets a page of the shop requests of a user
+func (s *ShopService) ListUserShopRequests(userID uint, params models.ListParams) (*models.Page[models.ShopRequest], error) {
+	return s.shopRequestRepo.ListByUserID(userID, params)
 }
 
-// ApproveShopRequest approves a shop request and creates a shop
-func (s *ShopService) ApproveShopRequest(requestID uint) error {
-	// Get the shop request
+// ApproveShopRequest approves a pending shop request that has all required
+// documents, creates its shop, makes the applicant a seller and notifies them
+func (s *ShopService) ApproveShopRequest(requestID, reviewerID uint) (*models.Shop, error) {
 	shopRequest, err := s.shopRequestRepo.FindByID(requestID)
 	if err != nil {
-		return err
+		return nil, ErrShopRequestNotFound
 	}
 
 	// Check if already processed
 	if shopRequest.Status != "pending" {
-		return errors.New("shop request has already been processed")
+		return nil, ErrShopRequestProcessed
+	}
+	if err := s.checkRequiredDocuments(requestID); err != nil {
+		return nil, err
 	}
 
 	// Create the shop (no restriction on multiple shops per user)
@@ -78,37 +124,294 @@ func (s *ShopService) ApproveShopRequest(requestID uint) error {
 		IsActive:    true,
 	}
 
-	err = s.shopRepo.Create(shop)
+	// Claim the request, create its shop and promote the applicant together,
+	// so concurrent reviews can not create two shops and a failure leaves the
+	// request pending
+	now := time.Now()
+	err = s.uow.Execute(func(repos *repositories.TxRepositories) error {
+		claimed, err := repos.ShopRequests.UpdateStatusIf(requestID, []string{"pending"}, map[string]interface{}{
+			"status":         "approved",
+			"reviewed_by_id": reviewerID,
+			"reviewed_at":    now,
+		})
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrShopRequestProcessed
+		}
+
+		if err := repos.Shops.Create(shop); err != nil {
+			return err
+		}
+		return promoteToSeller(repos, shopRequest.UserID)
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	s.notifyApplicant(shopRequest, "Your shop request was approved",
+		fmt.Sprintf("Your shop request \"%s\" has been approved and your shop is now open.\n", shopRequest.ShopName))
+
+	return shop, nil
+}
+
+// RejectShopRequest rejects a pending shop request and notifies the
+// applicant, who can then update and resubmit it
+func (s *ShopService) RejectShopRequest(requestID, reviewerID uint, reason string) error {
+	shopRequest, err := s.shopRequestRepo.FindByID(requestID)
+	if err != nil {
+		return ErrShopRequestNotFound
 	}
 
-	// Update shop request status
-	shopRequest.Status = "approved"
-	err = s.shopRequestRepo.Update(shopRequest)
+	// Check if already processed
+	if shopRequest.Status != "pending" {
+		return ErrShopRequestProcessed
+	}
+
+	rejected, err := s.shopRequestRepo.UpdateStatusIf(requestID, []string{"pending"}, map[string]interface{}{
+		"status":           "rejected",
+		"rejection_reason": reason,
+		"reviewed_by_id":   reviewerID,
+		"reviewed_at":      time.Now(),
+	})
 	if err != nil {
 		return err
 	}
+	if !rejected {
+		return ErrShopRequestProcessed
+	}
+
+	body := fmt.Sprintf("Your shop request \"%s\" has been rejected.\n", shopRequest.ShopName)
+	if reason != "" {
+		body += fmt.Sprintf("\nReason: %s\n", reason)
+	}
+	body += "\nYou can update the request and its documents and resubmit it for review.\n"
+	s.notifyApplicant(shopRequest, "Your shop request was rejected", body)
 
 	return nil
 }
 
-// RejectShopRequest rejects a shop request
-func (s *ShopService) RejectShopRequest(requestID uint, reason string) error {
+// UpdateShopRequest lets the applicant change a request that is pending or
+// was rejected
+func (s *ShopService) UpdateShopRequest(requestID uint, req *models.ShopRequestCreateRequest) (*models.ShopRequest, error) {
+	updated, err := s.shopRequestRepo.UpdateStatusIf(requestID, []string{"pending", "rejected"}, map[string]interface{}{
+		"shop_name":   req.ShopName,
+		"description": req.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		if _, err := s.shopRequestRepo.FindByID(requestID); err != nil {
+			return nil, ErrShopRequestNotFound
+		}
+		return nil, ErrShopRequestNotEditable
+	}
+
+	return s.GetShopRequestDetails(requestID)
+}
+
+// ResubmitShopRequest puts a rejected request back up for review once it has
+// all required documents
+func (s *ShopService) ResubmitShopRequest(requestID uint) (*models.ShopRequest, error) {
 	shopRequest, err := s.shopRequestRepo.FindByID(requestID)
+	if err != nil {
+		return nil, ErrShopRequestNotFound
+	}
+	if shopRequest.Status != "rejected" {
+		return nil, ErrShopRequestNotRejected
+	}
+	if err := s.checkRequiredDocuments(requestID); err != nil {
+		return nil, err
+	}
+	if err := s.checkPendingLimit(shopRequest.UserID); err != nil {
+		return nil, err
+	}
+
+	resubmitted, err := s.shopRequestRepo.UpdateStatusIf(requestID, []string{"rejected"}, map[string]interface{}{
+		"status":           "pending",
+		"rejection_reason": "",
+		"reviewed_by_id":   nil,
+		"reviewed_at":      nil,
+		"submissions":      shopRequest.Submissions + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resubmitted {
+		return nil, ErrShopRequestNotRejected
+	}
+
+	s.notifyApplicant(shopRequest, "Your shop request was resubmitted",
+		fmt.Sprintf("Your shop request \"%s\" has been resubmitted and is waiting for review again.\n", shopRequest.ShopName))
+
+	return s.GetShopRequestDetails(requestID)
+}
+
+// WithdrawShopRequest lets the applicant take back a request that is pending
+// or was rejected. Withdrawn requests can not be changed or resubmitted.
+func (s *ShopService) WithdrawShopRequest(requestID uint) (*models.ShopRequest, error) {
+	withdrawn, err := s.shopRequestRepo.UpdateStatusIf(requestID, []string{"pending", "rejected"}, map[string]interface{}{
+		"status": "withdrawn",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !withdrawn {
+		if _, err := s.shopRequestRepo.FindByID(requestID); err != nil {
+			return nil, ErrShopRequestNotFound
+		}
+		return nil, ErrShopRequestNotEditable
+	}
+
+	return s.GetShopRequestDetails(requestID)
+}
+
+// AddShopRequestDocument attaches an uploaded document to a request that is
+// pending or was rejected
+func (s *ShopService) AddShopRequestDocument(requestID uint, documentType, fileName, url string) (*models.ShopRequestDocument, error) {
+	if err := s.checkEditable(requestID); err != nil {
+		return nil, err
+	}
+
+	document := &models.ShopRequestDocument{
+		ShopRequestID: requestID,
+		Type:          documentType,
+		FileName:      fileName,
+		URL:           url,
+	}
+	if err := s.shopRequestRepo.CreateDocument(document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// DeleteShopRequestDocument removes a document from a request that is pending
+// or was rejected. The caller deletes the stored file.
+func (s *ShopService) DeleteShopRequestDocument(requestID, documentID uint) (*models.ShopRequestDocument, error) {
+	if err := s.checkEditable(requestID); err != nil {
+		return nil, err
+	}
+
+	document, err := s.shopRequestRepo.FindDocumentByID(requestID, documentID)
+	if err != nil {
+		return nil, ErrShopRequestDocumentNotFound
+	}
+	if err := s.shopRequestRepo.DeleteDocument(document.ID); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// GetShopRequestComments gets the comment log of a shop request
+func (s *ShopService) GetShopRequestComments(requestID uint) ([]models.ShopRequestComment, error) {
+	return s.shopRequestRepo.FindComments(requestID)
+}
+
+// AddShopRequestComment adds a comment by the applicant or a reviewer to a
+// shop request, optionally replying to an earlier comment
+func (s *ShopService) AddShopRequestComment(requestID, userID uint, isReviewer bool, req *models.ShopRequestCommentRequest) (*models.ShopRequestComment, error) {
+	if _, err := s.shopRequestRepo.FindByID(requestID); err != nil {
+		return nil, ErrShopRequestNotFound
+	}
+	author, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if req.ParentID != nil {
+		if _, err := s.shopRequestRepo.FindCommentByID(requestID, *req.ParentID); err != nil {
+			return nil, ErrShopRequestCommentNotFound
+		}
+	}
+
+	comment := &models.ShopRequestComment{
+		ShopRequestID: requestID,
+		UserID:        author.ID,
+		Username:      author.Username,
+		ParentID:      req.ParentID,
+		IsReviewer:    isReviewer,
+		Message:       req.Message,
+	}
+	if err := s.shopRequestRepo.CreateComment(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// checkEditable returns an error unless the request is pending or rejected
+func (s *ShopService) checkEditable(requestID uint) error {
+	shopRequest, err := s.shopRequestRepo.FindByID(requestID)
+	if err != nil {
+		return ErrShopRequestNotFound
+	}
+	if shopRequest.Status != "pending" && shopRequest.Status != "rejected" {
+		return ErrShopRequestNotEditable
+	}
+	return nil
+}
+
+// checkPendingLimit rejects a new submission when the user already has the
+// maximum number of requests waiting for review
+func (s *ShopService) checkPendingLimit(userID uint) error {
+	pending, err := s.shopRequestRepo.CountPendingRequests(userID)
 	if err != nil {
 		return err
 	}
+	if pending >= int64(s.maxPending) {
+		return ErrTooManyShopRequests
+	}
+	return nil
+}
 
-	// Check if already processed
-	if shopRequest.Status != "pending" {
-		return errors.New("shop request has already been processed")
+// promoteToSeller gives customers whose shop request was approved the seller
+// role. Admins and users with custom roles keep their role.
+func promoteToSeller(repos *repositories.TxRepositories, userID uint) error {
+	if _, err := repos.Users.UpdateRoleIf(userID, []string{"", models.RoleCustomer}, models.RoleSeller); err != nil {
+		return fmt.Errorf("failed to promote user %d to seller: %w", userID, err)
 	}
+	return nil
+}
 
-	shopRequest.Status = "rejected"
-	shopRequest.RejectionReason = reason
+// checkRequiredDocuments returns ErrShopRequestIncomplete naming the
+// required documents a request still lacks
+func (s *ShopService) checkRequiredDocuments(requestID uint) error {
+	types, err := s.shopRequestRepo.FindDocumentTypes(requestID)
+	if err != nil {
+		return err
+	}
 
-	return s.shopRequestRepo.Update(shopRequest)
+	attached := make(map[string]bool, len(types))
+	for _, t := range types {
+		attached[t] = true
+	}
+	var missing []string
+	for _, required := range models.RequiredShopRequestDocuments {
+		if !attached[required] {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrShopRequestIncomplete, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// notifyApplicant emails the applicant of a shop request about a status
+// change. The change is already saved, so delivery failures are only logged.
+func (s *ShopService) notifyApplicant(shopRequest *models.ShopRequest, subject, message string) {
+	if shopRequest.User.Email == "" {
+		return
+	}
+
+	err := s.mailer.Send(Email{
+		To:      shopRequest.User.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hello %s,\n\n%s", shopRequest.User.Username, message),
+	})
+	if err != nil {
+		utils.LogError(err, fmt.Sprintf("Failed to notify applicant of shop request %d", shopRequest.ID))
+	}
 }
 
 // GetAllShops gets all shops
@@ -157,6 +460,15 @@ func (s *ShopService) DeleteShop(shopID uint) error {
 		return err
 	}
 
+	// Products and sub-orders keep referring to the shop
+	inUse, err := s.shopRepo.HasProductsOrOrders(shopID)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrShopInUse
+	}
+
 	return s.shopRepo.Delete(shopID)
 }
 
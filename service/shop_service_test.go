@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"health-store/models"
+	"health-store/repositories"
+
+	"gorm.io/gorm"
+)
+
+func newTestShopService(t *testing.T, db *gorm.DB) *ShopService {
+	t.Helper()
+	return NewShopService(
+		repositories.NewShopRequestRepository(db),
+		repositories.NewShopRepository(db),
+		repositories.NewUserRepository(db),
+		repositories.NewUnitOfWork(db),
+		NewLogMailer(filepath.Join(t.TempDir(), "mail.log"), "shop@example.com"),
+		3,
+	)
+}
+
+// createTestShopRequest files a pending shop request with its required documents
+func createTestShopRequest(t *testing.T, db *gorm.DB, user *models.User) *models.ShopRequest {
+	t.Helper()
+	request := &models.ShopRequest{UserID: user.ID, ShopName: user.Username + " Pharmacy", Description: "Vitamins and first aid", Status: "pending"}
+	if err := db.Create(request).Error; err != nil {
+		t.Fatalf("create shop request: %v", err)
+	}
+	for _, documentType := range models.RequiredShopRequestDocuments {
+		document := &models.ShopRequestDocument{ShopRequestID: request.ID, Type: documentType, URL: "/uploads/" + documentType + ".pdf"}
+		if err := db.Create(document).Error; err != nil {
+			t.Fatalf("create document: %v", err)
+		}
+	}
+	return request
+}
+
+func userRole(t *testing.T, db *gorm.DB, userID uint) string {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	return user.Role
+}
+
+func TestApproveShopRequestPromotesApplicant(t *testing.T) {
+	db := newTestDB(t)
+	shops := newTestShopService(t, db)
+	user := createTestCustomer(t, db, "jade")
+	request := createTestShopRequest(t, db, user)
+
+	shop, err := shops.ApproveShopRequest(request.ID, 1)
+	if err != nil {
+		t.Fatalf("ApproveShopRequest: %v", err)
+	}
+	if shop.UserID != user.ID {
+		t.Errorf("shop owner = %d, want %d", shop.UserID, user.ID)
+	}
+	if role := userRole(t, db, user.ID); role != models.RoleSeller {
+		t.Errorf("role = %q, want %q", role, models.RoleSeller)
+	}
+	if _, err := shops.ApproveShopRequest(request.ID, 1); !errors.Is(err, ErrShopRequestProcessed) {
+		t.Errorf("second approval error = %v, want %v", err, ErrShopRequestProcessed)
+	}
+	if got := countRows(t, db, &models.Shop{}); got != 1 {
+		t.Errorf("shops = %d, want 1", got)
+	}
+}
+
+func TestApproveShopRequestKeepsRequestPendingWhenPromotionFails(t *testing.T) {
+	db := newTestDB(t)
+	shops := newTestShopService(t, db)
+	user := createTestCustomer(t, db, "kai")
+	request := createTestShopRequest(t, db, user)
+
+	failUpdatesOf(t, db, "users")
+
+	if _, err := shops.ApproveShopRequest(request.ID, 1); err == nil {
+		t.Fatal("ApproveShopRequest succeeded, want the injected failure")
+	}
+	if got := countRows(t, db, &models.Shop{}); got != 0 {
+		t.Errorf("shops = %d, want 0 after rollback", got)
+	}
+	var reloaded models.ShopRequest
+	if err := db.First(&reloaded, request.ID).Error; err != nil {
+		t.Fatalf("load shop request: %v", err)
+	}
+	if reloaded.Status != "pending" || reloaded.ReviewedByID != nil {
+		t.Errorf("shop request status = %q, reviewer = %v, want it pending and unreviewed", reloaded.Status, reloaded.ReviewedByID)
+	}
+	if role := userRole(t, db, user.ID); role != models.RoleCustomer {
+		t.Errorf("role = %q, want customer", role)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"health-store/models"
+	"strconv"
+
+	"github.com/unidoc/unipdf/v3/creator"
+)
+
+// statementPeriod describes the period of a statement for its header
+func statementPeriod(statement *models.SellerStatement) string {
+	start, end := "beginning", "today"
+	if statement.StartDate != nil {
+		start = *statement.StartDate
+	}
+	if statement.EndDate != nil {
+		end = *statement.EndDate
+	}
+	return fmt.Sprintf("%s to %s", start, end)
+}
+
+// statementReference names the order or payout a statement line belongs to
+func statementReference(line models.SellerStatementLine) string {
+	switch {
+	case line.OrderID != nil:
+		return fmt.Sprintf("Order #%d", *line.OrderID)
+	case line.PayoutID != nil:
+		return fmt.Sprintf("Payout #%d", *line.PayoutID)
+	default:
+		return ""
+	}
+}
+
+// generateStatementCSV creates a CSV seller statement
+func generateStatementCSV(statement *models.SellerStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	// Write header information
+	writer.Write([]string{"Medical Equipment Store - Seller Statement"})
+	writer.Write([]string{"Shop", statement.ShopName})
+	writer.Write([]string{"Shop ID", strconv.FormatUint(uint64(statement.ShopID), 10)})
+	writer.Write([]string{"Period", statementPeriod(statement)})
+	writer.Write([]string{"Generated", statement.GeneratedAt.Format("2006-01-02 15:04:05")})
+	writer.Write([]string{}) // Empty line
+
+	// Summary Section
+	writer.Write([]string{"Summary"})
+	writer.Write([]string{"Item", "Amount"})
+	writer.Write([]string{"Opening Balance", fmt.Sprintf("%.2f", statement.OpeningBalance)})
+	writer.Write([]string{"Sales", fmt.Sprintf("%.2f", statement.Sales)})
+	writer.Write([]string{"Refunds", fmt.Sprintf("%.2f", statement.Refunds)})
+	writer.Write([]string{"Commission", fmt.Sprintf("%.2f", statement.Commission)})
+	writer.Write([]string{"Payouts", fmt.Sprintf("%.2f", statement.Payouts)})
+	writer.Write([]string{"Closing Balance", fmt.Sprintf("%.2f", statement.ClosingBalance)})
+	writer.Write([]string{}) // Empty line
+
+	// Transactions
+	writer.Write([]string{"Transactions"})
+	writer.Write([]string{"Date", "Type", "Reference", "Description", "Gross", "Commission", "Net", "Balance"})
+	for _, line := range statement.Lines {
+		writer.Write([]string{
+			line.Date.Format("2006-01-02 15:04:05"),
+			line.Type,
+			statementReference(line),
+			line.Description,
+			fmt.Sprintf("%.2f", line.Gross),
+			fmt.Sprintf("%.2f", line.Commission),
+			fmt.Sprintf("%.2f", line.Net),
+			fmt.Sprintf("%.2f", line.Balance),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// generateStatementPDF creates a PDF seller statement
+func generateStatementPDF(statement *models.SellerStatement) ([]byte, error) {
+	c := creator.New()
+	c.SetPageMargins(50, 50, 50, 50)
+
+	title := c.NewParagraph("Seller Statement")
+	title.SetFontSize(24)
+	title.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+	c.Draw(title)
+
+	// Statement metadata
+	meta := c.NewParagraph(fmt.Sprintf("Shop: %s (#%d)\nPeriod: %s\nGenerated: %s",
+		statement.ShopName,
+		statement.ShopID,
+		statementPeriod(statement),
+		statement.GeneratedAt.Format("2006-01-02 15:04:05")))
+	meta.SetFontSize(10)
+	c.Draw(meta)
+
+	spacer := c.NewParagraph("\n")
+	c.Draw(spacer)
+
+	addTableCell := func(table *creator.Table, text string, isHeader bool) {
+		p := c.NewParagraph(text)
+		if isHeader {
+			p.SetFontSize(10)
+			p.SetColor(creator.ColorRGBFrom8bit(255, 255, 255))
+		} else {
+			p.SetFontSize(9)
+		}
+		cell := table.NewCell()
+		if isHeader {
+			cell.SetBackgroundColor(creator.ColorRGBFrom8bit(0, 51, 102))
+		} else {
+			cell.SetBackgroundColor(creator.ColorRGBFrom8bit(240, 240, 240))
+		}
+		cell.SetBorder(creator.CellBorderSideAll, creator.CellBorderStyleSingle, 1)
+		cell.SetContent(p)
+	}
+
+	// Summary Section
+	summaryTitle := c.NewParagraph("Summary")
+	summaryTitle.SetFontSize(18)
+	summaryTitle.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+	c.Draw(summaryTitle)
+
+	spacer2 := c.NewParagraph("\n")
+	c.Draw(spacer2)
+
+	summaryTable := c.NewTable(2)
+	summaryTable.SetColumnWidths(0.5, 0.5)
+
+	addTableCell(summaryTable, "Item", true)
+	addTableCell(summaryTable, "Amount", true)
+
+	summary := []struct {
+		label  string
+		amount float64
+	}{
+		{"Opening Balance", statement.OpeningBalance},
+		{"Sales", statement.Sales},
+		{"Refunds", statement.Refunds},
+		{"Commission", statement.Commission},
+		{"Payouts", statement.Payouts},
+		{"Closing Balance", statement.ClosingBalance},
+	}
+	for _, row := range summary {
+		addTableCell(summaryTable, row.label, false)
+		addTableCell(summaryTable, fmt.Sprintf("$%.2f", row.amount), false)
+	}
+
+	c.Draw(summaryTable)
+
+	// Transactions Table
+	if len(statement.Lines) > 0 {
+		c.NewPage()
+
+		linesTitle := c.NewParagraph("Transactions")
+		linesTitle.SetFontSize(18)
+		linesTitle.SetColor(creator.ColorRGBFrom8bit(0, 51, 102))
+		c.Draw(linesTitle)
+
+		spacer3 := c.NewParagraph("\n")
+		c.Draw(spacer3)
+
+		linesTable := c.NewTable(7)
+		linesTable.SetColumnWidths(0.14, 0.1, 0.2, 0.14, 0.14, 0.14, 0.14)
+
+		addTableCell(linesTable, "Date", true)
+		addTableCell(linesTable, "Type", true)
+		addTableCell(linesTable, "Reference", true)
+		addTableCell(linesTable, "Gross", true)
+		addTableCell(linesTable, "Commission", true)
+		addTableCell(linesTable, "Net", true)
+		addTableCell(linesTable, "Balance", true)
+
+		for _, line := range statement.Lines {
+			addTableCell(linesTable, line.Date.Format("2006-01-02"), false)
+			addTableCell(linesTable, line.Type, false)
+			addTableCell(linesTable, statementReference(line), false)
+			addTableCell(linesTable, fmt.Sprintf("$%.2f", line.Gross), false)
+			addTableCell(linesTable, fmt.Sprintf("$%.2f", line.Commission), false)
+			addTableCell(linesTable, fmt.Sprintf("$%.2f", line.Net), false)
+			addTableCell(linesTable, fmt.Sprintf("$%.2f", line.Balance), false)
+		}
+
+		c.Draw(linesTable)
+	}
+
+	// Write to buffer
+	var buf bytes.Buffer
+	err := c.Write(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"health-store/models"
+	"health-store/utils"
+	"strings"
+)
+
+// StockAlertNotifier tells admins about products running low on stock
+type StockAlertNotifier interface {
+	NotifyLowStock(alerts []models.LowStockAlert) error
+}
+
+// NewStockAlertNotifier creates a notifier that emails alerts to recipients,
+// or logs them when there are no recipients
+func NewStockAlertNotifier(mailer Mailer, recipients []string) StockAlertNotifier {
+	if len(recipients) == 0 {
+		return LogStockAlertNotifier{}
+	}
+	return &MailStockAlertNotifier{mailer: mailer, recipients: recipients}
+}
+
+// MailStockAlertNotifier emails a digest of low-stock alerts
+type MailStockAlertNotifier struct {
+	mailer     Mailer
+	recipients []string
+}
+
+// NotifyLowStock emails the alerts to every recipient
+func (n *MailStockAlertNotifier) NotifyLowStock(alerts []models.LowStockAlert) error {
+	email := Email{
+		Subject: fmt.Sprintf("Health Store: %d products low on stock", len(alerts)),
+		Body:    formatLowStockAlerts(alerts),
+	}
+	var errs []error
+	for _, to := range n.recipients {
+		email.To = to
+		if err := n.mailer.Send(email); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogStockAlertNotifier writes low-stock alerts to the application log
+type LogStockAlertNotifier struct{}
+
+// NotifyLowStock logs the alerts
+func (LogStockAlertNotifier) NotifyLowStock(alerts []models.LowStockAlert) error {
+	utils.Warnf("%d products low on stock:\n%s", len(alerts), formatLowStockAlerts(alerts))
+	return nil
+}
+
+// formatLowStockAlerts lists alerts one product a line
+func formatLowStockAlerts(alerts []models.LowStockAlert) string {
+	var b strings.Builder
+	for _, alert := range alerts {
+		cover := "no recent sales"
+		if alert.DaysOfCover != nil {
+			cover = fmt.Sprintf("%.1f days of cover", *alert.DaysOfCover)
+		}
+		fmt.Fprintf(&b, "- %s (#%d): %d in stock, threshold %d, %s, reorder %d\n",
+			alert.ProductName, alert.ProductID, alert.Stock, alert.ReorderThreshold, cover, alert.SuggestedReorder)
+	}
+	return b.String()
+}
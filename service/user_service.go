@@ -2,13 +2,20 @@ package service
 
 import (
 	"errors"
-	"fmt"
 	"health-store/models"
 	"health-store/repositories"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is returned for both unknown usernames and wrong
+// passwords so login responses do not reveal which accounts exist
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared against when the username is unknown so the
+// response takes as long as for an existing account
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 // UserService handles business logic for users
 type UserService struct {
 	userRepo repositories.UserRepositoryInterface
@@ -70,12 +77,13 @@ func (s *UserService) RegisterUser(req models.UserRegisterRequest) (*models.User
 func (s *UserService) AuthenticateUser(req models.UserLoginRequest) (*models.User, error) {
 	user, err := s.userRepo.FindByUsername(req.Username)
 	if err != nil {
-		return nil, fmt.Errorf("username not found: %s", req.Username)
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return nil, ErrInvalidCredentials
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
-		return nil, fmt.Errorf("password mismatch for user: %s", req.Username)
+		return nil, ErrInvalidCredentials
 	}
 
 	return user, nil
@@ -86,9 +94,9 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	return s.userRepo.FindByID(id)
 }
 
-// GetAllUsers gets all users
-func (s *UserService) GetAllUsers() ([]models.User, error) {
-	return s.userRepo.FindAll()
+// ListUsers gets a page of users
+func (s *UserService) ListUsers(params models.ListParams) (*models.Page[models.User], error) {
+	return s.userRepo.List(params)
 }
 
 // UpdateUser updates a user